@@ -0,0 +1,87 @@
+package main
+
+import (
+	"github.com/nnurry/harmonia/internal/config"
+	"github.com/urfave/cli/v2"
+)
+
+// shared by `api start` and `api config show` so show prints what start would use
+func serverConfigFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:    "config",
+			Usage:   "Path to server config file (YAML/JSON)",
+			EnvVars: []string{config.ENV_PREFIX + "CONFIG"},
+		},
+		&cli.StringFlag{
+			Name:  "listen-address",
+			Usage: "Address to listen on, overrides listen_address",
+		},
+		&cli.StringFlag{
+			Name:  "tls-cert",
+			Usage: "Path to TLS certificate, overrides tls.cert_file",
+		},
+		&cli.StringFlag{
+			Name:  "tls-key",
+			Usage: "Path to TLS private key, overrides tls.key_file",
+		},
+		&cli.StringFlag{
+			Name:  "tls-client-ca",
+			Usage: "Path to CA bundle verifying client certificates (mTLS), overrides tls.client_ca_file",
+		},
+		&cli.BoolFlag{
+			Name:  "tls-self-signed",
+			Usage: "Generate a self-signed certificate if none is given (lab use only)",
+		},
+		&cli.StringFlag{
+			Name:  "log-level",
+			Usage: "Log level (trace, debug, info, warn, error), overrides logging.level",
+		},
+		&cli.StringFlag{
+			Name:  "log-format",
+			Usage: "Log format (json, console), overrides logging.format",
+		},
+		&cli.StringFlag{
+			Name:  "default-hypervisor",
+			Usage: "Hypervisor used when a request names none, overrides default_hypervisor",
+		},
+	}
+}
+
+// defaults < config file < HARMONIA_* env vars < flags
+func loadServerConfig(c *cli.Context) (*config.ServerConfig, error) {
+	serverConfig, err := config.LoadServerConfig(c.String("config"))
+	if err != nil {
+		return nil, err
+	}
+
+	if c.IsSet("listen-address") {
+		serverConfig.ListenAddress = c.String("listen-address")
+	}
+	if c.IsSet("tls-cert") {
+		serverConfig.TLS.CertFile = c.String("tls-cert")
+	}
+	if c.IsSet("tls-key") {
+		serverConfig.TLS.KeyFile = c.String("tls-key")
+	}
+	if c.IsSet("tls-client-ca") {
+		serverConfig.TLS.ClientCAFile = c.String("tls-client-ca")
+	}
+	if c.IsSet("tls-self-signed") {
+		serverConfig.TLS.SelfSigned = c.Bool("tls-self-signed")
+	}
+	if c.IsSet("log-level") {
+		serverConfig.Logging.Level = c.String("log-level")
+	}
+	if c.IsSet("log-format") {
+		serverConfig.Logging.Format = c.String("log-format")
+	}
+	if c.IsSet("default-hypervisor") {
+		serverConfig.DefaultHypervisor = c.String("default-hypervisor")
+	}
+
+	if err = serverConfig.Validate(); err != nil {
+		return nil, err
+	}
+	return serverConfig, nil
+}
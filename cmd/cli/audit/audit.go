@@ -0,0 +1,83 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	"github.com/nnurry/harmonia/internal/audit"
+	"github.com/nnurry/harmonia/pkg/types"
+	"github.com/nnurry/harmonia/pkg/utils"
+	"github.com/urfave/cli/v2"
+)
+
+const (
+	AUDIT_COMMAND = types.InternalCommandName("Audit command")
+)
+
+const (
+	AUDIT_LOG_CTX_KEY = types.InternalCommandCtxKey("auditLog")
+)
+
+type AuditCommand struct {
+	config audit.Config
+}
+
+func (command *AuditCommand) Description() string {
+	return "Query the audit log of the Harmonia API server"
+}
+
+func (command *AuditCommand) Signature() string {
+	return "audit"
+}
+
+func (command *AuditCommand) Flags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:        "audit-path",
+			Value:       audit.DEFAULT_LOG_PATH,
+			Usage:       "Path to audit log file",
+			Destination: &command.config.Path,
+		},
+		&cli.IntFlag{
+			Name:        "max-backups",
+			Value:       audit.DEFAULT_MAX_BACKUPS,
+			Usage:       "Number of rotated files to read, must match the server config",
+			Destination: &command.config.MaxBackups,
+		},
+	}
+}
+
+func (command *AuditCommand) Subcommands() []*cli.Command {
+	return []*cli.Command{
+		(&TailAuditLogCommand{}).Build(),
+	}
+}
+
+func (command *AuditCommand) Handler() func(ctx *cli.Context) error {
+	return func(ctx *cli.Context) error {
+		buf := bytes.NewBufferString("")
+		for _, subcmd := range ctx.Command.Subcommands {
+			fmt.Fprintf(buf, "- %v\n", subcmd.Name)
+		}
+		return fmt.Errorf("use subcommands instead:\n%v", buf.String())
+	}
+}
+
+func (command *AuditCommand) Build() *cli.Command {
+	cliCommand := utils.ConvertInternalCommandToCliCommand(command)
+	cliCommand.Before = func(ctx *cli.Context) error {
+		// only read, size is irrelevant
+		command.config.MaxSizeInMB = audit.DEFAULT_MAX_SIZE_IN_MB
+
+		auditLog, err := audit.New(command.config)
+		if err != nil {
+			return fmt.Errorf("could not open audit log: %v", err)
+		}
+
+		ctx.Context = context.WithValue(ctx.Context, AUDIT_LOG_CTX_KEY, auditLog)
+		return nil
+	}
+
+	return cliCommand
+}
@@ -0,0 +1,190 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/nnurry/harmonia/internal/audit"
+	"github.com/nnurry/harmonia/pkg/output"
+	"github.com/nnurry/harmonia/pkg/utils"
+	"github.com/urfave/cli/v2"
+)
+
+func newEntryTable(entries []audit.Entry) *output.Table {
+	table := output.NewTable(
+		output.Column{Name: "TIME"},
+		output.Column{Name: "ACTION"},
+		output.Column{Name: "CALLER"},
+		output.Column{Name: "OUTCOME"},
+		output.Column{Name: "STATUS"},
+		output.Column{Name: "VMS"},
+		output.Column{Name: "HYPERVISORS"},
+		output.Column{Name: "REQUEST ID", IsWide: true},
+		output.Column{Name: "REMOTE ADDRESS", IsWide: true},
+		output.Column{Name: "COMMANDS", IsWide: true},
+		output.Column{Name: "DURATION", IsWide: true},
+		output.Column{Name: "ERROR", IsWide: true},
+	)
+	for _, entry := range entries {
+		table.AddRow(
+			entry.Time.Format(time.RFC3339),
+			entry.Action,
+			entry.Caller,
+			entry.Outcome,
+			entry.StatusCode,
+			strings.Join(entry.VirtualMachines, ","),
+			strings.Join(entry.Hypervisors, ","),
+			entry.RequestID,
+			entry.RemoteAddress,
+			len(entry.Commands),
+			time.Duration(entry.DurationMs)*time.Millisecond,
+			entry.Error,
+		)
+	}
+	return table
+}
+
+// json is written as JSON lines so followed entries can be piped into jq
+func writeEntries(format output.Format, entries []audit.Entry, isFollowing bool) error {
+	switch format {
+	case output.FORMAT_JSON:
+		for _, entry := range entries {
+			data, err := json.Marshal(entry)
+			if err != nil {
+				return fmt.Errorf("could not serialize audit entry: %v", err)
+			}
+			fmt.Println(string(data))
+		}
+		return nil
+	case output.FORMAT_YAML:
+		for _, entry := range entries {
+			fmt.Println("---")
+			if err := output.Write(os.Stdout, format, entry, nil); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		table := newEntryTable(entries)
+		table.IsHeaderless = isFollowing
+		return output.Write(os.Stdout, format, entries, table)
+	}
+}
+
+type TailAuditLogCommand struct {
+	filter   audit.Filter
+	since    string
+	lines    int
+	isFollow bool
+}
+
+func (command *TailAuditLogCommand) Description() string {
+	return "Print the latest audit entries, as JSON lines with --output json"
+}
+
+func (command *TailAuditLogCommand) Signature() string {
+	return "tail"
+}
+
+func (command *TailAuditLogCommand) Flags() []cli.Flag {
+	return []cli.Flag{
+		&cli.IntFlag{
+			Name:        "lines",
+			Aliases:     []string{"n"},
+			Value:       20,
+			Usage:       "Number of entries to print, 0 prints all",
+			Destination: &command.lines,
+		},
+		&cli.BoolFlag{
+			Name:        "follow",
+			Aliases:     []string{"f"},
+			Usage:       "Keep printing new entries",
+			Destination: &command.isFollow,
+		},
+		&cli.StringFlag{
+			Name:        "caller",
+			Usage:       "Only show entries of this token name or certificate CN",
+			Destination: &command.filter.Caller,
+		},
+		&cli.StringFlag{
+			Name:        "action",
+			Usage:       "Only show entries of this action, e.g. fleet.delete",
+			Destination: &command.filter.Action,
+		},
+		&cli.StringFlag{
+			Name:        "vm",
+			Usage:       "Only show entries touching this VM",
+			Destination: &command.filter.VirtualMachine,
+		},
+		&cli.StringFlag{
+			Name:        "hypervisor",
+			Usage:       "Only show entries touching this hypervisor (name or Libvirt connection URL)",
+			Destination: &command.filter.Hypervisor,
+		},
+		&cli.StringFlag{
+			Name:        "outcome",
+			Usage:       "Only show entries with this outcome (success, partial, failure)",
+			Destination: &command.filter.Outcome,
+		},
+		&cli.StringFlag{
+			Name:        "since",
+			Usage:       "Only show entries after this RFC3339 time or duration ago, e.g. 1h",
+			Destination: &command.since,
+		},
+	}
+}
+
+func (command *TailAuditLogCommand) Subcommands() []*cli.Command {
+	return []*cli.Command{}
+}
+
+func (command *TailAuditLogCommand) Handler() func(ctx *cli.Context) error {
+	return func(ctx *cli.Context) error {
+		auditLog, ok := ctx.Context.Value(AUDIT_LOG_CTX_KEY).(*audit.Log)
+		if !ok {
+			return fmt.Errorf("could not retrieve audit log from context")
+		}
+
+		if command.since != "" {
+			since, err := audit.ParseSince(command.since)
+			if err != nil {
+				return fmt.Errorf("invalid since '%v': %v", command.since, err)
+			}
+			command.filter.Since = since
+		}
+
+		format, err := output.FromContext(ctx)
+		if err != nil {
+			return err
+		}
+
+		entries, err := auditLog.Query(command.filter, command.lines)
+		if err != nil {
+			return fmt.Errorf("could not query audit log: %v", err)
+		}
+		if err = writeEntries(format, entries, false); err != nil {
+			return err
+		}
+
+		if !command.isFollow {
+			return nil
+		}
+
+		followCtx, stop := signal.NotifyContext(ctx.Context, syscall.SIGINT, syscall.SIGTERM)
+		defer stop()
+		return auditLog.Follow(followCtx, command.filter, func(entry audit.Entry) {
+			if err := writeEntries(format, []audit.Entry{entry}, true); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+			}
+		})
+	}
+}
+
+func (command *TailAuditLogCommand) Build() *cli.Command {
+	return utils.ConvertInternalCommandToCliCommand(command)
+}
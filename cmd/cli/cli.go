@@ -3,15 +3,25 @@ package cli
 import (
 	"fmt"
 
+	auditcmd "github.com/nnurry/harmonia/cmd/cli/audit"
+	clientcontextcmd "github.com/nnurry/harmonia/cmd/cli/clientcontext"
+	fleetcmd "github.com/nnurry/harmonia/cmd/cli/fleet"
 	libvirtcmd "github.com/nnurry/harmonia/cmd/cli/libvirt"
 	shellcmd "github.com/nnurry/harmonia/cmd/cli/shell"
+	statecmd "github.com/nnurry/harmonia/cmd/cli/state"
+	vmcmd "github.com/nnurry/harmonia/cmd/cli/vm"
 	"github.com/nnurry/harmonia/pkg/types"
 	"github.com/urfave/cli/v2"
 )
 
 var commandConstructorMap = map[types.InternalCommandName]types.InternalCommandConstructor{
-	libvirtcmd.LIBVIRT_COMMAND: func() types.InternalCommand { return &libvirtcmd.LibvirtCommand{} },
-	shellcmd.SHELL_COMMAND:     func() types.InternalCommand { return &shellcmd.ShellCommand{} },
+	libvirtcmd.LIBVIRT_COMMAND:       func() types.InternalCommand { return &libvirtcmd.LibvirtCommand{} },
+	shellcmd.SHELL_COMMAND:           func() types.InternalCommand { return &shellcmd.ShellCommand{} },
+	statecmd.STATE_COMMAND:           func() types.InternalCommand { return &statecmd.StateCommand{} },
+	auditcmd.AUDIT_COMMAND:           func() types.InternalCommand { return &auditcmd.AuditCommand{} },
+	fleetcmd.FLEET_COMMAND:           func() types.InternalCommand { return &fleetcmd.FleetCommand{} },
+	clientcontextcmd.CONTEXT_COMMAND: func() types.InternalCommand { return &clientcontextcmd.ContextCommand{} },
+	vmcmd.VM_COMMAND:                 func() types.InternalCommand { return &vmcmd.VMCommand{} },
 }
 
 func GetCliCommand(name types.InternalCommandName) *cli.Command {
@@ -0,0 +1,114 @@
+package clientcontext
+
+import (
+	"fmt"
+
+	"github.com/nnurry/harmonia/internal/config"
+	"github.com/nnurry/harmonia/pkg/utils"
+	"github.com/urfave/cli/v2"
+)
+
+type AddContextCommand struct{}
+
+func (command *AddContextCommand) Description() string {
+	return "Add a context, or update the given settings of an existing one"
+}
+
+func (command *AddContextCommand) Signature() string {
+	return "add"
+}
+
+func (command *AddContextCommand) Flags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{Name: "connect-url", Usage: "Libvirt connection URL"},
+		&cli.StringFlag{Name: "keyfile-path", Usage: "Libvirt SSH keyfile path"},
+		&cli.BoolFlag{Name: "local-shell", Usage: "Run shell commands locally instead of over SSH"},
+		&cli.StringFlag{Name: "ssh-host", Usage: "SSH host of the hypervisor"},
+		&cli.IntFlag{Name: "ssh-port", Value: 22, Usage: "SSH port of the hypervisor"},
+		&cli.StringFlag{Name: "ssh-user", Usage: "SSH user of the hypervisor"},
+		&cli.StringFlag{Name: "ssh-password", Usage: "SSH password, stored in plain text"},
+		&cli.StringFlag{Name: "ssh-privkey-path", Usage: "SSH private key path"},
+		&cli.StringFlag{Name: "ssh-passphrase", Usage: "SSH private key passphrase, stored in plain text"},
+		&cli.StringFlag{Name: "fleet", Usage: "Default fleet of commands filtering by fleet"},
+		&cli.StringFlag{Name: "api-server", Usage: "URL of the Harmonia API server, e.g. https://harmonia:8080"},
+		&cli.StringFlag{Name: "api-token", Usage: "Bearer token for the API server, stored in plain text"},
+		&cli.StringFlag{Name: "api-hypervisor", Usage: "Hypervisor of the server config used when commands name none"},
+		&cli.StringFlag{Name: "api-ca-file", Usage: "CA bundle verifying the API server"},
+		&cli.StringFlag{Name: "api-cert-file", Usage: "Client certificate for an API server requiring mTLS"},
+		&cli.StringFlag{Name: "api-key-file", Usage: "Client private key for an API server requiring mTLS"},
+		&cli.BoolFlag{Name: "use", Usage: "Also make it the current context"},
+	}
+}
+
+func (command *AddContextCommand) Subcommands() []*cli.Command {
+	return []*cli.Command{}
+}
+
+func (command *AddContextCommand) Handler() func(ctx *cli.Context) error {
+	return func(ctx *cli.Context) error {
+		if ctx.Args().Len() != 1 {
+			return fmt.Errorf("expected exactly one context name after the flags, e.g. add --connect-url qemu:///system lab")
+		}
+		name := ctx.Args().First()
+
+		clientConfig, err := loadConfig(ctx)
+		if err != nil {
+			return err
+		}
+
+		clientContext, exists := clientConfig.Contexts[name]
+		if !exists {
+			clientContext = config.ClientContext{}
+			clientContext.HypervisorConnection.SSHConfig.Port = ctx.Int("ssh-port")
+			clientContext.HypervisorConnection.SSHConfig.HostKeyCallbackName = "InsecureIgnoreHostKey"
+		}
+
+		hypervisorConnection := &clientContext.HypervisorConnection
+		stringSettings := map[string]*string{
+			"connect-url":      &hypervisorConnection.LibvirtConfig.ConnectionUrl,
+			"keyfile-path":     &hypervisorConnection.LibvirtConfig.KeyfilePath,
+			"ssh-host":         &hypervisorConnection.SSHConfig.Host,
+			"ssh-user":         &hypervisorConnection.SSHConfig.User,
+			"ssh-password":     &hypervisorConnection.SSHConfig.PasswordAuth.Password,
+			"ssh-privkey-path": &hypervisorConnection.SSHConfig.PrivateKeyAuth.PrivateKeyPath,
+			"ssh-passphrase":   &hypervisorConnection.SSHConfig.PrivateKeyAuth.Passphrase,
+			"fleet":            &clientContext.Fleet,
+			"api-server":       &clientContext.API.ServerURL,
+			"api-token":        &clientContext.API.Token,
+			"api-hypervisor":   &clientContext.API.Hypervisor,
+			"api-ca-file":      &clientContext.API.CAFile,
+			"api-cert-file":    &clientContext.API.CertFile,
+			"api-key-file":     &clientContext.API.KeyFile,
+		}
+		for flagName, setting := range stringSettings {
+			if ctx.IsSet(flagName) {
+				*setting = ctx.String(flagName)
+			}
+		}
+		if ctx.IsSet("ssh-port") {
+			hypervisorConnection.SSHConfig.Port = ctx.Int("ssh-port")
+		}
+		if ctx.IsSet("local-shell") {
+			hypervisorConnection.IsLocalShell = ctx.Bool("local-shell")
+		}
+
+		clientConfig.Contexts[name] = clientContext
+		if ctx.Bool("use") || clientConfig.CurrentContext == "" {
+			clientConfig.CurrentContext = name
+		}
+
+		if err = clientConfig.Save(configPath(ctx)); err != nil {
+			return err
+		}
+
+		action := "added"
+		if exists {
+			action = "updated"
+		}
+		return renderContextResult(ctx, ContextResult{Name: name, Action: action})
+	}
+}
+
+func (command *AddContextCommand) Build() *cli.Command {
+	return utils.ConvertInternalCommandToCliCommand(command)
+}
@@ -0,0 +1,173 @@
+package clientcontext
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/nnurry/harmonia/internal/config"
+	"github.com/nnurry/harmonia/pkg/client"
+	"github.com/nnurry/harmonia/pkg/output"
+	"github.com/nnurry/harmonia/pkg/types"
+	"github.com/nnurry/harmonia/pkg/utils"
+	"github.com/urfave/cli/v2"
+)
+
+const (
+	CONTEXT_COMMAND = types.InternalCommandName("Context command")
+)
+
+const (
+	CONTEXT_FLAG_NAME       = "context"
+	CLIENT_CONFIG_FLAG_NAME = "client-config"
+	SERVER_FLAG_NAME        = "server"
+	TOKEN_FLAG_NAME         = "token"
+)
+
+const (
+	API_CLIENT_CTX_KEY = types.InternalCommandCtxKey("apiClient")
+)
+
+// added to the cli command, every command below it picks its defaults from the chosen context
+func Flags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:    CONTEXT_FLAG_NAME,
+			Usage:   "Context to use instead of current_context of the client config",
+			EnvVars: []string{config.ENV_PREFIX + "CONTEXT"},
+		},
+		&cli.StringFlag{
+			Name:    CLIENT_CONFIG_FLAG_NAME,
+			Usage:   "Path to client config file, defaults to ~/.config/harmonia/config.yaml",
+			EnvVars: []string{config.ENV_PREFIX + "CLIENT_CONFIG"},
+		},
+		&cli.StringFlag{
+			Name:    SERVER_FLAG_NAME,
+			Usage:   "URL of a Harmonia API server to go through instead of Libvirt and SSH, overrides api.server_url",
+			EnvVars: []string{config.ENV_PREFIX + "SERVER"},
+		},
+		&cli.StringFlag{
+			Name:    TOKEN_FLAG_NAME,
+			Usage:   "Bearer token for the API server, overrides api.token",
+			EnvVars: []string{config.ENV_PREFIX + "TOKEN"},
+		},
+	}
+}
+
+func configPath(ctx *cli.Context) string {
+	if path := ctx.String(CLIENT_CONFIG_FLAG_NAME); path != "" {
+		return path
+	}
+	return config.DefaultClientConfigPath()
+}
+
+func loadConfig(ctx *cli.Context) (*config.ClientConfig, error) {
+	return config.LoadClientConfig(configPath(ctx))
+}
+
+// the context chosen with --context or current_context, empty if there is none
+func Resolve(ctx *cli.Context) (config.ClientContext, error) {
+	clientConfig, err := loadConfig(ctx)
+	if err != nil {
+		return config.ClientContext{}, err
+	}
+	return clientConfig.GetContext(ctx.String(CONTEXT_FLAG_NAME))
+}
+
+// a client of the API server given with --server or by the context, nil if there is none
+func NewAPIClient(ctx *cli.Context) (*client.Client, config.ClientAPIConfig, error) {
+	clientContext, err := Resolve(ctx)
+	if err != nil {
+		return nil, config.ClientAPIConfig{}, err
+	}
+
+	apiConfig := clientContext.API
+	if server := ctx.String(SERVER_FLAG_NAME); server != "" {
+		apiConfig.ServerURL = server
+	}
+	if token := ctx.String(TOKEN_FLAG_NAME); token != "" {
+		apiConfig.Token = token
+	}
+	if apiConfig.ServerURL == "" {
+		return nil, apiConfig, nil
+	}
+
+	apiClient, err := client.New(apiConfig.ServerURL)
+	if err != nil {
+		return nil, apiConfig, err
+	}
+	if apiConfig.CAFile != "" || apiConfig.CertFile != "" || apiConfig.KeyFile != "" {
+		tlsConfig, err := client.NewTLSConfig(apiConfig.CAFile, apiConfig.CertFile, apiConfig.KeyFile)
+		if err != nil {
+			return nil, apiConfig, err
+		}
+		apiClient = apiClient.WithTLSConfig(tlsConfig)
+	}
+	return apiClient.WithToken(apiConfig.Token), apiConfig, nil
+}
+
+// set by the Before of command groups running against an API server
+func APIClientFromContext(ctx *cli.Context) (*client.Client, bool) {
+	apiClient, ok := ctx.Context.Value(API_CLIENT_CTX_KEY).(*client.Client)
+	return apiClient, ok
+}
+
+// what context commands print
+type ContextResult struct {
+	Name   string `json:"name"`
+	Action string `json:"action"`
+}
+
+func renderContextResult(ctx *cli.Context, result ContextResult) error {
+	table := output.NewTable(output.Column{Name: "CONTEXT"}, output.Column{Name: "ACTION"})
+	table.AddRow(result.Name, result.Action)
+	return output.Render(ctx, result, table)
+}
+
+type ContextCommand struct{}
+
+func (command *ContextCommand) Description() string {
+	return "Manage named contexts holding default connection settings of the CLI"
+}
+
+func (command *ContextCommand) Signature() string {
+	return "context"
+}
+
+func (command *ContextCommand) Flags() []cli.Flag {
+	return []cli.Flag{}
+}
+
+func (command *ContextCommand) Subcommands() []*cli.Command {
+	return []*cli.Command{
+		(&ListContextsCommand{}).Build(),
+		(&UseContextCommand{}).Build(),
+		(&AddContextCommand{}).Build(),
+	}
+}
+
+func (command *ContextCommand) Handler() func(ctx *cli.Context) error {
+	return func(ctx *cli.Context) error {
+		buf := bytes.NewBufferString("")
+		for _, subcmd := range ctx.Command.Subcommands {
+			fmt.Fprintf(buf, "- %v\n", subcmd.Name)
+		}
+		return fmt.Errorf("use subcommands instead:\n%v", buf.String())
+	}
+}
+
+func (command *ContextCommand) Build() *cli.Command {
+	return utils.ConvertInternalCommandToCliCommand(command)
+}
+
+// fills an unset --fleet flag with the fleet of the client context
+func DefaultFleet(ctx *cli.Context, fleet *string) error {
+	if ctx.IsSet("fleet") {
+		return nil
+	}
+	clientContext, err := Resolve(ctx)
+	if err != nil {
+		return err
+	}
+	*fleet = clientContext.Fleet
+	return nil
+}
@@ -0,0 +1,82 @@
+package clientcontext
+
+import (
+	"fmt"
+
+	"github.com/nnurry/harmonia/internal/config"
+	"github.com/nnurry/harmonia/pkg/output"
+	"github.com/nnurry/harmonia/pkg/utils"
+	"github.com/urfave/cli/v2"
+)
+
+type ListContextsCommand struct{}
+
+func (command *ListContextsCommand) Description() string {
+	return "List contexts of the client config, * marks the current one"
+}
+
+func (command *ListContextsCommand) Signature() string {
+	return "list"
+}
+
+func (command *ListContextsCommand) Flags() []cli.Flag {
+	return []cli.Flag{}
+}
+
+func (command *ListContextsCommand) Subcommands() []*cli.Command {
+	return []*cli.Command{}
+}
+
+func (command *ListContextsCommand) Handler() func(ctx *cli.Context) error {
+	return func(ctx *cli.Context) error {
+		clientConfig, err := loadConfig(ctx)
+		if err != nil {
+			return err
+		}
+
+		table := output.NewTable(
+			output.Column{Name: "CURRENT"},
+			output.Column{Name: "NAME"},
+			output.Column{Name: "CONNECT URL"},
+			output.Column{Name: "SSH"},
+			output.Column{Name: "FLEET"},
+			output.Column{Name: "API SERVER"},
+			output.Column{Name: "KEYFILE", IsWide: true},
+		)
+
+		redacted := config.ClientConfig{CurrentContext: clientConfig.CurrentContext, Contexts: map[string]config.ClientContext{}}
+		for _, name := range clientConfig.ContextNames() {
+			clientContext := clientConfig.Contexts[name]
+			redacted.Contexts[name] = clientContext.Redacted()
+
+			current := ""
+			if name == clientConfig.CurrentContext {
+				current = "*"
+			}
+
+			sshConfig := clientContext.HypervisorConnection.SSHConfig
+			ssh := ""
+			if sshConfig.Host != "" {
+				ssh = fmt.Sprintf("%v@%v:%v", sshConfig.User, sshConfig.Host, sshConfig.Port)
+			}
+			if clientContext.HypervisorConnection.IsLocalShell {
+				ssh = "local"
+			}
+
+			table.AddRow(
+				current,
+				name,
+				clientContext.HypervisorConnection.LibvirtConfig.ConnectionUrl,
+				ssh,
+				clientContext.Fleet,
+				clientContext.API.ServerURL,
+				clientContext.HypervisorConnection.LibvirtConfig.KeyfilePath,
+			)
+		}
+		return output.Render(ctx, redacted, table)
+	}
+}
+
+func (command *ListContextsCommand) Build() *cli.Command {
+	return utils.ConvertInternalCommandToCliCommand(command)
+}
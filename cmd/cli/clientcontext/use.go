@@ -0,0 +1,53 @@
+package clientcontext
+
+import (
+	"fmt"
+
+	"github.com/nnurry/harmonia/pkg/utils"
+	"github.com/urfave/cli/v2"
+)
+
+type UseContextCommand struct{}
+
+func (command *UseContextCommand) Description() string {
+	return "Make a context the current one"
+}
+
+func (command *UseContextCommand) Signature() string {
+	return "use"
+}
+
+func (command *UseContextCommand) Flags() []cli.Flag {
+	return []cli.Flag{}
+}
+
+func (command *UseContextCommand) Subcommands() []*cli.Command {
+	return []*cli.Command{}
+}
+
+func (command *UseContextCommand) Handler() func(ctx *cli.Context) error {
+	return func(ctx *cli.Context) error {
+		if ctx.Args().Len() != 1 {
+			return fmt.Errorf("expected exactly one context name")
+		}
+		name := ctx.Args().First()
+
+		clientConfig, err := loadConfig(ctx)
+		if err != nil {
+			return err
+		}
+		if _, ok := clientConfig.Contexts[name]; !ok {
+			return fmt.Errorf("context '%v' not defined", name)
+		}
+
+		clientConfig.CurrentContext = name
+		if err = clientConfig.Save(configPath(ctx)); err != nil {
+			return err
+		}
+		return renderContextResult(ctx, ContextResult{Name: name, Action: "used"})
+	}
+}
+
+func (command *UseContextCommand) Build() *cli.Command {
+	return utils.ConvertInternalCommandToCliCommand(command)
+}
@@ -0,0 +1,98 @@
+package fleet
+
+import (
+	"fmt"
+
+	"github.com/nnurry/harmonia/cmd/cli/clientcontext"
+	"github.com/nnurry/harmonia/internal/contract"
+	"github.com/nnurry/harmonia/pkg/output"
+	"github.com/nnurry/harmonia/pkg/utils"
+	"github.com/urfave/cli/v2"
+)
+
+type CreateFleetCommand struct {
+	filePath string
+}
+
+func (command *CreateFleetCommand) Description() string {
+	return "Create networks and VMs of a fleet file"
+}
+
+func (command *CreateFleetCommand) Signature() string {
+	return "create"
+}
+
+func (command *CreateFleetCommand) Flags() []cli.Flag {
+	return []cli.Flag{fileFlag(&command.filePath)}
+}
+
+func (command *CreateFleetCommand) Subcommands() []*cli.Command {
+	return []*cli.Command{}
+}
+
+func (command *CreateFleetCommand) Handler() func(ctx *cli.Context) error {
+	return func(ctx *cli.Context) error {
+		fleetConfig, err := ReadFleetConfig(command.filePath)
+		if err != nil {
+			return err
+		}
+
+		if apiClient, ok := clientcontext.APIClientFromContext(ctx); ok {
+			// the API server doesn't read files of ours
+			fleetConfig, err = fleetConfig.WithPostProvisionInlined()
+			if err != nil {
+				return err
+			}
+			result, err := apiClient.CreateFleet(ctx.Context, contract.CreateVirtualMachineFleetRequest{VirtualMachineFleetConfig: fleetConfig})
+			if err != nil {
+				return fmt.Errorf("could not create virtual machine fleet: %v", err)
+			}
+			return renderCreateResult(ctx, result)
+		}
+
+		fleetService, err := newFleetService(ctx)
+		if err != nil {
+			return err
+		}
+
+		plannedFleetConfig, err := fleetService.Plan(fleetConfig)
+		if err != nil {
+			return fmt.Errorf("could not schedule virtual machine fleet: %v", err)
+		}
+
+		result := fleetService.
+			WithProgress(newProgressPrinter("create", len(plannedFleetConfig.VirtualMachineConfigs))).
+			Create(plannedFleetConfig)
+
+		return renderCreateResult(ctx, result)
+	}
+}
+
+// fails if any VM or fleet hook failed
+func renderCreateResult(ctx *cli.Context, result contract.CreateVirtualMachineFleetResult) error {
+	table := newResultTable()
+	for _, subResult := range result.NetworkSubResults {
+		addResultRow(table, "network", subResult.Name, "", subResult.UUID, subResult.Error, nil)
+	}
+	for _, subResult := range result.SubResults {
+		addResultRow(table, "vm", subResult.Name, subResult.Hypervisor, subResult.UUID, subResult.Error, subResult.Warnings)
+	}
+	for _, subResult := range result.PostProvisionSubResults {
+		addResultRow(table, "hook", fmt.Sprintf("%v on %v", subResult.Hook, subResult.VirtualMachine), "", "", subResult.Error, nil)
+	}
+	if err := output.Render(ctx, result, table); err != nil {
+		return err
+	}
+
+	if result.Failed > 0 {
+		return fmt.Errorf("could not create %v of %v virtual machines and networks", result.Failed, result.Total)
+	}
+	if failed := result.PostProvisionFailed(); failed > 0 {
+		return fmt.Errorf("%v of %v post-provision hook runs failed", failed, len(result.PostProvisionSubResults))
+	}
+	return nil
+}
+
+func (command *CreateFleetCommand) Build() *cli.Command {
+	return utils.ConvertInternalCommandToCliCommand(command)
+}
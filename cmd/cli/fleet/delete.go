@@ -0,0 +1,91 @@
+package fleet
+
+import (
+	"fmt"
+
+	"github.com/nnurry/harmonia/cmd/cli/clientcontext"
+	"github.com/nnurry/harmonia/internal/contract"
+	"github.com/nnurry/harmonia/pkg/output"
+	"github.com/nnurry/harmonia/pkg/utils"
+	"github.com/urfave/cli/v2"
+)
+
+type DeleteFleetCommand struct {
+	filePath string
+}
+
+func (command *DeleteFleetCommand) Description() string {
+	return "Delete VMs and networks of a fleet file"
+}
+
+func (command *DeleteFleetCommand) Signature() string {
+	return "delete"
+}
+
+func (command *DeleteFleetCommand) Flags() []cli.Flag {
+	return []cli.Flag{fileFlag(&command.filePath)}
+}
+
+func (command *DeleteFleetCommand) Subcommands() []*cli.Command {
+	return []*cli.Command{}
+}
+
+func (command *DeleteFleetCommand) Handler() func(ctx *cli.Context) error {
+	return func(ctx *cli.Context) error {
+		fleetConfig, err := ReadFleetConfig(command.filePath)
+		if err != nil {
+			return err
+		}
+
+		if apiClient, ok := clientcontext.APIClientFromContext(ctx); ok {
+			result, err := apiClient.DeleteFleet(ctx.Context, contract.DeleteVirtualMachineFleetRequest{VirtualMachineFleetConfig: fleetConfig})
+			if err != nil {
+				return fmt.Errorf("could not delete virtual machine fleet: %v", err)
+			}
+			return renderDeleteResult(ctx, result)
+		}
+
+		fleetService, err := newFleetService(ctx)
+		if err != nil {
+			return err
+		}
+
+		locatedFleetConfig, err := fleetService.Locate(fleetConfig)
+		if err != nil {
+			return fmt.Errorf("could not locate virtual machine fleet: %v", err)
+		}
+
+		result := fleetService.
+			WithProgress(newProgressPrinter("delete", len(locatedFleetConfig.VirtualMachineConfigs))).
+			Delete(locatedFleetConfig)
+
+		return renderDeleteResult(ctx, result)
+	}
+}
+
+// fails if any VM failed
+func renderDeleteResult(ctx *cli.Context, result contract.DeleteVirtualMachineFleetResult) error {
+	table := newResultTable()
+	for _, subResult := range result.SubResults {
+		addResultRow(table, "vm", subResult.Name, subResult.Hypervisor, subResult.UUID, subResult.Error, subResult.Warnings)
+	}
+	for _, subResult := range result.NetworkSubResults {
+		var warnings []string
+		if subResult.Kept != "" {
+			warnings = []string{"kept, " + subResult.Kept}
+		}
+		addResultRow(table, "network", subResult.Name, "", subResult.UUID, subResult.Error, warnings)
+	}
+	if err := output.Render(ctx, result, table); err != nil {
+		return err
+	}
+
+	if result.Failed > 0 {
+		return fmt.Errorf("could not delete %v of %v virtual machines and networks", result.Failed, result.Total)
+	}
+	return nil
+}
+
+func (command *DeleteFleetCommand) Build() *cli.Command {
+	return utils.ConvertInternalCommandToCliCommand(command)
+}
@@ -0,0 +1,234 @@
+package fleet
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/goccy/go-yaml"
+	"github.com/nnurry/harmonia/cmd/cli/clientcontext"
+	"github.com/nnurry/harmonia/internal/config"
+	"github.com/nnurry/harmonia/internal/connection"
+	"github.com/nnurry/harmonia/internal/contract"
+	"github.com/nnurry/harmonia/internal/interpolate"
+	"github.com/nnurry/harmonia/internal/logger"
+	"github.com/nnurry/harmonia/internal/service"
+	"github.com/nnurry/harmonia/internal/store"
+	"github.com/nnurry/harmonia/pkg/output"
+	"github.com/nnurry/harmonia/pkg/types"
+	"github.com/nnurry/harmonia/pkg/utils"
+	"github.com/urfave/cli/v2"
+)
+
+const (
+	FLEET_COMMAND = types.InternalCommandName("Fleet command")
+)
+
+const (
+	SERVER_CONFIG_CTX_KEY = types.InternalCommandCtxKey("serverConfig")
+	STATE_STORE_CTX_KEY   = types.InternalCommandCtxKey("stateStore")
+)
+
+// reads a fleet file the same way the API reads its body
+func ReadFleetConfig(path string) (contract.VirtualMachineFleetConfig, error) {
+	var fleetRequest contract.CreateVirtualMachineFleetRequest
+	err := readRequestFile(path, &fleetRequest)
+	return fleetRequest.VirtualMachineFleetConfig, err
+}
+
+// decodes a YAML/JSON file into the request v points to, yaml is converted to json first
+func readRequestFile(path string, v any) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("could not read fleet file '%v': %v", path, err)
+	}
+
+	jsonData, err := yaml.YAMLToJSON(data)
+	if err != nil {
+		return fmt.Errorf("could not parse fleet file '%v': %v", path, err)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(jsonData))
+	decoder.DisallowUnknownFields()
+	if err = decoder.Decode(v); err != nil {
+		return fmt.Errorf("could not parse fleet file '%v': %v", path, err)
+	}
+	return nil
+}
+
+func fileFlag(destination *string) cli.Flag {
+	return &cli.StringFlag{
+		Name:        "file",
+		Aliases:     []string{"f"},
+		Required:    true,
+		Usage:       "Path to fleet file (YAML/JSON), same body as the fleet API",
+		Destination: destination,
+	}
+}
+
+// builds the fleet service the same way the API handlers do
+func newFleetService(ctx *cli.Context) (*service.Fleet, error) {
+	serverConfig, ok := ctx.Context.Value(SERVER_CONFIG_CTX_KEY).(*config.ServerConfig)
+	if !ok {
+		return nil, fmt.Errorf("could not retrieve server config from context")
+	}
+	stateStore, ok := ctx.Context.Value(STATE_STORE_CTX_KEY).(*store.Store)
+	if !ok {
+		return nil, fmt.Errorf("could not retrieve state store from context")
+	}
+
+	return service.NewFleet(service.NewPlacement(serverConfig.GetHypervisor).WithAdmissionResolver(serverConfig.GetAdmission)).
+		WithContext(ctx.Context).
+		WithStateStore(stateStore).
+		WithPaths(serverConfig.Paths.CloudInitDir, serverConfig.Paths.DiskDir, serverConfig.Paths.ConsoleLogDir).
+		WithConcurrency(serverConfig.Limits.MaxConcurrentVMOperations).
+		WithInstanceTypes(serverConfig.InstanceTypes).
+		WithInterpolator(interpolate.New(serverConfig.Interpolation)), nil
+}
+
+// prints a line per finished VM or network to stderr, stdout is left to --output
+func newProgressPrinter(verb string, total int) service.FleetProgress {
+	var mutex sync.Mutex
+	done := 0
+
+	return func(event service.FleetEvent) {
+		if !event.IsDone {
+			return
+		}
+
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		prefix := "  "
+		if event.Kind == service.FLEET_EVENT_KIND_VM {
+			done++
+			prefix = fmt.Sprintf("[%v/%v]", done, total)
+		}
+
+		location := ""
+		if event.Hypervisor != "" {
+			location = fmt.Sprintf(" on %v", event.Hypervisor)
+		}
+
+		if event.Kind == service.FLEET_EVENT_KIND_HOOK {
+			if event.Err != nil {
+				fmt.Fprintf(os.Stderr, "%v hook %v%v failed: %v\n", prefix, event.Name, location, event.Err)
+				return
+			}
+			fmt.Fprintf(os.Stderr, "%v ran hook %v%v\n", prefix, event.Name, location)
+			return
+		}
+
+		if event.Err != nil {
+			fmt.Fprintf(os.Stderr, "%v could not %v %v %v%v: %v\n", prefix, verb, event.Kind, event.Name, location, event.Err)
+			return
+		}
+		fmt.Fprintf(os.Stderr, "%v %vd %v %v%v (%v)\n", prefix, verb, event.Kind, event.Name, location, event.UUID)
+	}
+}
+
+type FleetCommand struct {
+	configPath string
+	statePath  string
+}
+
+func (command *FleetCommand) Description() string {
+	return "Create, delete, validate, format and export fleets without running the API server"
+}
+
+func (command *FleetCommand) Signature() string {
+	return "fleet"
+}
+
+func (command *FleetCommand) Flags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:        "config",
+			Usage:       "Path to server config file (YAML/JSON) for named hypervisors, paths and limits, unused against an API server",
+			EnvVars:     []string{config.ENV_PREFIX + "CONFIG"},
+			Destination: &command.configPath,
+		},
+		&cli.StringFlag{
+			Name:        "state-path",
+			Usage:       "Path to state store file, overrides state_path",
+			Destination: &command.statePath,
+		},
+	}
+}
+
+func (command *FleetCommand) Subcommands() []*cli.Command {
+	return []*cli.Command{
+		(&CreateFleetCommand{}).Build(),
+		(&DeleteFleetCommand{}).Build(),
+		(&ValidateFleetCommand{}).Build(),
+		(&InventoryFleetCommand{}).Build(),
+		(&FormatFleetCommand{}).Build(),
+	}
+}
+
+func (command *FleetCommand) Handler() func(ctx *cli.Context) error {
+	return func(ctx *cli.Context) error {
+		buf := bytes.NewBufferString("")
+		for _, subcmd := range ctx.Command.Subcommands {
+			fmt.Fprintf(buf, "- %v\n", subcmd.Name)
+		}
+		return fmt.Errorf("use subcommands instead:\n%v", buf.String())
+	}
+}
+
+func (command *FleetCommand) Build() *cli.Command {
+	cliCommand := utils.ConvertInternalCommandToCliCommand(command)
+	cliCommand.Before = func(ctx *cli.Context) error {
+		apiClient, _, err := clientcontext.NewAPIClient(ctx)
+		if err != nil {
+			return err
+		}
+		if apiClient != nil {
+			ctx.Context = context.WithValue(ctx.Context, clientcontext.API_CLIENT_CTX_KEY, apiClient)
+			return nil
+		}
+
+		serverConfig, err := config.LoadServerConfig(command.configPath)
+		if err != nil {
+			return err
+		}
+		if command.statePath != "" {
+			serverConfig.StatePath = command.statePath
+		}
+
+		if err = logger.Configure(serverConfig.Logging.Level, serverConfig.Logging.Format); err != nil {
+			return err
+		}
+		connection.SetSSHTimeout(serverConfig.Timeouts.SSH.Duration())
+
+		stateStore, err := store.New(serverConfig.StatePath)
+		if err != nil {
+			return fmt.Errorf("could not open state store: %v", err)
+		}
+
+		ctx.Context = context.WithValue(ctx.Context, SERVER_CONFIG_CTX_KEY, serverConfig)
+		ctx.Context = context.WithValue(ctx.Context, STATE_STORE_CTX_KEY, stateStore)
+		return nil
+	}
+
+	return cliCommand
+}
+
+func newResultTable() *output.Table {
+	return output.NewTable(
+		output.Column{Name: "KIND"},
+		output.Column{Name: "NAME"},
+		output.Column{Name: "HYPERVISOR"},
+		output.Column{Name: "UUID"},
+		output.Column{Name: "ERROR"},
+		output.Column{Name: "WARNINGS", IsWide: true},
+	)
+}
+
+func addResultRow(table *output.Table, kind string, name string, hypervisor string, uuid string, errMessage string, warnings []string) {
+	table.AddRow(kind, name, hypervisor, uuid, errMessage, strings.Join(warnings, "; "))
+}
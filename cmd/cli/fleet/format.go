@@ -0,0 +1,103 @@
+package fleet
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/nnurry/harmonia/cmd/cli/clientcontext"
+	"github.com/nnurry/harmonia/internal/format"
+	"github.com/nnurry/harmonia/pkg/utils"
+	"github.com/urfave/cli/v2"
+)
+
+type FormatFleetCommand struct {
+	filePath     string
+	contractName string
+	format       string
+}
+
+func (command *FormatFleetCommand) Description() string {
+	return "Print a fleet file (or any request) the way the API acts on it, or the JSON Schema of its contract"
+}
+
+func (command *FormatFleetCommand) Signature() string {
+	return "format"
+}
+
+func (command *FormatFleetCommand) Flags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:        "file",
+			Aliases:     []string{"f"},
+			Usage:       "Path to request file (YAML/JSON), not needed with --format json-schema",
+			Destination: &command.filePath,
+		},
+		&cli.StringFlag{
+			Name:        "contract",
+			Value:       "create_fleet",
+			Usage:       "One of " + strings.Join(format.ContractNames(), ", "),
+			Destination: &command.contractName,
+		},
+		&cli.StringFlag{
+			Name:        "format",
+			Value:       format.FORMAT_YAML,
+			Usage:       "One of " + strings.Join(format.FORMATS, ", "),
+			Destination: &command.format,
+		},
+	}
+}
+
+func (command *FormatFleetCommand) Subcommands() []*cli.Command {
+	return []*cli.Command{}
+}
+
+func (command *FormatFleetCommand) formatRequest(ctx *cli.Context) ([]byte, error) {
+	request, err := format.NewContract(command.contractName)
+	if err != nil {
+		return nil, err
+	}
+
+	if command.format != format.FORMAT_JSON_SCHEMA {
+		if command.filePath == "" {
+			return nil, fmt.Errorf("--file is required with --format %v", command.format)
+		}
+		if err = readRequestFile(command.filePath, request); err != nil {
+			return nil, err
+		}
+	} else {
+		request = nil
+	}
+
+	if apiClient, ok := clientcontext.APIClientFromContext(ctx); ok {
+		return apiClient.Format(ctx.Context, command.contractName, command.format, request)
+	}
+
+	if command.format == format.FORMAT_JSON_SCHEMA {
+		return format.Schema(command.contractName)
+	}
+
+	fleetService, err := newFleetService(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err = fleetService.Normalize(request); err != nil {
+		return nil, fmt.Errorf("unresolved references:\n%v", err)
+	}
+	return format.Serialize(request, command.format)
+}
+
+func (command *FormatFleetCommand) Handler() func(ctx *cli.Context) error {
+	return func(ctx *cli.Context) error {
+		data, err := command.formatRequest(ctx)
+		if err != nil {
+			return err
+		}
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+}
+
+func (command *FormatFleetCommand) Build() *cli.Command {
+	return utils.ConvertInternalCommandToCliCommand(command)
+}
@@ -0,0 +1,104 @@
+package fleet
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/nnurry/harmonia/cmd/cli/clientcontext"
+	"github.com/nnurry/harmonia/internal/config"
+	"github.com/nnurry/harmonia/internal/contract"
+	"github.com/nnurry/harmonia/internal/inventory"
+	"github.com/nnurry/harmonia/internal/service"
+	"github.com/nnurry/harmonia/internal/store"
+	"github.com/nnurry/harmonia/pkg/utils"
+	"github.com/urfave/cli/v2"
+)
+
+type InventoryFleetCommand struct {
+	format string
+}
+
+func (command *InventoryFleetCommand) Description() string {
+	return "Print an Ansible inventory or ssh_config of a created fleet"
+}
+
+func (command *InventoryFleetCommand) Signature() string {
+	return "inventory"
+}
+
+func (command *InventoryFleetCommand) Flags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:        "format",
+			Value:       inventory.FORMAT_ANSIBLE_INI,
+			Usage:       "One of " + strings.Join(inventory.FORMATS, ", "),
+			Destination: &command.format,
+		},
+	}
+}
+
+func (command *InventoryFleetCommand) Subcommands() []*cli.Command {
+	return []*cli.Command{}
+}
+
+func (command *InventoryFleetCommand) getInventory(ctx *cli.Context, fleet string) (contract.FleetInventory, error) {
+	if apiClient, ok := clientcontext.APIClientFromContext(ctx); ok {
+		return apiClient.FleetInventory(ctx.Context, fleet)
+	}
+
+	serverConfig, ok := ctx.Context.Value(SERVER_CONFIG_CTX_KEY).(*config.ServerConfig)
+	if !ok {
+		return contract.FleetInventory{}, fmt.Errorf("could not retrieve server config from context")
+	}
+	stateStore, ok := ctx.Context.Value(STATE_STORE_CTX_KEY).(*store.Store)
+	if !ok {
+		return contract.FleetInventory{}, fmt.Errorf("could not retrieve state store from context")
+	}
+
+	records, err := stateStore.ListVirtualMachines(contract.VirtualMachineRecordFilter{Fleet: fleet})
+	if err != nil {
+		return contract.FleetInventory{}, fmt.Errorf("could not read state store: %v", err)
+	}
+	if len(records) < 1 {
+		return contract.FleetInventory{}, fmt.Errorf("no virtual machine recorded for fleet %v", fleet)
+	}
+	return service.GetFleetInventory(fleet, records, serverConfig.GetHypervisor), nil
+}
+
+// problems go to stderr so the inventory can be piped straight into a file
+func (command *InventoryFleetCommand) Handler() func(ctx *cli.Context) error {
+	return func(ctx *cli.Context) error {
+		fleet := ctx.Args().First()
+		if fleet == "" {
+			return fmt.Errorf("missing fleet name")
+		}
+
+		fleetInventory, err := command.getInventory(ctx, fleet)
+		if err != nil {
+			return fmt.Errorf("could not get inventory of fleet %v: %v", fleet, err)
+		}
+
+		data, err := inventory.Render(fleetInventory, command.format)
+		if err != nil {
+			return err
+		}
+
+		problems := []string{}
+		for source := range fleetInventory.Errors {
+			problems = append(problems, source)
+		}
+		sort.Strings(problems)
+		for _, source := range problems {
+			fmt.Fprintf(os.Stderr, "warning: %v: %v\n", source, fleetInventory.Errors[source])
+		}
+
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+}
+
+func (command *InventoryFleetCommand) Build() *cli.Command {
+	return utils.ConvertInternalCommandToCliCommand(command)
+}
@@ -0,0 +1,94 @@
+package fleet
+
+import (
+	"fmt"
+
+	"github.com/nnurry/harmonia/cmd/cli/clientcontext"
+	"github.com/nnurry/harmonia/internal/contract"
+	"github.com/nnurry/harmonia/pkg/output"
+	"github.com/nnurry/harmonia/pkg/utils"
+	"github.com/urfave/cli/v2"
+)
+
+type ValidateFleetCommand struct {
+	filePath string
+}
+
+func (command *ValidateFleetCommand) Description() string {
+	return "Check a fleet file and print its VMs without connecting to any hypervisor"
+}
+
+func (command *ValidateFleetCommand) Signature() string {
+	return "validate"
+}
+
+func (command *ValidateFleetCommand) Flags() []cli.Flag {
+	return []cli.Flag{fileFlag(&command.filePath)}
+}
+
+func (command *ValidateFleetCommand) Subcommands() []*cli.Command {
+	return []*cli.Command{}
+}
+
+func (command *ValidateFleetCommand) Handler() func(ctx *cli.Context) error {
+	return func(ctx *cli.Context) error {
+		fleetConfig, err := ReadFleetConfig(command.filePath)
+		if err != nil {
+			return err
+		}
+
+		var validatedFleetConfig contract.VirtualMachineFleetConfig
+		if _, ok := clientcontext.APIClientFromContext(ctx); ok {
+			// hypervisor names and instance types of the server config are only known to the server,
+			// check what can be checked here
+			validatedFleetConfig = fleetConfig.GetCoalesced()
+			if err = validatedFleetConfig.Validate(); err != nil {
+				return fmt.Errorf("invalid fleet: %v", err)
+			}
+		} else {
+			fleetService, err := newFleetService(ctx)
+			if err != nil {
+				return err
+			}
+
+			validatedFleetConfig, err = fleetService.Validate(fleetConfig)
+			if err != nil {
+				return err
+			}
+		}
+
+		table := output.NewTable(
+			output.Column{Name: "NAME"},
+			output.Column{Name: "HYPERVISOR"},
+			output.Column{Name: "BASE VM"},
+			output.Column{Name: "VCPUS"},
+			output.Column{Name: "MEMORY"},
+			output.Column{Name: "FLEET"},
+			output.Column{Name: "CONNECTION URL", IsWide: true},
+		)
+		for _, vmConfig := range validatedFleetConfig.VirtualMachineConfigs {
+			hypervisor, connectionUrl := vmConfig.Hypervisor, ""
+			if vmConfig.HypervisorConnectionConfig != nil {
+				connectionUrl = vmConfig.HypervisorConnectionConfig.LibvirtConfig.ConnectionUrl
+			} else if validatedFleetConfig.IsScheduled() {
+				// placed by the scheduler upon create
+				hypervisor = "(scheduled)"
+			}
+
+			table.AddRow(
+				vmConfig.Name,
+				hypervisor,
+				vmConfig.BaseVirtualMachineName,
+				vmConfig.NumOfVCPUs,
+				output.FormatBytes(vmConfig.MemoryInGiB*1024*1024*1024),
+				vmConfig.Fleet,
+				connectionUrl,
+			)
+		}
+		return output.Render(ctx, validatedFleetConfig.Redacted(), table)
+	}
+}
+
+func (command *ValidateFleetCommand) Build() *cli.Command {
+	return utils.ConvertInternalCommandToCliCommand(command)
+}
@@ -68,6 +68,10 @@ func (command *DefineLibvirtDomainCommand) Subcommands() []*cli.Command {
 
 func (command *DefineLibvirtDomainCommand) Handler() func(ctx *cli.Context) error {
 	return func(ctx *cli.Context) error {
+		if _, _, ok := RemoteClient(ctx); ok {
+			return errNotRemote(command.Signature())
+		}
+
 		if ctx.NArg() < 1 {
 			return fmt.Errorf("missing <base domain name> (need 1 base domain to build other child domains)")
 		}
@@ -134,13 +138,19 @@ func (command *DefineLibvirtDomainCommand) Handler() func(ctx *cli.Context) erro
 			return err
 		}
 
-		_, err = libvirtService.DefineDomainFromBuilder(domainBuilder)
+		domain, err := libvirtService.DefineDomainFromBuilder(domainBuilder)
+
+		if err != nil {
+			return err
+		}
+		defer domain.Free()
 
+		domainUuid, err := domain.GetUUIDString()
 		if err != nil {
 			return err
 		}
 
-		return nil
+		return renderActionResult(ctx, ActionResult{Kind: "domain", Name: command.domainName, UUID: domainUuid, Action: "defined"})
 	}
 }
 
@@ -0,0 +1,122 @@
+package libvirt
+
+import (
+	"fmt"
+
+	"github.com/nnurry/harmonia/internal/builder"
+	"github.com/nnurry/harmonia/internal/connection"
+	"github.com/nnurry/harmonia/internal/contract"
+	"github.com/nnurry/harmonia/internal/service"
+	"github.com/nnurry/harmonia/pkg/utils"
+	"github.com/urfave/cli/v2"
+)
+
+type DefineLibvirtNetworkCommand struct {
+	config contract.VirtualNetworkConfig
+}
+
+func (command *DefineLibvirtNetworkCommand) Description() string {
+	return "Define and start a network in Libvirt"
+}
+
+func (command *DefineLibvirtNetworkCommand) Signature() string {
+	return "define-network"
+}
+
+func (command *DefineLibvirtNetworkCommand) Flags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:        "name",
+			Required:    true,
+			Usage:       "Set name of new network",
+			Destination: &command.config.Name,
+		},
+		&cli.StringFlag{
+			Name:        "mode",
+			Value:       builder.NETWORK_FORWARD_MODE_NAT,
+			Usage:       "Set forward mode of network (nat, route, isolated). Default to nat",
+			Destination: &command.config.Mode,
+		},
+		&cli.StringFlag{
+			Name:        "forward-device",
+			Usage:       "Set host device to forward traffic to (nat and route only)",
+			Destination: &command.config.ForwardDevice,
+		},
+		&cli.StringFlag{
+			Name:        "bridge",
+			Usage:       "Set name of bridge created for network. Libvirt picks one (virbrN) if empty",
+			Destination: &command.config.BridgeName,
+		},
+		&cli.StringFlag{
+			Name:        "ip",
+			Required:    true,
+			Usage:       "Set IPv4 address of host on network, e.g. 192.168.100.1",
+			Destination: &command.config.IPv4Address,
+		},
+		&cli.UintFlag{
+			Name:        "prefix",
+			Value:       24,
+			Usage:       "Set IPv4 prefix length of network. Default to 24",
+			Destination: &command.config.IPv4Prefix,
+		},
+		&cli.StringFlag{
+			Name:        "dhcp-start",
+			Usage:       "Set first address of DHCP range. DHCP is disabled if empty",
+			Destination: &command.config.DHCPRangeStart,
+		},
+		&cli.StringFlag{
+			Name:        "dhcp-end",
+			Usage:       "Set last address of DHCP range. DHCP is disabled if empty",
+			Destination: &command.config.DHCPRangeEnd,
+		},
+		&cli.StringFlag{
+			Name:        "domain",
+			Usage:       "Set DNS domain served by network",
+			Destination: &command.config.DomainName,
+		},
+		&cli.BoolFlag{
+			Name:        "autostart",
+			Usage:       "Start network when hypervisor boots",
+			Destination: &command.config.Autostart,
+		},
+	}
+}
+
+func (command *DefineLibvirtNetworkCommand) Subcommands() []*cli.Command {
+	return []*cli.Command{}
+}
+
+func (command *DefineLibvirtNetworkCommand) Handler() func(ctx *cli.Context) error {
+	return func(ctx *cli.Context) error {
+		if _, _, ok := RemoteClient(ctx); ok {
+			return errNotRemote(command.Signature())
+		}
+
+		libvirtInternalConnection, ok := ctx.Context.Value(LIBVIRT_INTERNAL_CONNECTION_CTX_KEY).(*connection.Libvirt)
+		if !ok {
+			return fmt.Errorf("could not retrieve Libvirt internal connection from context")
+		}
+
+		libvirtService, err := service.NewLibvirt(libvirtInternalConnection)
+		if err != nil {
+			return err
+		}
+
+		virtualNetworkService, err := service.NewVirtualNetwork(libvirtService)
+		if err != nil {
+			return err
+		}
+		defer virtualNetworkService.Cleanup()
+
+		networkUuid, err := virtualNetworkService.Create(command.config)
+		if err != nil {
+			return fmt.Errorf("could not define network %v: %v", command.config.Name, err)
+		}
+
+		return renderActionResult(ctx, ActionResult{Kind: "network", Name: command.config.Name, UUID: networkUuid, Action: "defined"})
+	}
+}
+
+func (command *DefineLibvirtNetworkCommand) Build() *cli.Command {
+	return utils.ConvertInternalCommandToCliCommand(command)
+}
@@ -5,8 +5,10 @@ import (
 	"context"
 	"fmt"
 
+	"github.com/nnurry/harmonia/cmd/cli/clientcontext"
 	"github.com/nnurry/harmonia/internal/connection"
 	"github.com/nnurry/harmonia/internal/logger"
+	"github.com/nnurry/harmonia/pkg/output"
 	"github.com/nnurry/harmonia/pkg/types"
 	"github.com/nnurry/harmonia/pkg/utils"
 	"github.com/urfave/cli/v2"
@@ -20,8 +22,28 @@ const (
 	LIBVIRT_INTERNAL_CONNECTION_CTX_KEY = types.InternalCommandCtxKey("libvirtInternalConnection")
 )
 
+// what commands changing a domain or network print
+type ActionResult struct {
+	Kind   string `json:"kind"`
+	Name   string `json:"name"`
+	UUID   string `json:"uuid,omitempty"`
+	Action string `json:"action"`
+}
+
+func renderActionResult(ctx *cli.Context, result ActionResult) error {
+	table := output.NewTable(
+		output.Column{Name: "KIND"},
+		output.Column{Name: "NAME"},
+		output.Column{Name: "ACTION"},
+		output.Column{Name: "UUID", IsWide: true},
+	)
+	table.AddRow(result.Kind, result.Name, result.Action, result.UUID)
+	return output.Render(ctx, result, table)
+}
+
 type LibvirtCommand struct {
-	config connection.LibvirtConfig
+	config     connection.LibvirtConfig
+	hypervisor string
 }
 
 func (command *LibvirtCommand) Description() string {
@@ -33,16 +55,7 @@ func (command *LibvirtCommand) Signature() string {
 }
 
 func (command *LibvirtCommand) Flags() []cli.Flag {
-	return []cli.Flag{
-		&cli.StringFlag{
-			Name:        "connect-url",
-			Destination: &command.config.ConnectionUrl,
-		},
-		&cli.StringFlag{
-			Name:        "keyfile-path",
-			Destination: &command.config.KeyfilePath,
-		},
-	}
+	return ConnectionFlags(&command.config, &command.hypervisor)
 }
 
 func (command *LibvirtCommand) Subcommands() []*cli.Command {
@@ -50,8 +63,12 @@ func (command *LibvirtCommand) Subcommands() []*cli.Command {
 		(&DefineLibvirtDomainCommand{}).Build(),
 		(&RemoveLibvirtDomainCommand{}).Build(),
 		(&ListLibvirtDomainsCommand{}).Build(),
+		(&StatsLibvirtDomainCommand{}).Build(),
 		(&StartLibvirtDomainCommand{}).Build(),
 		(&StopLibvirtDomainCommand{}).Build(),
+		(&DefineLibvirtNetworkCommand{}).Build(),
+		(&ListLibvirtNetworksCommand{}).Build(),
+		(&RemoveLibvirtNetworkCommand{}).Build(),
 	}
 }
 
@@ -68,18 +85,68 @@ func (command *LibvirtCommand) Handler() func(ctx *cli.Context) error {
 func (command *LibvirtCommand) Build() *cli.Command {
 	cliCommand := utils.ConvertInternalCommandToCliCommand(command)
 	cliCommand.Before = func(ctx *cli.Context) error {
-		libvirtConnection, err := connection.NewLibvirt(command.config)
+		return SetupConnection(ctx, &command.config, &command.hypervisor)
+	}
 
-		if err != nil {
-			return fmt.Errorf("could not establish Libvirt connection: %v", err)
-		}
+	return cliCommand
+}
+
+// flags picking the hypervisor, shared by every group talking to libvirt
+func ConnectionFlags(config *connection.LibvirtConfig, hypervisor *string) []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:        "connect-url",
+			Destination: &config.ConnectionUrl,
+		},
+		&cli.StringFlag{
+			Name:        "keyfile-path",
+			Destination: &config.KeyfilePath,
+		},
+		&cli.StringFlag{
+			Name:        "hypervisor",
+			Usage:       "Hypervisor of the server config to use against an API server, overrides api.hypervisor",
+			Destination: hypervisor,
+		},
+	}
+}
 
-		logger.Infof("Setting Libvirt connection with URL = %v\n", libvirtConnection.URL())
+// puts the API client in ctx when a server is configured, a Libvirt connection otherwise;
+// settings of the client context fill in flags not given
+func SetupConnection(ctx *cli.Context, config *connection.LibvirtConfig, hypervisor *string) error {
+	apiClient, apiConfig, err := clientcontext.NewAPIClient(ctx)
+	if err != nil {
+		return err
+	}
+	if apiClient != nil {
+		if !ctx.IsSet("hypervisor") {
+			*hypervisor = apiConfig.Hypervisor
+		}
+		logger.Infof("Going through Harmonia API server %v", apiConfig.ServerURL)
 
-		ctx.Context = context.WithValue(ctx.Context, LIBVIRT_INTERNAL_CONNECTION_CTX_KEY, libvirtConnection)
+		ctx.Context = context.WithValue(ctx.Context, clientcontext.API_CLIENT_CTX_KEY, apiClient)
+		ctx.Context = context.WithValue(ctx.Context, REMOTE_HYPERVISOR_CTX_KEY, *hypervisor)
 		return nil
+	}
 
+	clientContext, err := clientcontext.Resolve(ctx)
+	if err != nil {
+		return err
+	}
+	if !ctx.IsSet("connect-url") {
+		config.ConnectionUrl = clientContext.HypervisorConnection.LibvirtConfig.ConnectionUrl
+	}
+	if !ctx.IsSet("keyfile-path") {
+		config.KeyfilePath = clientContext.HypervisorConnection.LibvirtConfig.KeyfilePath
 	}
 
-	return cliCommand
+	libvirtConnection, err := connection.NewLibvirt(*config)
+
+	if err != nil {
+		return fmt.Errorf("could not establish Libvirt connection: %v", err)
+	}
+
+	logger.Infof("Setting Libvirt connection with URL = %v\n", libvirtConnection.URL())
+
+	ctx.Context = context.WithValue(ctx.Context, LIBVIRT_INTERNAL_CONNECTION_CTX_KEY, libvirtConnection)
+	return nil
 }
@@ -1,78 +1,87 @@
 package libvirt
 
 import (
-	"bytes"
 	"fmt"
+	"sort"
+	"strings"
 
+	"github.com/nnurry/harmonia/cmd/cli/clientcontext"
 	"github.com/nnurry/harmonia/internal/connection"
+	"github.com/nnurry/harmonia/internal/contract"
 	"github.com/nnurry/harmonia/internal/service"
+	"github.com/nnurry/harmonia/pkg/output"
 	"github.com/nnurry/harmonia/pkg/types"
 	"github.com/nnurry/harmonia/pkg/utils"
 	"github.com/urfave/cli/v2"
-	"libvirt.org/go/libvirt"
 )
 
 const LIST_LIBVIRT_DOMAIN_COMMAND = types.InternalCommandName("list Libvirt domains command")
 
-type DomainMetadata struct {
-	Name  string
-	UUID  string
-	State string
-}
-
-func NewDomainMetadata(domain libvirt.Domain) (*DomainMetadata, error) {
-	domainName, err := domain.GetName()
-	if err != nil {
-		return nil, fmt.Errorf("fail to get name of domain: %v", err)
-	}
-
-	domainUuid, err := domain.GetUUIDString()
-	if err != nil {
-		return nil, fmt.Errorf("fail to get uuid of domain %v: %v", domainName, err)
+func formatLabels(labels map[string]string) string {
+	keys := []string{}
+	for key := range labels {
+		keys = append(keys, key)
 	}
-
-	domainState, reason, err := domain.GetState()
-	if err != nil {
-		return nil, fmt.Errorf("fail to get name of domain %v: %v (%v)", domainName, err, reason)
+	sort.Strings(keys)
+	pairs := []string{}
+	for _, key := range keys {
+		pairs = append(pairs, fmt.Sprintf("%v=%v", key, labels[key]))
 	}
+	return strings.Join(pairs, ",")
+}
 
-	metadata := &DomainMetadata{
-		Name: domainName,
-		UUID: domainUuid,
-	}
-	switch domainState {
-	case libvirt.DOMAIN_RUNNING:
-		metadata.State = "running"
-	case libvirt.DOMAIN_SHUTOFF:
-		metadata.State = "shutoff"
-	case libvirt.DOMAIN_SHUTDOWN:
-		metadata.State = "shutdown"
-	case libvirt.DOMAIN_CRASHED:
-		metadata.State = "crashed"
-	case libvirt.DOMAIN_NOSTATE:
-		metadata.State = "nostate"
-	case libvirt.DOMAIN_PAUSED:
-		metadata.State = "paused"
-	default:
-		metadata.State = fmt.Sprintf("other (code=%v)", domainState)
+func NewDomainTable(summaries []contract.DomainSummary) *output.Table {
+	table := output.NewTable(
+		output.Column{Name: "NAME"},
+		output.Column{Name: "STATE"},
+		output.Column{Name: "VCPUS"},
+		output.Column{Name: "MEMORY"},
+		output.Column{Name: "IP"},
+		output.Column{Name: "FLEET"},
+		output.Column{Name: "UUID", IsWide: true},
+		output.Column{Name: "LABELS", IsWide: true},
+		output.Column{Name: "BASE VM", IsWide: true},
+		output.Column{Name: "CREATED", IsWide: true},
+	)
+	for _, summary := range summaries {
+		metadata := contract.HarmoniaDomainMetadata{}
+		if summary.Harmonia != nil {
+			metadata = *summary.Harmonia
+		}
+		table.AddRow(
+			summary.Name,
+			summary.State,
+			summary.NumOfVCPUs,
+			output.FormatBytes(float64(summary.MemoryInKiB*1024)),
+			strings.Join(summary.IPv4Addresses, ","),
+			metadata.Fleet,
+			summary.UUID,
+			formatLabels(metadata.Labels),
+			metadata.BaseVM,
+			metadata.CreatedAt,
+		)
 	}
-	return metadata, nil
+	return table
 }
 
-func (metadata *DomainMetadata) ToString(pos int) string {
-	buf := bytes.NewBufferString("")
-	if pos > -1 {
-		fmt.Fprintf(buf, "%v)	name: %v \n", pos, metadata.Name)
-	} else {
-		fmt.Fprintf(buf, "		name: %v \n", metadata.Name)
+// parses repeated --label key=value flags
+func ParseLabels(rawLabels []string) (map[string]string, error) {
+	labels := map[string]string{}
+	for _, rawLabel := range rawLabels {
+		key, value, found := strings.Cut(rawLabel, "=")
+		if !found || key == "" {
+			return nil, fmt.Errorf("invalid label '%v', expected key=value", rawLabel)
+		}
+		labels[key] = value
 	}
-	fmt.Fprintf(buf, "	uuid: %v\n", metadata.UUID)
-	fmt.Fprintf(buf, "	state: %v\n", metadata.State)
-	return buf.String()
+	return labels, nil
 }
 
 type ListLibvirtDomainsCommand struct {
-	isListAll bool
+	isListAll      bool
+	isHarmoniaOnly bool
+	fleet          string
+	labels         cli.StringSlice
 }
 
 func (command *ListLibvirtDomainsCommand) Description() string {
@@ -90,6 +99,21 @@ func (command *ListLibvirtDomainsCommand) Flags() []cli.Flag {
 			Usage:       "This will include inactive domains as well.",
 			Destination: &command.isListAll,
 		},
+		&cli.BoolFlag{
+			Name:        "harmonia-only",
+			Usage:       "Only list domains created by harmonia.",
+			Destination: &command.isHarmoniaOnly,
+		},
+		&cli.StringFlag{
+			Name:        "fleet",
+			Usage:       "Only list domains of this fleet.",
+			Destination: &command.fleet,
+		},
+		&cli.StringSliceFlag{
+			Name:        "label",
+			Usage:       "Only list domains having this label (key=value), can be repeated.",
+			Destination: &command.labels,
+		},
 	}
 }
 
@@ -99,6 +123,29 @@ func (command *ListLibvirtDomainsCommand) Subcommands() []*cli.Command {
 
 func (command *ListLibvirtDomainsCommand) Handler() func(ctx *cli.Context) error {
 	return func(ctx *cli.Context) error {
+		if err := clientcontext.DefaultFleet(ctx, &command.fleet); err != nil {
+			return err
+		}
+
+		labels, err := ParseLabels(command.labels.Value())
+		if err != nil {
+			return err
+		}
+		selector := contract.DomainSelector{
+			HarmoniaOnly: command.isHarmoniaOnly,
+			Fleet:        command.fleet,
+			Labels:       labels,
+		}
+
+		if apiClient, hypervisor, ok := RemoteClient(ctx); ok {
+			request := contract.ListDomainsRequest{IncludeInactive: command.isListAll, Selector: selector, Hypervisor: hypervisor}
+			result, err := apiClient.ListVirtualMachines(ctx.Context, request)
+			if err != nil {
+				return fmt.Errorf("could not list domains: %v", err)
+			}
+			return output.Render(ctx, result, NewDomainTable(result.Domains))
+		}
+
 		libvirtInternalConnection, ok := ctx.Context.Value(LIBVIRT_INTERNAL_CONNECTION_CTX_KEY).(*connection.Libvirt)
 		if !ok {
 			return fmt.Errorf("could not retrieve Libvirt internal connection from context")
@@ -109,22 +156,12 @@ func (command *ListLibvirtDomainsCommand) Handler() func(ctx *cli.Context) error
 			return err
 		}
 		defer libvirtService.Cleanup()
-		domains, err := libvirtService.ListDomains(command.isListAll)
 
+		summaries, err := libvirtService.ListDomainSummaries(command.isListAll, selector)
 		if err != nil {
 			return fmt.Errorf("could not list domains: %v", err)
 		}
-		fmt.Println("List of domains:")
-		for i, domain := range domains {
-			metadata, err := NewDomainMetadata(domain)
-			if err != nil {
-				fmt.Println("can't fetch metadata of domain -> ", err)
-				continue
-			}
-			fmt.Println(metadata.ToString(i + 1))
-		}
-
-		return nil
+		return output.Render(ctx, contract.ListDomainsResult{Domains: summaries}, NewDomainTable(summaries))
 	}
 }
 
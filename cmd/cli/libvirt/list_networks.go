@@ -0,0 +1,87 @@
+package libvirt
+
+import (
+	"fmt"
+
+	"github.com/nnurry/harmonia/internal/connection"
+	"github.com/nnurry/harmonia/internal/contract"
+	"github.com/nnurry/harmonia/internal/service"
+	"github.com/nnurry/harmonia/pkg/output"
+	"github.com/nnurry/harmonia/pkg/utils"
+	"github.com/urfave/cli/v2"
+)
+
+func NewNetworkTable(networks []contract.VirtualNetworkSummary) *output.Table {
+	table := output.NewTable(
+		output.Column{Name: "NAME"},
+		output.Column{Name: "ACTIVE"},
+		output.Column{Name: "AUTOSTART"},
+		output.Column{Name: "BRIDGE"},
+		output.Column{Name: "UUID", IsWide: true},
+	)
+	for _, network := range networks {
+		table.AddRow(network.Name, network.IsActive, network.Autostart, network.BridgeName, network.UUID)
+	}
+	return table
+}
+
+type ListLibvirtNetworksCommand struct {
+	isListAll bool
+}
+
+func (command *ListLibvirtNetworksCommand) Description() string {
+	return "List networks in Libvirt"
+}
+
+func (command *ListLibvirtNetworksCommand) Signature() string {
+	return "list-networks"
+}
+
+func (command *ListLibvirtNetworksCommand) Flags() []cli.Flag {
+	return []cli.Flag{
+		&cli.BoolFlag{
+			Name:        "all",
+			Usage:       "This will include inactive networks as well.",
+			Destination: &command.isListAll,
+		},
+	}
+}
+
+func (command *ListLibvirtNetworksCommand) Subcommands() []*cli.Command {
+	return []*cli.Command{}
+}
+
+func (command *ListLibvirtNetworksCommand) Handler() func(ctx *cli.Context) error {
+	return func(ctx *cli.Context) error {
+		if _, _, ok := RemoteClient(ctx); ok {
+			return errNotRemote(command.Signature())
+		}
+
+		libvirtInternalConnection, ok := ctx.Context.Value(LIBVIRT_INTERNAL_CONNECTION_CTX_KEY).(*connection.Libvirt)
+		if !ok {
+			return fmt.Errorf("could not retrieve Libvirt internal connection from context")
+		}
+
+		libvirtService, err := service.NewLibvirt(libvirtInternalConnection)
+		if err != nil {
+			return err
+		}
+
+		virtualNetworkService, err := service.NewVirtualNetwork(libvirtService)
+		if err != nil {
+			return err
+		}
+		defer virtualNetworkService.Cleanup()
+
+		networks, err := virtualNetworkService.List(command.isListAll)
+		if err != nil {
+			return fmt.Errorf("could not list networks: %v", err)
+		}
+
+		return output.Render(ctx, contract.ListVirtualNetworksResult{Networks: networks}, NewNetworkTable(networks))
+	}
+}
+
+func (command *ListLibvirtNetworksCommand) Build() *cli.Command {
+	return utils.ConvertInternalCommandToCliCommand(command)
+}
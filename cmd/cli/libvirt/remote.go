@@ -0,0 +1,28 @@
+package libvirt
+
+import (
+	"fmt"
+
+	"github.com/nnurry/harmonia/cmd/cli/clientcontext"
+	"github.com/nnurry/harmonia/pkg/client"
+	"github.com/nnurry/harmonia/pkg/types"
+	"github.com/urfave/cli/v2"
+)
+
+const (
+	REMOTE_HYPERVISOR_CTX_KEY = types.InternalCommandCtxKey("remoteHypervisor")
+)
+
+// the API client and the hypervisor to ask for when running against an API server
+func RemoteClient(ctx *cli.Context) (*client.Client, string, bool) {
+	apiClient, ok := clientcontext.APIClientFromContext(ctx)
+	if !ok {
+		return nil, "", false
+	}
+	hypervisor, _ := ctx.Context.Value(REMOTE_HYPERVISOR_CTX_KEY).(string)
+	return apiClient, hypervisor, true
+}
+
+func errNotRemote(signature string) error {
+	return fmt.Errorf("%v needs a direct Libvirt connection, it is not available against an API server", signature)
+}
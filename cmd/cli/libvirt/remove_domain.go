@@ -4,12 +4,14 @@ import (
 	"fmt"
 
 	"github.com/nnurry/harmonia/internal/connection"
+	"github.com/nnurry/harmonia/internal/contract"
 	"github.com/nnurry/harmonia/internal/service"
 	"github.com/nnurry/harmonia/pkg/utils"
 	"github.com/urfave/cli/v2"
 )
 
 type RemoveLibvirtDomainCommand struct {
+	isPurge bool
 }
 
 func (command *RemoveLibvirtDomainCommand) Description() string {
@@ -21,7 +23,13 @@ func (command *RemoveLibvirtDomainCommand) Signature() string {
 }
 
 func (command *RemoveLibvirtDomainCommand) Flags() []cli.Flag {
-	return []cli.Flag{}
+	return []cli.Flag{
+		&cli.BoolFlag{
+			Name:        "purge",
+			Usage:       "Through the API server, delete the VM as a whole, disks and record included. Required there since the API can't only undefine a domain.",
+			Destination: &command.isPurge,
+		},
+	}
 }
 
 func (command *RemoveLibvirtDomainCommand) Subcommands() []*cli.Command {
@@ -39,6 +47,20 @@ func (command *RemoveLibvirtDomainCommand) Handler() func(ctx *cli.Context) erro
 			return fmt.Errorf("<domain name> is empty")
 		}
 
+		// the API deletes harmonia VMs as a whole, disks and records included
+		if apiClient, hypervisor, ok := RemoteClient(ctx); ok {
+			if !command.isPurge {
+				return fmt.Errorf("through the API server %v would be deleted with its disks and record, pass --purge to do so", domainName)
+			}
+			request := contract.DeleteVirtualMachineRequest{}
+			request.Name, request.Hypervisor = domainName, hypervisor
+			result, err := apiClient.DeleteVirtualMachine(ctx.Context, request)
+			if err != nil {
+				return fmt.Errorf("could not remove domain %v: %v", domainName, err)
+			}
+			return renderActionResult(ctx, ActionResult{Kind: "domain", Name: domainName, UUID: result.UUID, Action: "removed"})
+		}
+
 		libvirtInternalConnection, ok := ctx.Context.Value(LIBVIRT_INTERNAL_CONNECTION_CTX_KEY).(*connection.Libvirt)
 		if !ok {
 			return fmt.Errorf("could not retrieve Libvirt internal connection from context")
@@ -55,7 +77,7 @@ func (command *RemoveLibvirtDomainCommand) Handler() func(ctx *cli.Context) erro
 			return fmt.Errorf("could not remove domain %v: %v", domainName, err)
 		}
 
-		return nil
+		return renderActionResult(ctx, ActionResult{Kind: "domain", Name: domainName, Action: "removed"})
 	}
 }
 
@@ -0,0 +1,68 @@
+package libvirt
+
+import (
+	"fmt"
+
+	"github.com/nnurry/harmonia/internal/connection"
+	"github.com/nnurry/harmonia/internal/service"
+	"github.com/nnurry/harmonia/pkg/utils"
+	"github.com/urfave/cli/v2"
+)
+
+type RemoveLibvirtNetworkCommand struct {
+}
+
+func (command *RemoveLibvirtNetworkCommand) Description() string {
+	return "Stop and remove a network in Libvirt"
+}
+
+func (command *RemoveLibvirtNetworkCommand) Signature() string {
+	return "remove-network"
+}
+
+func (command *RemoveLibvirtNetworkCommand) Flags() []cli.Flag {
+	return []cli.Flag{}
+}
+
+func (command *RemoveLibvirtNetworkCommand) Subcommands() []*cli.Command {
+	return []*cli.Command{}
+}
+
+func (command *RemoveLibvirtNetworkCommand) Handler() func(ctx *cli.Context) error {
+	return func(ctx *cli.Context) error {
+		if _, _, ok := RemoteClient(ctx); ok {
+			return errNotRemote(command.Signature())
+		}
+
+		if ctx.NArg() < 1 {
+			return fmt.Errorf("missing <network name>")
+		}
+
+		networkName := ctx.Args().First()
+		if networkName == "" {
+			return fmt.Errorf("<network name> is empty")
+		}
+
+		libvirtInternalConnection, ok := ctx.Context.Value(LIBVIRT_INTERNAL_CONNECTION_CTX_KEY).(*connection.Libvirt)
+		if !ok {
+			return fmt.Errorf("could not retrieve Libvirt internal connection from context")
+		}
+
+		libvirtService, err := service.NewLibvirt(libvirtInternalConnection)
+		if err != nil {
+			return err
+		}
+		defer libvirtService.Cleanup()
+
+		err = libvirtService.RemoveNetworkByName(networkName)
+		if err != nil {
+			return fmt.Errorf("could not remove network %v: %v", networkName, err)
+		}
+
+		return renderActionResult(ctx, ActionResult{Kind: "network", Name: networkName, Action: "removed"})
+	}
+}
+
+func (command *RemoveLibvirtNetworkCommand) Build() *cli.Command {
+	return utils.ConvertInternalCommandToCliCommand(command)
+}
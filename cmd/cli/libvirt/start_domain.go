@@ -4,6 +4,7 @@ import (
 	"fmt"
 
 	"github.com/nnurry/harmonia/internal/connection"
+	"github.com/nnurry/harmonia/internal/contract"
 	"github.com/nnurry/harmonia/internal/service"
 	"github.com/nnurry/harmonia/pkg/utils"
 	"github.com/urfave/cli/v2"
@@ -39,6 +40,14 @@ func (command *StartLibvirtDomainCommand) Handler() func(ctx *cli.Context) error
 			return fmt.Errorf("<domain name> is empty")
 		}
 
+		if apiClient, hypervisor, ok := RemoteClient(ctx); ok {
+			request := contract.VirtualMachinePowerRequest{Name: domainName, Hypervisor: hypervisor}
+			if _, err := apiClient.StartVirtualMachine(ctx.Context, request); err != nil {
+				return fmt.Errorf("could not start domain %v: %v", domainName, err)
+			}
+			return renderActionResult(ctx, ActionResult{Kind: "domain", Name: domainName, Action: "started"})
+		}
+
 		libvirtInternalConnection, ok := ctx.Context.Value(LIBVIRT_INTERNAL_CONNECTION_CTX_KEY).(*connection.Libvirt)
 		if !ok {
 			return fmt.Errorf("could not retrieve Libvirt internal connection from context")
@@ -55,7 +64,7 @@ func (command *StartLibvirtDomainCommand) Handler() func(ctx *cli.Context) error
 			return fmt.Errorf("could not start domain %v: %v", domainName, err)
 		}
 
-		return nil
+		return renderActionResult(ctx, ActionResult{Kind: "domain", Name: domainName, Action: "started"})
 	}
 }
 
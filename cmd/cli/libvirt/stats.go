@@ -0,0 +1,303 @@
+package libvirt
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/nnurry/harmonia/cmd/cli/clientcontext"
+	"github.com/nnurry/harmonia/internal/connection"
+	"github.com/nnurry/harmonia/internal/contract"
+	"github.com/nnurry/harmonia/internal/logger"
+	"github.com/nnurry/harmonia/internal/service"
+	"github.com/nnurry/harmonia/pkg/client"
+	"github.com/nnurry/harmonia/pkg/output"
+	"github.com/nnurry/harmonia/pkg/types"
+	"github.com/nnurry/harmonia/pkg/utils"
+	"github.com/urfave/cli/v2"
+	"libvirt.org/go/libvirt"
+)
+
+const STATS_LIBVIRT_DOMAIN_COMMAND = types.InternalCommandName("show Libvirt domain stats command")
+
+func NewDomainStatsTable(allStats []contract.DomainStats) *output.Table {
+	table := output.NewTable(
+		output.Column{Name: "NAME"},
+		output.Column{Name: "FLEET"},
+		output.Column{Name: "STATE"},
+		output.Column{Name: "VCPUS"},
+		output.Column{Name: "CPU%"},
+		output.Column{Name: "MEMORY"},
+		output.Column{Name: "READ/s"},
+		output.Column{Name: "WRITE/s"},
+		output.Column{Name: "IOPS"},
+		output.Column{Name: "RX/s"},
+		output.Column{Name: "TX/s"},
+		output.Column{Name: "DISKS", IsWide: true},
+		output.Column{Name: "INTERFACES", IsWide: true},
+	)
+	for _, stats := range allStats {
+		disks := []string{}
+		for _, disk := range stats.Disks {
+			disks = append(disks, fmt.Sprintf(
+				"%v r=%v/s w=%v/s %.0f iops",
+				disk.Name, output.FormatBytes(disk.ReadBytesPerSecond), output.FormatBytes(disk.WriteBytesPerSecond), disk.ReadIOPS+disk.WriteIOPS,
+			))
+		}
+		interfaces := []string{}
+		for _, networkInterface := range stats.Interfaces {
+			interfaces = append(interfaces, fmt.Sprintf(
+				"%v rx=%v/s tx=%v/s",
+				networkInterface.Name, output.FormatBytes(networkInterface.RxBytesPerSecond), output.FormatBytes(networkInterface.TxBytesPerSecond),
+			))
+		}
+
+		table.AddRow(
+			stats.Name, stats.Fleet, stats.State, stats.VCPUs,
+			fmt.Sprintf("%.1f", stats.CPUUtilisationPercent),
+			output.FormatBytes(float64(stats.MemoryCurrentKiB*1024)),
+			output.FormatBytes(stats.ReadBytesPerSecond), output.FormatBytes(stats.WriteBytesPerSecond),
+			fmt.Sprintf("%.0f", stats.IOPS),
+			output.FormatBytes(stats.RxBytesPerSecond), output.FormatBytes(stats.TxBytesPerSecond),
+			strings.Join(disks, "; "), strings.Join(interfaces, "; "),
+		)
+	}
+	return table
+}
+
+func NewFleetStatsTable(fleets []contract.FleetStats) *output.Table {
+	table := output.NewTable(
+		output.Column{Name: "FLEET"},
+		output.Column{Name: "DOMAINS"},
+		output.Column{Name: "VCPUS"},
+		output.Column{Name: "CPU CORES"},
+		output.Column{Name: "MEMORY"},
+		output.Column{Name: "READ/s"},
+		output.Column{Name: "WRITE/s"},
+		output.Column{Name: "IOPS"},
+		output.Column{Name: "RX/s"},
+		output.Column{Name: "TX/s"},
+		output.Column{Name: "BUSIEST"},
+	)
+	for _, fleet := range fleets {
+		table.AddRow(
+			fleet.Fleet, fleet.Domains, fleet.VCPUs,
+			fmt.Sprintf("%.2f", fleet.CPUCoresUsed),
+			output.FormatBytes(float64(fleet.MemoryCurrentKiB*1024)),
+			output.FormatBytes(fleet.ReadBytesPerSecond), output.FormatBytes(fleet.WriteBytesPerSecond),
+			fmt.Sprintf("%.0f", fleet.IOPS),
+			output.FormatBytes(fleet.RxBytesPerSecond), output.FormatBytes(fleet.TxBytesPerSecond),
+			fleet.BusiestDomain,
+		)
+	}
+	return table
+}
+
+// domains first, then the fleet totals below them
+func writeDomainStats(format output.Format, allStats []contract.DomainStats) error {
+	result := contract.VirtualMachineStatsResult{
+		Domains: allStats,
+		Fleets:  service.AggregateFleetStats(allStats),
+	}
+	if !format.IsTable() {
+		return output.Write(os.Stdout, format, result, nil)
+	}
+
+	if err := output.Write(os.Stdout, format, result, NewDomainStatsTable(result.Domains)); err != nil {
+		return err
+	}
+	if len(result.Fleets) == 0 {
+		return nil
+	}
+	fmt.Println()
+	return output.Write(os.Stdout, format, result, NewFleetStatsTable(result.Fleets))
+}
+
+type StatsLibvirtDomainCommand struct {
+	interval time.Duration
+	fleet    string
+	isWatch  bool
+}
+
+func (command *StatsLibvirtDomainCommand) Description() string {
+	return "Show CPU, memory, disk and network usage of domains, all of them if no name is given"
+}
+
+func (command *StatsLibvirtDomainCommand) Signature() string {
+	return "stats"
+}
+
+func (command *StatsLibvirtDomainCommand) Flags() []cli.Flag {
+	return []cli.Flag{
+		&cli.DurationFlag{
+			Name:        "interval",
+			Value:       2 * time.Second,
+			Usage:       "Time between the samples rates are computed from",
+			Destination: &command.interval,
+		},
+		&cli.StringFlag{
+			Name:        "fleet",
+			Usage:       "Only show domains of this fleet.",
+			Destination: &command.fleet,
+		},
+		&cli.BoolFlag{
+			Name:        "watch",
+			Aliases:     []string{"w"},
+			Usage:       "Keep printing stats every interval",
+			Destination: &command.isWatch,
+		},
+	}
+}
+
+func (command *StatsLibvirtDomainCommand) Subcommands() []*cli.Command {
+	return []*cli.Command{}
+}
+
+// the server samples over the interval, so every round takes one interval as well
+func (command *StatsLibvirtDomainCommand) remoteHandler(ctx *cli.Context, apiClient *client.Client, hypervisor string, format output.Format) error {
+	watchCtx, stop := signal.NotifyContext(ctx.Context, syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	for {
+		allStats, err := command.fetchRemoteStats(watchCtx, ctx.Args().Slice(), apiClient, hypervisor)
+		// interrupted while waiting for the server
+		if watchCtx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if command.isWatch && format.IsTable() {
+			fmt.Print("\033[H\033[2J")
+			fmt.Printf("every %v, %v\n\n", command.interval, time.Now().Format(time.TimeOnly))
+		}
+		if err = writeDomainStats(format, allStats); err != nil {
+			return err
+		}
+
+		if !command.isWatch {
+			return nil
+		}
+	}
+}
+
+func (command *StatsLibvirtDomainCommand) fetchRemoteStats(ctx context.Context, domainNames []string, apiClient *client.Client, hypervisor string) ([]contract.DomainStats, error) {
+	if len(domainNames) == 0 {
+		result, err := apiClient.ListVirtualMachineStats(ctx, hypervisor, command.fleet, command.interval)
+		if err != nil {
+			return nil, fmt.Errorf("could not get stats: %v", err)
+		}
+		for name, errMessage := range result.Errors {
+			logger.Warnf("could not get stats of hypervisor %v: %v", name, errMessage)
+		}
+		return result.Domains, nil
+	}
+
+	allStats := []contract.DomainStats{}
+	for _, domainName := range domainNames {
+		stats, err := apiClient.VirtualMachineStats(ctx, domainName, hypervisor, command.interval)
+		if err != nil {
+			return nil, fmt.Errorf("could not get stats of domain %v: %v", domainName, err)
+		}
+		allStats = append(allStats, stats)
+	}
+	return allStats, nil
+}
+
+func (command *StatsLibvirtDomainCommand) Handler() func(ctx *cli.Context) error {
+	return func(ctx *cli.Context) error {
+		format, err := output.FromContext(ctx)
+		if err != nil {
+			return err
+		}
+
+		if command.interval <= 0 {
+			command.interval = service.DEFAULT_STATS_INTERVAL
+		}
+
+		// domains named on the command line are shown whatever their fleet
+		if !ctx.Args().Present() {
+			if err = clientcontext.DefaultFleet(ctx, &command.fleet); err != nil {
+				return err
+			}
+		}
+
+		if apiClient, hypervisor, ok := RemoteClient(ctx); ok {
+			return command.remoteHandler(ctx, apiClient, hypervisor, format)
+		}
+
+		libvirtInternalConnection, ok := ctx.Context.Value(LIBVIRT_INTERNAL_CONNECTION_CTX_KEY).(*connection.Libvirt)
+		if !ok {
+			return fmt.Errorf("could not retrieve Libvirt internal connection from context")
+		}
+
+		libvirtService, err := service.NewLibvirt(libvirtInternalConnection)
+		if err != nil {
+			return err
+		}
+		defer libvirtService.Cleanup()
+
+		domains := []*libvirt.Domain{}
+		for _, domainName := range ctx.Args().Slice() {
+			domain, err := libvirtService.GetDomainByName(domainName)
+			if err != nil {
+				return fmt.Errorf("could not find domain %v: %v", domainName, err)
+			}
+			defer domain.Free()
+			domains = append(domains, domain)
+		}
+
+		watchCtx, stop := signal.NotifyContext(ctx.Context, syscall.SIGINT, syscall.SIGTERM)
+		defer stop()
+
+		previous, err := libvirtService.GetDomainStats(domains...)
+		if err != nil {
+			return err
+		}
+
+		ticker := time.NewTicker(command.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-watchCtx.Done():
+				return nil
+			case <-ticker.C:
+			}
+
+			current, err := libvirtService.GetDomainStats(domains...)
+			if err != nil {
+				return err
+			}
+
+			allStats := []contract.DomainStats{}
+			for _, stats := range service.ComputeAllDomainStats(previous, current) {
+				if command.fleet == "" || stats.Fleet == command.fleet {
+					allStats = append(allStats, stats)
+				}
+			}
+			previous = current
+
+			if command.isWatch && format.IsTable() {
+				// clear the screen like watch(1)
+				fmt.Print("\033[H\033[2J")
+				fmt.Printf("every %v, %v\n\n", command.interval, time.Now().Format(time.TimeOnly))
+			}
+			if err = writeDomainStats(format, allStats); err != nil {
+				return err
+			}
+
+			if !command.isWatch {
+				return nil
+			}
+		}
+	}
+}
+
+func (command *StatsLibvirtDomainCommand) Build() *cli.Command {
+	return utils.ConvertInternalCommandToCliCommand(command)
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/nnurry/harmonia/cmd/cli/clientcontext"
 	"github.com/nnurry/harmonia/internal/connection"
 	"github.com/nnurry/harmonia/internal/logger"
 	"github.com/nnurry/harmonia/internal/processor"
@@ -69,12 +70,50 @@ func (command *ShellCommand) Subcommands() []*cli.Command {
 	return []*cli.Command{}
 }
 
+// settings of the client context fill in flags that were not given
+func (command *ShellCommand) applyClientContext(ctx *cli.Context) error {
+	clientContext, err := clientcontext.Resolve(ctx)
+	if err != nil {
+		return err
+	}
+	hypervisorConnection := clientContext.HypervisorConnection
+	sshConfig := hypervisorConnection.SSHConfig
+
+	if !ctx.IsSet("local") && hypervisorConnection.IsLocalShell {
+		command.isLocal = true
+	}
+
+	stringSettings := map[string][2]*string{
+		"user":             {&command.config.User, &sshConfig.User},
+		"host":             {&command.config.Host, &sshConfig.Host},
+		"ssh-password":     {&command.config.PasswordAuth.Password, &sshConfig.PasswordAuth.Password},
+		"ssh-privkey-path": {&command.config.PrivateKeyAuth.PrivateKeyPath, &sshConfig.PrivateKeyAuth.PrivateKeyPath},
+		"ssh-passphrase":   {&command.config.PrivateKeyAuth.Passphrase, &sshConfig.PrivateKeyAuth.Passphrase},
+	}
+	for flagName, setting := range stringSettings {
+		if !ctx.IsSet(flagName) && *setting[1] != "" {
+			*setting[0] = *setting[1]
+		}
+	}
+	if !ctx.IsSet("port") && sshConfig.Port != 0 {
+		command.config.Port = sshConfig.Port
+	}
+	if sshConfig.HostKeyCallbackName != "" {
+		command.config.HostKeyCallbackName = sshConfig.HostKeyCallbackName
+	}
+	return nil
+}
+
 func (command *ShellCommand) Handler() func(ctx *cli.Context) error {
 	return func(ctx *cli.Context) error {
 		if !ctx.Args().Present() {
 			return fmt.Errorf("no entrypoint")
 		}
 
+		if err := command.applyClientContext(ctx); err != nil {
+			return err
+		}
+
 		var shellProcessor ShellProcessor
 
 		if command.isLocal {
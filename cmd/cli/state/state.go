@@ -0,0 +1,85 @@
+package state
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	"github.com/nnurry/harmonia/cmd/cli/clientcontext"
+	"github.com/nnurry/harmonia/internal/store"
+	"github.com/nnurry/harmonia/pkg/types"
+	"github.com/nnurry/harmonia/pkg/utils"
+	"github.com/urfave/cli/v2"
+)
+
+const (
+	STATE_COMMAND = types.InternalCommandName("State command")
+)
+
+const (
+	STATE_STORE_CTX_KEY = types.InternalCommandCtxKey("stateStore")
+)
+
+type StateCommand struct {
+	statePath string
+}
+
+func (command *StateCommand) Description() string {
+	return "Query records of resources created by Harmonia"
+}
+
+func (command *StateCommand) Signature() string {
+	return "state"
+}
+
+func (command *StateCommand) Flags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:        "state-path",
+			Value:       store.DEFAULT_STATE_PATH,
+			Usage:       "Path to state store file",
+			Destination: &command.statePath,
+		},
+	}
+}
+
+func (command *StateCommand) Subcommands() []*cli.Command {
+	return []*cli.Command{
+		(&ListVirtualMachineRecordsCommand{}).Build(),
+		(&GetVirtualMachineRecordCommand{}).Build(),
+	}
+}
+
+func (command *StateCommand) Handler() func(ctx *cli.Context) error {
+	return func(ctx *cli.Context) error {
+		buf := bytes.NewBufferString("")
+		for _, subcmd := range ctx.Command.Subcommands {
+			fmt.Fprintf(buf, "- %v\n", subcmd.Name)
+		}
+		return fmt.Errorf("use subcommands instead:\n%v", buf.String())
+	}
+}
+
+func (command *StateCommand) Build() *cli.Command {
+	cliCommand := utils.ConvertInternalCommandToCliCommand(command)
+	cliCommand.Before = func(ctx *cli.Context) error {
+		apiClient, _, err := clientcontext.NewAPIClient(ctx)
+		if err != nil {
+			return err
+		}
+		if apiClient != nil {
+			ctx.Context = context.WithValue(ctx.Context, clientcontext.API_CLIENT_CTX_KEY, apiClient)
+			return nil
+		}
+
+		stateStore, err := store.New(command.statePath)
+		if err != nil {
+			return fmt.Errorf("could not open state store: %v", err)
+		}
+
+		ctx.Context = context.WithValue(ctx.Context, STATE_STORE_CTX_KEY, stateStore)
+		return nil
+	}
+
+	return cliCommand
+}
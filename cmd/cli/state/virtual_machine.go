@@ -0,0 +1,163 @@
+package state
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/nnurry/harmonia/cmd/cli/clientcontext"
+	"github.com/nnurry/harmonia/internal/contract"
+	"github.com/nnurry/harmonia/internal/store"
+	"github.com/nnurry/harmonia/pkg/output"
+	"github.com/nnurry/harmonia/pkg/utils"
+	"github.com/urfave/cli/v2"
+)
+
+func renderRecords(ctx *cli.Context, records []contract.VirtualMachineRecord) error {
+	table := output.NewTable(
+		output.Column{Name: "NAME"},
+		output.Column{Name: "FLEET"},
+		output.Column{Name: "HYPERVISOR"},
+		output.Column{Name: "VCPUS"},
+		output.Column{Name: "MEMORY"},
+		output.Column{Name: "IP"},
+		output.Column{Name: "UUID", IsWide: true},
+		output.Column{Name: "CONNECTION URL", IsWide: true},
+		output.Column{Name: "CREATED", IsWide: true},
+	)
+	for _, record := range records {
+		table.AddRow(
+			record.Name,
+			record.Fleet,
+			record.Hypervisor,
+			record.Config.GeneralVMConfig.NumOfVCPUs,
+			output.FormatBytes(record.Config.GeneralVMConfig.MemoryInGiB*1024*1024*1024),
+			strings.Join(record.IPv4Addresses, ","),
+			record.UUID,
+			record.ConnectionUrl,
+			record.CreatedAt.Format(time.RFC3339),
+		)
+	}
+	return output.Render(ctx, contract.ListVirtualMachineRecordsResult{Records: records}, table)
+}
+
+// from the API server when there is one, the local state store otherwise
+func listRecords(ctx *cli.Context, filter contract.VirtualMachineRecordFilter) ([]contract.VirtualMachineRecord, error) {
+	if apiClient, ok := clientcontext.APIClientFromContext(ctx); ok {
+		result, err := apiClient.ListVirtualMachineRecords(ctx.Context, filter)
+		return result.Records, err
+	}
+
+	stateStore, ok := ctx.Context.Value(STATE_STORE_CTX_KEY).(*store.Store)
+	if !ok {
+		return nil, fmt.Errorf("could not retrieve state store from context")
+	}
+	return stateStore.ListVirtualMachines(filter)
+}
+
+type ListVirtualMachineRecordsCommand struct {
+	filter contract.VirtualMachineRecordFilter
+}
+
+func (command *ListVirtualMachineRecordsCommand) Description() string {
+	return "List recorded virtual machines"
+}
+
+func (command *ListVirtualMachineRecordsCommand) Signature() string {
+	return "list-vms"
+}
+
+func (command *ListVirtualMachineRecordsCommand) Flags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:        "fleet",
+			Usage:       "Only show VMs of this fleet",
+			Destination: &command.filter.Fleet,
+		},
+		&cli.StringFlag{
+			Name:        "hypervisor",
+			Usage:       "Only show VMs on this hypervisor (name or Libvirt connection URL)",
+			Destination: &command.filter.Hypervisor,
+		},
+	}
+}
+
+func (command *ListVirtualMachineRecordsCommand) Subcommands() []*cli.Command {
+	return []*cli.Command{}
+}
+
+func (command *ListVirtualMachineRecordsCommand) Handler() func(ctx *cli.Context) error {
+	return func(ctx *cli.Context) error {
+		if err := clientcontext.DefaultFleet(ctx, &command.filter.Fleet); err != nil {
+			return err
+		}
+
+		records, err := listRecords(ctx, command.filter)
+		if err != nil {
+			return fmt.Errorf("could not list records: %v", err)
+		}
+
+		return renderRecords(ctx, records)
+	}
+}
+
+func (command *ListVirtualMachineRecordsCommand) Build() *cli.Command {
+	return utils.ConvertInternalCommandToCliCommand(command)
+}
+
+type GetVirtualMachineRecordCommand struct {
+	hypervisor string
+}
+
+func (command *GetVirtualMachineRecordCommand) Description() string {
+	return "Show records of a virtual machine"
+}
+
+func (command *GetVirtualMachineRecordCommand) Signature() string {
+	return "get-vm"
+}
+
+func (command *GetVirtualMachineRecordCommand) Flags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:        "hypervisor",
+			Usage:       "Only show the VM on this hypervisor (name or Libvirt connection URL)",
+			Destination: &command.hypervisor,
+		},
+	}
+}
+
+func (command *GetVirtualMachineRecordCommand) Subcommands() []*cli.Command {
+	return []*cli.Command{}
+}
+
+func (command *GetVirtualMachineRecordCommand) Handler() func(ctx *cli.Context) error {
+	return func(ctx *cli.Context) error {
+		if ctx.NArg() < 1 {
+			return fmt.Errorf("missing <domain name>")
+		}
+
+		domainName := ctx.Args().First()
+		if domainName == "" {
+			return fmt.Errorf("<domain name> is empty")
+		}
+
+		records, err := listRecords(ctx, contract.VirtualMachineRecordFilter{
+			Name:       domainName,
+			Hypervisor: command.hypervisor,
+		})
+		if err != nil {
+			return fmt.Errorf("could not get records: %v", err)
+		}
+
+		if len(records) == 0 {
+			return fmt.Errorf("no record of %v", domainName)
+		}
+
+		return renderRecords(ctx, records)
+	}
+}
+
+func (command *GetVirtualMachineRecordCommand) Build() *cli.Command {
+	return utils.ConvertInternalCommandToCliCommand(command)
+}
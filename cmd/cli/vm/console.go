@@ -0,0 +1,125 @@
+package vm
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+
+	libvirtcmd "github.com/nnurry/harmonia/cmd/cli/libvirt"
+	"github.com/nnurry/harmonia/internal/console"
+	"github.com/nnurry/harmonia/pkg/utils"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/term"
+)
+
+// stdin and stdout as one stream, stdin ends at the escape byte
+type terminal struct {
+	isEscaped bool
+}
+
+func (terminal *terminal) Read(p []byte) (int, error) {
+	if terminal.isEscaped {
+		return 0, io.EOF
+	}
+
+	n, err := os.Stdin.Read(p)
+	if index := bytes.IndexByte(p[:n], console.ESCAPE_BYTE); index >= 0 {
+		terminal.isEscaped = true
+		return index, nil
+	}
+	return n, err
+}
+
+func (terminal *terminal) Write(p []byte) (int, error) {
+	return os.Stdout.Write(p)
+}
+
+// stdin stays open, a read blocked on it ends with the process
+func (terminal *terminal) Close() error {
+	return nil
+}
+
+type ConsoleVMCommand struct {
+	isForce bool
+}
+
+func (command *ConsoleVMCommand) Description() string {
+	return "Attach to the serial console of a running VM, " + console.ESCAPE_NAME + " detaches"
+}
+
+func (command *ConsoleVMCommand) Signature() string {
+	return "console"
+}
+
+func (command *ConsoleVMCommand) Flags() []cli.Flag {
+	return []cli.Flag{
+		&cli.BoolFlag{
+			Name:        "force",
+			Usage:       "Take the console over from whoever holds it",
+			Destination: &command.isForce,
+		},
+	}
+}
+
+func (command *ConsoleVMCommand) Subcommands() []*cli.Command {
+	return []*cli.Command{}
+}
+
+func (command *ConsoleVMCommand) openConsole(ctx *cli.Context, name string) (io.ReadWriteCloser, func(), error) {
+	if apiClient, hypervisor, ok := libvirtcmd.RemoteClient(ctx); ok {
+		domainConsole, err := apiClient.OpenConsole(ctx.Context, name, hypervisor, command.isForce)
+		return domainConsole, func() {}, err
+	}
+
+	libvirtService, err := newLibvirtService(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	domainConsole, err := libvirtService.OpenConsole(name, command.isForce)
+	if err != nil {
+		libvirtService.Cleanup()
+		return nil, nil, err
+	}
+	return domainConsole, func() { libvirtService.Cleanup() }, nil
+}
+
+func (command *ConsoleVMCommand) Handler() func(ctx *cli.Context) error {
+	return func(ctx *cli.Context) error {
+		name, err := vmName(ctx)
+		if err != nil {
+			return err
+		}
+
+		domainConsole, cleanup, err := command.openConsole(ctx, name)
+		if err != nil {
+			return fmt.Errorf("could not attach to console of %v: %v", name, err)
+		}
+		defer cleanup()
+
+		// raw mode hands every keystroke, Ctrl-C included, to the guest
+		stdinFd := int(os.Stdin.Fd())
+		if term.IsTerminal(stdinFd) {
+			oldState, err := term.MakeRaw(stdinFd)
+			if err != nil {
+				domainConsole.Close()
+				return fmt.Errorf("could not put terminal in raw mode: %v", err)
+			}
+			defer term.Restore(stdinFd, oldState)
+		}
+
+		fmt.Fprintf(os.Stderr, "Connected to %v, escape character is %v\r\n", name, console.ESCAPE_NAME)
+		err = console.Bridge(domainConsole, &terminal{})
+		fmt.Fprintf(os.Stderr, "\r\nDetached from %v\r\n", name)
+
+		if err != nil {
+			return fmt.Errorf("console of %v closed: %v", name, err)
+		}
+		return nil
+	}
+}
+
+func (command *ConsoleVMCommand) Build() *cli.Command {
+	return utils.ConvertInternalCommandToCliCommand(command)
+}
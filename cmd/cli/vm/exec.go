@@ -0,0 +1,128 @@
+package vm
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	libvirtcmd "github.com/nnurry/harmonia/cmd/cli/libvirt"
+	"github.com/nnurry/harmonia/internal/contract"
+	"github.com/nnurry/harmonia/internal/service"
+	"github.com/nnurry/harmonia/pkg/output"
+	"github.com/nnurry/harmonia/pkg/utils"
+	"github.com/urfave/cli/v2"
+)
+
+type ExecVMCommand struct {
+	timeout time.Duration
+	env     cli.StringSlice
+	isStdin bool
+}
+
+func (command *ExecVMCommand) Description() string {
+	return "Run a command in a running VM through its guest agent, e.g. exec web-1 /bin/sh -c 'uptime'"
+}
+
+func (command *ExecVMCommand) Signature() string {
+	return "exec"
+}
+
+func (command *ExecVMCommand) Flags() []cli.Flag {
+	return []cli.Flag{
+		&cli.DurationFlag{
+			Name:        "timeout",
+			Value:       service.DEFAULT_GUEST_EXEC_TIMEOUT,
+			Usage:       "How long to wait for the command, at most 10m",
+			Destination: &command.timeout,
+		},
+		&cli.StringSliceFlag{
+			Name:        "env",
+			Usage:       "KEY=value set for the command, may be repeated",
+			Destination: &command.env,
+		},
+		&cli.BoolFlag{
+			Name:        "stdin",
+			Usage:       "Feed local stdin to the command",
+			Destination: &command.isStdin,
+		},
+	}
+}
+
+func (command *ExecVMCommand) Subcommands() []*cli.Command {
+	return []*cli.Command{}
+}
+
+func (command *ExecVMCommand) Handler() func(ctx *cli.Context) error {
+	return func(ctx *cli.Context) error {
+		name, err := vmName(ctx)
+		if err != nil {
+			return err
+		}
+		if ctx.NArg() < 2 {
+			return fmt.Errorf("missing <command path> after <vm name>")
+		}
+
+		execRequest := contract.GuestExecRequest{
+			Path:           ctx.Args().Get(1),
+			Args:           ctx.Args().Slice()[2:],
+			Env:            command.env.Value(),
+			TimeoutSeconds: int(command.timeout.Seconds()),
+		}
+		if command.isStdin {
+			input, err := io.ReadAll(os.Stdin)
+			if err != nil {
+				return fmt.Errorf("could not read stdin: %v", err)
+			}
+			execRequest.Input = input
+		}
+
+		result := contract.GuestExecResult{Name: name}
+		if apiClient, hypervisor, ok := libvirtcmd.RemoteClient(ctx); ok {
+			result, err = apiClient.GuestExec(ctx.Context, name, hypervisor, execRequest)
+		} else {
+			libvirtService, serviceErr := newLibvirtService(ctx)
+			if serviceErr != nil {
+				return serviceErr
+			}
+			defer libvirtService.Cleanup()
+
+			var execResult *contract.GuestExecResult
+			execResult, err = libvirtService.GuestExec(ctx.Context, name, execRequest)
+			if execResult != nil {
+				execResult.Name = name
+				result = *execResult
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("could not run %v in %v: %v", execRequest.Path, name, err)
+		}
+
+		format, err := output.FromContext(ctx)
+		if err != nil {
+			return err
+		}
+		// tables show the output of the command as is
+		if format.IsTable() {
+			os.Stdout.Write(result.Stdout)
+			os.Stderr.Write(result.Stderr)
+		} else if err = output.Render(ctx, result, nil); err != nil {
+			return err
+		}
+
+		if result.IsTruncated {
+			fmt.Fprintln(os.Stderr, "output was truncated by the guest agent")
+		}
+		if result.Signal != 0 {
+			return fmt.Errorf("%v killed by signal %v", execRequest.Path, result.Signal)
+		}
+		if result.ExitCode != 0 {
+			return fmt.Errorf("%v exited with code %v", execRequest.Path, result.ExitCode)
+		}
+		return nil
+	}
+}
+
+func (command *ExecVMCommand) Build() *cli.Command {
+	return utils.ConvertInternalCommandToCliCommand(command)
+}
@@ -0,0 +1,72 @@
+package vm
+
+import (
+	"fmt"
+	"strings"
+
+	libvirtcmd "github.com/nnurry/harmonia/cmd/cli/libvirt"
+	"github.com/nnurry/harmonia/internal/contract"
+	"github.com/nnurry/harmonia/pkg/output"
+	"github.com/nnurry/harmonia/pkg/utils"
+	"github.com/urfave/cli/v2"
+)
+
+type InterfacesVMCommand struct{}
+
+func (command *InterfacesVMCommand) Description() string {
+	return "List the interfaces and addresses the guest agent of a running VM reports"
+}
+
+func (command *InterfacesVMCommand) Signature() string {
+	return "interfaces"
+}
+
+func (command *InterfacesVMCommand) Flags() []cli.Flag {
+	return []cli.Flag{}
+}
+
+func (command *InterfacesVMCommand) Subcommands() []*cli.Command {
+	return []*cli.Command{}
+}
+
+func (command *InterfacesVMCommand) Handler() func(ctx *cli.Context) error {
+	return func(ctx *cli.Context) error {
+		name, err := vmName(ctx)
+		if err != nil {
+			return err
+		}
+
+		result := contract.GuestInterfacesResult{Name: name}
+		if apiClient, hypervisor, ok := libvirtcmd.RemoteClient(ctx); ok {
+			result, err = apiClient.GuestInterfaces(ctx.Context, name, hypervisor)
+		} else {
+			libvirtService, serviceErr := newLibvirtService(ctx)
+			if serviceErr != nil {
+				return serviceErr
+			}
+			defer libvirtService.Cleanup()
+			result.Interfaces, err = libvirtService.GetGuestInterfaces(name)
+		}
+		if err != nil {
+			return fmt.Errorf("could not get interfaces of %v: %v", name, err)
+		}
+
+		table := output.NewTable(
+			output.Column{Name: "INTERFACE"},
+			output.Column{Name: "MAC"},
+			output.Column{Name: "ADDRESSES"},
+		)
+		for _, guestInterface := range result.Interfaces {
+			addresses := []string{}
+			for _, address := range guestInterface.IPAddresses {
+				addresses = append(addresses, fmt.Sprintf("%v/%v", address.Address, address.Prefix))
+			}
+			table.AddRow(guestInterface.Name, guestInterface.MacAddress, strings.Join(addresses, ","))
+		}
+		return output.Render(ctx, result, table)
+	}
+}
+
+func (command *InterfacesVMCommand) Build() *cli.Command {
+	return utils.ConvertInternalCommandToCliCommand(command)
+}
@@ -0,0 +1,87 @@
+package vm
+
+import (
+	"fmt"
+	"os"
+
+	libvirtcmd "github.com/nnurry/harmonia/cmd/cli/libvirt"
+	"github.com/nnurry/harmonia/internal/contract"
+	"github.com/nnurry/harmonia/pkg/output"
+	"github.com/nnurry/harmonia/pkg/utils"
+	"github.com/urfave/cli/v2"
+)
+
+type PushFileVMCommand struct {
+	isAppend bool
+}
+
+func (command *PushFileVMCommand) Description() string {
+	return "Write a local file into a running VM through its guest agent"
+}
+
+func (command *PushFileVMCommand) Signature() string {
+	return "push-file"
+}
+
+func (command *PushFileVMCommand) Flags() []cli.Flag {
+	return []cli.Flag{
+		&cli.BoolFlag{
+			Name:        "append",
+			Usage:       "Append to the file in the guest instead of replacing it",
+			Destination: &command.isAppend,
+		},
+	}
+}
+
+func (command *PushFileVMCommand) Subcommands() []*cli.Command {
+	return []*cli.Command{}
+}
+
+func (command *PushFileVMCommand) Handler() func(ctx *cli.Context) error {
+	return func(ctx *cli.Context) error {
+		name, err := vmName(ctx)
+		if err != nil {
+			return err
+		}
+		if ctx.NArg() != 3 {
+			return fmt.Errorf("expected <vm name> <local path> <guest path>")
+		}
+		localPath, guestPath := ctx.Args().Get(1), ctx.Args().Get(2)
+
+		content, err := os.ReadFile(localPath)
+		if err != nil {
+			return fmt.Errorf("could not read %v: %v", localPath, err)
+		}
+
+		result := contract.GuestFileWriteResult{Name: name, Path: guestPath}
+		if apiClient, hypervisor, ok := libvirtcmd.RemoteClient(ctx); ok {
+			result, err = apiClient.GuestWriteFile(ctx.Context, name, hypervisor, contract.GuestFileWriteRequest{
+				Path:     guestPath,
+				Content:  content,
+				IsAppend: command.isAppend,
+			})
+		} else {
+			libvirtService, serviceErr := newLibvirtService(ctx)
+			if serviceErr != nil {
+				return serviceErr
+			}
+			defer libvirtService.Cleanup()
+			result.BytesWritten, err = libvirtService.GuestWriteFile(name, guestPath, content, command.isAppend)
+		}
+		if err != nil {
+			return fmt.Errorf("could not write %v in %v: %v", guestPath, name, err)
+		}
+
+		table := output.NewTable(
+			output.Column{Name: "NAME"},
+			output.Column{Name: "PATH"},
+			output.Column{Name: "BYTES"},
+		)
+		table.AddRow(result.Name, result.Path, result.BytesWritten)
+		return output.Render(ctx, result, table)
+	}
+}
+
+func (command *PushFileVMCommand) Build() *cli.Command {
+	return utils.ConvertInternalCommandToCliCommand(command)
+}
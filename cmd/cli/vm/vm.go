@@ -0,0 +1,83 @@
+package vm
+
+import (
+	"bytes"
+	"fmt"
+
+	libvirtcmd "github.com/nnurry/harmonia/cmd/cli/libvirt"
+	"github.com/nnurry/harmonia/internal/connection"
+	"github.com/nnurry/harmonia/internal/service"
+	"github.com/nnurry/harmonia/pkg/types"
+	"github.com/nnurry/harmonia/pkg/utils"
+	"github.com/urfave/cli/v2"
+)
+
+const (
+	VM_COMMAND = types.InternalCommandName("VM command")
+)
+
+// Libvirt service over the connection of the group, the caller cleans it up
+func newLibvirtService(ctx *cli.Context) (*service.Libvirt, error) {
+	libvirtInternalConnection, ok := ctx.Context.Value(libvirtcmd.LIBVIRT_INTERNAL_CONNECTION_CTX_KEY).(*connection.Libvirt)
+	if !ok {
+		return nil, fmt.Errorf("could not retrieve Libvirt internal connection from context")
+	}
+	return service.NewLibvirt(libvirtInternalConnection)
+}
+
+// the one positional name every subcommand starts with
+func vmName(ctx *cli.Context) (string, error) {
+	if ctx.NArg() < 1 {
+		return "", fmt.Errorf("missing <vm name>")
+	}
+	name := ctx.Args().First()
+	if name == "" {
+		return "", fmt.Errorf("<vm name> is empty")
+	}
+	return name, nil
+}
+
+type VMCommand struct {
+	config     connection.LibvirtConfig
+	hypervisor string
+}
+
+func (command *VMCommand) Description() string {
+	return "Virtual machine command entrypoint"
+}
+
+func (command *VMCommand) Signature() string {
+	return "vm"
+}
+
+func (command *VMCommand) Flags() []cli.Flag {
+	return libvirtcmd.ConnectionFlags(&command.config, &command.hypervisor)
+}
+
+func (command *VMCommand) Subcommands() []*cli.Command {
+	return []*cli.Command{
+		(&ConsoleVMCommand{}).Build(),
+		(&InterfacesVMCommand{}).Build(),
+		(&ExecVMCommand{}).Build(),
+		(&PushFileVMCommand{}).Build(),
+	}
+}
+
+func (command *VMCommand) Handler() func(ctx *cli.Context) error {
+	return func(ctx *cli.Context) error {
+		buf := bytes.NewBufferString("")
+		for _, subcmd := range ctx.Command.Subcommands {
+			fmt.Fprintf(buf, "- %v\n", subcmd.Name)
+		}
+		return fmt.Errorf("use subcommands instead:\n%v", buf.String())
+	}
+}
+
+func (command *VMCommand) Build() *cli.Command {
+	cliCommand := utils.ConvertInternalCommandToCliCommand(command)
+	cliCommand.Before = func(ctx *cli.Context) error {
+		return libvirtcmd.SetupConnection(ctx, &command.config, &command.hypervisor)
+	}
+
+	return cliCommand
+}
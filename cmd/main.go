@@ -7,10 +7,18 @@ import (
 	"syscall"
 
 	mycli "github.com/nnurry/harmonia/cmd/cli"
+	auditcmd "github.com/nnurry/harmonia/cmd/cli/audit"
+	clientcontextcmd "github.com/nnurry/harmonia/cmd/cli/clientcontext"
+	fleetcmd "github.com/nnurry/harmonia/cmd/cli/fleet"
 	libvirtcmd "github.com/nnurry/harmonia/cmd/cli/libvirt"
 	shellcmd "github.com/nnurry/harmonia/cmd/cli/shell"
+	statecmd "github.com/nnurry/harmonia/cmd/cli/state"
+	vmcmd "github.com/nnurry/harmonia/cmd/cli/vm"
+	"github.com/nnurry/harmonia/internal/auth"
+	"github.com/nnurry/harmonia/internal/connection"
 	"github.com/nnurry/harmonia/internal/logger"
 	"github.com/nnurry/harmonia/internal/server"
+	"github.com/nnurry/harmonia/pkg/output"
 	"github.com/urfave/cli/v2"
 )
 
@@ -19,9 +27,15 @@ func main() {
 	cliCommands := &cli.Command{
 		Name:        "cli",
 		Description: "Commands for interacting with Harmonia's features directly.",
+		Flags:       append(clientcontextcmd.Flags(), output.Flag()),
 		Subcommands: []*cli.Command{
 			mycli.GetCliCommand(libvirtcmd.LIBVIRT_COMMAND),
 			mycli.GetCliCommand(shellcmd.SHELL_COMMAND),
+			mycli.GetCliCommand(statecmd.STATE_COMMAND),
+			mycli.GetCliCommand(auditcmd.AUDIT_COMMAND),
+			mycli.GetCliCommand(fleetcmd.FLEET_COMMAND),
+			mycli.GetCliCommand(clientcontextcmd.CONTEXT_COMMAND),
+			mycli.GetCliCommand(vmcmd.VM_COMMAND),
 		},
 	}
 
@@ -32,22 +46,77 @@ func main() {
 			{
 				Name:        "start",
 				Description: "Start the Harmonia API server",
+				Flags:       serverConfigFlags(),
 				Action: func(c *cli.Context) error {
 					var wg sync.WaitGroup
 
+					serverConfig, err := loadServerConfig(c)
+					if err != nil {
+						return err
+					}
+
+					if err = logger.Configure(serverConfig.Logging.Level, serverConfig.Logging.Format); err != nil {
+						return err
+					}
+					connection.SetSSHTimeout(serverConfig.Timeouts.SSH.Duration())
+
 					osChan := make(chan os.Signal, 1)
 					signal.Notify(osChan, syscall.SIGTERM, syscall.SIGINT)
 
 					logger.Info("Starting Harmonia API server...")
-					httpSrv := server.Init()
+					httpSrv, err := server.Init(serverConfig)
+					if err != nil {
+						return err
+					}
 
-					go server.Cleanup(httpSrv, osChan, &wg)
+					go server.Cleanup(httpSrv, serverConfig.Timeouts.Shutdown.Duration(), osChan, &wg)
 					server.Start(httpSrv, osChan, &wg)
 
 					wg.Wait()
 					return nil
 				},
 			},
+			{
+				Name:        "config",
+				Description: "Inspect the server configuration",
+				Subcommands: []*cli.Command{
+					{
+						Name:        "show",
+						Description: "Print the effective server config (file, env and flags merged) with secrets redacted",
+						Flags:       append(serverConfigFlags(), output.Flag()),
+						Action: func(c *cli.Context) error {
+							serverConfig, err := loadServerConfig(c)
+							if err != nil {
+								return err
+							}
+
+							// a nested config has no table, table modes fall back to yaml
+							return output.Render(c, serverConfig.Redacted(), nil)
+						},
+					},
+				},
+			},
+			{
+				Name:        "token",
+				Description: "Manage API tokens",
+				Subcommands: []*cli.Command{
+					{
+						Name:        "generate",
+						Description: "Generate an API token and the hash to put in the server config",
+						Flags:       []cli.Flag{output.Flag()},
+						Action: func(c *cli.Context) error {
+							token, hash, err := auth.GenerateToken()
+							if err != nil {
+								return err
+							}
+
+							table := output.NewTable(output.Column{Name: "TOKEN"}, output.Column{Name: "HASH"})
+							table.AddRow(token, hash)
+							return output.Render(c, map[string]string{"token": token, "hash": hash}, table)
+						},
+					},
+				},
+			},
 		},
 	}
 
@@ -55,6 +124,7 @@ func main() {
 		Name:                 "harmonia",
 		Description:          "Entrypoint of harmonia",
 		EnableBashCompletion: true,
+		Flags:                []cli.Flag{output.Flag()},
 		Commands: []*cli.Command{
 			cliCommands,
 			apiCommands,
@@ -0,0 +1,208 @@
+package audit
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	OUTCOME_SUCCESS = "success"
+	OUTCOME_PARTIAL = "partial"
+	OUTCOME_FAILURE = "failure"
+)
+
+type Command struct {
+	Time       time.Time `json:"time"`
+	Processor  string    `json:"processor"`
+	Command    string    `json:"command"`
+	DurationMs int64     `json:"duration_ms"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// one line of the audit log
+type Entry struct {
+	Time            time.Time `json:"time"`
+	RequestID       string    `json:"request_id"`
+	Caller          string    `json:"caller,omitempty"`
+	CallerMethod    string    `json:"caller_method,omitempty"`
+	RemoteAddress   string    `json:"remote_address,omitempty"`
+	Action          string    `json:"action"`
+	Endpoint        string    `json:"endpoint"`
+	Hypervisors     []string  `json:"hypervisors,omitempty"`
+	VirtualMachines []string  `json:"virtual_machines,omitempty"`
+	Config          any       `json:"config,omitempty"`
+	Commands        []Command `json:"commands,omitempty"`
+	StatusCode      int       `json:"status_code"`
+	Outcome         string    `json:"outcome"`
+	Error           string    `json:"error,omitempty"`
+	DurationMs      int64     `json:"duration_ms"`
+}
+
+// empty fields match everything
+type Filter struct {
+	Caller         string
+	Action         string
+	VirtualMachine string
+	Hypervisor     string
+	Outcome        string
+	RequestID      string
+	Since          time.Time
+}
+
+func (filter Filter) Match(entry Entry) bool {
+	if filter.Caller != "" && filter.Caller != entry.Caller {
+		return false
+	}
+	if filter.Action != "" && filter.Action != entry.Action {
+		return false
+	}
+	if filter.Outcome != "" && filter.Outcome != entry.Outcome {
+		return false
+	}
+	if filter.RequestID != "" && filter.RequestID != entry.RequestID {
+		return false
+	}
+	if !filter.Since.IsZero() && entry.Time.Before(filter.Since) {
+		return false
+	}
+	if filter.VirtualMachine != "" && !contains(entry.VirtualMachines, filter.VirtualMachine) {
+		return false
+	}
+	if filter.Hypervisor != "" && !contains(entry.Hypervisors, filter.Hypervisor) {
+		return false
+	}
+	return true
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+type recorderCtxKey struct{}
+
+// collects what happens while serving one request, VMs of a fleet may run
+// concurrently so every method is safe for concurrent use
+type Recorder struct {
+	mu    sync.Mutex
+	entry Entry
+}
+
+func NewRecorder(entry Entry) *Recorder {
+	return &Recorder{entry: entry}
+}
+
+func WithRecorder(ctx context.Context, recorder *Recorder) context.Context {
+	return context.WithValue(ctx, recorderCtxKey{}, recorder)
+}
+
+// nil when the context is not audited, all Recorder methods accept a nil receiver
+func FromContext(ctx context.Context) *Recorder {
+	if ctx == nil {
+		return nil
+	}
+	recorder, _ := ctx.Value(recorderCtxKey{}).(*Recorder)
+	return recorder
+}
+
+func (recorder *Recorder) AddVirtualMachines(names ...string) {
+	if recorder == nil {
+		return
+	}
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	for _, name := range names {
+		if name != "" && !contains(recorder.entry.VirtualMachines, name) {
+			recorder.entry.VirtualMachines = append(recorder.entry.VirtualMachines, name)
+		}
+	}
+}
+
+func (recorder *Recorder) AddHypervisors(names ...string) {
+	if recorder == nil {
+		return
+	}
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	for _, name := range names {
+		if name != "" && !contains(recorder.entry.Hypervisors, name) {
+			recorder.entry.Hypervisors = append(recorder.entry.Hypervisors, name)
+		}
+	}
+}
+
+// config must already have its secrets redacted
+func (recorder *Recorder) SetConfig(config any) {
+	if recorder == nil {
+		return
+	}
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	recorder.entry.Config = config
+}
+
+// overrides the outcome derived from the status code, e.g. for partial fleet failures
+func (recorder *Recorder) SetOutcome(outcome string, err string) {
+	if recorder == nil {
+		return
+	}
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	recorder.entry.Outcome = outcome
+	recorder.entry.Error = err
+}
+
+func (recorder *Recorder) RecordCommand(processor string, command string, args []string, started time.Time, err error) {
+	if recorder == nil {
+		return
+	}
+
+	recordedCommand := Command{
+		Time:       started.UTC(),
+		Processor:  processor,
+		Command:    strings.TrimSpace(command + " " + strings.Join(args, " ")),
+		DurationMs: time.Since(started).Milliseconds(),
+	}
+	if err != nil {
+		recordedCommand.Error = err.Error()
+	}
+
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	recorder.entry.Commands = append(recorder.entry.Commands, recordedCommand)
+}
+
+// records a shell command if the context is audited
+func RecordCommand(ctx context.Context, processor string, command string, args []string, started time.Time, err error) {
+	FromContext(ctx).RecordCommand(processor, command, args, started, err)
+}
+
+func (recorder *Recorder) Finish(statusCode int) Entry {
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+
+	recorder.entry.StatusCode = statusCode
+	recorder.entry.DurationMs = time.Since(recorder.entry.Time).Milliseconds()
+	if recorder.entry.Outcome == "" {
+		if statusCode < 400 {
+			recorder.entry.Outcome = OUTCOME_SUCCESS
+		} else {
+			recorder.entry.Outcome = OUTCOME_FAILURE
+		}
+	}
+	return recorder.entry
+}
+
+// accepts an absolute RFC3339 time or a duration back from now, e.g. 1h
+func ParseSince(since string) (time.Time, error) {
+	if duration, err := time.ParseDuration(since); err == nil {
+		return time.Now().Add(-duration), nil
+	}
+	return time.Parse(time.RFC3339, since)
+}
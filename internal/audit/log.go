@@ -0,0 +1,244 @@
+package audit
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	DEFAULT_LOG_PATH         = "/var/lib/harmonia/audit.log"
+	DEFAULT_MAX_SIZE_IN_MB   = 50
+	DEFAULT_MAX_BACKUPS      = 5
+	FOLLOW_POLL_INTERVAL     = time.Second
+	LOG_FILE_PERMISSION      = 0600
+	LOG_DIRECTORY_PERMISSION = 0700
+)
+
+type Config struct {
+	Path        string `json:"path"`
+	MaxSizeInMB int    `json:"max_size_mb"`
+	MaxBackups  int    `json:"max_backups"`
+}
+
+func NewConfig() Config {
+	return Config{
+		Path:        DEFAULT_LOG_PATH,
+		MaxSizeInMB: DEFAULT_MAX_SIZE_IN_MB,
+		MaxBackups:  DEFAULT_MAX_BACKUPS,
+	}
+}
+
+func (cfg Config) Validate() error {
+	if cfg.Path == "" {
+		return fmt.Errorf("path is empty")
+	}
+	if cfg.MaxSizeInMB < 1 {
+		return fmt.Errorf("max_size_mb must be at least 1")
+	}
+	if cfg.MaxBackups < 0 {
+		return fmt.Errorf("max_backups is negative")
+	}
+	return nil
+}
+
+// append-only JSON lines file, rotated to <path>.1 .. <path>.<max backups> once too big
+type Log struct {
+	mu     sync.Mutex
+	config Config
+}
+
+func New(config Config) (*Log, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return &Log{config: config}, nil
+}
+
+func (log *Log) Path() string {
+	return log.config.Path
+}
+
+func (log *Log) Write(entry Entry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("could not serialize audit entry: %v", err)
+	}
+	data = append(data, '\n')
+
+	log.mu.Lock()
+	defer log.mu.Unlock()
+
+	if err = os.MkdirAll(filepath.Dir(log.config.Path), LOG_DIRECTORY_PERMISSION); err != nil {
+		return fmt.Errorf("could not create audit log directory: %v", err)
+	}
+
+	if err = log.rotateIfNeeded(int64(len(data))); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(log.config.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, LOG_FILE_PERMISSION)
+	if err != nil {
+		return fmt.Errorf("could not open audit log: %v", err)
+	}
+	defer file.Close()
+
+	if _, err = file.Write(data); err != nil {
+		return fmt.Errorf("could not write audit log: %v", err)
+	}
+	return nil
+}
+
+func (log *Log) rotateIfNeeded(incomingSize int64) error {
+	info, err := os.Stat(log.config.Path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("could not stat audit log: %v", err)
+	}
+	if info.Size()+incomingSize <= int64(log.config.MaxSizeInMB)*1024*1024 {
+		return nil
+	}
+
+	if log.config.MaxBackups == 0 {
+		return os.Remove(log.config.Path)
+	}
+
+	os.Remove(log.backupPath(log.config.MaxBackups))
+	for i := log.config.MaxBackups - 1; i >= 1; i-- {
+		if _, err := os.Stat(log.backupPath(i)); err == nil {
+			if err = os.Rename(log.backupPath(i), log.backupPath(i+1)); err != nil {
+				return fmt.Errorf("could not rotate audit log: %v", err)
+			}
+		}
+	}
+	if err = os.Rename(log.config.Path, log.backupPath(1)); err != nil {
+		return fmt.Errorf("could not rotate audit log: %v", err)
+	}
+	return nil
+}
+
+func (log *Log) backupPath(index int) string {
+	return fmt.Sprintf("%v.%d", log.config.Path, index)
+}
+
+// last limit matching entries across rotated files, oldest first; limit < 1 returns all
+func (log *Log) Query(filter Filter, limit int) ([]Entry, error) {
+	paths := []string{}
+	for i := log.config.MaxBackups; i >= 1; i-- {
+		paths = append(paths, log.backupPath(i))
+	}
+	paths = append(paths, log.config.Path)
+
+	entries := []Entry{}
+	for _, path := range paths {
+		file, err := os.Open(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("could not open audit log: %v", err)
+		}
+
+		_, err = readEntries(file, func(entry Entry) {
+			if filter.Match(entry) {
+				entries = append(entries, entry)
+			}
+		})
+		file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("could not read %v: %v", path, err)
+		}
+	}
+
+	if limit > 0 && len(entries) > limit {
+		entries = entries[len(entries)-limit:]
+	}
+	return entries, nil
+}
+
+// calls fn for every matching entry appended after the call until ctx is done
+func (log *Log) Follow(ctx context.Context, filter Filter, fn func(entry Entry)) error {
+	offset := int64(0)
+	if info, err := os.Stat(log.config.Path); err == nil {
+		offset = info.Size()
+	}
+
+	ticker := time.NewTicker(FOLLOW_POLL_INTERVAL)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		info, err := os.Stat(log.config.Path)
+		if os.IsNotExist(err) {
+			offset = 0
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("could not stat audit log: %v", err)
+		}
+		// rotated underneath us
+		if info.Size() < offset {
+			offset = 0
+		}
+		if info.Size() == offset {
+			continue
+		}
+
+		file, err := os.Open(log.config.Path)
+		if err != nil {
+			return fmt.Errorf("could not open audit log: %v", err)
+		}
+		if _, err = file.Seek(offset, io.SeekStart); err != nil {
+			file.Close()
+			return fmt.Errorf("could not seek audit log: %v", err)
+		}
+
+		read, err := readEntries(file, func(entry Entry) {
+			if filter.Match(entry) {
+				fn(entry)
+			}
+		})
+		file.Close()
+		if err != nil {
+			return err
+		}
+		offset += read
+	}
+}
+
+// returns bytes consumed, a trailing partial line is left for the next read
+func readEntries(reader io.Reader, fn func(entry Entry)) (int64, error) {
+	bufferedReader := bufio.NewReaderSize(reader, 64*1024)
+	consumed := int64(0)
+
+	for {
+		line, err := bufferedReader.ReadBytes('\n')
+		if err == io.EOF {
+			return consumed, nil
+		}
+		if err != nil {
+			return consumed, err
+		}
+		consumed += int64(len(line))
+
+		entry := Entry{}
+		if err = json.Unmarshal(line, &entry); err != nil {
+			// skip corrupted lines instead of hiding everything after them
+			continue
+		}
+		fn(entry)
+	}
+}
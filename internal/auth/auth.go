@@ -0,0 +1,242 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+type Scope string
+
+const (
+	SCOPE_ALL             = Scope("*")
+	SCOPE_VM_READ         = Scope("vm:read")
+	SCOPE_VM_WRITE        = Scope("vm:write")
+	SCOPE_VM_CONSOLE      = Scope("vm:console")
+	SCOPE_VM_EXEC         = Scope("vm:exec")
+	SCOPE_FLEET_READ      = Scope("fleet:read")
+	SCOPE_FLEET_WRITE     = Scope("fleet:write")
+	SCOPE_FLEET_DELETE    = Scope("fleet:delete")
+	SCOPE_NETWORK_READ    = Scope("network:read")
+	SCOPE_NETWORK_WRITE   = Scope("network:write")
+	SCOPE_HYPERVISOR_READ = Scope("hypervisor:read")
+	SCOPE_STATE_READ      = Scope("state:read")
+	SCOPE_AUDIT_READ      = Scope("audit:read")
+	SCOPE_METRICS_READ    = Scope("metrics:read")
+)
+
+var KNOWN_SCOPES = []Scope{
+	SCOPE_ALL,
+	SCOPE_VM_READ,
+	SCOPE_VM_WRITE,
+	SCOPE_VM_CONSOLE,
+	SCOPE_VM_EXEC,
+	SCOPE_FLEET_READ,
+	SCOPE_FLEET_WRITE,
+	SCOPE_FLEET_DELETE,
+	SCOPE_NETWORK_READ,
+	SCOPE_NETWORK_WRITE,
+	SCOPE_HYPERVISOR_READ,
+	SCOPE_STATE_READ,
+	SCOPE_AUDIT_READ,
+	SCOPE_METRICS_READ,
+}
+
+const (
+	TOKEN_HASH_PREFIX = "sha256:"
+	TOKEN_LENGTH      = 32
+)
+
+const (
+	METHOD_TOKEN       = "token"
+	METHOD_CERTIFICATE = "certificate"
+)
+
+type principalCtxKey struct{}
+
+// tokens are stored as "sha256:<hex>" so the server config never holds them in clear text
+type TokenConfig struct {
+	Name   string   `json:"name"`
+	Hash   string   `json:"hash"`
+	Scopes []string `json:"scopes"`
+}
+
+// grants scopes to mTLS clients by the CN of their verified certificate
+type ClientConfig struct {
+	CommonName string   `json:"common_name"`
+	Scopes     []string `json:"scopes"`
+}
+
+type Config struct {
+	Tokens  []TokenConfig  `json:"tokens"`
+	Clients []ClientConfig `json:"clients"`
+}
+
+func (cfg Config) Enabled() bool {
+	return len(cfg.Tokens) > 0 || len(cfg.Clients) > 0
+}
+
+func (cfg Config) Validate() error {
+	seen := map[string]bool{}
+	for _, token := range cfg.Tokens {
+		if token.Name == "" {
+			return fmt.Errorf("auth token without name")
+		}
+		if seen[token.Name] {
+			return fmt.Errorf("auth token '%v' is listed twice", token.Name)
+		}
+		seen[token.Name] = true
+
+		if _, err := decodeHash(token.Hash); err != nil {
+			return fmt.Errorf("auth token '%v': %v", token.Name, err)
+		}
+		for _, scope := range token.Scopes {
+			if !isKnownScope(Scope(scope)) {
+				return fmt.Errorf("auth token '%v' has unknown scope '%v'", token.Name, scope)
+			}
+		}
+	}
+
+	seen = map[string]bool{}
+	for _, client := range cfg.Clients {
+		if client.CommonName == "" {
+			return fmt.Errorf("auth client without common_name")
+		}
+		if seen[client.CommonName] {
+			return fmt.Errorf("auth client '%v' is listed twice", client.CommonName)
+		}
+		seen[client.CommonName] = true
+
+		for _, scope := range client.Scopes {
+			if !isKnownScope(Scope(scope)) {
+				return fmt.Errorf("auth client '%v' has unknown scope '%v'", client.CommonName, scope)
+			}
+		}
+	}
+	return nil
+}
+
+// the caller identified by a token or client certificate, kept in the request context
+type Principal struct {
+	Name   string
+	Method string
+	Scopes []Scope
+}
+
+func (principal Principal) HasScope(scope Scope) bool {
+	for _, grantedScope := range principal.Scopes {
+		if grantedScope == SCOPE_ALL || grantedScope == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func WithPrincipal(ctx context.Context, principal Principal) context.Context {
+	return context.WithValue(ctx, principalCtxKey{}, principal)
+}
+
+func PrincipalFromContext(ctx context.Context) (Principal, bool) {
+	principal, ok := ctx.Value(principalCtxKey{}).(Principal)
+	return principal, ok
+}
+
+type Authenticator struct {
+	tokens  []TokenConfig
+	hashes  [][]byte
+	clients map[string]ClientConfig
+}
+
+func NewAuthenticator(cfg Config) (*Authenticator, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	authenticator := &Authenticator{tokens: cfg.Tokens, clients: map[string]ClientConfig{}}
+	for _, client := range cfg.Clients {
+		authenticator.clients[client.CommonName] = client
+	}
+	for _, token := range cfg.Tokens {
+		hash, _ := decodeHash(token.Hash)
+		authenticator.hashes = append(authenticator.hashes, hash)
+	}
+	return authenticator, nil
+}
+
+func (authenticator *Authenticator) Enabled() bool {
+	return len(authenticator.tokens) > 0 || len(authenticator.clients) > 0
+}
+
+// every configured hash is compared so timing doesn't leak which token matched
+func (authenticator *Authenticator) Authenticate(rawToken string) (*Principal, error) {
+	presentedHash := sha256.Sum256([]byte(rawToken))
+
+	matched := -1
+	for i, hash := range authenticator.hashes {
+		if subtle.ConstantTimeCompare(presentedHash[:], hash) == 1 && matched == -1 {
+			matched = i
+		}
+	}
+	if matched == -1 {
+		return nil, fmt.Errorf("invalid token")
+	}
+
+	token := authenticator.tokens[matched]
+	principal := &Principal{Name: token.Name, Method: METHOD_TOKEN}
+	for _, scope := range token.Scopes {
+		principal.Scopes = append(principal.Scopes, Scope(scope))
+	}
+	return principal, nil
+}
+
+// the certificate must already be verified against the client CA by the TLS layer
+func (authenticator *Authenticator) AuthenticateCertificate(commonName string) (*Principal, error) {
+	client, ok := authenticator.clients[commonName]
+	if !ok {
+		return nil, fmt.Errorf("unknown client certificate '%v'", commonName)
+	}
+
+	principal := &Principal{Name: commonName, Method: METHOD_CERTIFICATE}
+	for _, scope := range client.Scopes {
+		principal.Scopes = append(principal.Scopes, Scope(scope))
+	}
+	return principal, nil
+}
+
+func GenerateToken() (string, string, error) {
+	buf := make([]byte, TOKEN_LENGTH)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", fmt.Errorf("could not generate token: %v", err)
+	}
+	token := hex.EncodeToString(buf)
+	return token, HashToken(token), nil
+}
+
+func HashToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return TOKEN_HASH_PREFIX + hex.EncodeToString(hash[:])
+}
+
+func decodeHash(rawHash string) ([]byte, error) {
+	if !strings.HasPrefix(rawHash, TOKEN_HASH_PREFIX) {
+		return nil, fmt.Errorf("hash must start with '%v'", TOKEN_HASH_PREFIX)
+	}
+	hash, err := hex.DecodeString(strings.TrimPrefix(rawHash, TOKEN_HASH_PREFIX))
+	if err != nil || len(hash) != sha256.Size {
+		return nil, fmt.Errorf("hash is not a hex encoded SHA-256 digest")
+	}
+	return hash, nil
+}
+
+func isKnownScope(scope Scope) bool {
+	for _, knownScope := range KNOWN_SCOPES {
+		if knownScope == scope {
+			return true
+		}
+	}
+	return false
+}
@@ -1,14 +1,27 @@
 package builder
 
 import (
+	"bytes"
+	"encoding/xml"
 	"fmt"
+	"io"
 
+	"github.com/nnurry/harmonia/internal/contract"
 	"github.com/nnurry/harmonia/internal/logger"
 	"github.com/nnurry/harmonia/pkg/types"
 	"libvirt.org/go/libvirt"
 	"libvirt.org/go/libvirtxml"
 )
 
+const (
+	DEFAULT_BRIDGE_NAME          = "br0"
+	DEFAULT_NETWORK_DEVICE_MODEL = "virtio"
+	GUEST_AGENT_CHANNEL_NAME     = "org.qemu.guest_agent.0"
+	// fw_cfg keys Fedora CoreOS and Flatcar read their Ignition config from
+	FCOS_IGNITION_FW_CFG_NAME    = "opt/com.coreos/config"
+	FLATCAR_IGNITION_FW_CFG_NAME = "opt/org.flatcar-linux/config"
+)
+
 type DomainBuilderFlag struct {
 	name string
 }
@@ -23,6 +36,7 @@ var (
 	SET_MEMORY          = &DomainBuilderFlag{name: "set memory"}
 	SET_QCOW2_DISK_PATH = &DomainBuilderFlag{name: "set qcow2 disk path"}
 	SET_CI_DISK_PATH    = &DomainBuilderFlag{name: "set cloud-init disk path"}
+	SET_IGNITION_PATH   = &DomainBuilderFlag{name: "set ignition config path"}
 )
 
 type LibvirtDomainBuilder struct {
@@ -30,10 +44,19 @@ type LibvirtDomainBuilder struct {
 	newDomainXml    *libvirtxml.Domain
 	qcow2DomainDisk *libvirtxml.DomainDisk
 	ciDomainDisk    *libvirtxml.DomainDisk
+	consoleLogPath  string
 
 	builderFlagMap *types.BuilderFlagMap
 }
 
+// either Network or Bridge is set, Network takes precedence
+type DomainNetworkInterface struct {
+	Network    string
+	Bridge     string
+	MacAddress string
+	Model      string
+}
+
 func NewLibvirtDomainBuilder(baseDomain *libvirt.Domain, requiredFlags []*DomainBuilderFlag, useDefaultBuilderFlags bool) (*LibvirtDomainBuilder, error) {
 	castedRequiredFlags := []types.BuilderFlag{}
 
@@ -102,7 +125,10 @@ func (builder *LibvirtDomainBuilder) getDefaultBuilderFlags() []types.BuilderFla
 func (builder *LibvirtDomainBuilder) WithMacAddress(address string) *LibvirtDomainBuilder {
 	logger.Info("setting mac address for VM")
 	for _, domainInterface := range builder.newDomainXml.Devices.Interfaces {
-		if domainInterface.Source.Bridge.Bridge == "br0" {
+		if domainInterface.Source == nil || domainInterface.Source.Bridge == nil || domainInterface.MAC == nil {
+			continue
+		}
+		if domainInterface.Source.Bridge.Bridge == DEFAULT_BRIDGE_NAME {
 			domainInterface.MAC.Address = address
 		}
 	}
@@ -111,6 +137,60 @@ func (builder *LibvirtDomainBuilder) WithMacAddress(address string) *LibvirtDoma
 	return builder
 }
 
+// sets the model of every interface inherited from base domain
+func (builder *LibvirtDomainBuilder) WithInterfaceModel(model string) *LibvirtDomainBuilder {
+	logger.Info("setting network interface model for VM")
+	for i := range builder.newDomainXml.Devices.Interfaces {
+		builder.newDomainXml.Devices.Interfaces[i].Model = &libvirtxml.DomainInterfaceModel{Type: model}
+	}
+	return builder
+}
+
+// replaces every interface inherited from base domain
+func (builder *LibvirtDomainBuilder) WithNetworkInterfaces(interfaces ...DomainNetworkInterface) *LibvirtDomainBuilder {
+	logger.Info("setting network interfaces for VM")
+
+	defaultModel := DEFAULT_NETWORK_DEVICE_MODEL
+	for _, baseInterface := range builder.baseDomainXml.Devices.Interfaces {
+		if baseInterface.Model != nil && baseInterface.Model.Type != "" {
+			defaultModel = baseInterface.Model.Type
+			break
+		}
+	}
+
+	domainInterfaces := []libvirtxml.DomainInterface{}
+	for _, networkInterface := range interfaces {
+		domainInterface := libvirtxml.DomainInterface{
+			Source: &libvirtxml.DomainInterfaceSource{},
+			Model:  &libvirtxml.DomainInterfaceModel{Type: defaultModel},
+		}
+
+		if networkInterface.Network != "" {
+			domainInterface.Source.Network = &libvirtxml.DomainInterfaceSourceNetwork{Network: networkInterface.Network}
+		} else {
+			bridge := networkInterface.Bridge
+			if bridge == "" {
+				bridge = DEFAULT_BRIDGE_NAME
+			}
+			domainInterface.Source.Bridge = &libvirtxml.DomainInterfaceSourceBridge{Bridge: bridge}
+		}
+
+		if networkInterface.MacAddress != "" {
+			domainInterface.MAC = &libvirtxml.DomainInterfaceMAC{Address: networkInterface.MacAddress}
+		}
+
+		if networkInterface.Model != "" {
+			domainInterface.Model.Type = networkInterface.Model
+		}
+
+		domainInterfaces = append(domainInterfaces, domainInterface)
+	}
+
+	builder.newDomainXml.Devices.Interfaces = domainInterfaces
+
+	return builder
+}
+
 func (builder *LibvirtDomainBuilder) WithDomainName(name string) *LibvirtDomainBuilder {
 	logger.Info("setting domain name for VM")
 	builder.newDomainXml.Name = name
@@ -139,6 +219,16 @@ func (builder *LibvirtDomainBuilder) WithNumOfCpus(numOfCpus int) *LibvirtDomain
 	return builder
 }
 
+// must come after WithNumOfCpus, which keeps the mode of base domain
+func (builder *LibvirtDomainBuilder) WithCPUMode(mode string) *LibvirtDomainBuilder {
+	logger.Info("setting CPU mode for VM")
+	if builder.newDomainXml.CPU == nil {
+		builder.newDomainXml.CPU = &libvirtxml.DomainCPU{}
+	}
+	builder.newDomainXml.CPU.Mode = mode
+	return builder
+}
+
 func (builder *LibvirtDomainBuilder) WithMemory(memory uint, unit string) *LibvirtDomainBuilder {
 	logger.Info("setting memory for VM")
 
@@ -164,6 +254,24 @@ func (builder *LibvirtDomainBuilder) WithQcow2DiskPath(path string) *LibvirtDoma
 	return builder
 }
 
+// must come after WithQcow2DiskPath, the disk is on virtio otherwise
+func (builder *LibvirtDomainBuilder) WithDiskBus(bus string) *LibvirtDomainBuilder {
+	logger.Info("setting disk bus for VM")
+	if builder.qcow2DomainDisk == nil {
+		return builder
+	}
+	dev := "sdb"
+	switch bus {
+	case "virtio":
+		dev = "vdb"
+	case "ide":
+		// hdc is the cloud-init disk
+		dev = "hda"
+	}
+	builder.qcow2DomainDisk.Target = &libvirtxml.DomainDiskTarget{Dev: dev, Bus: bus}
+	return builder
+}
+
 func (builder *LibvirtDomainBuilder) WithCiDiskPath(path string) *LibvirtDomainBuilder {
 	logger.Info("setting cloud-init disk path for VM")
 
@@ -180,6 +288,133 @@ func (builder *LibvirtDomainBuilder) WithCiDiskPath(path string) *LibvirtDomainB
 	return builder
 }
 
+// hands the Ignition config to the guest over fw_cfg, needs libvirt 6.5+
+func (builder *LibvirtDomainBuilder) WithIgnitionConfigPath(path string) *LibvirtDomainBuilder {
+	logger.Info("setting ignition config path for VM")
+
+	builder.newDomainXml.SysInfo = append(builder.newDomainXml.SysInfo, libvirtxml.DomainSysInfo{
+		FWCfg: &libvirtxml.DomainSysInfoFWCfg{
+			Entry: []libvirtxml.DomainSysInfoEntry{
+				{Name: FCOS_IGNITION_FW_CFG_NAME, File: path},
+				{Name: FLATCAR_IGNITION_FW_CFG_NAME, File: path},
+			},
+		},
+	})
+
+	builder.builderFlagMap.MarkAsChecked(SET_IGNITION_PATH)
+	return builder
+}
+
+// replaces harmonia metadata inherited from the base VM, other namespaces are kept
+func (builder *LibvirtDomainBuilder) WithHarmoniaMetadata(metadata contract.HarmoniaDomainMetadata) *LibvirtDomainBuilder {
+	logger.Info("setting harmonia metadata for VM")
+
+	metadataXml, err := xml.Marshal(metadata)
+	if err != nil {
+		logger.Errorf("could not serialize harmonia metadata: %v", err)
+		return builder
+	}
+
+	innerXml := ""
+	if builder.newDomainXml.Metadata != nil {
+		innerXml = stripHarmoniaMetadata(builder.newDomainXml.Metadata.XML)
+	}
+
+	builder.newDomainXml.Metadata = &libvirtxml.DomainMetadata{XML: innerXml + string(metadataXml)}
+	return builder
+}
+
+func stripHarmoniaMetadata(innerXml string) string {
+	decoder := xml.NewDecoder(bytes.NewBufferString(innerXml))
+	stripped := ""
+	lastOffset := int64(0)
+	depth := 0
+
+	for {
+		startOffset := decoder.InputOffset()
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			// leave metadata we can't parse untouched
+			return innerXml
+		}
+
+		switch element := token.(type) {
+		case xml.StartElement:
+			depth++
+			if depth == 1 && element.Name.Space == contract.HARMONIA_METADATA_NAMESPACE {
+				stripped += innerXml[lastOffset:startOffset]
+				if err := decoder.Skip(); err != nil {
+					return innerXml
+				}
+				depth--
+				lastOffset = decoder.InputOffset()
+			}
+		case xml.EndElement:
+			depth--
+		}
+	}
+
+	return stripped + innerXml[lastOffset:]
+}
+
+// virtlogd appends everything the guest prints on its serial port to path
+func (builder *LibvirtDomainBuilder) WithConsoleLogPath(path string) *LibvirtDomainBuilder {
+	logger.Info("setting console log path for VM")
+
+	builder.consoleLogPath = path
+	return builder
+}
+
+// harmonia attaches to the serial console, base VMs without one get a pty serial port and a console on it
+func (builder *LibvirtDomainBuilder) ensureSerialConsole() {
+	devices := builder.newDomainXml.Devices
+	port := uint(0)
+
+	if len(devices.Serials) < 1 {
+		logger.Info("adding serial port to VM")
+		devices.Serials = []libvirtxml.DomainSerial{{
+			Source: &libvirtxml.DomainChardevSource{Pty: &libvirtxml.DomainChardevSourcePty{}},
+			Target: &libvirtxml.DomainSerialTarget{Type: "isa-serial", Port: &port},
+		}}
+	}
+
+	if len(devices.Consoles) < 1 {
+		logger.Info("adding serial console to VM")
+		devices.Consoles = []libvirtxml.DomainConsole{{
+			Source: &libvirtxml.DomainChardevSource{Pty: &libvirtxml.DomainChardevSourcePty{}},
+			Target: &libvirtxml.DomainConsoleTarget{Type: "serial", Port: &port},
+		}}
+	}
+
+	// a console on the serial port shares its log, libvirt wants it set on the serial port
+	if builder.consoleLogPath != "" {
+		devices.Serials[0].Log = &libvirtxml.DomainChardevLog{File: builder.consoleLogPath, Append: "on"}
+	}
+}
+
+// harmonia talks to qemu-guest-agent for IPs, exec and files; a channel inherited from the base VM
+// is replaced so its socket path isn't shared, libvirt picks one for the new domain
+func (builder *LibvirtDomainBuilder) ensureGuestAgentChannel() {
+	devices := builder.newDomainXml.Devices
+
+	channels := []libvirtxml.DomainChannel{}
+	for _, channel := range devices.Channels {
+		if channel.Target != nil && channel.Target.VirtIO != nil && channel.Target.VirtIO.Name == GUEST_AGENT_CHANNEL_NAME {
+			continue
+		}
+		channels = append(channels, channel)
+	}
+
+	logger.Info("adding guest agent channel to VM")
+	devices.Channels = append(channels, libvirtxml.DomainChannel{
+		Source: &libvirtxml.DomainChardevSource{UNIX: &libvirtxml.DomainChardevSourceUNIX{Mode: "bind"}},
+		Target: &libvirtxml.DomainChannelTarget{VirtIO: &libvirtxml.DomainChannelTargetVirtIO{Name: GUEST_AGENT_CHANNEL_NAME}},
+	})
+}
+
 func (builder *LibvirtDomainBuilder) Verify() error {
 	return builder.builderFlagMap.Verify()
 }
@@ -189,10 +424,13 @@ func (builder *LibvirtDomainBuilder) BuildXMLString() (string, error) {
 		return "", err
 	}
 
-	builder.newDomainXml.Devices.Disks = []libvirtxml.DomainDisk{
-		*builder.qcow2DomainDisk,
-		*builder.ciDomainDisk,
+	builder.newDomainXml.Devices.Disks = []libvirtxml.DomainDisk{*builder.qcow2DomainDisk}
+	// VMs provisioned by Ignition have no cloud-init disk
+	if builder.ciDomainDisk != nil {
+		builder.newDomainXml.Devices.Disks = append(builder.newDomainXml.Devices.Disks, *builder.ciDomainDisk)
 	}
+	builder.ensureSerialConsole()
+	builder.ensureGuestAgentChannel()
 
 	xmlString, err := builder.newDomainXml.Marshal()
 	if err != nil {
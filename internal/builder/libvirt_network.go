@@ -0,0 +1,192 @@
+package builder
+
+import (
+	"fmt"
+
+	"github.com/nnurry/harmonia/internal/logger"
+	"github.com/nnurry/harmonia/pkg/types"
+	"libvirt.org/go/libvirt"
+	"libvirt.org/go/libvirtxml"
+)
+
+const (
+	NETWORK_FORWARD_MODE_NAT      = "nat"
+	NETWORK_FORWARD_MODE_ROUTE    = "route"
+	NETWORK_FORWARD_MODE_ISOLATED = "isolated"
+)
+
+type NetworkBuilderFlag struct {
+	name string
+}
+
+func (flag *NetworkBuilderFlag) Name() string {
+	return flag.name
+}
+
+var (
+	SET_NETWORK_NAME         = &NetworkBuilderFlag{name: "set network name"}
+	SET_NETWORK_FORWARD_MODE = &NetworkBuilderFlag{name: "set network forward mode"}
+	SET_NETWORK_BRIDGE_NAME  = &NetworkBuilderFlag{name: "set network bridge name"}
+	SET_NETWORK_IPV4_ADDRESS = &NetworkBuilderFlag{name: "set network IPv4 address"}
+)
+
+type LibvirtNetworkBuilder struct {
+	newNetworkXml *libvirtxml.Network
+	ipv4          *libvirtxml.NetworkIP
+
+	builderFlagMap *types.BuilderFlagMap
+}
+
+func NewLibvirtNetworkBuilder(requiredFlags []*NetworkBuilderFlag, useDefaultBuilderFlags bool) (*LibvirtNetworkBuilder, error) {
+	castedRequiredFlags := []types.BuilderFlag{}
+
+	for _, flag := range requiredFlags {
+		castedRequiredFlags = append(castedRequiredFlags, types.BuilderFlag(flag))
+	}
+
+	builder := &LibvirtNetworkBuilder{}
+	builderFlagMap, err := types.NewFlagMapFromBuilderFlags(
+		castedRequiredFlags,
+		builder.getDefaultBuilderFlags(),
+		useDefaultBuilderFlags,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	builder.newNetworkXml = &libvirtxml.Network{}
+	builder.builderFlagMap = builderFlagMap
+	return builder, nil
+}
+
+func (builder *LibvirtNetworkBuilder) getDefaultBuilderFlags() []types.BuilderFlag {
+	return []types.BuilderFlag{
+		SET_NETWORK_NAME,
+		SET_NETWORK_FORWARD_MODE,
+		SET_NETWORK_BRIDGE_NAME,
+		SET_NETWORK_IPV4_ADDRESS,
+	}
+}
+
+func (builder *LibvirtNetworkBuilder) WithNetworkName(name string) *LibvirtNetworkBuilder {
+	logger.Info("setting network name")
+	builder.newNetworkXml.Name = name
+
+	builder.builderFlagMap.MarkAsChecked(SET_NETWORK_NAME)
+	return builder
+}
+
+// isolated networks have no <forward> element at all,
+// the guests can only talk to each other and the host
+func (builder *LibvirtNetworkBuilder) WithForwardMode(mode string, device string) *LibvirtNetworkBuilder {
+	logger.Info("setting network forward mode")
+
+	switch mode {
+	case NETWORK_FORWARD_MODE_ISOLATED, "":
+		builder.newNetworkXml.Forward = nil
+	case NETWORK_FORWARD_MODE_NAT:
+		builder.newNetworkXml.Forward = &libvirtxml.NetworkForward{
+			Mode: mode,
+			Dev:  device,
+			NAT: &libvirtxml.NetworkForwardNAT{
+				Ports: []libvirtxml.NetworkForwardNATPort{{Start: 1024, End: 65535}},
+			},
+		}
+	default:
+		builder.newNetworkXml.Forward = &libvirtxml.NetworkForward{Mode: mode, Dev: device}
+	}
+
+	builder.builderFlagMap.MarkAsChecked(SET_NETWORK_FORWARD_MODE)
+	return builder
+}
+
+func (builder *LibvirtNetworkBuilder) WithBridgeName(name string) *LibvirtNetworkBuilder {
+	logger.Info("setting network bridge name")
+	builder.newNetworkXml.Bridge = &libvirtxml.NetworkBridge{Name: name, STP: "on", Delay: "0"}
+
+	builder.builderFlagMap.MarkAsChecked(SET_NETWORK_BRIDGE_NAME)
+	return builder
+}
+
+func (builder *LibvirtNetworkBuilder) WithIPv4Address(address string, prefix uint) *LibvirtNetworkBuilder {
+	logger.Info("setting network IPv4 address")
+	if builder.ipv4 == nil {
+		builder.ipv4 = &libvirtxml.NetworkIP{Family: "ipv4"}
+	}
+	builder.ipv4.Address = address
+	builder.ipv4.Prefix = prefix
+
+	builder.builderFlagMap.MarkAsChecked(SET_NETWORK_IPV4_ADDRESS)
+	return builder
+}
+
+func (builder *LibvirtNetworkBuilder) WithDHCPRange(start string, end string) *LibvirtNetworkBuilder {
+	logger.Info("setting network DHCP range")
+	dhcp := builder.getDHCP()
+	dhcp.Ranges = append(dhcp.Ranges, libvirtxml.NetworkDHCPRange{Start: start, End: end})
+
+	// no flag coz DHCP is optional
+	return builder
+}
+
+func (builder *LibvirtNetworkBuilder) WithDHCPHost(mac string, name string, ip string) *LibvirtNetworkBuilder {
+	logger.Info("adding network DHCP host")
+	dhcp := builder.getDHCP()
+	dhcp.Hosts = append(dhcp.Hosts, libvirtxml.NetworkDHCPHost{MAC: mac, Name: name, IP: ip})
+
+	return builder
+}
+
+func (builder *LibvirtNetworkBuilder) WithDomainName(name string) *LibvirtNetworkBuilder {
+	logger.Info("setting network DNS domain")
+	builder.newNetworkXml.Domain = &libvirtxml.NetworkDomain{Name: name, LocalOnly: "yes"}
+
+	return builder
+}
+
+func (builder *LibvirtNetworkBuilder) getDHCP() *libvirtxml.NetworkDHCP {
+	if builder.ipv4 == nil {
+		builder.ipv4 = &libvirtxml.NetworkIP{Family: "ipv4"}
+	}
+	if builder.ipv4.DHCP == nil {
+		builder.ipv4.DHCP = &libvirtxml.NetworkDHCP{}
+	}
+	return builder.ipv4.DHCP
+}
+
+func (builder *LibvirtNetworkBuilder) Verify() error {
+	return builder.builderFlagMap.Verify()
+}
+
+func (builder *LibvirtNetworkBuilder) BuildXMLString() (string, error) {
+	if err := builder.Verify(); err != nil {
+		return "", err
+	}
+
+	builder.newNetworkXml.IPs = []libvirtxml.NetworkIP{}
+	if builder.ipv4 != nil {
+		builder.newNetworkXml.IPs = append(builder.newNetworkXml.IPs, *builder.ipv4)
+	}
+
+	xmlString, err := builder.newNetworkXml.Marshal()
+	if err != nil {
+		return "", fmt.Errorf("unable to serialize network from XML definition due to %v", err)
+	}
+
+	return xmlString, nil
+}
+
+func (builder *LibvirtNetworkBuilder) Build(conn *libvirt.Connect) (*libvirt.Network, error) {
+	xmlDefinition, err := builder.BuildXMLString()
+	if err != nil {
+		return nil, err
+	}
+
+	network, err := conn.NetworkDefineXML(xmlDefinition)
+	if err != nil {
+		return nil, err
+	}
+
+	return network, err
+}
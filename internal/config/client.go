@@ -0,0 +1,121 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/goccy/go-yaml"
+	"github.com/nnurry/harmonia/internal/connconfig"
+	"github.com/nnurry/harmonia/internal/contract"
+)
+
+const (
+	CLIENT_CONFIG_DIR  = "harmonia"
+	CLIENT_CONFIG_FILE = "config.yaml"
+)
+
+// what the CLI talks to by default, flags given on the command line win
+type ClientContext struct {
+	HypervisorConnection contract.HypervisorConnectionConfig `json:"hypervisor_connection"`
+	// used by commands filtering by fleet when --fleet is not given
+	Fleet string          `json:"fleet,omitempty"`
+	API   ClientAPIConfig `json:"api,omitempty"`
+}
+
+// when server_url is set the CLI goes through the API instead of libvirt and SSH
+type ClientAPIConfig struct {
+	ServerURL string `json:"server_url,omitempty"`
+	Token     string `json:"token,omitempty"`
+	// hypervisor of the server config used when commands name none, empty is its default_hypervisor
+	Hypervisor string `json:"hypervisor,omitempty"`
+	CAFile     string `json:"ca_file,omitempty"`
+	CertFile   string `json:"cert_file,omitempty"`
+	KeyFile    string `json:"key_file,omitempty"`
+}
+
+// copy safe to print, SSH secrets and the API token are masked
+func (clientContext ClientContext) Redacted() ClientContext {
+	clientContext.HypervisorConnection = clientContext.HypervisorConnection.Redacted()
+	if clientContext.API.Token != "" {
+		clientContext.API.Token = connconfig.REDACTED
+	}
+	return clientContext
+}
+
+type ClientConfig struct {
+	CurrentContext string                   `json:"current_context"`
+	Contexts       map[string]ClientContext `json:"contexts"`
+}
+
+// ~/.config/harmonia/config.yaml, or wherever the OS keeps user config
+func DefaultClientConfigPath() string {
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		configDir = "."
+	}
+	return filepath.Join(configDir, CLIENT_CONFIG_DIR, CLIENT_CONFIG_FILE)
+}
+
+// a missing file is an empty config
+func LoadClientConfig(path string) (*ClientConfig, error) {
+	clientConfig := &ClientConfig{Contexts: map[string]ClientContext{}}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return clientConfig, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read client config '%v': %v", path, err)
+	}
+
+	if err = yaml.Unmarshal(data, clientConfig); err != nil {
+		return nil, fmt.Errorf("could not parse client config '%v': %v", path, err)
+	}
+	if clientConfig.Contexts == nil {
+		clientConfig.Contexts = map[string]ClientContext{}
+	}
+	return clientConfig, nil
+}
+
+// the file may hold SSH passwords and API tokens, only the owner can read it
+func (cfg *ClientConfig) Save(path string) error {
+	data, err := yaml.Marshal(cfg)
+	if err != nil {
+		return fmt.Errorf("could not serialize client config: %v", err)
+	}
+
+	if err = os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("could not create client config directory: %v", err)
+	}
+	if err = os.WriteFile(path, data, 0600); err != nil {
+		return fmt.Errorf("could not write client config '%v': %v", path, err)
+	}
+	return nil
+}
+
+// empty name falls back to current_context, no context at all is an empty one
+func (cfg *ClientConfig) GetContext(name string) (ClientContext, error) {
+	if name == "" {
+		name = cfg.CurrentContext
+	}
+	if name == "" {
+		return ClientContext{}, nil
+	}
+
+	clientContext, ok := cfg.Contexts[name]
+	if !ok {
+		return ClientContext{}, fmt.Errorf("context '%v' not defined", name)
+	}
+	return clientContext, nil
+}
+
+func (cfg *ClientConfig) ContextNames() []string {
+	names := []string{}
+	for name := range cfg.Contexts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
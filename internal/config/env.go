@@ -0,0 +1,105 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const ENV_PREFIX = "HARMONIA_"
+
+type envOverride struct {
+	name  string
+	apply func(cfg *ServerConfig, value string) error
+}
+
+func stringOverride(name string, target func(cfg *ServerConfig) *string) envOverride {
+	return envOverride{name: name, apply: func(cfg *ServerConfig, value string) error {
+		*target(cfg) = value
+		return nil
+	}}
+}
+
+func durationOverride(name string, target func(cfg *ServerConfig) *Duration) envOverride {
+	return envOverride{name: name, apply: func(cfg *ServerConfig, value string) error {
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		*target(cfg) = Duration(parsed)
+		return nil
+	}}
+}
+
+func intOverride(name string, target func(cfg *ServerConfig) *int) envOverride {
+	return envOverride{name: name, apply: func(cfg *ServerConfig, value string) error {
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		*target(cfg) = parsed
+		return nil
+	}}
+}
+
+func boolOverride(name string, target func(cfg *ServerConfig) *bool) envOverride {
+	return envOverride{name: name, apply: func(cfg *ServerConfig, value string) error {
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		*target(cfg) = parsed
+		return nil
+	}}
+}
+
+var ENV_OVERRIDES = []envOverride{
+	stringOverride("LISTEN_ADDRESS", func(cfg *ServerConfig) *string { return &cfg.ListenAddress }),
+	stringOverride("TLS_CERT_FILE", func(cfg *ServerConfig) *string { return &cfg.TLS.CertFile }),
+	stringOverride("TLS_KEY_FILE", func(cfg *ServerConfig) *string { return &cfg.TLS.KeyFile }),
+	stringOverride("TLS_CLIENT_CA_FILE", func(cfg *ServerConfig) *string { return &cfg.TLS.ClientCAFile }),
+	stringOverride("TLS_CLIENT_AUTH", func(cfg *ServerConfig) *string { return &cfg.TLS.ClientAuth }),
+	boolOverride("TLS_SELF_SIGNED", func(cfg *ServerConfig) *bool { return &cfg.TLS.SelfSigned }),
+	durationOverride("TIMEOUT_READ_HEADER", func(cfg *ServerConfig) *Duration { return &cfg.Timeouts.ReadHeader }),
+	durationOverride("TIMEOUT_READ", func(cfg *ServerConfig) *Duration { return &cfg.Timeouts.Read }),
+	durationOverride("TIMEOUT_WRITE", func(cfg *ServerConfig) *Duration { return &cfg.Timeouts.Write }),
+	durationOverride("TIMEOUT_IDLE", func(cfg *ServerConfig) *Duration { return &cfg.Timeouts.Idle }),
+	durationOverride("TIMEOUT_SHUTDOWN", func(cfg *ServerConfig) *Duration { return &cfg.Timeouts.Shutdown }),
+	durationOverride("TIMEOUT_SSH", func(cfg *ServerConfig) *Duration { return &cfg.Timeouts.SSH }),
+	stringOverride("CLOUD_INIT_DIR", func(cfg *ServerConfig) *string { return &cfg.Paths.CloudInitDir }),
+	stringOverride("DISK_DIR", func(cfg *ServerConfig) *string { return &cfg.Paths.DiskDir }),
+	stringOverride("CONSOLE_LOG_DIR", func(cfg *ServerConfig) *string { return &cfg.Paths.ConsoleLogDir }),
+	stringOverride("LOG_LEVEL", func(cfg *ServerConfig) *string { return &cfg.Logging.Level }),
+	stringOverride("LOG_FORMAT", func(cfg *ServerConfig) *string { return &cfg.Logging.Format }),
+	intOverride("MAX_CONCURRENT_REQUESTS", func(cfg *ServerConfig) *int { return &cfg.Limits.MaxConcurrentRequests }),
+	intOverride("MAX_CONCURRENT_VM_OPERATIONS", func(cfg *ServerConfig) *int { return &cfg.Limits.MaxConcurrentVMOperations }),
+	stringOverride("DEFAULT_HYPERVISOR", func(cfg *ServerConfig) *string { return &cfg.DefaultHypervisor }),
+	stringOverride("STATE_PATH", func(cfg *ServerConfig) *string { return &cfg.StatePath }),
+	stringOverride("AUDIT_PATH", func(cfg *ServerConfig) *string { return &cfg.Audit.Path }),
+	stringOverride("SECRETS_DIR", func(cfg *ServerConfig) *string { return &cfg.Interpolation.SecretsDir }),
+}
+
+// names of every supported variable, e.g. HARMONIA_LISTEN_ADDRESS
+func EnvNames() []string {
+	names := []string{}
+	for _, override := range ENV_OVERRIDES {
+		names = append(names, ENV_PREFIX+override.name)
+	}
+	return names
+}
+
+// lookup is os.LookupEnv outside of tests
+func (cfg *ServerConfig) ApplyEnv(lookup func(string) (string, bool)) error {
+	for _, override := range ENV_OVERRIDES {
+		envName := ENV_PREFIX + override.name
+		value, ok := lookup(envName)
+		if !ok {
+			continue
+		}
+		if err := override.apply(cfg, strings.TrimSpace(value)); err != nil {
+			return fmt.Errorf("invalid %v: %v", envName, err)
+		}
+	}
+	return nil
+}
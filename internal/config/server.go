@@ -0,0 +1,305 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/goccy/go-yaml"
+	"github.com/nnurry/harmonia/internal/audit"
+	"github.com/nnurry/harmonia/internal/auth"
+	"github.com/nnurry/harmonia/internal/connconfig"
+	"github.com/nnurry/harmonia/internal/contract"
+	"github.com/nnurry/harmonia/internal/defaults"
+	"github.com/nnurry/harmonia/internal/interpolate"
+	"github.com/nnurry/harmonia/internal/logger"
+	"github.com/nnurry/harmonia/internal/store"
+)
+
+const (
+	DEFAULT_LISTEN_ADDRESS   = ":15000"
+	DEFAULT_SELF_SIGNED_DIR  = "/var/lib/harmonia/tls"
+	TLS_CLIENT_AUTH_REQUIRE  = "require"
+	TLS_CLIENT_AUTH_OPTIONAL = "optional"
+)
+
+const (
+	DEFAULT_READ_HEADER_TIMEOUT = 10 * time.Second
+	DEFAULT_READ_TIMEOUT        = 60 * time.Second
+	DEFAULT_IDLE_TIMEOUT        = 120 * time.Second
+	DEFAULT_SHUTDOWN_TIMEOUT    = 30 * time.Second
+)
+
+// time.Duration written as "30s" in YAML/JSON instead of nanoseconds
+type Duration time.Duration
+
+func (duration Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(duration).String()), nil
+}
+
+func (duration *Duration) UnmarshalText(text []byte) error {
+	parsed, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*duration = Duration(parsed)
+	return nil
+}
+
+func (duration Duration) Duration() time.Duration {
+	return time.Duration(duration)
+}
+
+type TLSConfig struct {
+	CertFile     string `json:"cert_file"`
+	KeyFile      string `json:"key_file"`
+	ClientCAFile string `json:"client_ca_file"`
+	// require (default when client_ca_file is set) or optional
+	ClientAuth string `json:"client_auth"`
+	// generate cert_file/key_file under self_signed_dir if missing, for lab use
+	SelfSigned    bool     `json:"self_signed"`
+	SelfSignedDir string   `json:"self_signed_dir"`
+	Hosts         []string `json:"hosts"`
+}
+
+func (cfg TLSConfig) Enabled() bool {
+	return cfg.SelfSigned || cfg.CertFile != "" || cfg.KeyFile != ""
+}
+
+func (cfg TLSConfig) Validate() error {
+	if !cfg.Enabled() {
+		if cfg.ClientCAFile != "" {
+			return fmt.Errorf("client_ca_file needs TLS to be enabled")
+		}
+		return nil
+	}
+	if !cfg.SelfSigned && (cfg.CertFile == "" || cfg.KeyFile == "") {
+		return fmt.Errorf("both cert_file and key_file are required")
+	}
+	switch cfg.ClientAuth {
+	case "", TLS_CLIENT_AUTH_REQUIRE, TLS_CLIENT_AUTH_OPTIONAL:
+	default:
+		return fmt.Errorf("unknown client_auth '%v'", cfg.ClientAuth)
+	}
+	if cfg.ClientAuth != "" && cfg.ClientCAFile == "" {
+		return fmt.Errorf("client_auth needs client_ca_file")
+	}
+	return nil
+}
+
+// zero disables a timeout, write stays disabled by default since fleets take long
+type TimeoutsConfig struct {
+	ReadHeader Duration `json:"read_header"`
+	Read       Duration `json:"read"`
+	Write      Duration `json:"write"`
+	Idle       Duration `json:"idle"`
+	Shutdown   Duration `json:"shutdown"`
+	SSH        Duration `json:"ssh"`
+}
+
+func (cfg TimeoutsConfig) Validate() error {
+	timeouts := map[string]Duration{
+		"read_header": cfg.ReadHeader,
+		"read":        cfg.Read,
+		"write":       cfg.Write,
+		"idle":        cfg.Idle,
+		"shutdown":    cfg.Shutdown,
+		"ssh":         cfg.SSH,
+	}
+	for name, timeout := range timeouts {
+		if timeout < 0 {
+			return fmt.Errorf("timeout %v is negative", name)
+		}
+	}
+	if cfg.Shutdown == 0 {
+		return fmt.Errorf("timeout shutdown must be positive")
+	}
+	return nil
+}
+
+type PathsConfig struct {
+	// cloud-init data of every VM goes to <cloud_init_dir>/<vm name>/<timestamp>
+	CloudInitDir string `json:"cloud_init_dir"`
+	// empty keeps new disks next to the base VM disk
+	DiskDir string `json:"disk_dir"`
+	// serial console output of every VM goes to <console_log_dir>/<vm name>/console.log
+	ConsoleLogDir string `json:"console_log_dir"`
+}
+
+type LoggingConfig struct {
+	Level  string `json:"level"`
+	Format string `json:"format"`
+}
+
+func (cfg LoggingConfig) Validate() error {
+	return logger.Validate(cfg.Level, cfg.Format)
+}
+
+// zero means unlimited
+type LimitsConfig struct {
+	MaxConcurrentRequests int `json:"max_concurrent_requests"`
+	// VMs of a fleet created or deleted in parallel, 1 keeps them sequential
+	MaxConcurrentVMOperations int `json:"max_concurrent_vm_operations"`
+}
+
+func (cfg LimitsConfig) Validate() error {
+	if cfg.MaxConcurrentRequests < 0 {
+		return fmt.Errorf("max_concurrent_requests is negative")
+	}
+	if cfg.MaxConcurrentVMOperations < 1 {
+		return fmt.Errorf("max_concurrent_vm_operations must be at least 1")
+	}
+	return nil
+}
+
+type ServerConfig struct {
+	ListenAddress     string                                         `json:"listen_address"`
+	TLS               TLSConfig                                      `json:"tls"`
+	Timeouts          TimeoutsConfig                                 `json:"timeouts"`
+	Paths             PathsConfig                                    `json:"paths"`
+	Logging           LoggingConfig                                  `json:"logging"`
+	Limits            LimitsConfig                                   `json:"limits"`
+	DefaultHypervisor string                                         `json:"default_hypervisor"`
+	Hypervisors       map[string]contract.HypervisorConnectionConfig `json:"hypervisors"`
+	StatePath         string                                         `json:"state_path"`
+	Audit             audit.Config                                   `json:"audit"`
+	Auth              auth.Config                                    `json:"auth"`
+	// referred to by instance_type of VMs, fleets can define their own in shared_config
+	InstanceTypes map[string]contract.InstanceType `json:"instance_types"`
+	// where ${secret:name} and ${file:/path} in requests are read from
+	Interpolation interpolate.Config `json:"interpolation"`
+	// of hypervisors not defined in hypervisors, admission sent along a request is ignored
+	Admission contract.AdmissionConfig `json:"admission"`
+}
+
+func NewServerConfig() *ServerConfig {
+	return &ServerConfig{
+		ListenAddress: DEFAULT_LISTEN_ADDRESS,
+		TLS:           TLSConfig{SelfSignedDir: DEFAULT_SELF_SIGNED_DIR},
+		Timeouts: TimeoutsConfig{
+			ReadHeader: Duration(DEFAULT_READ_HEADER_TIMEOUT),
+			Read:       Duration(DEFAULT_READ_TIMEOUT),
+			Idle:       Duration(DEFAULT_IDLE_TIMEOUT),
+			Shutdown:   Duration(DEFAULT_SHUTDOWN_TIMEOUT),
+			SSH:        Duration(connconfig.DEFAULT_SSH_TIMEOUT),
+		},
+		Paths:         PathsConfig{CloudInitDir: defaults.CLOUD_INIT_DIR, ConsoleLogDir: defaults.CONSOLE_LOG_DIR},
+		Logging:       LoggingConfig{Level: logger.DEFAULT_LEVEL, Format: logger.FORMAT_JSON},
+		Limits:        LimitsConfig{MaxConcurrentVMOperations: 1},
+		Hypervisors:   map[string]contract.HypervisorConnectionConfig{},
+		StatePath:     store.DEFAULT_STATE_PATH,
+		Audit:         audit.NewConfig(),
+		Interpolation: interpolate.NewConfig(),
+	}
+}
+
+func (cfg *ServerConfig) Validate() error {
+	if cfg.ListenAddress == "" {
+		return fmt.Errorf("listen_address is empty")
+	}
+	if err := cfg.TLS.Validate(); err != nil {
+		return fmt.Errorf("invalid tls config: %v", err)
+	}
+	if err := cfg.Timeouts.Validate(); err != nil {
+		return fmt.Errorf("invalid timeouts config: %v", err)
+	}
+	if cfg.Paths.CloudInitDir == "" {
+		return fmt.Errorf("invalid paths config: cloud_init_dir is empty")
+	}
+	if cfg.Paths.ConsoleLogDir == "" {
+		return fmt.Errorf("invalid paths config: console_log_dir is empty")
+	}
+	if err := cfg.Logging.Validate(); err != nil {
+		return fmt.Errorf("invalid logging config: %v", err)
+	}
+	if err := cfg.Limits.Validate(); err != nil {
+		return fmt.Errorf("invalid limits config: %v", err)
+	}
+	if cfg.DefaultHypervisor != "" {
+		if _, ok := cfg.Hypervisors[cfg.DefaultHypervisor]; !ok {
+			return fmt.Errorf("default_hypervisor '%v' is not defined", cfg.DefaultHypervisor)
+		}
+	}
+	if cfg.StatePath == "" {
+		return fmt.Errorf("state_path is empty")
+	}
+	if err := cfg.Interpolation.Validate(); err != nil {
+		return fmt.Errorf("invalid interpolation config: %v", err)
+	}
+	for name, instanceType := range cfg.InstanceTypes {
+		if err := instanceType.Validate(); err != nil {
+			return fmt.Errorf("invalid instance type %v: %v", name, err)
+		}
+	}
+	if err := cfg.Audit.Validate(); err != nil {
+		return fmt.Errorf("invalid audit config: %v", err)
+	}
+	if err := cfg.Auth.Validate(); err != nil {
+		return fmt.Errorf("invalid auth config: %v", err)
+	}
+	return nil
+}
+
+// empty path means no config file, every setting stays at its default;
+// HARMONIA_* environment variables are applied on top of the file
+func LoadServerConfig(path string) (*ServerConfig, error) {
+	serverConfig := NewServerConfig()
+
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("could not read server config '%v': %v", path, err)
+		}
+
+		if err = yaml.Unmarshal(data, serverConfig); err != nil {
+			return nil, fmt.Errorf("could not parse server config '%v': %v", path, err)
+		}
+	}
+
+	if serverConfig.Hypervisors == nil {
+		serverConfig.Hypervisors = map[string]contract.HypervisorConnectionConfig{}
+	}
+
+	if err := serverConfig.ApplyEnv(os.LookupEnv); err != nil {
+		return nil, err
+	}
+
+	return serverConfig, nil
+}
+
+// admission of the hypervisor defined with name, else the one of the server config
+func (cfg *ServerConfig) GetAdmission(name string) contract.AdmissionConfig {
+	if name == "" {
+		name = cfg.DefaultHypervisor
+	}
+	if hypervisorConfig, ok := cfg.Hypervisors[name]; ok {
+		return hypervisorConfig.Admission
+	}
+	return cfg.Admission
+}
+
+// empty name falls back to default_hypervisor
+func (cfg *ServerConfig) GetHypervisor(name string) (*contract.HypervisorConnectionConfig, error) {
+	if name == "" {
+		if cfg.DefaultHypervisor == "" {
+			return nil, fmt.Errorf("no hypervisor given and no default_hypervisor configured")
+		}
+		name = cfg.DefaultHypervisor
+	}
+
+	hypervisorConfig, ok := cfg.Hypervisors[name]
+	if !ok {
+		return nil, fmt.Errorf("hypervisor '%v' not defined", name)
+	}
+	return &hypervisorConfig, nil
+}
+
+// copy safe to print, SSH secrets of hypervisors are masked
+func (cfg *ServerConfig) Redacted() ServerConfig {
+	redacted := *cfg
+	redacted.Hypervisors = map[string]contract.HypervisorConnectionConfig{}
+	for name, hypervisorConfig := range cfg.Hypervisors {
+		redacted.Hypervisors[name] = hypervisorConfig.Redacted()
+	}
+	return redacted
+}
@@ -1,4 +1,4 @@
-package connection
+package connconfig
 
 type LibvirtConfig struct {
 	ConnectionUrl string `json:"connection_url"`
@@ -1,9 +1,10 @@
-package connection
+package connconfig
 
 import (
 	"errors"
 	"fmt"
 	"os"
+	"time"
 
 	"golang.org/x/crypto/ssh"
 )
@@ -14,6 +15,8 @@ type SSHConfig struct {
 	Port int    `json:"port"`
 
 	HostKeyCallbackName string `json:"hostkey_callback_name"`
+	// authorized_keys line of the only host key FixedHostKey accepts
+	HostKey string `json:"host_key,omitempty"`
 
 	PasswordAuth   passwordAuthSSHConfig   `json:"password_auth_config"`
 	PrivateKeyAuth privateKeyAuthSSHConfig `json:"privkey_auth_config"`
@@ -25,13 +28,41 @@ type passwordAuthSSHConfig struct {
 
 type privateKeyAuthSSHConfig struct {
 	PrivateKeyPath string `json:"path"`
-	Passphrase     string `json:"passphrase"`
+	// PEM of the key, wins over path
+	PrivateKey string `json:"content,omitempty"`
+	Passphrase string `json:"passphrase"`
+}
+
+const REDACTED = "<redacted>"
+
+const DEFAULT_SSH_TIMEOUT = 360 * time.Second
+
+func (cfg SSHConfig) Redacted() SSHConfig {
+	if cfg.PasswordAuth.Password != "" {
+		cfg.PasswordAuth.Password = REDACTED
+	}
+	if cfg.PrivateKeyAuth.PrivateKey != "" {
+		cfg.PrivateKeyAuth.PrivateKey = REDACTED
+	}
+	if cfg.PrivateKeyAuth.Passphrase != "" {
+		cfg.PrivateKeyAuth.Passphrase = REDACTED
+	}
+	return cfg
 }
 
 func (cfg SSHConfig) HostKeyCallback(callbackName string) (ssh.HostKeyCallback, error) {
 	switch callbackName {
 	case "InsecureIgnoreHostKey":
 		return ssh.InsecureIgnoreHostKey(), nil
+	case "FixedHostKey":
+		if cfg.HostKey == "" {
+			return nil, errors.New("no host key to pin")
+		}
+		hostKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(cfg.HostKey))
+		if err != nil {
+			return nil, fmt.Errorf("can't parse host key: %v", err)
+		}
+		return ssh.FixedHostKey(hostKey), nil
 	}
 	return nil, errors.New("unsupported host key callback")
 }
@@ -44,16 +75,31 @@ func (cfg SSHConfig) ParsePasswordAuth() (ssh.AuthMethod, error) {
 }
 
 func (cfg SSHConfig) ParsePrivateKeyAuth() (ssh.AuthMethod, error) {
-	if cfg.PrivateKeyAuth.PrivateKeyPath == "" {
-		return nil, fmt.Errorf("empty private key path")
+	signer, err := cfg.ParsePrivateKey()
+	if err != nil {
+		return nil, err
 	}
+	return ssh.PublicKeys(signer), nil
+}
 
-	keyContent, err := os.ReadFile(cfg.PrivateKeyAuth.PrivateKeyPath)
-	if err != nil {
-		return nil, fmt.Errorf("can't read private key: %v", err)
+func (cfg SSHConfig) ParsePrivateKey() (ssh.Signer, error) {
+	keyContent := []byte(cfg.PrivateKeyAuth.PrivateKey)
+	if len(keyContent) < 1 {
+		if cfg.PrivateKeyAuth.PrivateKeyPath == "" {
+			return nil, fmt.Errorf("empty private key path")
+		}
+
+		var err error
+		keyContent, err = os.ReadFile(cfg.PrivateKeyAuth.PrivateKeyPath)
+		if err != nil {
+			return nil, fmt.Errorf("can't read private key: %v", err)
+		}
 	}
 
-	var signer ssh.Signer
+	var (
+		signer ssh.Signer
+		err    error
+	)
 
 	if cfg.PrivateKeyAuth.Passphrase != "" {
 		signer, err = ssh.ParsePrivateKeyWithPassphrase(keyContent, []byte(cfg.PrivateKeyAuth.Passphrase))
@@ -67,5 +113,5 @@ func (cfg SSHConfig) ParsePrivateKeyAuth() (ssh.AuthMethod, error) {
 		}
 	}
 
-	return ssh.PublicKeys(signer), nil
+	return signer, nil
 }
@@ -0,0 +1,11 @@
+package connection
+
+import "github.com/nnurry/harmonia/internal/connconfig"
+
+// the config types live apart so contract does not pull in the libvirt bindings
+type (
+	LibvirtConfig = connconfig.LibvirtConfig
+	SSHConfig     = connconfig.SSHConfig
+)
+
+const REDACTED = connconfig.REDACTED
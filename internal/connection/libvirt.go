@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"net/url"
 
+	"github.com/nnurry/harmonia/internal/metrics"
 	"libvirt.org/go/libvirt"
 )
 
@@ -38,6 +39,7 @@ func NewLibvirt(config LibvirtConfig) (*Libvirt, error) {
 	}
 
 	connection.connect = libvirtConnection
+	metrics.ConnectionOpened(metrics.CONNECTION_LIBVIRT)
 
 	return connection, nil
 }
@@ -56,5 +58,6 @@ func (connection *Libvirt) Connect() *libvirt.Connect {
 
 func (connection *Libvirt) Cleanup() error {
 	_, err := connection.connect.Close()
+	metrics.ConnectionClosed(metrics.CONNECTION_LIBVIRT)
 	return err
 }
@@ -5,10 +5,21 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/nnurry/harmonia/internal/connconfig"
 	"github.com/nnurry/harmonia/internal/logger"
+	"github.com/nnurry/harmonia/internal/metrics"
 	"golang.org/x/crypto/ssh"
 )
 
+const DEFAULT_SSH_TIMEOUT = connconfig.DEFAULT_SSH_TIMEOUT
+
+var sshTimeout = DEFAULT_SSH_TIMEOUT
+
+// applies to every SSH connection opened afterwards
+func SetSSHTimeout(timeout time.Duration) {
+	sshTimeout = timeout
+}
+
 type SSH struct {
 	client *ssh.Client
 }
@@ -25,7 +36,7 @@ func NewSSH(config SSHConfig) (*SSH, error) {
 		User:            config.User,
 		Auth:            []ssh.AuthMethod{},
 		HostKeyCallback: hostKeyCallback,
-		Timeout:         time.Duration(360 * time.Second),
+		Timeout:         sshTimeout,
 	}
 
 	// let's parse both and see what we got
@@ -55,6 +66,7 @@ func NewSSH(config SSHConfig) (*SSH, error) {
 	}
 
 	connection.client = client
+	metrics.ConnectionOpened(metrics.CONNECTION_SSH)
 	logger.Info("created SSH client")
 
 	return connection, nil
@@ -73,5 +85,6 @@ func (connection *SSH) Session() (*ssh.Session, error) {
 }
 
 func (connection *SSH) Cleanup() error {
+	metrics.ConnectionClosed(metrics.CONNECTION_SSH)
 	return connection.client.Close()
 }
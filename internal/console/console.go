@@ -0,0 +1,98 @@
+package console
+
+import (
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// Ctrl-], the byte detaching an interactive console like virsh console does
+	ESCAPE_BYTE = 0x1d
+	ESCAPE_NAME = "Ctrl-]"
+
+	// what the console endpoint speaks, clients must offer it
+	SUBPROTOCOL = "harmonia.console"
+	// browsers can't set headers on WebSocket requests, they offer the token as "bearer.<token>" instead
+	BEARER_SUBPROTOCOL_PREFIX = "bearer."
+)
+
+// token offered as a bearer subprotocol, empty if none
+func BearerFromSubprotocols(request *http.Request) string {
+	for _, subprotocol := range websocket.Subprotocols(request) {
+		if token, found := strings.CutPrefix(subprotocol, BEARER_SUBPROTOCOL_PREFIX); found {
+			return token
+		}
+	}
+	return ""
+}
+
+// console bytes over a WebSocket, one binary message per write
+type WebSocketStream struct {
+	conn   *websocket.Conn
+	reader io.Reader
+}
+
+func NewWebSocketStream(conn *websocket.Conn) *WebSocketStream {
+	return &WebSocketStream{conn: conn}
+}
+
+// text and binary messages alike are keystrokes, a normal close is io.EOF
+func (stream *WebSocketStream) Read(p []byte) (int, error) {
+	for {
+		if stream.reader == nil {
+			_, reader, err := stream.conn.NextReader()
+			if websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				return 0, io.EOF
+			}
+			if err != nil {
+				return 0, err
+			}
+			stream.reader = reader
+		}
+
+		n, err := stream.reader.Read(p)
+		if err == io.EOF {
+			stream.reader = nil
+			if n > 0 {
+				return n, nil
+			}
+			continue
+		}
+		return n, err
+	}
+}
+
+func (stream *WebSocketStream) Write(p []byte) (int, error) {
+	if err := stream.conn.WriteMessage(websocket.BinaryMessage, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// says goodbye before closing, the peer may already be gone
+func (stream *WebSocketStream) Close() error {
+	message := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")
+	stream.conn.WriteMessage(websocket.CloseMessage, message)
+	return stream.conn.Close()
+}
+
+// copies both ways until either side is done, then closes both
+func Bridge(console io.ReadWriteCloser, peer io.ReadWriteCloser) error {
+	errChan := make(chan error, 2)
+	go func() {
+		_, err := io.Copy(peer, console)
+		errChan <- err
+	}()
+	go func() {
+		_, err := io.Copy(console, peer)
+		errChan <- err
+	}()
+
+	err := <-errChan
+	console.Close()
+	peer.Close()
+	return err
+}
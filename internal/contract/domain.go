@@ -0,0 +1,109 @@
+package contract
+
+import (
+	"encoding/xml"
+	"sort"
+)
+
+const HARMONIA_METADATA_NAMESPACE = "https://github.com/nnurry/harmonia/xmlns/domain/1.0"
+
+// written into <metadata> of every domain harmonia creates
+type HarmoniaDomainMetadata struct {
+	XMLName     xml.Name     `xml:"https://github.com/nnurry/harmonia/xmlns/domain/1.0 instance" json:"-"`
+	Fleet       string       `xml:"fleet,omitempty" json:"fleet,omitempty"`
+	CreatedAt   string       `xml:"created_at" json:"created_at"`
+	SourceImage string       `xml:"source_image,omitempty" json:"source_image,omitempty"`
+	BaseVM      string       `xml:"base_vm,omitempty" json:"base_vm,omitempty"`
+	ConfigHash  string       `xml:"config_hash,omitempty" json:"config_hash,omitempty"`
+	Labels      DomainLabels `xml:"labels,omitempty" json:"labels,omitempty"`
+}
+
+type DomainLabels map[string]string
+
+type domainLabel struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type domainLabelList struct {
+	Labels []domainLabel `xml:"label"`
+}
+
+// <labels><label key="..." value="..."/></labels>, sorted by key
+func (labels DomainLabels) MarshalXML(encoder *xml.Encoder, start xml.StartElement) error {
+	keys := []string{}
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	labelList := domainLabelList{}
+	for _, key := range keys {
+		labelList.Labels = append(labelList.Labels, domainLabel{Key: key, Value: labels[key]})
+	}
+	return encoder.EncodeElement(labelList, start)
+}
+
+func (labels *DomainLabels) UnmarshalXML(decoder *xml.Decoder, start xml.StartElement) error {
+	labelList := domainLabelList{}
+	if err := decoder.DecodeElement(&labelList, &start); err != nil {
+		return err
+	}
+
+	*labels = DomainLabels{}
+	for _, label := range labelList.Labels {
+		(*labels)[label.Key] = label.Value
+	}
+	return nil
+}
+
+type DomainSummary struct {
+	Name        string `json:"name"`
+	UUID        string `json:"uuid"`
+	State       string `json:"state"`
+	NumOfVCPUs  uint   `json:"vcpus"`
+	MemoryInKiB uint64 `json:"memory_kib"`
+	// reported by the guest agent, or leased by libvirt-managed networks; empty for stopped domains
+	IPv4Addresses []string                `json:"ipv4_addresses"`
+	Harmonia      *HarmoniaDomainMetadata `json:"harmonia,omitempty"`
+}
+
+// empty fields match everything, labels must all match
+type DomainSelector struct {
+	HarmoniaOnly bool              `json:"harmonia_only"`
+	Fleet        string            `json:"fleet"`
+	Labels       map[string]string `json:"labels"`
+}
+
+func (selector DomainSelector) IsEmpty() bool {
+	return !selector.HarmoniaOnly && selector.Fleet == "" && len(selector.Labels) == 0
+}
+
+func (selector DomainSelector) Match(summary DomainSummary) bool {
+	if selector.IsEmpty() {
+		return true
+	}
+	if summary.Harmonia == nil {
+		return false
+	}
+	if selector.Fleet != "" && selector.Fleet != summary.Harmonia.Fleet {
+		return false
+	}
+	for key, value := range selector.Labels {
+		if labelValue, ok := summary.Harmonia.Labels[key]; !ok || labelValue != value {
+			return false
+		}
+	}
+	return true
+}
+
+type ListDomainsRequest struct {
+	IncludeInactive             bool           `json:"all"`
+	Selector                    DomainSelector `json:"selector"`
+	Hypervisor                  string         `json:"hypervisor,omitempty"`
+	*HypervisorConnectionConfig `json:"hypervisor_connection,omitempty"`
+}
+
+type ListDomainsResult struct {
+	Domains []DomainSummary `json:"domains"`
+}
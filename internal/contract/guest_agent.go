@@ -0,0 +1,68 @@
+package contract
+
+const (
+	IP_ADDRESS_TYPE_IPV4 = "ipv4"
+	IP_ADDRESS_TYPE_IPV6 = "ipv6"
+)
+
+type GuestIPAddress struct {
+	Type    string `json:"type"`
+	Address string `json:"address"`
+	Prefix  uint   `json:"prefix"`
+}
+
+// an interface as the guest sees it, reported by qemu-guest-agent
+type GuestInterface struct {
+	Name        string           `json:"name"`
+	MacAddress  string           `json:"mac_address,omitempty"`
+	IPAddresses []GuestIPAddress `json:"ip_addresses"`
+}
+
+type GuestInterfacesResult struct {
+	Name       string           `json:"name"`
+	Hypervisor string           `json:"hypervisor,omitempty"`
+	Interfaces []GuestInterface `json:"interfaces"`
+	Error      string           `json:"error,omitempty"`
+}
+
+// runs path inside the guest without a shell, wrap with /bin/sh -c for one
+type GuestExecRequest struct {
+	Path string   `json:"path"`
+	Args []string `json:"args,omitempty"`
+	// KEY=value pairs
+	Env []string `json:"env,omitempty"`
+	// fed to stdin, base64 in JSON
+	Input []byte `json:"input,omitempty"`
+	// 0 is the default of 30s
+	TimeoutSeconds int `json:"timeout_seconds,omitempty"`
+}
+
+type GuestExecResult struct {
+	Name       string `json:"name"`
+	Hypervisor string `json:"hypervisor,omitempty"`
+	PID        int    `json:"pid"`
+	ExitCode   int    `json:"exit_code"`
+	// set when the command was killed by a signal
+	Signal int `json:"signal,omitempty"`
+	// base64 in JSON, output needn't be text
+	Stdout []byte `json:"stdout"`
+	Stderr []byte `json:"stderr"`
+	// the guest agent caps captured output
+	IsTruncated bool   `json:"is_truncated,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
+
+type GuestFileWriteRequest struct {
+	Path string `json:"path"`
+	// base64 in JSON
+	Content  []byte `json:"content"`
+	IsAppend bool   `json:"is_append,omitempty"`
+}
+
+type GuestFileWriteResult struct {
+	Name         string `json:"name"`
+	Hypervisor   string `json:"hypervisor,omitempty"`
+	Path         string `json:"path"`
+	BytesWritten int    `json:"bytes_written"`
+	Error        string `json:"error,omitempty"`
+}
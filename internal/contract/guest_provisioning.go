@@ -0,0 +1,52 @@
+package contract
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+)
+
+const (
+	PROVISIONER_CLOUD_INIT = "cloud-init"
+	PROVISIONER_IGNITION   = "ignition"
+
+	DEFAULT_GUEST_FILE_MODE = 0644
+)
+
+var PROVISIONERS = []string{PROVISIONER_CLOUD_INIT, PROVISIONER_IGNITION}
+
+// written into the guest on first boot by cloud-init or Ignition
+type GuestFileConfig struct {
+	Path string `json:"path"`
+	// left as is like scripts, its ${VAR} belong to shells and units in the guest
+	Content string `json:"content" interpolate:"-"`
+	// octal, e.g. "0600"; empty is 0644
+	Mode string `json:"mode,omitempty"`
+}
+
+func (file GuestFileConfig) FileMode() (uint32, error) {
+	if file.Mode == "" {
+		return DEFAULT_GUEST_FILE_MODE, nil
+	}
+	mode, err := strconv.ParseUint(file.Mode, 8, 32)
+	if err != nil || mode > 07777 {
+		return 0, fmt.Errorf("mode '%v' of %v is not an octal file mode", file.Mode, file.Path)
+	}
+	return uint32(mode), nil
+}
+
+func (file GuestFileConfig) Validate() error {
+	if !path.IsAbs(file.Path) {
+		return fmt.Errorf("file path '%v' is not absolute", file.Path)
+	}
+	_, err := file.FileMode()
+	return err
+}
+
+// empty is cloud-init
+func (config VirtualMachineConfig) GetProvisioner() string {
+	if config.GeneralVMConfig.Provisioner == "" {
+		return PROVISIONER_CLOUD_INIT
+	}
+	return config.GeneralVMConfig.Provisioner
+}
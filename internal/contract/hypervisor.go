@@ -0,0 +1,64 @@
+package contract
+
+const (
+	ADMISSION_MODE_OFF    = "off"
+	ADMISSION_MODE_WARN   = "warn"
+	ADMISSION_MODE_REJECT = "reject"
+
+	DEFAULT_CPU_OVERCOMMIT_RATIO    = 4.0
+	DEFAULT_MEMORY_OVERCOMMIT_RATIO = 1.0
+	DEFAULT_DISK_OVERCOMMIT_RATIO   = 1.0
+)
+
+// ratios are applied against physical capacity, 0 means default ratio
+type AdmissionConfig struct {
+	Mode                  string  `json:"mode"`
+	CPUOvercommitRatio    float64 `json:"cpu_overcommit_ratio,omitempty"`
+	MemoryOvercommitRatio float64 `json:"memory_overcommit_ratio,omitempty"`
+	DiskOvercommitRatio   float64 `json:"disk_overcommit_ratio,omitempty"`
+}
+
+func (config AdmissionConfig) GetCoalesced() AdmissionConfig {
+	if config.Mode == "" {
+		config.Mode = ADMISSION_MODE_WARN
+	}
+	if config.CPUOvercommitRatio <= 0 {
+		config.CPUOvercommitRatio = DEFAULT_CPU_OVERCOMMIT_RATIO
+	}
+	if config.MemoryOvercommitRatio <= 0 {
+		config.MemoryOvercommitRatio = DEFAULT_MEMORY_OVERCOMMIT_RATIO
+	}
+	if config.DiskOvercommitRatio <= 0 {
+		config.DiskOvercommitRatio = DEFAULT_DISK_OVERCOMMIT_RATIO
+	}
+	return config
+}
+
+type StoragePoolCapacity struct {
+	Name            string `json:"name"`
+	Path            string `json:"path"`
+	IsActive        bool   `json:"active"`
+	CapacityBytes   uint64 `json:"capacity_bytes"`
+	AllocationBytes uint64 `json:"allocation_bytes"`
+	AvailableBytes  uint64 `json:"available_bytes"`
+}
+
+type HypervisorCapacity struct {
+	Name     string `json:"name"`
+	CPUModel string `json:"cpu_model"`
+	CPUs     uint   `json:"cpus"`
+
+	TotalMemoryKiB uint64 `json:"total_memory_kib"`
+	FreeMemoryKiB  uint64 `json:"free_memory_kib"`
+
+	// summed over every defined domain, running or not
+	NumOfDomains       int    `json:"domains"`
+	AllocatedVCPUs     uint   `json:"allocated_vcpus"`
+	AllocatedMemoryKiB uint64 `json:"allocated_memory_kib"`
+
+	// summed over running domains only
+	RunningVCPUs     uint   `json:"running_vcpus"`
+	RunningMemoryKiB uint64 `json:"running_memory_kib"`
+
+	StoragePools []StoragePoolCapacity `json:"storage_pools"`
+}
@@ -0,0 +1,71 @@
+package contract
+
+import (
+	"fmt"
+	"slices"
+)
+
+var (
+	CPU_MODES  = []string{"host-passthrough", "host-model", "maximum", "custom"}
+	DISK_BUSES = []string{"virtio", "scsi", "sata", "ide"}
+)
+
+// sizing shared by VMs referring to it with instance_type, what a VM sets itself wins
+type InstanceType struct {
+	NumOfVCPUs         int     `json:"vcpu,omitempty"`
+	MemoryInGiB        float64 `json:"memory_gb,omitempty"`
+	DiskSizeInGiB      float64 `json:"disk_gb,omitempty"`
+	IsCopyOnWriteClone bool    `json:"is_cow_clone,omitempty"`
+
+	// empty keeps what the base VM uses
+	CPUMode  string `json:"cpu_mode,omitempty"`
+	DiskBus  string `json:"disk_bus,omitempty"`
+	NICModel string `json:"nic_model,omitempty"`
+}
+
+func (instanceType InstanceType) Validate() error {
+	if instanceType.CPUMode != "" && !slices.Contains(CPU_MODES, instanceType.CPUMode) {
+		return fmt.Errorf("unknown cpu_mode '%v', use one of %v", instanceType.CPUMode, CPU_MODES)
+	}
+	if instanceType.DiskBus != "" && !slices.Contains(DISK_BUSES, instanceType.DiskBus) {
+		return fmt.Errorf("unknown disk_bus '%v', use one of %v", instanceType.DiskBus, DISK_BUSES)
+	}
+	return nil
+}
+
+// the sizing the VM ends up with, the config as is if it has no instance_type;
+// false if the instance type is not one of instanceTypes
+func (config VirtualMachineConfig) WithInstanceType(instanceTypes map[string]InstanceType) (VirtualMachineConfig, bool) {
+	if config.GeneralVMConfig.InstanceType == "" {
+		return config, true
+	}
+	instanceType, ok := instanceTypes[config.GeneralVMConfig.InstanceType]
+	if !ok {
+		return config, false
+	}
+
+	general := &config.GeneralVMConfig
+	if general.NumOfVCPUs == 0 {
+		general.NumOfVCPUs = instanceType.NumOfVCPUs
+	}
+	if general.MemoryInGiB == 0 {
+		general.MemoryInGiB = instanceType.MemoryInGiB
+	}
+	if general.DiskSizeInGiB == 0 {
+		general.DiskSizeInGiB = instanceType.DiskSizeInGiB
+	}
+	if general.IsCopyOnWriteClone == nil {
+		isCopyOnWriteClone := instanceType.IsCopyOnWriteClone
+		general.IsCopyOnWriteClone = &isCopyOnWriteClone
+	}
+	if general.CPUMode == "" {
+		general.CPUMode = instanceType.CPUMode
+	}
+	if general.DiskBus == "" {
+		general.DiskBus = instanceType.DiskBus
+	}
+	if general.NICModel == "" {
+		general.NICModel = instanceType.NICModel
+	}
+	return config, true
+}
@@ -0,0 +1,23 @@
+package contract
+
+// a fleet as seen by configuration management, built from the state store and the hypervisors
+type FleetInventory struct {
+	Fleet string          `json:"fleet"`
+	Hosts []InventoryHost `json:"hosts"`
+	// group name to host names, the fleet itself is a group of every host
+	Groups map[string][]string `json:"groups"`
+	// per hypervisor or VM, recorded addresses are used for hosts of unreachable hypervisors
+	Errors map[string]string `json:"errors,omitempty"`
+}
+
+type InventoryHost struct {
+	Name       string `json:"name"`
+	Address    string `json:"address,omitempty"`
+	User       string `json:"user,omitempty"`
+	Hypervisor string `json:"hypervisor,omitempty"`
+	State      string `json:"state,omitempty"`
+	// post_provision key of the VM, as a path on the machine that created it
+	PrivateKeyPath string            `json:"private_key_path,omitempty"`
+	Groups         []string          `json:"groups"`
+	Labels         map[string]string `json:"labels,omitempty"`
+}
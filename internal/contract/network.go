@@ -0,0 +1,65 @@
+package contract
+
+type VirtualNetworkConfig struct {
+	Name          string `json:"name"`
+	Mode          string `json:"mode"`
+	BridgeName    string `json:"bridge_name"`
+	ForwardDevice string `json:"forward_device,omitempty"`
+
+	IPv4Address    string `json:"ip_address"`
+	IPv4Prefix     uint   `json:"ip_prefix"`
+	DHCPRangeStart string `json:"dhcp_start,omitempty"`
+	DHCPRangeEnd   string `json:"dhcp_end,omitempty"`
+	DomainName     string `json:"domain,omitempty"`
+
+	Autostart                   bool `json:"autostart"`
+	*HypervisorConnectionConfig `json:"hypervisor_connection,omitempty"`
+}
+
+func (config VirtualNetworkConfig) Redacted() VirtualNetworkConfig {
+	if config.HypervisorConnectionConfig != nil {
+		redactedConnectionConfig := config.HypervisorConnectionConfig.Redacted()
+		config.HypervisorConnectionConfig = &redactedConnectionConfig
+	}
+	return config
+}
+
+type CreateVirtualNetworkRequest struct {
+	VirtualNetworkConfig `json:",inline"`
+}
+
+type DeleteVirtualNetworkRequest struct {
+	Name                        string `json:"name"`
+	*HypervisorConnectionConfig `json:"hypervisor_connection,omitempty"`
+}
+
+type ListVirtualNetworksRequest struct {
+	IncludeInactive             bool `json:"all"`
+	*HypervisorConnectionConfig `json:"hypervisor_connection,omitempty"`
+}
+
+type CreateVirtualNetworkResult struct {
+	UUID  string `json:"uuid,omitempty"`
+	Name  string `json:"name"`
+	Error string `json:"error,omitempty"`
+}
+
+type DeleteVirtualNetworkResult struct {
+	UUID  string `json:"uuid,omitempty"`
+	Name  string `json:"name"`
+	Error string `json:"error,omitempty"`
+	// why the network was left in place though it is no failure, e.g. the fleet didn't create it
+	Kept string `json:"kept,omitempty"`
+}
+
+type VirtualNetworkSummary struct {
+	Name       string `json:"name"`
+	UUID       string `json:"uuid"`
+	BridgeName string `json:"bridge_name"`
+	IsActive   bool   `json:"active"`
+	Autostart  bool   `json:"autostart"`
+}
+
+type ListVirtualNetworksResult struct {
+	Networks []VirtualNetworkSummary `json:"networks"`
+}
@@ -0,0 +1,236 @@
+package contract
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/nnurry/harmonia/internal/connconfig"
+)
+
+// scripts run over SSH as the user of a VM once it is ready
+type PostProvisionConfig struct {
+	// its public key is added to the authorized keys of the user, read by the CLI; the API server
+	// only takes private_key, the CLI fills it from the path before sending
+	PrivateKeyPath string `json:"private_key_path,omitempty"`
+	// PEM of the key, wins over private_key_path
+	PrivateKey string `json:"private_key,omitempty"`
+	Passphrase string `json:"passphrase,omitempty"`
+	// 0 is 22
+	Port int `json:"port,omitempty"`
+	// how long to wait for SSH and cloud-init, 0 is 5 minutes
+	ReadyTimeoutSeconds int `json:"ready_timeout_seconds,omitempty"`
+
+	Steps []PostProvisionStep `json:"steps,omitempty"`
+
+	// PEM of the SSH host key given to the guest upon create, the only one post-provision accepts
+	HostKey string `json:"-" interpolate:"-"`
+}
+
+// one of script and script_path
+type PostProvisionStep struct {
+	Name   string `json:"name,omitempty"`
+	Script string `json:"script,omitempty" interpolate:"-"`
+	// read by the CLI, the API server refuses it; the CLI turns it into script before sending
+	ScriptPath string `json:"script_path,omitempty"`
+	// per attempt, 0 is 10 minutes
+	TimeoutSeconds int `json:"timeout_seconds,omitempty"`
+	// attempts after the first one failed
+	Retries           int `json:"retries,omitempty"`
+	RetryDelaySeconds int `json:"retry_delay_seconds,omitempty"`
+}
+
+// steps run after every VM of a fleet was created and ran its own steps
+type FleetPostProvisionHook struct {
+	Name  string              `json:"name"`
+	On    FleetHookTarget     `json:"on"`
+	Steps []PostProvisionStep `json:"steps"`
+}
+
+// VMs a fleet hook runs on, in fleet order; all of them if nothing is set
+type FleetHookTarget struct {
+	// names as in the fleet file, prefixed with fleet_name upon coalescing
+	Names  []string          `json:"names,omitempty"`
+	Labels map[string]string `json:"labels,omitempty"`
+	// only the first matching VM, e.g. the first master
+	IsFirstOnly bool `json:"first_only,omitempty"`
+}
+
+type PostProvisionStepResult struct {
+	Name     string `json:"name"`
+	Attempts int    `json:"attempts"`
+	// of the last attempt
+	Stdout string `json:"stdout"`
+	Stderr string `json:"stderr"`
+	// output is cut to its last 64 KiB
+	IsTruncated bool   `json:"is_truncated,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
+
+type FleetPostProvisionResult struct {
+	Hook           string                    `json:"hook"`
+	VirtualMachine string                    `json:"virtual_machine,omitempty"`
+	Steps          []PostProvisionStepResult `json:"steps"`
+	Error          string                    `json:"error,omitempty"`
+}
+
+func (config PostProvisionConfig) Redacted() PostProvisionConfig {
+	if config.PrivateKey != "" {
+		config.PrivateKey = connconfig.REDACTED
+	}
+	if config.Passphrase != "" {
+		config.Passphrase = connconfig.REDACTED
+	}
+	return config
+}
+
+// fields of the VM win, steps of shared go first
+func (config PostProvisionConfig) CoalescedWith(shared PostProvisionConfig) PostProvisionConfig {
+	if !config.HasPrivateKey() {
+		config.PrivateKeyPath = shared.PrivateKeyPath
+		config.PrivateKey = shared.PrivateKey
+		config.Passphrase = shared.Passphrase
+	}
+	if config.Port == 0 {
+		config.Port = shared.Port
+	}
+	if config.ReadyTimeoutSeconds == 0 {
+		config.ReadyTimeoutSeconds = shared.ReadyTimeoutSeconds
+	}
+	if len(shared.Steps) > 0 {
+		config.Steps = append(append([]PostProvisionStep{}, shared.Steps...), config.Steps...)
+	}
+	return config
+}
+
+// problems of the config of VM name, none if it has no steps
+func (config PostProvisionConfig) Validate(name string) []error {
+	problems := []error{}
+	if len(config.Steps) < 1 {
+		return problems
+	}
+	if !config.HasPrivateKey() {
+		problems = append(problems, fmt.Errorf("virtual machine %v has post_provision steps but no private_key_path", name))
+	}
+	for i, step := range config.Steps {
+		if err := step.Validate(); err != nil {
+			problems = append(problems, fmt.Errorf("post_provision step #%d of %v: %v", i+1, name, err))
+		}
+	}
+	return problems
+}
+
+func (config PostProvisionConfig) HasPrivateKey() bool {
+	return config.PrivateKey != "" || config.PrivateKeyPath != ""
+}
+
+// problems of a config the API server was sent, it reads no file of its own for a caller
+func (config PostProvisionConfig) ValidateInlined(name string) []error {
+	problems := []error{}
+	if config.PrivateKey == "" && config.PrivateKeyPath != "" {
+		problems = append(problems, fmt.Errorf("post_provision of %v has private_key_path but no private_key", name))
+	}
+	problems = append(problems, ValidateStepsInlined(config.Steps, name)...)
+	return problems
+}
+
+func ValidateStepsInlined(steps []PostProvisionStep, name string) []error {
+	problems := []error{}
+	for i, step := range steps {
+		if step.ScriptPath != "" {
+			problems = append(problems, fmt.Errorf("post_provision step #%d of %v has script_path instead of script", i+1, name))
+		}
+	}
+	return problems
+}
+
+// copy of config with the files it refers to read into private_key and script, for the API server
+func (config PostProvisionConfig) Inlined() (PostProvisionConfig, error) {
+	if config.PrivateKey == "" && config.PrivateKeyPath != "" {
+		content, err := os.ReadFile(config.PrivateKeyPath)
+		if err != nil {
+			return config, fmt.Errorf("could not read private key '%v': %v", config.PrivateKeyPath, err)
+		}
+		config.PrivateKey = string(content)
+	}
+
+	steps, err := InlinedSteps(config.Steps)
+	config.Steps = steps
+	return config, err
+}
+
+func InlinedSteps(steps []PostProvisionStep) ([]PostProvisionStep, error) {
+	if steps == nil {
+		return nil, nil
+	}
+	inlinedSteps := make([]PostProvisionStep, len(steps))
+	for i, step := range steps {
+		if step.ScriptPath != "" {
+			content, err := os.ReadFile(step.ScriptPath)
+			if err != nil {
+				return steps, fmt.Errorf("could not read script '%v': %v", step.ScriptPath, err)
+			}
+			// keeps the name results are reported under
+			step.Name = step.DisplayName(i)
+			step.Script, step.ScriptPath = string(content), ""
+		}
+		inlinedSteps[i] = step
+	}
+	return inlinedSteps, nil
+}
+
+func (step PostProvisionStep) Validate() error {
+	if (step.Script == "") == (step.ScriptPath == "") {
+		return fmt.Errorf("needs exactly one of script and script_path")
+	}
+	if step.TimeoutSeconds < 0 || step.Retries < 0 || step.RetryDelaySeconds < 0 {
+		return fmt.Errorf("timeout_seconds, retries and retry_delay_seconds can't be negative")
+	}
+	return nil
+}
+
+// name given in the config, else script_path, else its position
+func (step PostProvisionStep) DisplayName(index int) string {
+	if step.Name != "" {
+		return step.Name
+	}
+	if step.ScriptPath != "" {
+		return step.ScriptPath
+	}
+	return fmt.Sprintf("step-%d", index+1)
+}
+
+func (target FleetHookTarget) Match(config VirtualMachineConfig) bool {
+	if len(target.Names) > 0 {
+		isNamed := false
+		for _, name := range target.Names {
+			if name == config.GeneralVMConfig.Name {
+				isNamed = true
+				break
+			}
+		}
+		if !isNamed {
+			return false
+		}
+	}
+	for key, value := range target.Labels {
+		if config.GeneralVMConfig.Labels[key] != value {
+			return false
+		}
+	}
+	return true
+}
+
+// VMs of vmConfigs the hook runs on, in order
+func (hook FleetPostProvisionHook) Targets(vmConfigs []VirtualMachineConfig) []VirtualMachineConfig {
+	targets := []VirtualMachineConfig{}
+	for _, vmConfig := range vmConfigs {
+		if !hook.On.Match(vmConfig) {
+			continue
+		}
+		targets = append(targets, vmConfig)
+		if hook.On.IsFirstOnly {
+			break
+		}
+	}
+	return targets
+}
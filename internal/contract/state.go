@@ -0,0 +1,60 @@
+package contract
+
+import "time"
+
+// everything harmonia created for a VM, used to clean up exactly that upon deletion
+type VirtualMachineRecord struct {
+	Name          string `json:"name"`
+	UUID          string `json:"uuid"`
+	Fleet         string `json:"fleet,omitempty"`
+	Hypervisor    string `json:"hypervisor,omitempty"`
+	ConnectionUrl string `json:"connection_url"`
+
+	DiskPaths        []string `json:"disk_paths"`
+	CloudInitISOPath string   `json:"cloud_init_iso_path"`
+	CloudInitDir     string   `json:"cloud_init_dir"`
+	// kept after the VM is deleted
+	ConsoleLogPath string `json:"console_log_path,omitempty"`
+
+	IPv4Addresses []string `json:"ip_addresses"`
+	MacAddresses  []string `json:"mac_addresses"`
+
+	// secrets are redacted before storing
+	Config VirtualMachineConfig `json:"config"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// a network a fleet defined, fleets only delete their own networks
+type NetworkRecord struct {
+	Name          string `json:"name"`
+	UUID          string `json:"uuid"`
+	Fleet         string `json:"fleet,omitempty"`
+	ConnectionUrl string `json:"connection_url"`
+
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type VirtualMachineRecordFilter struct {
+	Name       string
+	Fleet      string
+	Hypervisor string
+}
+
+func (filter VirtualMachineRecordFilter) Match(record VirtualMachineRecord) bool {
+	if filter.Name != "" && filter.Name != record.Name {
+		return false
+	}
+	if filter.Fleet != "" && filter.Fleet != record.Fleet {
+		return false
+	}
+	if filter.Hypervisor != "" && filter.Hypervisor != record.Hypervisor && filter.Hypervisor != record.ConnectionUrl {
+		return false
+	}
+	return true
+}
+
+type ListVirtualMachineRecordsResult struct {
+	Records []VirtualMachineRecord `json:"records"`
+}
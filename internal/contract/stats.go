@@ -0,0 +1,102 @@
+package contract
+
+// cumulative counters of a domain at one point in time
+type DomainStatsSample struct {
+	Name             string                 `json:"name"`
+	UUID             string                 `json:"uuid"`
+	Fleet            string                 `json:"fleet,omitempty"`
+	State            string                 `json:"state"`
+	VCPUs            uint                   `json:"vcpus"`
+	CPUTimeNs        uint64                 `json:"cpu_time_ns"`
+	MemoryCurrentKiB uint64                 `json:"memory_current_kib"`
+	MemoryMaximumKiB uint64                 `json:"memory_maximum_kib"`
+	BlockReadBytes   uint64                 `json:"block_read_bytes"`
+	BlockWriteBytes  uint64                 `json:"block_write_bytes"`
+	NetRxBytes       uint64                 `json:"net_rx_bytes"`
+	NetTxBytes       uint64                 `json:"net_tx_bytes"`
+	Disks            []DiskStatsSample      `json:"disks"`
+	Interfaces       []InterfaceStatsSample `json:"interfaces"`
+	// unix nanoseconds the sample was taken at, used to compute rates
+	Timestamp int64 `json:"timestamp"`
+}
+
+type DiskStatsSample struct {
+	Name          string `json:"name"`
+	ReadBytes     uint64 `json:"read_bytes"`
+	WriteBytes    uint64 `json:"write_bytes"`
+	ReadRequests  uint64 `json:"read_requests"`
+	WriteRequests uint64 `json:"write_requests"`
+}
+
+type InterfaceStatsSample struct {
+	Name      string `json:"name"`
+	RxBytes   uint64 `json:"rx_bytes"`
+	TxBytes   uint64 `json:"tx_bytes"`
+	RxPackets uint64 `json:"rx_packets"`
+	TxPackets uint64 `json:"tx_packets"`
+}
+
+// counters of the latest sample plus rates since the previous one
+type DomainStats struct {
+	Name       string `json:"name"`
+	UUID       string `json:"uuid"`
+	Fleet      string `json:"fleet,omitempty"`
+	Hypervisor string `json:"hypervisor,omitempty"`
+	State      string `json:"state"`
+	VCPUs      uint   `json:"vcpus"`
+	CPUTimeNs  uint64 `json:"cpu_time_ns"`
+	// share of the allocated vCPUs in use, 100 means all of them are busy
+	CPUUtilisationPercent float64          `json:"cpu_utilisation_percent"`
+	MemoryCurrentKiB      uint64           `json:"memory_current_kib"`
+	MemoryMaximumKiB      uint64           `json:"memory_maximum_kib"`
+	ReadBytesPerSecond    float64          `json:"read_bytes_per_second"`
+	WriteBytesPerSecond   float64          `json:"write_bytes_per_second"`
+	IOPS                  float64          `json:"iops"`
+	RxBytesPerSecond      float64          `json:"rx_bytes_per_second"`
+	TxBytesPerSecond      float64          `json:"tx_bytes_per_second"`
+	Disks                 []DiskStats      `json:"disks"`
+	Interfaces            []InterfaceStats `json:"interfaces"`
+	IntervalSeconds       float64          `json:"interval_seconds"`
+}
+
+type DiskStats struct {
+	Name                string  `json:"name"`
+	ReadBytes           uint64  `json:"read_bytes"`
+	WriteBytes          uint64  `json:"write_bytes"`
+	ReadBytesPerSecond  float64 `json:"read_bytes_per_second"`
+	WriteBytesPerSecond float64 `json:"write_bytes_per_second"`
+	ReadIOPS            float64 `json:"read_iops"`
+	WriteIOPS           float64 `json:"write_iops"`
+}
+
+type InterfaceStats struct {
+	Name               string  `json:"name"`
+	RxBytes            uint64  `json:"rx_bytes"`
+	TxBytes            uint64  `json:"tx_bytes"`
+	RxBytesPerSecond   float64 `json:"rx_bytes_per_second"`
+	TxBytesPerSecond   float64 `json:"tx_bytes_per_second"`
+	RxPacketsPerSecond float64 `json:"rx_packets_per_second"`
+	TxPacketsPerSecond float64 `json:"tx_packets_per_second"`
+}
+
+// totals of every domain in a fleet, the busiest domain points at noisy neighbours
+type FleetStats struct {
+	Fleet               string  `json:"fleet"`
+	Domains             int     `json:"domains"`
+	VCPUs               uint    `json:"vcpus"`
+	CPUCoresUsed        float64 `json:"cpu_cores_used"`
+	MemoryCurrentKiB    uint64  `json:"memory_current_kib"`
+	ReadBytesPerSecond  float64 `json:"read_bytes_per_second"`
+	WriteBytesPerSecond float64 `json:"write_bytes_per_second"`
+	IOPS                float64 `json:"iops"`
+	RxBytesPerSecond    float64 `json:"rx_bytes_per_second"`
+	TxBytesPerSecond    float64 `json:"tx_bytes_per_second"`
+	BusiestDomain       string  `json:"busiest_domain"`
+}
+
+type VirtualMachineStatsResult struct {
+	Domains []DomainStats `json:"domains"`
+	Fleets  []FleetStats  `json:"fleets,omitempty"`
+	// hypervisors that could not be sampled, by name
+	Errors map[string]string `json:"errors,omitempty"`
+}
@@ -1,6 +1,16 @@
 package contract
 
-import "github.com/nnurry/harmonia/internal/connection"
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	"github.com/nnurry/harmonia/internal/connconfig"
+	"github.com/nnurry/harmonia/internal/interpolate"
+)
+
+const DEFAULT_IPV4_PREFIX = 24
 
 type VirtualMachineConfig struct {
 	GeneralVMConfig             `json:",inline"`
@@ -10,12 +20,85 @@ type VirtualMachineConfig struct {
 
 	CloudInitISOPath string `json:"cloud_init_iso_path"`
 	QCOW2FilePath    string `json:"qcow2_file_path"`
+
+	PostProvision PostProvisionConfig `json:"post_provision,omitempty"`
+
+	// strings filled from references, masked by Redacted
+	SensitiveValues []string `json:"-" interpolate:"-"`
 }
 
 type HypervisorConnectionConfig struct {
-	connection.LibvirtConfig `json:"libvirt"`
-	connection.SSHConfig     `json:"ssh"`
-	IsLocalShell             bool `json:"is_local_shell"`
+	connconfig.LibvirtConfig `json:"libvirt"`
+	connconfig.SSHConfig     `json:"ssh"`
+	IsLocalShell             bool            `json:"is_local_shell"`
+	Admission                AdmissionConfig `json:"admission,omitempty"`
+}
+
+// name known to harmonia when given, connection URL otherwise; for metrics, progress and the audit log
+func HypervisorLabel(name string, config *HypervisorConnectionConfig) string {
+	if name != "" || config == nil {
+		return name
+	}
+	return config.LibvirtConfig.ConnectionUrl
+}
+
+func (config VirtualMachineConfig) HypervisorLabel() string {
+	return HypervisorLabel(config.GeneralVMConfig.Hypervisor, config.HypervisorConnectionConfig)
+}
+
+// copy of config with SSH secrets masked, safe to persist or echo back
+func (config VirtualMachineConfig) Redacted() VirtualMachineConfig {
+	if config.HypervisorConnectionConfig != nil {
+		redactedConnectionConfig := config.HypervisorConnectionConfig.Redacted()
+		config.HypervisorConnectionConfig = &redactedConnectionConfig
+	}
+	config.PostProvision = config.PostProvision.Redacted()
+	return interpolate.Redacted(config, config.SensitiveValues)
+}
+
+// fingerprint of the redacted config, stored in domain metadata to spot drift
+func (config VirtualMachineConfig) Hash() (string, error) {
+	data, err := json.Marshal(config.Redacted())
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(data)), nil
+}
+
+// checks a single virtual machine needs before it is created, the same ones fleet create runs per virtual machine
+func (config VirtualMachineConfig) ValidateForCreate() []error {
+	problems := []error{}
+	name := config.GeneralVMConfig.Name
+	if !slices.Contains(PROVISIONERS, config.GetProvisioner()) {
+		problems = append(problems, fmt.Errorf("virtual machine %v has unknown provisioner %v, use one of %v", name, config.GeneralVMConfig.Provisioner, PROVISIONERS))
+	}
+	for j, networkInterface := range config.NetworkVMConfig.GetInterfaces() {
+		if networkInterface.IPv4Prefix > 32 {
+			problems = append(problems, fmt.Errorf("interface #%d of %v has ip_prefix %v above 32", j+1, name, networkInterface.IPv4Prefix))
+		}
+	}
+	if config.GetProvisioner() == PROVISIONER_IGNITION {
+		for j, networkInterface := range config.NetworkVMConfig.GetInterfaces() {
+			if networkInterface.IPv4Address != "" && networkInterface.MacAddress == "" {
+				problems = append(problems, fmt.Errorf("interface #%d of %v needs a mac_address for its static address under ignition", j+1, name))
+			}
+		}
+	}
+	for _, file := range config.Files {
+		if err := file.Validate(); err != nil {
+			problems = append(problems, fmt.Errorf("virtual machine %v: %v", name, err))
+		}
+	}
+	sizing := InstanceType{CPUMode: config.GeneralVMConfig.CPUMode, DiskBus: config.GeneralVMConfig.DiskBus}
+	if err := sizing.Validate(); err != nil {
+		problems = append(problems, fmt.Errorf("virtual machine %v: %v", name, err))
+	}
+	return append(problems, config.PostProvision.Validate(name)...)
+}
+
+func (config HypervisorConnectionConfig) Redacted() HypervisorConnectionConfig {
+	config.SSHConfig = config.SSHConfig.Redacted()
+	return config
 }
 
 type GeneralVMConfig struct {
@@ -24,7 +107,32 @@ type GeneralVMConfig struct {
 	NumOfVCPUs             int     `json:"vcpu"`
 	MemoryInGiB            float64 `json:"memory_gb"`
 	DiskSizeInGiB          float64 `json:"disk_gb"`
-	IsCopyOnWriteClone     bool    `json:"is_cow_clone"`
+	// nil takes the one of instance_type, else false
+	IsCopyOnWriteClone *bool `json:"is_cow_clone,omitempty"`
+
+	// fills the sizing above and below when left unset, see InstanceType
+	InstanceType string `json:"instance_type,omitempty"`
+	CPUMode      string `json:"cpu_mode,omitempty"`
+	DiskBus      string `json:"disk_bus,omitempty"`
+	// model of NICs that don't set their own, empty keeps the one of the base VM
+	NICModel string `json:"nic_model,omitempty"`
+
+	// cloud-init (default) or ignition, for Fedora CoreOS and Flatcar guests
+	Provisioner string `json:"provisioner,omitempty"`
+
+	// set from shared_config.general.fleet_name upon coalescing
+	Fleet string `json:"fleet,omitempty"`
+
+	// written into domain metadata, merged with shared_config.general.labels
+	Labels map[string]string `json:"labels,omitempty"`
+
+	// only used when the VM has no hypervisor_connection of its own
+	Hypervisor        string `json:"hypervisor,omitempty"`
+	AntiAffinityGroup string `json:"anti_affinity_group,omitempty"`
+}
+
+func (config GeneralVMConfig) GetIsCopyOnWriteClone() bool {
+	return config.IsCopyOnWriteClone != nil && *config.IsCopyOnWriteClone
 }
 
 type UserVMConfig struct {
@@ -32,13 +140,51 @@ type UserVMConfig struct {
 	AuthorizedKeyPaths    []string `json:"authorized_key_paths"`
 	AuthorizedKeyContents []string `json:"authorized_key_contents"`
 	DisableRootPassword   bool     `json:"disable_root_pw,omitempty"`
+	// after those of shared_config.files
+	Files []GuestFileConfig `json:"files,omitempty"`
 }
 
 type NetworkVMConfig struct {
 	IPv4Address        string   `json:"ip_address"`
+	IPv4Prefix         uint     `json:"ip_prefix,omitempty"`
 	IPv4GatewayAddress string   `json:"gateway_address"`
 	MacAddress         string   `json:"mac_address"`
 	Nameservers        []string `json:"nameservers"`
+
+	// when set, top-level ip_address/gateway_address/mac_address are ignored
+	Interfaces []NetworkInterfaceConfig `json:"interfaces,omitempty"`
+}
+
+type NetworkInterfaceConfig struct {
+	Network     string `json:"network,omitempty"`
+	Bridge      string `json:"bridge,omitempty"` // default to br0 if network is also empty
+	Model       string `json:"model,omitempty"`
+	MacAddress  string `json:"mac_address"`
+	IPv4Address string `json:"ip_address,omitempty"`
+	// 0 takes ip_prefix of the fleet network the NIC is on upon coalescing, else 24
+	IPv4Prefix         uint   `json:"ip_prefix,omitempty"`
+	IPv4GatewayAddress string `json:"gateway_address,omitempty"`
+}
+
+func (config NetworkInterfaceConfig) GetIPv4Prefix() uint {
+	if config.IPv4Prefix == 0 {
+		return DEFAULT_IPV4_PREFIX
+	}
+	return config.IPv4Prefix
+}
+
+// legacy configs only have a single NIC on the default host bridge
+func (config NetworkVMConfig) GetInterfaces() []NetworkInterfaceConfig {
+	if len(config.Interfaces) > 0 {
+		return config.Interfaces
+	}
+
+	return []NetworkInterfaceConfig{{
+		MacAddress:         config.MacAddress,
+		IPv4Address:        config.IPv4Address,
+		IPv4Prefix:         config.IPv4Prefix,
+		IPv4GatewayAddress: config.IPv4GatewayAddress,
+	}}
 }
 
 type CreateVirtualMachineRequest struct {
@@ -46,13 +192,54 @@ type CreateVirtualMachineRequest struct {
 }
 
 type CreateVirtualMachineResult struct {
-	UUID  string `json:"uuid,omitempty"`
-	Name  string `json:"name"`
-	Error string `json:"error,omitempty"`
+	UUID       string   `json:"uuid,omitempty"`
+	Name       string   `json:"name"`
+	Hypervisor string   `json:"hypervisor,omitempty"`
+	Error      string   `json:"error,omitempty"`
+	Warnings   []string `json:"warnings,omitempty"`
+	// end of the serial console log when the VM failed after being started
+	ConsoleLog string `json:"console_log,omitempty"`
+	// steps that ran, up to the first failing one
+	PostProvision []PostProvisionStepResult `json:"post_provision,omitempty"`
 }
 
 type DeleteVirtualMachineResult struct {
-	UUID  string `json:"uuid,omitempty"`
-	Name  string `json:"name"`
-	Error string `json:"error,omitempty"`
+	UUID       string `json:"uuid,omitempty"`
+	Name       string `json:"name"`
+	Hypervisor string `json:"hypervisor,omitempty"`
+	Error      string `json:"error,omitempty"`
+	// files that could not be removed, the VM stays in the state store then
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// only name and hypervisor (or hypervisor_connection) are needed
+type DeleteVirtualMachineRequest struct {
+	VirtualMachineConfig `json:",inline"`
+}
+
+const (
+	POWER_ACTION_START = "start"
+	POWER_ACTION_STOP  = "stop"
+)
+
+type VirtualMachinePowerRequest struct {
+	Name                        string `json:"name"`
+	Hypervisor                  string `json:"hypervisor,omitempty"`
+	*HypervisorConnectionConfig `json:"hypervisor_connection,omitempty"`
+}
+
+type VirtualMachinePowerResult struct {
+	Name       string `json:"name"`
+	Hypervisor string `json:"hypervisor,omitempty"`
+	Action     string `json:"action"`
+	Error      string `json:"error,omitempty"`
+}
+
+// tail of the serial console log kept on the hypervisor
+type ConsoleLogResult struct {
+	Name       string `json:"name"`
+	Hypervisor string `json:"hypervisor,omitempty"`
+	Path       string `json:"path"`
+	Log        string `json:"log"`
+	Error      string `json:"error,omitempty"`
 }
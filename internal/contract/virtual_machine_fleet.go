@@ -1,10 +1,24 @@
 package contract
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+
+	"github.com/nnurry/harmonia/internal/interpolate"
+)
 
 type VirtualMachineFleetConfig struct {
 	SharedConfig          FleetSharedConfig      `json:"shared_config"`
 	VirtualMachineConfigs []VirtualMachineConfig `json:"virtual_machines"`
+	// appended to virtual_machines upon coalescing, groups that can't be expanded are kept for Validate to report
+	VirtualMachineGroups  []VirtualMachineGroup  `json:"virtual_machine_groups,omitempty"`
+	VirtualNetworkConfigs []VirtualNetworkConfig `json:"networks,omitempty"`
+
+	// run in order once every VM is created and ran its own post_provision steps
+	PostProvisionHooks []FleetPostProvisionHook `json:"post_provision_hooks,omitempty"`
+
+	// strings filled from references, handed to every VM upon coalescing and masked by Redacted
+	SensitiveValues []string `json:"-" interpolate:"-"`
 }
 
 type FleetSharedConfig struct {
@@ -12,11 +26,37 @@ type FleetSharedConfig struct {
 	SSHSharedConfig             `json:"ssh"`
 	NetworkSharedConfig         `json:"cloud_init"`
 	*HypervisorConnectionConfig `json:"hypervisor_connection,omitempty"`
+
+	// when set, VMs without hypervisor_connection are scheduled across these instead
+	Hypervisors []FleetHypervisorConfig `json:"hypervisors,omitempty"`
+	Scheduling  SchedulingConfig        `json:"scheduling,omitempty"`
+
+	// connection settings for VMs without their own, steps run before those of each VM
+	PostProvision PostProvisionConfig `json:"post_provision,omitempty"`
+
+	// win over instance types of the server config with the same name
+	InstanceTypes map[string]InstanceType `json:"instance_types,omitempty"`
+
+	// written into every VM before its own files
+	Files []GuestFileConfig `json:"files,omitempty"`
+}
+
+// only name is needed if the hypervisor is defined in the server config
+type FleetHypervisorConfig struct {
+	Name                       string `json:"name"`
+	HypervisorConnectionConfig `json:",inline"`
+}
+
+type SchedulingConfig struct {
+	Policy string `json:"policy"`
 }
 
 type GeneralSharedConfig struct {
-	BaseVirtualMachineName  string `json:"base_vm_name"`
-	VirtualMachineFleetName string `json:"fleet_name"`
+	BaseVirtualMachineName  string            `json:"base_vm_name"`
+	VirtualMachineFleetName string            `json:"fleet_name"`
+	Labels                  map[string]string `json:"labels,omitempty"`
+	// for VMs without their own
+	Provisioner string `json:"provisioner,omitempty"`
 }
 
 type SSHSharedConfig struct {
@@ -29,12 +69,118 @@ type NetworkSharedConfig struct {
 	Nameservers []string `json:"nameservers"`
 }
 
+// copy of the fleet with SSH secrets of every connection masked
+func (r VirtualMachineFleetConfig) Redacted() VirtualMachineFleetConfig {
+	if r.SharedConfig.HypervisorConnectionConfig != nil {
+		redactedConnectionConfig := r.SharedConfig.HypervisorConnectionConfig.Redacted()
+		r.SharedConfig.HypervisorConnectionConfig = &redactedConnectionConfig
+	}
+	r.SharedConfig.PostProvision = r.SharedConfig.PostProvision.Redacted()
+
+	hypervisors := make([]FleetHypervisorConfig, len(r.SharedConfig.Hypervisors))
+	for i, hypervisor := range r.SharedConfig.Hypervisors {
+		hypervisor.HypervisorConnectionConfig = hypervisor.HypervisorConnectionConfig.Redacted()
+		hypervisors[i] = hypervisor
+	}
+	r.SharedConfig.Hypervisors = hypervisors
+
+	vmConfigs := make([]VirtualMachineConfig, len(r.VirtualMachineConfigs))
+	for i, vmConfig := range r.VirtualMachineConfigs {
+		vmConfigs[i] = vmConfig.Redacted()
+	}
+	r.VirtualMachineConfigs = vmConfigs
+
+	groups := make([]VirtualMachineGroup, len(r.VirtualMachineGroups))
+	for i, group := range r.VirtualMachineGroups {
+		group.VirtualMachineConfig = group.VirtualMachineConfig.Redacted()
+		groups[i] = group
+	}
+	r.VirtualMachineGroups = groups
+
+	networkConfigs := make([]VirtualNetworkConfig, len(r.VirtualNetworkConfigs))
+	for i, networkConfig := range r.VirtualNetworkConfigs {
+		networkConfigs[i] = networkConfig.Redacted()
+	}
+	r.VirtualNetworkConfigs = networkConfigs
+
+	return interpolate.Redacted(r, r.SensitiveValues)
+}
+
+// instance types of the fleet with defaults (e.g. of the server config) for names it doesn't define
+func (r VirtualMachineFleetConfig) WithInstanceTypes(defaults map[string]InstanceType) VirtualMachineFleetConfig {
+	if len(defaults) < 1 {
+		return r
+	}
+	instanceTypes := map[string]InstanceType{}
+	for name, instanceType := range defaults {
+		instanceTypes[name] = instanceType
+	}
+	for name, instanceType := range r.SharedConfig.InstanceTypes {
+		instanceTypes[name] = instanceType
+	}
+	r.SharedConfig.InstanceTypes = instanceTypes
+	return r
+}
+
+// fleet with its groups turned into VMs after those of virtual_machines
+func (r VirtualMachineFleetConfig) ExpandGroups() VirtualMachineFleetConfig {
+	if len(r.VirtualMachineGroups) < 1 {
+		return r
+	}
+	vmConfigs := append([]VirtualMachineConfig{}, r.VirtualMachineConfigs...)
+	unexpandedGroups := []VirtualMachineGroup{}
+	for _, group := range r.VirtualMachineGroups {
+		group.Interfaces = r.withNetworkPrefixes(group.Interfaces)
+		groupVMConfigs, err := group.Expand()
+		if err != nil {
+			unexpandedGroups = append(unexpandedGroups, group)
+			continue
+		}
+		vmConfigs = append(vmConfigs, groupVMConfigs...)
+	}
+	r.VirtualMachineConfigs = vmConfigs
+	r.VirtualMachineGroups = unexpandedGroups
+	return r
+}
+
+// NICs on networks of the fleet take their prefix, interfaces is copied before
+func (r VirtualMachineFleetConfig) withNetworkPrefixes(interfaces []NetworkInterfaceConfig) []NetworkInterfaceConfig {
+	if len(interfaces) < 1 || len(r.VirtualNetworkConfigs) < 1 {
+		return interfaces
+	}
+	interfaces = append([]NetworkInterfaceConfig{}, interfaces...)
+	for i, networkInterface := range interfaces {
+		if networkInterface.IPv4Prefix != 0 || networkInterface.Network == "" {
+			continue
+		}
+		for _, networkConfig := range r.VirtualNetworkConfigs {
+			if networkConfig.Name == networkInterface.Network {
+				interfaces[i].IPv4Prefix = networkConfig.IPv4Prefix
+			}
+		}
+	}
+	return interfaces
+}
+
 func (r VirtualMachineFleetConfig) GetCoalesced() VirtualMachineFleetConfig {
+	r = r.ExpandGroups()
 	for i, vmConfig := range r.VirtualMachineConfigs {
+		// unknown instance types are left for Validate to report
+		if resolvedVMConfig, ok := vmConfig.WithInstanceType(r.SharedConfig.InstanceTypes); ok {
+			r.VirtualMachineConfigs[i] = resolvedVMConfig
+			vmConfig = resolvedVMConfig
+		}
+
 		if len(vmConfig.Nameservers) < 1 {
 			r.VirtualMachineConfigs[i].Nameservers = r.SharedConfig.Nameservers
 		}
 
+		r.VirtualMachineConfigs[i].Interfaces = r.withNetworkPrefixes(vmConfig.Interfaces)
+
+		if len(r.SensitiveValues) > 0 {
+			r.VirtualMachineConfigs[i].SensitiveValues = append(append([]string{}, vmConfig.SensitiveValues...), r.SensitiveValues...)
+		}
+
 		if len(vmConfig.AuthorizedKeyPaths) < 1 {
 			r.VirtualMachineConfigs[i].AuthorizedKeyPaths = r.SharedConfig.AuthorizedKeyPaths
 		}
@@ -47,16 +193,39 @@ func (r VirtualMachineFleetConfig) GetCoalesced() VirtualMachineFleetConfig {
 			r.VirtualMachineConfigs[i].User = r.SharedConfig.User
 		}
 
+		if len(r.SharedConfig.Labels) > 0 {
+			labels := map[string]string{}
+			for key, value := range r.SharedConfig.Labels {
+				labels[key] = value
+			}
+			for key, value := range vmConfig.Labels {
+				labels[key] = value
+			}
+			r.VirtualMachineConfigs[i].Labels = labels
+		}
+
+		r.VirtualMachineConfigs[i].PostProvision = vmConfig.PostProvision.CoalescedWith(r.SharedConfig.PostProvision)
+
 		if vmConfig.BaseVirtualMachineName == "" {
 			r.VirtualMachineConfigs[i].BaseVirtualMachineName = r.SharedConfig.BaseVirtualMachineName
 		}
 
-		if vmConfig.HypervisorConnectionConfig == nil {
+		if vmConfig.GeneralVMConfig.Provisioner == "" {
+			r.VirtualMachineConfigs[i].GeneralVMConfig.Provisioner = r.SharedConfig.GeneralSharedConfig.Provisioner
+		}
+
+		if len(r.SharedConfig.Files) > 0 {
+			r.VirtualMachineConfigs[i].Files = append(append([]GuestFileConfig{}, r.SharedConfig.Files...), vmConfig.Files...)
+		}
+
+		// scheduled VMs get their connection upon placement
+		if vmConfig.HypervisorConnectionConfig == nil && !r.IsScheduled() && r.SharedConfig.HypervisorConnectionConfig != nil {
 			sharedHypervisorConnectionConfig := *r.SharedConfig.HypervisorConnectionConfig
 			r.VirtualMachineConfigs[i].HypervisorConnectionConfig = &sharedHypervisorConnectionConfig
 		}
 
 		if r.SharedConfig.GeneralSharedConfig.VirtualMachineFleetName != "" {
+			r.VirtualMachineConfigs[i].GeneralVMConfig.Fleet = r.SharedConfig.GeneralSharedConfig.VirtualMachineFleetName
 			r.VirtualMachineConfigs[i].GeneralVMConfig.Name = fmt.Sprintf(
 				"%v-%v",
 				r.SharedConfig.GeneralSharedConfig.VirtualMachineFleetName,
@@ -65,18 +234,211 @@ func (r VirtualMachineFleetConfig) GetCoalesced() VirtualMachineFleetConfig {
 		}
 	}
 
+	if fleetName := r.SharedConfig.GeneralSharedConfig.VirtualMachineFleetName; fleetName != "" {
+		hooks := make([]FleetPostProvisionHook, len(r.PostProvisionHooks))
+		for i, hook := range r.PostProvisionHooks {
+			names := make([]string, len(hook.On.Names))
+			for j, name := range hook.On.Names {
+				names[j] = fmt.Sprintf("%v-%v", fleetName, name)
+			}
+			hook.On.Names = names
+			hooks[i] = hook
+		}
+		r.PostProvisionHooks = hooks
+	}
+
+	for i, networkConfig := range r.VirtualNetworkConfigs {
+		if networkConfig.HypervisorConnectionConfig == nil && !r.IsScheduled() && r.SharedConfig.HypervisorConnectionConfig != nil {
+			sharedHypervisorConnectionConfig := *r.SharedConfig.HypervisorConnectionConfig
+			r.VirtualNetworkConfigs[i].HypervisorConnectionConfig = &sharedHypervisorConnectionConfig
+		}
+	}
+
 	return r
 }
 
+// copy of the fleet with every post_provision key and script it refers to read, for the API server
+func (r VirtualMachineFleetConfig) WithPostProvisionInlined() (VirtualMachineFleetConfig, error) {
+	var err error
+	if r.SharedConfig.PostProvision, err = r.SharedConfig.PostProvision.Inlined(); err != nil {
+		return r, err
+	}
+
+	vmConfigs := make([]VirtualMachineConfig, len(r.VirtualMachineConfigs))
+	for i, vmConfig := range r.VirtualMachineConfigs {
+		if vmConfig.PostProvision, err = vmConfig.PostProvision.Inlined(); err != nil {
+			return r, err
+		}
+		vmConfigs[i] = vmConfig
+	}
+	r.VirtualMachineConfigs = vmConfigs
+
+	groups := make([]VirtualMachineGroup, len(r.VirtualMachineGroups))
+	for i, group := range r.VirtualMachineGroups {
+		if group.PostProvision, err = group.PostProvision.Inlined(); err != nil {
+			return r, err
+		}
+		groups[i] = group
+	}
+	r.VirtualMachineGroups = groups
+
+	hooks := make([]FleetPostProvisionHook, len(r.PostProvisionHooks))
+	for i, hook := range r.PostProvisionHooks {
+		if hook.Steps, err = InlinedSteps(hook.Steps); err != nil {
+			return r, err
+		}
+		hooks[i] = hook
+	}
+	r.PostProvisionHooks = hooks
+	return r, nil
+}
+
+// problems of a coalesced fleet the API server was sent, see PostProvisionConfig.ValidateInlined
+func (r VirtualMachineFleetConfig) ValidateInlined() error {
+	problems := []error{}
+	for _, vmConfig := range r.VirtualMachineConfigs {
+		problems = append(problems, vmConfig.PostProvision.ValidateInlined(vmConfig.GeneralVMConfig.Name)...)
+	}
+	for i, hook := range r.PostProvisionHooks {
+		hookName := hook.Name
+		if hookName == "" {
+			hookName = fmt.Sprintf("hook-%d", i+1)
+		}
+		problems = append(problems, ValidateStepsInlined(hook.Steps, "post_provision_hook "+hookName)...)
+	}
+	return errors.Join(problems...)
+}
+
+// checks a coalesced fleet without touching any hypervisor, reporting every problem at once;
+// every check, as done by fleet validate
+func (r VirtualMachineFleetConfig) Validate() error {
+	return r.validate(true)
+}
+
+// checks of fields fleets got over time only, as done when creating one; missing names,
+// sizing and users are left to fail on the hypervisor like they always did
+func (r VirtualMachineFleetConfig) ValidateForCreate() error {
+	return r.validate(false)
+}
+
+func (r VirtualMachineFleetConfig) validate(isStrict bool) error {
+	problems := []error{}
+	for _, group := range r.VirtualMachineGroups {
+		group.Interfaces = r.withNetworkPrefixes(group.Interfaces)
+		if _, err := group.Expand(); err != nil {
+			problems = append(problems, err)
+		}
+	}
+	if isStrict && len(r.VirtualMachineConfigs) < 1 && len(r.VirtualMachineGroups) < 1 {
+		problems = append(problems, fmt.Errorf("fleet has no virtual machines"))
+	}
+
+	seenVMNames := map[string]bool{}
+	for i, vmConfig := range r.VirtualMachineConfigs {
+		name := vmConfig.GeneralVMConfig.Name
+		if isStrict {
+			if name == "" {
+				problems = append(problems, fmt.Errorf("virtual machine #%d has no name", i+1))
+			} else if seenVMNames[name] {
+				problems = append(problems, fmt.Errorf("virtual machine %v is listed twice", name))
+			}
+			seenVMNames[name] = true
+
+			if vmConfig.GeneralVMConfig.BaseVirtualMachineName == "" {
+				problems = append(problems, fmt.Errorf("virtual machine %v has no base_vm_name", name))
+			}
+			if vmConfig.GeneralVMConfig.NumOfVCPUs < 1 {
+				problems = append(problems, fmt.Errorf("virtual machine %v needs at least 1 vcpu", name))
+			}
+			if vmConfig.GeneralVMConfig.MemoryInGiB <= 0 {
+				problems = append(problems, fmt.Errorf("virtual machine %v needs memory_gb above 0", name))
+			}
+			if vmConfig.UserVMConfig.User == "" {
+				problems = append(problems, fmt.Errorf("virtual machine %v has no user", name))
+			}
+		}
+
+		if instanceType := vmConfig.GeneralVMConfig.InstanceType; instanceType != "" {
+			if _, ok := r.SharedConfig.InstanceTypes[instanceType]; !ok {
+				problems = append(problems, fmt.Errorf("virtual machine %v has unknown instance_type %v", name, instanceType))
+			}
+		}
+		problems = append(problems, vmConfig.ValidateForCreate()...)
+	}
+
+	for i, hook := range r.PostProvisionHooks {
+		hookName := hook.Name
+		if hookName == "" {
+			hookName = fmt.Sprintf("#%d", i+1)
+		}
+		if len(hook.Steps) < 1 {
+			problems = append(problems, fmt.Errorf("post_provision_hook %v has no steps", hookName))
+		}
+		for j, step := range hook.Steps {
+			if err := step.Validate(); err != nil {
+				problems = append(problems, fmt.Errorf("step #%d of post_provision_hook %v: %v", j+1, hookName, err))
+			}
+		}
+
+		targets := hook.Targets(r.VirtualMachineConfigs)
+		if len(targets) < 1 {
+			problems = append(problems, fmt.Errorf("post_provision_hook %v matches no virtual machine", hookName))
+		}
+		for _, target := range targets {
+			if !target.PostProvision.HasPrivateKey() {
+				problems = append(problems, fmt.Errorf("post_provision_hook %v runs on %v which has no private_key_path", hookName, target.GeneralVMConfig.Name))
+			}
+		}
+	}
+
+	for name, instanceType := range r.SharedConfig.InstanceTypes {
+		if err := instanceType.Validate(); err != nil {
+			problems = append(problems, fmt.Errorf("instance type %v: %v", name, err))
+		}
+	}
+
+	seenNetworkNames := map[string]bool{}
+	for i, networkConfig := range r.VirtualNetworkConfigs {
+		if !isStrict {
+			continue
+		}
+		if networkConfig.Name == "" {
+			problems = append(problems, fmt.Errorf("network #%d has no name", i+1))
+		} else if seenNetworkNames[networkConfig.Name] {
+			problems = append(problems, fmt.Errorf("network %v is listed twice", networkConfig.Name))
+		}
+		seenNetworkNames[networkConfig.Name] = true
+	}
+
+	return errors.Join(problems...)
+}
+
+func (r VirtualMachineFleetConfig) IsScheduled() bool {
+	return len(r.SharedConfig.Hypervisors) > 0
+}
+
 type CreateVirtualMachineFleetRequest struct {
 	VirtualMachineFleetConfig `json:",inline"`
 }
 
 type CreateVirtualMachineFleetResult struct {
-	SubResults []CreateVirtualMachineResult `json:"sub_results"`
-	Failed     int                          `json:"failed"`
-	Success    int                          `json:"success"`
-	Total      int                          `json:"total"`
+	SubResults        []CreateVirtualMachineResult `json:"sub_results"`
+	NetworkSubResults []CreateVirtualNetworkResult `json:"network_sub_results,omitempty"`
+	// a result per hook and VM it ran on, hooks after a failing one are skipped
+	PostProvisionSubResults []FleetPostProvisionResult `json:"post_provision_sub_results,omitempty"`
+	Failed                  int                        `json:"failed"`
+	Success                 int                        `json:"success"`
+	Total                   int                        `json:"total"`
+}
+
+func (r CreateVirtualMachineFleetResult) PostProvisionFailed() int {
+	failed := 0
+	for _, subResult := range r.PostProvisionSubResults {
+		if subResult.Error != "" {
+			failed++
+		}
+	}
+	return failed
 }
 
 // Same as CreateVirtualMachineFleetRequest
@@ -85,8 +447,9 @@ type DeleteVirtualMachineFleetRequest struct {
 }
 
 type DeleteVirtualMachineFleetResult struct {
-	SubResults []DeleteVirtualMachineResult `json:"sub_results"`
-	Failed     int                          `json:"failed"`
-	Success    int                          `json:"success"`
-	Total      int                          `json:"total"`
+	SubResults        []DeleteVirtualMachineResult `json:"sub_results"`
+	NetworkSubResults []DeleteVirtualNetworkResult `json:"network_sub_results,omitempty"`
+	Failed            int                          `json:"failed"`
+	Success           int                          `json:"success"`
+	Total             int                          `json:"total"`
 }
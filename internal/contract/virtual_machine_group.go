@@ -0,0 +1,134 @@
+package contract
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// keeps a typo in count from defining thousands of domains
+const MAX_VIRTUAL_MACHINE_GROUP_COUNT = 1000
+
+// count near-identical VMs, expanded upon coalescing into VMs named and addressed by their index (from 1);
+// changing count only adds or drops VMs at the end, the others keep their name and addresses
+type VirtualMachineGroup struct {
+	// fmt pattern taking the index, e.g. worker-%02d
+	NamePattern string `json:"name_pattern"`
+	Count       int    `json:"count"`
+	// addresses of the first VM, incremented for each next one;
+	// they go to the first entry of interfaces if there are any
+	IPStart  string `json:"ip_start,omitempty"`
+	MacStart string `json:"mac_start,omitempty"`
+
+	// everything else as for an entry of virtual_machines
+	VirtualMachineConfig `json:",inline"`
+}
+
+func (group VirtualMachineGroup) Expand() ([]VirtualMachineConfig, error) {
+	if group.Count < 1 {
+		return nil, fmt.Errorf("group %v needs a count of at least 1", group.NamePattern)
+	}
+	if group.Count > MAX_VIRTUAL_MACHINE_GROUP_COUNT {
+		return nil, fmt.Errorf("group %v has a count above %v", group.NamePattern, MAX_VIRTUAL_MACHINE_GROUP_COUNT)
+	}
+	if strings.Count(group.NamePattern, "%") != 1 || strings.Contains(fmt.Sprintf(group.NamePattern, 1), "%!") {
+		return nil, fmt.Errorf("name_pattern '%v' needs exactly one verb for the index, e.g. worker-%%02d", group.NamePattern)
+	}
+
+	var ipStart uint32
+	if group.IPStart != "" {
+		ip := net.ParseIP(group.IPStart).To4()
+		if ip == nil {
+			return nil, fmt.Errorf("ip_start '%v' of group %v is not an IPv4 address", group.IPStart, group.NamePattern)
+		}
+		ipStart = binary.BigEndian.Uint32(ip)
+		if err := group.checkIPRange(ipStart); err != nil {
+			return nil, err
+		}
+	}
+
+	var macStart uint64
+	if group.MacStart != "" {
+		mac, err := net.ParseMAC(group.MacStart)
+		if err != nil || len(mac) != 6 {
+			return nil, fmt.Errorf("mac_start '%v' of group %v is not a MAC address", group.MacStart, group.NamePattern)
+		}
+		macStart = binary.BigEndian.Uint64(append([]byte{0, 0}, mac...))
+		if macStart+uint64(group.Count-1) > 0xffffffffffff {
+			return nil, fmt.Errorf("group %v runs out of addresses after mac_start '%v'", group.NamePattern, group.MacStart)
+		}
+	}
+
+	vmConfigs := make([]VirtualMachineConfig, group.Count)
+	for i := range vmConfigs {
+		vmConfig := group.VirtualMachineConfig
+		vmConfig.GeneralVMConfig.Name = fmt.Sprintf(group.NamePattern, i+1)
+
+		// VMs must not share maps and slices that coalescing or the caller may change
+		if group.Labels != nil {
+			vmConfig.Labels = map[string]string{}
+			for key, value := range group.Labels {
+				vmConfig.Labels[key] = value
+			}
+		}
+		vmConfig.Interfaces = append([]NetworkInterfaceConfig(nil), group.Interfaces...)
+
+		ipAddress, macAddress := "", ""
+		if group.IPStart != "" {
+			ip := make(net.IP, 4)
+			binary.BigEndian.PutUint32(ip, ipStart+uint32(i))
+			ipAddress = ip.String()
+		}
+		if group.MacStart != "" {
+			mac := make([]byte, 8)
+			binary.BigEndian.PutUint64(mac, macStart+uint64(i))
+			macAddress = net.HardwareAddr(mac[2:]).String()
+		}
+
+		if len(vmConfig.Interfaces) > 0 {
+			if ipAddress != "" {
+				vmConfig.Interfaces[0].IPv4Address = ipAddress
+			}
+			if macAddress != "" {
+				vmConfig.Interfaces[0].MacAddress = macAddress
+			}
+		} else {
+			if ipAddress != "" {
+				vmConfig.IPv4Address = ipAddress
+			}
+			if macAddress != "" {
+				vmConfig.MacAddress = macAddress
+			}
+		}
+
+		vmConfigs[i] = vmConfig
+	}
+	return vmConfigs, nil
+}
+
+// addresses must stay within the subnet of the NIC they go to, without its network and broadcast address
+func (group VirtualMachineGroup) checkIPRange(ipStart uint32) error {
+	prefix := NetworkInterfaceConfig{IPv4Prefix: group.IPv4Prefix}.GetIPv4Prefix()
+	if len(group.Interfaces) > 0 {
+		prefix = group.Interfaces[0].GetIPv4Prefix()
+	}
+	if prefix > 32 {
+		return fmt.Errorf("ip_prefix %v of group %v is above 32", prefix, group.NamePattern)
+	}
+
+	mask := uint32(0xffffffff) << (32 - prefix)
+	if prefix == 0 {
+		mask = 0
+	}
+	ipEnd := uint64(ipStart) + uint64(group.Count-1)
+	if ipEnd > 0xffffffff || uint32(ipEnd)&mask != ipStart&mask {
+		return fmt.Errorf("group %v runs out of its /%v subnet after ip_start '%v'", group.NamePattern, prefix, group.IPStart)
+	}
+
+	// /31 and /32 have no network and broadcast address
+	if prefix < 31 && (ipStart&^mask == 0 || uint32(ipEnd)&^mask == ^mask) {
+		return fmt.Errorf("addresses of group %v from ip_start '%v' take the network or broadcast address of its /%v subnet", group.NamePattern, group.IPStart, prefix)
+	}
+	return nil
+}
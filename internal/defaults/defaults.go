@@ -0,0 +1,8 @@
+// locations on hypervisors used when the server config doesn't set them, apart from service
+// so that config does not pull in the libvirt bindings
+package defaults
+
+const (
+	CLOUD_INIT_DIR  = "/var/my-cloud-init"
+	CONSOLE_LOG_DIR = "/var/log/libvirt/harmonia"
+)
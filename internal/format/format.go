@@ -0,0 +1,72 @@
+package format
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/goccy/go-yaml"
+	"github.com/nnurry/harmonia/internal/contract"
+)
+
+const (
+	FORMAT_JSON        = "json"
+	FORMAT_YAML        = "yaml"
+	FORMAT_JSON_SCHEMA = "json-schema"
+)
+
+var FORMATS = []string{FORMAT_JSON, FORMAT_YAML, FORMAT_JSON_SCHEMA}
+
+// request bodies of the API by the name /format and the CLI know them by
+var CONTRACTS = map[string]func() any{
+	"create":           func() any { return &contract.CreateVirtualMachineRequest{} },
+	"delete":           func() any { return &contract.DeleteVirtualMachineRequest{} },
+	"power":            func() any { return &contract.VirtualMachinePowerRequest{} },
+	"list":             func() any { return &contract.ListDomainsRequest{} },
+	"guest_exec":       func() any { return &contract.GuestExecRequest{} },
+	"guest_file_write": func() any { return &contract.GuestFileWriteRequest{} },
+	"create_fleet":     func() any { return &contract.CreateVirtualMachineFleetRequest{} },
+	"delete_fleet":     func() any { return &contract.DeleteVirtualMachineFleetRequest{} },
+	"create_network":   func() any { return &contract.CreateVirtualNetworkRequest{} },
+	"delete_network":   func() any { return &contract.DeleteVirtualNetworkRequest{} },
+	"list_networks":    func() any { return &contract.ListVirtualNetworksRequest{} },
+}
+
+func ContractNames() []string {
+	names := []string{}
+	for name := range CONTRACTS {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// pointer to an empty request of the contract
+func NewContract(name string) (any, error) {
+	newContract, ok := CONTRACTS[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown contract '%v', use one of %v", name, ContractNames())
+	}
+	return newContract(), nil
+}
+
+// v as json or yaml, yaml keeps the json field names and order
+func Serialize(v any, format string) ([]byte, error) {
+	data, err := json.MarshalIndent(v, "", " ")
+	if err != nil {
+		return nil, fmt.Errorf("could not serialize as json: %v", err)
+	}
+
+	switch format {
+	case FORMAT_JSON:
+		return append(data, '\n'), nil
+	case FORMAT_YAML:
+		yamlData, err := yaml.JSONToYAML(data)
+		if err != nil {
+			return nil, fmt.Errorf("could not serialize as yaml: %v", err)
+		}
+		return yamlData, nil
+	default:
+		return nil, fmt.Errorf("unknown format '%v', use one of %v", format, FORMATS)
+	}
+}
@@ -0,0 +1,118 @@
+package format
+
+import (
+	"encoding"
+	"encoding/json"
+	"reflect"
+	"strings"
+)
+
+const JSON_SCHEMA_DIALECT = "https://json-schema.org/draft/2020-12/schema"
+
+var textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+// JSON Schema of the request body of a contract, e.g. for editors to complete fleet files
+func Schema(name string) ([]byte, error) {
+	request, err := NewContract(name)
+	if err != nil {
+		return nil, err
+	}
+
+	generator := schemaGenerator{defs: map[string]any{}}
+	root := generator.structSchema(reflect.TypeOf(request).Elem())
+	root["$schema"] = JSON_SCHEMA_DIALECT
+	root["title"] = name
+	if len(generator.defs) > 0 {
+		root["$defs"] = generator.defs
+	}
+
+	data, err := json.MarshalIndent(root, "", " ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// named structs go to $defs once and are referred to from everywhere else
+type schemaGenerator struct {
+	defs map[string]any
+}
+
+func (generator *schemaGenerator) schemaOf(valueType reflect.Type) map[string]any {
+	if valueType.Kind() == reflect.Pointer {
+		valueType = valueType.Elem()
+	}
+	if reflect.PointerTo(valueType).Implements(textUnmarshalerType) {
+		return map[string]any{"type": "string"}
+	}
+
+	switch valueType.Kind() {
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return map[string]any{"type": "integer"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer", "minimum": 0}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if valueType.Elem().Kind() == reflect.Uint8 {
+			return map[string]any{"type": "string", "contentEncoding": "base64"}
+		}
+		// encoding/json writes nil slices and maps as null and takes it back
+		return map[string]any{"type": []string{"array", "null"}, "items": generator.schemaOf(valueType.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": []string{"object", "null"}, "additionalProperties": generator.schemaOf(valueType.Elem())}
+	case reflect.Struct:
+		if valueType.Name() == "" {
+			return generator.structSchema(valueType)
+		}
+		if _, ok := generator.defs[valueType.Name()]; !ok {
+			// placeholder first, in case the struct refers to itself
+			generator.defs[valueType.Name()] = map[string]any{}
+			generator.defs[valueType.Name()] = generator.structSchema(valueType)
+		}
+		return map[string]any{"$ref": "#/$defs/" + valueType.Name()}
+	default:
+		return map[string]any{}
+	}
+}
+
+// fields of embedded structs without a json name are its own, as encoding/json does
+func (generator *schemaGenerator) structSchema(structType reflect.Type) map[string]any {
+	properties := map[string]any{}
+	generator.addProperties(structType, properties)
+	return map[string]any{
+		"type":                 "object",
+		"properties":           properties,
+		"additionalProperties": false,
+	}
+}
+
+func (generator *schemaGenerator) addProperties(structType reflect.Type, properties map[string]any) {
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+
+		fieldType := field.Type
+		if fieldType.Kind() == reflect.Pointer {
+			fieldType = fieldType.Elem()
+		}
+		if field.Anonymous && name == "" && fieldType.Kind() == reflect.Struct {
+			generator.addProperties(fieldType, properties)
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		properties[name] = generator.schemaOf(field.Type)
+	}
+}
@@ -0,0 +1,119 @@
+package handler
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/nnurry/harmonia/internal/audit"
+	"github.com/nnurry/harmonia/internal/auth"
+	"github.com/nnurry/harmonia/internal/contract"
+	"github.com/nnurry/harmonia/internal/httputil"
+	"github.com/nnurry/harmonia/internal/logger"
+)
+
+const (
+	REQUEST_ID_HEADER       = "X-Request-ID"
+	DEFAULT_AUDIT_TAIL_SIZE = 100
+)
+
+type Audit struct {
+	auditLog *audit.Log
+}
+
+func NewAudit(auditLog *audit.Log) *Audit {
+	return &Audit{auditLog: auditLog}
+}
+
+func newRequestID() string {
+	buf := make([]byte, 8)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+// writes one audit entry per request once next is done,
+// must run inside auth so the caller is known
+func (handler *Audit) Record(action string, next http.HandlerFunc) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		requestID := request.Header.Get(REQUEST_ID_HEADER)
+		if requestID == "" {
+			requestID = newRequestID()
+		}
+		writer.Header().Set(REQUEST_ID_HEADER, requestID)
+
+		entry := audit.Entry{
+			Time:          time.Now().UTC(),
+			RequestID:     requestID,
+			RemoteAddress: request.RemoteAddr,
+			Action:        action,
+			Endpoint:      request.Method + " " + request.RequestURI,
+		}
+		if principal, ok := auth.PrincipalFromContext(request.Context()); ok {
+			entry.Caller = principal.Name
+			entry.CallerMethod = principal.Method
+		}
+
+		recorder := audit.NewRecorder(entry)
+		statusWriter := httputil.NewStatusRecorder(writer)
+		next(statusWriter, request.WithContext(audit.WithRecorder(request.Context(), recorder)))
+
+		if err := handler.auditLog.Write(recorder.Finish(statusWriter.StatusCode)); err != nil {
+			logger.Errorf("could not write audit entry of request %v: %v", requestID, err)
+		}
+	}
+}
+
+func (handler *Audit) Query(writer http.ResponseWriter, request *http.Request) {
+	queries := request.URL.Query()
+
+	filter := audit.Filter{
+		Caller:         queries.Get("caller"),
+		Action:         queries.Get("action"),
+		VirtualMachine: queries.Get("vm"),
+		Hypervisor:     queries.Get("hypervisor"),
+		Outcome:        queries.Get("outcome"),
+		RequestID:      queries.Get("request_id"),
+	}
+
+	if since := queries.Get("since"); since != "" {
+		sinceTime, err := audit.ParseSince(since)
+		if err != nil {
+			writeResult(writer, http.StatusBadRequest, contract.GenericResponse{
+				Body:    err.Error(),
+				Message: "invalid since, expected RFC3339 time or duration",
+			})
+			return
+		}
+		filter.Since = sinceTime
+	}
+
+	limit := DEFAULT_AUDIT_TAIL_SIZE
+	if rawLimit := queries.Get("limit"); rawLimit != "" {
+		parsedLimit, err := strconv.Atoi(rawLimit)
+		if err != nil {
+			writeResult(writer, http.StatusBadRequest, contract.GenericResponse{
+				Body:    err.Error(),
+				Message: "invalid limit",
+			})
+			return
+		}
+		limit = parsedLimit
+	}
+
+	entries, err := handler.auditLog.Query(filter, limit)
+	if err != nil {
+		logger.Errorf("failed to query audit log: %v", err)
+		writeResult(writer, http.StatusInternalServerError, contract.GenericResponse{
+			Body:    err.Error(),
+			Message: "could not query audit log",
+		})
+		return
+	}
+
+	writeResult(writer, http.StatusOK, contract.GenericResponse{
+		Body:    entries,
+		Message: "queried audit log",
+	})
+}
@@ -0,0 +1,93 @@
+package handler
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/nnurry/harmonia/internal/auth"
+	"github.com/nnurry/harmonia/internal/console"
+	"github.com/nnurry/harmonia/internal/contract"
+	"github.com/nnurry/harmonia/internal/logger"
+)
+
+type Auth struct {
+	authenticator *auth.Authenticator
+}
+
+func NewAuth(authenticator *auth.Authenticator) *Auth {
+	return &Auth{authenticator: authenticator}
+}
+
+// CN of the verified client certificate, empty without mTLS
+func clientCommonName(request *http.Request) string {
+	if request.TLS == nil || len(request.TLS.VerifiedChains) == 0 || len(request.TLS.VerifiedChains[0]) == 0 {
+		return ""
+	}
+	return request.TLS.VerifiedChains[0][0].Subject.CommonName
+}
+
+// wraps a handler so it only runs for callers holding the scope, identified by
+// bearer token (header or WebSocket subprotocol) first and verified client certificate second;
+// everything passes through when no token or client is configured
+func (handler *Auth) Require(scope auth.Scope, next http.HandlerFunc) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		commonName := clientCommonName(request)
+
+		if !handler.authenticator.Enabled() {
+			if commonName != "" {
+				request = request.WithContext(auth.WithPrincipal(request.Context(), auth.Principal{
+					Name:   commonName,
+					Method: auth.METHOD_CERTIFICATE,
+				}))
+			}
+			next(writer, request)
+			return
+		}
+
+		var (
+			principal *auth.Principal
+			err       error
+		)
+
+		authorization := request.Header.Get("Authorization")
+		if token := console.BearerFromSubprotocols(request); authorization == "" && token != "" {
+			authorization = "Bearer " + token
+		}
+		rawToken, found := strings.CutPrefix(authorization, "Bearer ")
+		switch {
+		case found && strings.TrimSpace(rawToken) != "":
+			principal, err = handler.authenticator.Authenticate(strings.TrimSpace(rawToken))
+		case authorization == "" && commonName != "":
+			principal, err = handler.authenticator.AuthenticateCertificate(commonName)
+		default:
+			writer.Header().Set("WWW-Authenticate", `Bearer realm="harmonia"`)
+			writeResult(writer, http.StatusUnauthorized, contract.GenericResponse{
+				Body:    "missing bearer token or client certificate",
+				Message: "unauthorized",
+			})
+			return
+		}
+
+		if err != nil {
+			writer.Header().Set("WWW-Authenticate", `Bearer realm="harmonia", error="invalid_token"`)
+			writeResult(writer, http.StatusUnauthorized, contract.GenericResponse{
+				Body:    err.Error(),
+				Message: "unauthorized",
+			})
+			return
+		}
+
+		if !principal.HasScope(scope) {
+			logger.Warnf("%v %v lacks scope %v for %v %v", principal.Method, principal.Name, scope, request.Method, request.RequestURI)
+			writeResult(writer, http.StatusForbidden, contract.GenericResponse{
+				Body: struct {
+					RequiredScope auth.Scope `json:"required_scope"`
+				}{RequiredScope: scope},
+				Message: "forbidden",
+			})
+			return
+		}
+
+		next(writer, request.WithContext(auth.WithPrincipal(request.Context(), *principal)))
+	}
+}
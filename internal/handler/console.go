@@ -0,0 +1,175 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/nnurry/harmonia/internal/audit"
+	"github.com/nnurry/harmonia/internal/config"
+	"github.com/nnurry/harmonia/internal/connection"
+	"github.com/nnurry/harmonia/internal/console"
+	"github.com/nnurry/harmonia/internal/contract"
+	"github.com/nnurry/harmonia/internal/logger"
+	"github.com/nnurry/harmonia/internal/service"
+)
+
+// lines of console log returned when ?tail= is not given
+const DEFAULT_CONSOLE_LOG_TAIL = 100
+
+type Console struct {
+	serverConfig *config.ServerConfig
+	stateStore   service.StateStore
+	upgrader     websocket.Upgrader
+}
+
+func NewConsole(serverConfig *config.ServerConfig, stateStore service.StateStore) *Console {
+	return &Console{
+		serverConfig: serverConfig,
+		stateStore:   stateStore,
+		upgrader:     websocket.Upgrader{Subprotocols: []string{console.SUBPROTOCOL}},
+	}
+}
+
+// bridges the serial console of a running domain over a WebSocket, on ?hypervisor= or
+// the default hypervisor; ?force=true takes the console over from whoever holds it
+func (handler *Console) Attach(writer http.ResponseWriter, request *http.Request) {
+	name := request.PathValue("name")
+	hypervisorName := request.URL.Query().Get("hypervisor")
+	if hypervisorName == "" {
+		hypervisorName = handler.serverConfig.DefaultHypervisor
+	}
+	isForce := request.URL.Query().Get("force") == "true"
+
+	recorder := audit.FromContext(request.Context())
+	recorder.AddVirtualMachines(name)
+	recorder.AddHypervisors(hypervisorName)
+
+	hypervisorConfig, err := handler.serverConfig.GetHypervisor(hypervisorName)
+	if err != nil {
+		recorder.SetOutcome(audit.OUTCOME_FAILURE, err.Error())
+		writeResult(writer, http.StatusBadRequest, contract.GenericResponse{
+			Body:    err.Error(),
+			Message: "no matching hypervisor",
+		})
+		return
+	}
+
+	conn, err := connection.NewLibvirt(hypervisorConfig.LibvirtConfig)
+	if err != nil {
+		recorder.SetOutcome(audit.OUTCOME_FAILURE, err.Error())
+		writeResult(writer, http.StatusBadGateway, contract.GenericResponse{
+			Body:    err.Error(),
+			Message: "could not connect to hypervisor",
+		})
+		return
+	}
+
+	libvirtService, err := service.NewLibvirt(conn)
+	if err != nil {
+		recorder.SetOutcome(audit.OUTCOME_FAILURE, err.Error())
+		writeResult(writer, http.StatusInternalServerError, contract.GenericResponse{
+			Body:    err.Error(),
+			Message: "could not create Libvirt service",
+		})
+		return
+	}
+	defer libvirtService.Cleanup()
+
+	domainConsole, err := libvirtService.OpenConsole(name, isForce)
+	if err != nil {
+		recorder.SetOutcome(audit.OUTCOME_FAILURE, err.Error())
+		writeResult(writer, http.StatusConflict, contract.GenericResponse{
+			Body:    err.Error(),
+			Message: "could not open console of virtual machine",
+		})
+		return
+	}
+
+	// the upgrader answers the client itself on failure
+	socket, err := handler.upgrader.Upgrade(writer, request, nil)
+	if err != nil {
+		domainConsole.Close()
+		recorder.SetOutcome(audit.OUTCOME_FAILURE, err.Error())
+		return
+	}
+	// server read and write timeouts are meant for requests, not sessions
+	socket.NetConn().SetDeadline(time.Time{})
+
+	logger.Infof("console of %v on %v attached by %v", name, hypervisorName, request.RemoteAddr)
+	err = console.Bridge(domainConsole, console.NewWebSocketStream(socket))
+	if err != nil {
+		recorder.SetOutcome(audit.OUTCOME_FAILURE, err.Error())
+	}
+	logger.Infof("console of %v on %v detached by %v", name, hypervisorName, request.RemoteAddr)
+}
+
+// tail of the serial console log of a VM, on ?hypervisor= or the default hypervisor;
+// ?tail=N lines (default 100), 0 for its last MiB
+func (handler *Console) Log(writer http.ResponseWriter, request *http.Request) {
+	name := request.PathValue("name")
+	hypervisorName := request.URL.Query().Get("hypervisor")
+	if hypervisorName == "" {
+		hypervisorName = handler.serverConfig.DefaultHypervisor
+	}
+
+	result := contract.ConsoleLogResult{Name: name, Hypervisor: hypervisorName}
+
+	lines := DEFAULT_CONSOLE_LOG_TAIL
+	if rawTail := request.URL.Query().Get("tail"); rawTail != "" {
+		var err error
+		lines, err = strconv.Atoi(rawTail)
+		if err != nil || lines < 0 {
+			writeResult(writer, http.StatusBadRequest, contract.GenericResponse{
+				Body:    fmt.Sprintf("tail must be a number of lines, got '%v'", rawTail),
+				Message: "invalid tail",
+			})
+			return
+		}
+	}
+
+	hypervisorConfig, err := handler.serverConfig.GetHypervisor(hypervisorName)
+	if err != nil {
+		result.Error = err.Error()
+		writeResult(writer, http.StatusBadRequest, contract.GenericResponse{
+			Body:    result,
+			Message: "no matching hypervisor",
+		})
+		return
+	}
+
+	vmConfig := contract.VirtualMachineConfig{HypervisorConnectionConfig: hypervisorConfig}
+	vmConfig.Name, vmConfig.Hypervisor = name, hypervisorName
+
+	virtualMachineService, err := service.NewVirtualMachineFromVirtualMachineConfig(vmConfig)
+	if err != nil {
+		result.Error = err.Error()
+		writeResult(writer, http.StatusBadGateway, contract.GenericResponse{
+			Body:    result,
+			Message: "could not connect to hypervisor",
+		})
+		return
+	}
+	defer virtualMachineService.Cleanup()
+
+	result.Log, result.Path, err = virtualMachineService.
+		WithContext(request.Context()).
+		WithStateStore(handler.stateStore).
+		WithPaths(handler.serverConfig.Paths.CloudInitDir, handler.serverConfig.Paths.DiskDir, handler.serverConfig.Paths.ConsoleLogDir).
+		ReadConsoleLog(vmConfig, lines)
+	if err != nil {
+		result.Error = err.Error()
+		writeResult(writer, http.StatusInternalServerError, contract.GenericResponse{
+			Body:    result,
+			Message: "could not read console log",
+		})
+		return
+	}
+
+	writeResult(writer, http.StatusOK, contract.GenericResponse{
+		Body:    result,
+		Message: "fetched console log",
+	})
+}
@@ -0,0 +1,197 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/nnurry/harmonia/internal/audit"
+	"github.com/nnurry/harmonia/internal/config"
+	"github.com/nnurry/harmonia/internal/connection"
+	"github.com/nnurry/harmonia/internal/contract"
+	"github.com/nnurry/harmonia/internal/logger"
+	"github.com/nnurry/harmonia/internal/service"
+)
+
+// talks to qemu-guest-agent of VMs on ?hypervisor= or the default hypervisor
+type GuestAgent struct {
+	serverConfig *config.ServerConfig
+}
+
+func NewGuestAgent(serverConfig *config.ServerConfig) *GuestAgent {
+	return &GuestAgent{serverConfig: serverConfig}
+}
+
+func (handler *GuestAgent) hypervisorName(request *http.Request) string {
+	hypervisorName := request.URL.Query().Get("hypervisor")
+	if hypervisorName == "" {
+		hypervisorName = handler.serverConfig.DefaultHypervisor
+	}
+	return hypervisorName
+}
+
+// writes the failure with result as body when no service could be created
+func (handler *GuestAgent) newLibvirtService(writer http.ResponseWriter, hypervisorName string, result any, setError func(err error)) (*service.Libvirt, bool) {
+	hypervisorConfig, err := handler.serverConfig.GetHypervisor(hypervisorName)
+	if err != nil {
+		setError(err)
+		writeResult(writer, http.StatusBadRequest, contract.GenericResponse{
+			Body:    result,
+			Message: "no matching hypervisor",
+		})
+		return nil, false
+	}
+
+	conn, err := connection.NewLibvirt(hypervisorConfig.LibvirtConfig)
+	if err != nil {
+		setError(err)
+		writeResult(writer, http.StatusBadGateway, contract.GenericResponse{
+			Body:    result,
+			Message: "could not connect to hypervisor",
+		})
+		return nil, false
+	}
+
+	libvirtService, err := service.NewLibvirt(conn)
+	if err != nil {
+		setError(err)
+		writeResult(writer, http.StatusInternalServerError, contract.GenericResponse{
+			Body:    result,
+			Message: "could not create Libvirt service",
+		})
+		return nil, false
+	}
+	return libvirtService, true
+}
+
+func (handler *GuestAgent) Interfaces(writer http.ResponseWriter, request *http.Request) {
+	result := contract.GuestInterfacesResult{
+		Name:       request.PathValue("name"),
+		Hypervisor: handler.hypervisorName(request),
+		Interfaces: []contract.GuestInterface{},
+	}
+	setError := func(err error) { result.Error = err.Error() }
+
+	libvirtService, ok := handler.newLibvirtService(writer, result.Hypervisor, &result, setError)
+	if !ok {
+		return
+	}
+	defer libvirtService.Cleanup()
+
+	interfaces, err := libvirtService.GetGuestInterfaces(result.Name)
+	if err != nil {
+		setError(err)
+		writeResult(writer, http.StatusBadGateway, contract.GenericResponse{
+			Body:    result,
+			Message: "could not get interfaces from guest agent",
+		})
+		return
+	}
+	result.Interfaces = interfaces
+
+	writeResult(writer, http.StatusOK, contract.GenericResponse{
+		Body:    result,
+		Message: "fetched guest interfaces",
+	})
+}
+
+// a command exiting non-zero is still a 200, see exit_code
+func (handler *GuestAgent) Exec(writer http.ResponseWriter, request *http.Request) {
+	var execRequest contract.GuestExecRequest
+	cb, err := parseBodyAndHandleError(writer, request, &execRequest, true)
+	if err != nil {
+		cb()
+		return
+	}
+
+	result := contract.GuestExecResult{
+		Name:       request.PathValue("name"),
+		Hypervisor: handler.hypervisorName(request),
+	}
+
+	recorder := audit.FromContext(request.Context())
+	recorder.AddVirtualMachines(result.Name)
+	recorder.AddHypervisors(result.Hypervisor)
+	recorder.SetConfig(struct {
+		Path string   `json:"path"`
+		Args []string `json:"args,omitempty"`
+	}{Path: execRequest.Path, Args: execRequest.Args})
+	setError := func(err error) {
+		recorder.SetOutcome(audit.OUTCOME_FAILURE, err.Error())
+		result.Error = err.Error()
+	}
+
+	libvirtService, ok := handler.newLibvirtService(writer, result.Hypervisor, &result, setError)
+	if !ok {
+		return
+	}
+	defer libvirtService.Cleanup()
+
+	execResult, err := libvirtService.GuestExec(request.Context(), result.Name, execRequest)
+	if execResult != nil {
+		execResult.Name, execResult.Hypervisor = result.Name, result.Hypervisor
+		result = *execResult
+	}
+	if err != nil {
+		logger.Errorf("failed to exec %v in %v: %v", execRequest.Path, result.Name, err)
+		setError(err)
+		writeResult(writer, http.StatusBadGateway, contract.GenericResponse{
+			Body:    result,
+			Message: "could not run command in guest",
+		})
+		return
+	}
+
+	writeResult(writer, http.StatusOK, contract.GenericResponse{
+		Body:    result,
+		Message: "ran command in guest",
+	})
+}
+
+func (handler *GuestAgent) WriteFile(writer http.ResponseWriter, request *http.Request) {
+	var writeRequest contract.GuestFileWriteRequest
+	cb, err := parseBodyAndHandleError(writer, request, &writeRequest, true)
+	if err != nil {
+		cb()
+		return
+	}
+
+	result := contract.GuestFileWriteResult{
+		Name:       request.PathValue("name"),
+		Hypervisor: handler.hypervisorName(request),
+		Path:       writeRequest.Path,
+	}
+
+	recorder := audit.FromContext(request.Context())
+	recorder.AddVirtualMachines(result.Name)
+	recorder.AddHypervisors(result.Hypervisor)
+	recorder.SetConfig(struct {
+		Path     string `json:"path"`
+		Size     int    `json:"size"`
+		IsAppend bool   `json:"is_append,omitempty"`
+	}{Path: writeRequest.Path, Size: len(writeRequest.Content), IsAppend: writeRequest.IsAppend})
+	setError := func(err error) {
+		recorder.SetOutcome(audit.OUTCOME_FAILURE, err.Error())
+		result.Error = err.Error()
+	}
+
+	libvirtService, ok := handler.newLibvirtService(writer, result.Hypervisor, &result, setError)
+	if !ok {
+		return
+	}
+	defer libvirtService.Cleanup()
+
+	result.BytesWritten, err = libvirtService.GuestWriteFile(result.Name, writeRequest.Path, writeRequest.Content, writeRequest.IsAppend)
+	if err != nil {
+		logger.Errorf("failed to write %v in %v: %v", writeRequest.Path, result.Name, err)
+		setError(err)
+		writeResult(writer, http.StatusBadGateway, contract.GenericResponse{
+			Body:    result,
+			Message: "could not write file in guest",
+		})
+		return
+	}
+
+	writeResult(writer, http.StatusOK, contract.GenericResponse{
+		Body:    result,
+		Message: "wrote file in guest",
+	})
+}
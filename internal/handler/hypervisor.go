@@ -0,0 +1,69 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/nnurry/harmonia/internal/config"
+	"github.com/nnurry/harmonia/internal/connection"
+	"github.com/nnurry/harmonia/internal/contract"
+	"github.com/nnurry/harmonia/internal/logger"
+	"github.com/nnurry/harmonia/internal/service"
+)
+
+type Hypervisor struct {
+	serverConfig *config.ServerConfig
+}
+
+func NewHypervisor(serverConfig *config.ServerConfig) *Hypervisor {
+	return &Hypervisor{serverConfig: serverConfig}
+}
+
+func (handler *Hypervisor) Capacity(writer http.ResponseWriter, request *http.Request) {
+	name := request.PathValue("name")
+
+	hypervisorConfig, err := handler.serverConfig.GetHypervisor(name)
+	if err != nil {
+		writeResult(writer, http.StatusNotFound, contract.GenericResponse{
+			Body:    err.Error(),
+			Message: "no matching hypervisor",
+		})
+		return
+	}
+
+	conn, err := connection.NewLibvirt(hypervisorConfig.LibvirtConfig)
+	if err != nil {
+		writeResult(writer, http.StatusBadGateway, contract.GenericResponse{
+			Body:    err.Error(),
+			Message: "could not connect to hypervisor",
+		})
+		return
+	}
+
+	libvirtService, err := service.NewLibvirt(conn)
+	if err != nil {
+		writeResult(writer, http.StatusInternalServerError, contract.GenericResponse{
+			Body:    err.Error(),
+			Message: "could not create Libvirt service",
+		})
+		return
+	}
+	defer libvirtService.Cleanup()
+
+	capacity, err := libvirtService.GetCapacity()
+	if err != nil {
+		logger.Errorf("failed to get capacity of hypervisor %v: %v", name, err)
+		writeResult(writer, http.StatusInternalServerError, contract.GenericResponse{
+			Body:    err.Error(),
+			Message: "could not get hypervisor capacity",
+		})
+		return
+	}
+
+	// report the name known to harmonia, not the hostname
+	capacity.Name = name
+
+	writeResult(writer, http.StatusOK, contract.GenericResponse{
+		Body:    capacity,
+		Message: "fetched hypervisor capacity",
+	})
+}
@@ -0,0 +1,83 @@
+package handler
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/nnurry/harmonia/internal/config"
+	"github.com/nnurry/harmonia/internal/contract"
+	"github.com/nnurry/harmonia/internal/inventory"
+	"github.com/nnurry/harmonia/internal/logger"
+	"github.com/nnurry/harmonia/internal/service"
+	"github.com/nnurry/harmonia/internal/store"
+)
+
+var inventoryContentTypes = map[string]string{
+	inventory.FORMAT_ANSIBLE_INI:  "text/plain; charset=utf-8",
+	inventory.FORMAT_ANSIBLE_YAML: "application/yaml",
+	inventory.FORMAT_SSH_CONFIG:   "text/plain; charset=utf-8",
+}
+
+type Inventory struct {
+	serverConfig *config.ServerConfig
+	stateStore   *store.Store
+}
+
+func NewInventory(serverConfig *config.ServerConfig, stateStore *store.Store) *Inventory {
+	return &Inventory{serverConfig: serverConfig, stateStore: stateStore}
+}
+
+// hosts of a fleet for configuration management, ?format= is ansible-ini (default), ansible-yaml,
+// ssh-config or json; json is the usual response, the others are the file itself
+func (handler *Inventory) Fleet(writer http.ResponseWriter, request *http.Request) {
+	fleet := request.PathValue("name")
+	format := request.URL.Query().Get("format")
+	if format == "" {
+		format = inventory.FORMAT_ANSIBLE_INI
+	}
+	if !slices.Contains(inventory.FORMATS, format) {
+		writeResult(writer, http.StatusBadRequest, contract.GenericResponse{
+			Body:    "format must be one of " + strings.Join(inventory.FORMATS, ", "),
+			Message: "invalid format",
+		})
+		return
+	}
+
+	records, err := handler.stateStore.ListVirtualMachines(contract.VirtualMachineRecordFilter{Fleet: fleet})
+	if err != nil {
+		logger.Errorf("failed to list state records of fleet %v: %v", fleet, err)
+		writeResult(writer, http.StatusInternalServerError, contract.GenericResponse{
+			Body:    err.Error(),
+			Message: "could not read state store",
+		})
+		return
+	}
+	if len(records) < 1 {
+		writeResult(writer, http.StatusNotFound, contract.GenericResponse{
+			Body:    nil,
+			Message: "no virtual machine recorded for fleet",
+		})
+		return
+	}
+
+	fleetInventory := service.GetFleetInventory(fleet, records, handler.serverConfig.GetHypervisor)
+	if format == inventory.FORMAT_JSON {
+		writeResult(writer, http.StatusOK, contract.GenericResponse{
+			Body:    fleetInventory,
+			Message: "built fleet inventory",
+		})
+		return
+	}
+
+	data, err := inventory.Render(fleetInventory, format)
+	if err != nil {
+		writeResult(writer, http.StatusInternalServerError, contract.GenericResponse{
+			Body:    err.Error(),
+			Message: "could not render fleet inventory",
+		})
+		return
+	}
+	writer.Header().Set("Content-Type", inventoryContentTypes[format])
+	writeBytes(writer, http.StatusOK, data)
+}
@@ -0,0 +1,41 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/nnurry/harmonia/internal/contract"
+)
+
+type Limiter struct {
+	slots chan struct{}
+}
+
+// max < 1 means unlimited
+func NewLimiter(max int) *Limiter {
+	limiter := &Limiter{}
+	if max > 0 {
+		limiter.slots = make(chan struct{}, max)
+	}
+	return limiter
+}
+
+// rejects requests beyond the limit right away instead of queueing them
+func (limiter *Limiter) Limit(next http.Handler) http.Handler {
+	if limiter.slots == nil {
+		return next
+	}
+
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		select {
+		case limiter.slots <- struct{}{}:
+			defer func() { <-limiter.slots }()
+			next.ServeHTTP(writer, request)
+		default:
+			writer.Header().Set("Retry-After", "5")
+			writeResult(writer, http.StatusServiceUnavailable, contract.GenericResponse{
+				Body:    "too many concurrent requests",
+				Message: "server busy",
+			})
+		}
+	})
+}
@@ -0,0 +1,138 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/nnurry/harmonia/internal/audit"
+	"github.com/nnurry/harmonia/internal/contract"
+	"github.com/nnurry/harmonia/internal/logger"
+	"github.com/nnurry/harmonia/internal/service"
+)
+
+type VirtualNetwork struct {
+}
+
+func NewVirtualNetwork() *VirtualNetwork {
+	return &VirtualNetwork{}
+}
+
+func (handler *VirtualNetwork) create(config contract.VirtualNetworkConfig) (string, error) {
+	virtualNetworkService, err := service.NewVirtualNetworkFromHypervisorConnectionConfig(config.HypervisorConnectionConfig)
+	if err != nil {
+		return "", err
+	}
+	defer virtualNetworkService.Cleanup()
+
+	return virtualNetworkService.Create(config)
+}
+
+func (handler *VirtualNetwork) delete(name string, config *contract.HypervisorConnectionConfig) (string, error) {
+	virtualNetworkService, err := service.NewVirtualNetworkFromHypervisorConnectionConfig(config)
+	if err != nil {
+		return "", err
+	}
+	defer virtualNetworkService.Cleanup()
+
+	return virtualNetworkService.Delete(name)
+}
+
+func (handler *VirtualNetwork) Create(writer http.ResponseWriter, request *http.Request) {
+	var createRequest contract.CreateVirtualNetworkRequest
+	cb, err := parseBodyAndHandleError(writer, request, &createRequest, true)
+	if err != nil {
+		cb()
+		return
+	}
+
+	recorder := audit.FromContext(request.Context())
+	recorder.SetConfig(createRequest.VirtualNetworkConfig.Redacted())
+	recorder.AddHypervisors(contract.HypervisorLabel("", createRequest.HypervisorConnectionConfig))
+
+	networkUuid, err := handler.create(createRequest.VirtualNetworkConfig)
+	result := contract.CreateVirtualNetworkResult{
+		Name: createRequest.Name,
+	}
+	if err != nil {
+		recorder.SetOutcome(audit.OUTCOME_FAILURE, err.Error())
+		result.Error = err.Error()
+		writeResult(writer, http.StatusInternalServerError, contract.GenericResponse{
+			Body:    result,
+			Message: "could not create virtual network",
+		})
+		return
+	}
+
+	result.UUID = networkUuid
+
+	writeResult(writer, http.StatusOK, contract.GenericResponse{
+		Body:    result,
+		Message: "created virtual network",
+	})
+}
+
+func (handler *VirtualNetwork) Delete(writer http.ResponseWriter, request *http.Request) {
+	var deleteRequest contract.DeleteVirtualNetworkRequest
+	cb, err := parseBodyAndHandleError(writer, request, &deleteRequest, true)
+	if err != nil {
+		cb()
+		return
+	}
+
+	recorder := audit.FromContext(request.Context())
+	recorder.SetConfig(contract.DeleteVirtualNetworkRequest{Name: deleteRequest.Name})
+	recorder.AddHypervisors(contract.HypervisorLabel("", deleteRequest.HypervisorConnectionConfig))
+
+	networkUuid, err := handler.delete(deleteRequest.Name, deleteRequest.HypervisorConnectionConfig)
+	result := contract.DeleteVirtualNetworkResult{
+		Name: deleteRequest.Name,
+		UUID: networkUuid,
+	}
+	if err != nil {
+		recorder.SetOutcome(audit.OUTCOME_FAILURE, err.Error())
+		result.Error = err.Error()
+		writeResult(writer, http.StatusInternalServerError, contract.GenericResponse{
+			Body:    result,
+			Message: "could not delete virtual network",
+		})
+		return
+	}
+
+	writeResult(writer, http.StatusOK, contract.GenericResponse{
+		Body:    result,
+		Message: "deleted virtual network",
+	})
+}
+
+func (handler *VirtualNetwork) List(writer http.ResponseWriter, request *http.Request) {
+	var listRequest contract.ListVirtualNetworksRequest
+	cb, err := parseBodyAndHandleError(writer, request, &listRequest, true)
+	if err != nil {
+		cb()
+		return
+	}
+
+	virtualNetworkService, err := service.NewVirtualNetworkFromHypervisorConnectionConfig(listRequest.HypervisorConnectionConfig)
+	if err != nil {
+		writeResult(writer, http.StatusInternalServerError, contract.GenericResponse{
+			Body:    err.Error(),
+			Message: "could not connect to hypervisor",
+		})
+		return
+	}
+	defer virtualNetworkService.Cleanup()
+
+	networks, err := virtualNetworkService.List(listRequest.IncludeInactive)
+	if err != nil {
+		logger.Errorf("failed to list virtual networks: %v", err)
+		writeResult(writer, http.StatusInternalServerError, contract.GenericResponse{
+			Body:    err.Error(),
+			Message: "could not list virtual networks",
+		})
+		return
+	}
+
+	writeResult(writer, http.StatusOK, contract.GenericResponse{
+		Body:    contract.ListVirtualNetworksResult{Networks: networks},
+		Message: "listed virtual networks",
+	})
+}
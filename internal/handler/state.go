@@ -0,0 +1,50 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/nnurry/harmonia/internal/contract"
+	"github.com/nnurry/harmonia/internal/logger"
+	"github.com/nnurry/harmonia/internal/store"
+)
+
+type State struct {
+	stateStore *store.Store
+}
+
+func NewState(stateStore *store.Store) *State {
+	return &State{stateStore: stateStore}
+}
+
+func (handler *State) list(writer http.ResponseWriter, filter contract.VirtualMachineRecordFilter) {
+	records, err := handler.stateStore.ListVirtualMachines(filter)
+	if err != nil {
+		logger.Errorf("failed to list state records: %v", err)
+		writeResult(writer, http.StatusInternalServerError, contract.GenericResponse{
+			Body:    err.Error(),
+			Message: "could not read state store",
+		})
+		return
+	}
+
+	writeResult(writer, http.StatusOK, contract.GenericResponse{
+		Body:    contract.ListVirtualMachineRecordsResult{Records: records},
+		Message: "listed virtual machine records",
+	})
+}
+
+func (handler *State) ListVirtualMachines(writer http.ResponseWriter, request *http.Request) {
+	queries := request.URL.Query()
+	handler.list(writer, contract.VirtualMachineRecordFilter{
+		Fleet:      queries.Get("fleet"),
+		Hypervisor: queries.Get("hypervisor"),
+	})
+}
+
+// the same name may exist on several hypervisors
+func (handler *State) GetVirtualMachine(writer http.ResponseWriter, request *http.Request) {
+	handler.list(writer, contract.VirtualMachineRecordFilter{
+		Name:       request.PathValue("name"),
+		Hypervisor: request.URL.Query().Get("hypervisor"),
+	})
+}
@@ -0,0 +1,200 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/nnurry/harmonia/internal/config"
+	"github.com/nnurry/harmonia/internal/connection"
+	"github.com/nnurry/harmonia/internal/contract"
+	"github.com/nnurry/harmonia/internal/logger"
+	"github.com/nnurry/harmonia/internal/service"
+)
+
+// longest interval a caller may hold a request open for
+const MAX_STATS_INTERVAL = 60 * time.Second
+
+type Stats struct {
+	serverConfig *config.ServerConfig
+}
+
+func NewStats(serverConfig *config.ServerConfig) *Stats {
+	return &Stats{serverConfig: serverConfig}
+}
+
+func parseStatsInterval(request *http.Request) (time.Duration, error) {
+	rawInterval := request.URL.Query().Get("interval")
+	if rawInterval == "" {
+		return service.DEFAULT_STATS_INTERVAL, nil
+	}
+	interval, err := time.ParseDuration(rawInterval)
+	if err != nil {
+		return 0, err
+	}
+	if interval > MAX_STATS_INTERVAL {
+		interval = MAX_STATS_INTERVAL
+	}
+	return interval, nil
+}
+
+// samples one domain, on ?hypervisor= or the default hypervisor
+func (handler *Stats) VirtualMachine(writer http.ResponseWriter, request *http.Request) {
+	name := request.PathValue("name")
+	hypervisorName := request.URL.Query().Get("hypervisor")
+
+	interval, err := parseStatsInterval(request)
+	if err != nil {
+		writeResult(writer, http.StatusBadRequest, contract.GenericResponse{
+			Body:    err.Error(),
+			Message: "invalid interval",
+		})
+		return
+	}
+
+	hypervisorConfig, err := handler.serverConfig.GetHypervisor(hypervisorName)
+	if err != nil {
+		writeResult(writer, http.StatusBadRequest, contract.GenericResponse{
+			Body:    err.Error(),
+			Message: "no matching hypervisor",
+		})
+		return
+	}
+
+	conn, err := connection.NewLibvirt(hypervisorConfig.LibvirtConfig)
+	if err != nil {
+		writeResult(writer, http.StatusBadGateway, contract.GenericResponse{
+			Body:    err.Error(),
+			Message: "could not connect to hypervisor",
+		})
+		return
+	}
+
+	libvirtService, err := service.NewLibvirt(conn)
+	if err != nil {
+		writeResult(writer, http.StatusInternalServerError, contract.GenericResponse{
+			Body:    err.Error(),
+			Message: "could not create Libvirt service",
+		})
+		return
+	}
+	defer libvirtService.Cleanup()
+
+	domain, err := libvirtService.GetDomainByName(name)
+	if err != nil {
+		writeResult(writer, http.StatusNotFound, contract.GenericResponse{
+			Body:    err.Error(),
+			Message: "no matching virtual machine",
+		})
+		return
+	}
+	defer domain.Free()
+
+	allStats, err := libvirtService.SampleDomainStats(interval, domain)
+	if err == nil && len(allStats) < 1 {
+		err = fmt.Errorf("libvirt returned no stats for %v", name)
+	}
+	if err != nil {
+		logger.Errorf("failed to get stats of %v: %v", name, err)
+		writeResult(writer, http.StatusInternalServerError, contract.GenericResponse{
+			Body:    err.Error(),
+			Message: "could not get virtual machine stats",
+		})
+		return
+	}
+
+	stats := allStats[0]
+	stats.Hypervisor = hypervisorName
+	if stats.Hypervisor == "" {
+		stats.Hypervisor = handler.serverConfig.DefaultHypervisor
+	}
+
+	writeResult(writer, http.StatusOK, contract.GenericResponse{
+		Body:    stats,
+		Message: "fetched virtual machine stats",
+	})
+}
+
+// samples every domain of ?hypervisor= (all configured hypervisors if unset),
+// optionally narrowed to ?fleet=, and sums them up per fleet
+func (handler *Stats) List(writer http.ResponseWriter, request *http.Request) {
+	queries := request.URL.Query()
+	fleet := queries.Get("fleet")
+
+	interval, err := parseStatsInterval(request)
+	if err != nil {
+		writeResult(writer, http.StatusBadRequest, contract.GenericResponse{
+			Body:    err.Error(),
+			Message: "invalid interval",
+		})
+		return
+	}
+
+	hypervisors := map[string]contract.HypervisorConnectionConfig{}
+	if hypervisorName := queries.Get("hypervisor"); hypervisorName != "" {
+		hypervisorConfig, err := handler.serverConfig.GetHypervisor(hypervisorName)
+		if err != nil {
+			writeResult(writer, http.StatusBadRequest, contract.GenericResponse{
+				Body:    err.Error(),
+				Message: "no matching hypervisor",
+			})
+			return
+		}
+		hypervisors[hypervisorName] = *hypervisorConfig
+	} else {
+		hypervisors = handler.serverConfig.Hypervisors
+	}
+
+	result := contract.VirtualMachineStatsResult{
+		Domains: []contract.DomainStats{},
+		Errors:  map[string]string{},
+	}
+
+	// sample all hypervisors at once so the request takes a single interval
+	var (
+		wg sync.WaitGroup
+		mu sync.Mutex
+	)
+	for name, hypervisorConfig := range hypervisors {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			allStats, err := service.SampleHypervisorDomainStats(hypervisorConfig, interval)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				logger.Errorf("failed to get domain stats of hypervisor %v: %v", name, err)
+				result.Errors[name] = err.Error()
+				return
+			}
+			for _, stats := range allStats {
+				if fleet != "" && stats.Fleet != fleet {
+					continue
+				}
+				stats.Hypervisor = name
+				result.Domains = append(result.Domains, stats)
+			}
+		}()
+	}
+	wg.Wait()
+
+	sort.Slice(result.Domains, func(i, j int) bool {
+		if result.Domains[i].Hypervisor != result.Domains[j].Hypervisor {
+			return result.Domains[i].Hypervisor < result.Domains[j].Hypervisor
+		}
+		return result.Domains[i].Name < result.Domains[j].Name
+	})
+	result.Fleets = service.AggregateFleetStats(result.Domains)
+
+	code := http.StatusOK
+	if len(hypervisors) > 0 && len(result.Errors) == len(hypervisors) {
+		code = http.StatusBadGateway
+	}
+	writeResult(writer, code, contract.GenericResponse{
+		Body:    result,
+		Message: "fetched virtual machine stats",
+	})
+}
@@ -1,10 +1,18 @@
 package handler
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
+	"fmt"
 	"net/http"
+	"strings"
 
+	"github.com/nnurry/harmonia/internal/audit"
+	"github.com/nnurry/harmonia/internal/config"
+	"github.com/nnurry/harmonia/internal/connection"
 	"github.com/nnurry/harmonia/internal/contract"
+	"github.com/nnurry/harmonia/internal/format"
+	"github.com/nnurry/harmonia/internal/interpolate"
 	"github.com/nnurry/harmonia/internal/logger"
 	"github.com/nnurry/harmonia/internal/service"
 )
@@ -12,46 +20,111 @@ import (
 type responseCallback func()
 
 type VirtualMachine struct {
+	serverConfig     *config.ServerConfig
+	placementService *service.Placement
+	stateStore       service.StateStore
+	interpolator     *interpolate.Interpolator
 }
 
-func NewVirtualMachine() *VirtualMachine {
-	return &VirtualMachine{}
+func NewVirtualMachine(serverConfig *config.ServerConfig, stateStore service.StateStore) *VirtualMachine {
+	return &VirtualMachine{
+		serverConfig:     serverConfig,
+		placementService: service.NewPlacement(serverConfig.GetHypervisor).WithAdmissionResolver(serverConfig.GetAdmission),
+		stateStore:       stateStore,
+		interpolator:     interpolate.New(serverConfig.Interpolation),
+	}
 }
 
-func (handler *VirtualMachine) create(config contract.VirtualMachineConfig) (string, error) {
-	virtualMachineService, err := service.NewVirtualMachineFromVirtualMachineConfig(config)
+// a fleet service per request, it carries the request context
+func (handler *VirtualMachine) newFleetService(ctx context.Context) *service.Fleet {
+	return service.NewFleet(handler.placementService).
+		WithContext(ctx).
+		WithStateStore(handler.stateStore).
+		WithPaths(handler.serverConfig.Paths.CloudInitDir, handler.serverConfig.Paths.DiskDir, handler.serverConfig.Paths.ConsoleLogDir).
+		WithConcurrency(handler.serverConfig.Limits.MaxConcurrentVMOperations).
+		WithInstanceTypes(handler.serverConfig.InstanceTypes).
+		WithInterpolator(handler.interpolator)
+}
 
+func (handler *VirtualMachine) Create(writer http.ResponseWriter, request *http.Request) {
+	var createRequest contract.CreateVirtualMachineRequest
+	cb, err := parseBodyAndHandleError(writer, request, &createRequest, true)
 	if err != nil {
-		return "", nil
+		cb()
+		return
 	}
 
-	return virtualMachineService.Create(config)
-}
+	var result contract.CreateVirtualMachineResult
+	result.Name, result.Hypervisor = createRequest.Name, createRequest.Hypervisor
 
-func (handler *VirtualMachine) delete(config contract.VirtualMachineConfig) (string, error) {
-	virtualMachineService, err := service.NewVirtualMachineFromVirtualMachineConfig(config)
+	recorder := audit.FromContext(request.Context())
+	recorder.AddVirtualMachines(createRequest.Name)
 
+	filled, err := handler.interpolator.Resolve(&createRequest.VirtualMachineConfig)
+	createRequest.SensitiveValues = filled.Values()
 	if err != nil {
-		return "", nil
+		recorder.SetConfig(createRequest.VirtualMachineConfig.Redacted())
+		recorder.SetOutcome(audit.OUTCOME_FAILURE, err.Error())
+		result.Error = err.Error()
+		writeResult(writer, http.StatusBadRequest, contract.GenericResponse{
+			Body:    result,
+			Message: "could not resolve references of virtual machine",
+		})
+		return
 	}
 
-	return virtualMachineService.Delete(config)
-}
+	vmConfig, ok := createRequest.VirtualMachineConfig.WithInstanceType(handler.serverConfig.InstanceTypes)
+	if !ok {
+		err = fmt.Errorf("unknown instance_type %v", vmConfig.InstanceType)
+		recorder.SetConfig(vmConfig.Redacted())
+		recorder.SetOutcome(audit.OUTCOME_FAILURE, err.Error())
+		result.Error = err.Error()
+		writeResult(writer, http.StatusBadRequest, contract.GenericResponse{
+			Body:    result,
+			Message: "could not resolve instance type of virtual machine",
+		})
+		return
+	}
 
-func (handler *VirtualMachine) Create(writer http.ResponseWriter, request *http.Request) {
-	var createRequest contract.CreateVirtualMachineRequest
-	cb, err := parseBodyAndHandleError(writer, request, &createRequest, true)
-	if err != nil {
-		cb()
+	if err = errors.Join(vmConfig.ValidateForCreate()...); err != nil {
+		recorder.SetConfig(vmConfig.Redacted())
+		recorder.SetOutcome(audit.OUTCOME_FAILURE, err.Error())
+		result.Error = err.Error()
+		writeResult(writer, http.StatusBadRequest, contract.GenericResponse{
+			Body:    result,
+			Message: "invalid virtual machine",
+		})
 		return
 	}
 
-	domainUuid, err := handler.create(createRequest.VirtualMachineConfig)
-	result := contract.CreateVirtualMachineResult{
-		Name: createRequest.Name,
+	// the server reads no key or script of its own for a caller
+	if err = errors.Join(vmConfig.PostProvision.ValidateInlined(vmConfig.Name)...); err != nil {
+		recorder.SetConfig(vmConfig.Redacted())
+		recorder.SetOutcome(audit.OUTCOME_FAILURE, err.Error())
+		result.Error = err.Error()
+		writeResult(writer, http.StatusBadRequest, contract.GenericResponse{
+			Body:    result,
+			Message: "post-provision keys and scripts must be sent inline",
+		})
+		return
 	}
+
+	vmConfig, err = handler.placementService.ResolveVirtualMachine(vmConfig)
+	recorder.SetConfig(vmConfig.Redacted())
+	recorder.AddHypervisors(vmConfig.HypervisorLabel())
 	if err != nil {
+		recorder.SetOutcome(audit.OUTCOME_FAILURE, err.Error())
 		result.Error = err.Error()
+		writeResult(writer, http.StatusBadRequest, contract.GenericResponse{
+			Body:    result,
+			Message: "could not resolve hypervisor of virtual machine",
+		})
+		return
+	}
+
+	result, err = handler.newFleetService(request.Context()).CreateVirtualMachine(vmConfig)
+	if err != nil {
+		recorder.SetOutcome(audit.OUTCOME_FAILURE, err.Error())
 		writeResult(writer, http.StatusInternalServerError, contract.GenericResponse{
 			Body:    result,
 			Message: "could not create single virtual machine",
@@ -59,66 +132,218 @@ func (handler *VirtualMachine) Create(writer http.ResponseWriter, request *http.
 		return
 	}
 
-	result.UUID = domainUuid
-
 	writeResult(writer, http.StatusOK, contract.GenericResponse{
 		Body:    result,
 		Message: "created single virtual machine",
 	})
 }
 
-func (handler *VirtualMachine) FormatRequest(writer http.ResponseWriter, request *http.Request) {
-	contractGeneratorMap := map[string]func() any{
-		"create":       func() any { return contract.CreateVirtualMachineRequest{} },
-		"create_fleet": func() any { return contract.CreateVirtualMachineFleetRequest{} },
+func (handler *VirtualMachine) Delete(writer http.ResponseWriter, request *http.Request) {
+	var deleteRequest contract.DeleteVirtualMachineRequest
+	cb, err := parseBodyAndHandleError(writer, request, &deleteRequest, true)
+	if err != nil {
+		cb()
+		return
 	}
 
-	serializerMap := map[string]func(any) ([]byte, error){
-		"json": func(v any) ([]byte, error) { return json.MarshalIndent(v, "", " ") },
+	result := contract.DeleteVirtualMachineResult{
+		Name:       deleteRequest.Name,
+		Hypervisor: deleteRequest.Hypervisor,
 	}
 
-	queries := request.URL.Query()
+	recorder := audit.FromContext(request.Context())
+	recorder.AddVirtualMachines(deleteRequest.Name)
 
-	var (
-		inputData  any
-		outputData []byte
-		err        error
-	)
+	filled, err := handler.interpolator.Resolve(&deleteRequest.VirtualMachineConfig)
+	deleteRequest.SensitiveValues = filled.Values()
+	if err != nil {
+		recorder.SetOutcome(audit.OUTCOME_FAILURE, err.Error())
+		result.Error = err.Error()
+		writeResult(writer, http.StatusBadRequest, contract.GenericResponse{
+			Body:    result,
+			Message: "could not resolve references of virtual machine",
+		})
+		return
+	}
 
-	if contractGenerator, ok := contractGeneratorMap[queries.Get("contract")]; !ok {
-		writeResult(writer, http.StatusNotFound, contract.GenericResponse{
-			Body:    nil,
-			Message: "no matching contract to format request",
+	vmConfig, err := handler.placementService.ResolveVirtualMachine(deleteRequest.VirtualMachineConfig)
+	recorder.SetConfig(vmConfig.Redacted())
+	recorder.AddHypervisors(vmConfig.HypervisorLabel())
+	if err != nil {
+		recorder.SetOutcome(audit.OUTCOME_FAILURE, err.Error())
+		result.Error = err.Error()
+		writeResult(writer, http.StatusBadRequest, contract.GenericResponse{
+			Body:    result,
+			Message: "could not resolve hypervisor of virtual machine",
+		})
+		return
+	}
+
+	result, err = handler.newFleetService(request.Context()).DeleteVirtualMachine(vmConfig)
+	if err != nil {
+		recorder.SetOutcome(audit.OUTCOME_FAILURE, err.Error())
+		result.Error = err.Error()
+		writeResult(writer, http.StatusInternalServerError, contract.GenericResponse{
+			Body:    result,
+			Message: "could not delete single virtual machine",
 		})
 		return
-	} else {
-		inputData = contractGenerator()
 	}
 
-	cb, err := parseBodyAndHandleError(writer, request, &inputData, true)
+	writeResult(writer, http.StatusOK, contract.GenericResponse{
+		Body:    result,
+		Message: "deleted single virtual machine",
+	})
+}
+
+func (handler *VirtualMachine) Start(writer http.ResponseWriter, request *http.Request) {
+	handler.power(writer, request, contract.POWER_ACTION_START)
+}
+
+func (handler *VirtualMachine) Stop(writer http.ResponseWriter, request *http.Request) {
+	handler.power(writer, request, contract.POWER_ACTION_STOP)
+}
+
+func (handler *VirtualMachine) power(writer http.ResponseWriter, request *http.Request, action string) {
+	var powerRequest contract.VirtualMachinePowerRequest
+	cb, err := parseBodyAndHandleError(writer, request, &powerRequest, true)
 	if err != nil {
 		cb()
 		return
 	}
 
-	if serializer, ok := serializerMap[queries.Get("format")]; !ok {
+	result := contract.VirtualMachinePowerResult{
+		Name:       powerRequest.Name,
+		Hypervisor: powerRequest.Hypervisor,
+		Action:     action,
+	}
+
+	recorder := audit.FromContext(request.Context())
+	recorder.AddVirtualMachines(powerRequest.Name)
+
+	vmConfig := contract.VirtualMachineConfig{HypervisorConnectionConfig: powerRequest.HypervisorConnectionConfig}
+	vmConfig.Name, vmConfig.Hypervisor = powerRequest.Name, powerRequest.Hypervisor
+
+	vmConfig, err = handler.placementService.ResolveVirtualMachine(vmConfig)
+	recorder.AddHypervisors(vmConfig.HypervisorLabel())
+	if err != nil {
+		recorder.SetOutcome(audit.OUTCOME_FAILURE, err.Error())
+		result.Error = err.Error()
+		writeResult(writer, http.StatusBadRequest, contract.GenericResponse{
+			Body:    result,
+			Message: "could not resolve hypervisor of virtual machine",
+		})
+		return
+	}
+
+	conn, err := connection.NewLibvirt(vmConfig.HypervisorConnectionConfig.LibvirtConfig)
+	if err != nil {
+		recorder.SetOutcome(audit.OUTCOME_FAILURE, err.Error())
+		result.Error = err.Error()
+		writeResult(writer, http.StatusBadGateway, contract.GenericResponse{
+			Body:    result,
+			Message: "could not connect to hypervisor",
+		})
+		return
+	}
+
+	libvirtService, err := service.NewLibvirt(conn)
+	if err != nil {
+		recorder.SetOutcome(audit.OUTCOME_FAILURE, err.Error())
+		result.Error = err.Error()
+		writeResult(writer, http.StatusInternalServerError, contract.GenericResponse{
+			Body:    result,
+			Message: "could not create Libvirt service",
+		})
+		return
+	}
+	defer libvirtService.Cleanup()
+
+	if action == contract.POWER_ACTION_START {
+		err = libvirtService.StartDomainWithName(powerRequest.Name)
+	} else {
+		err = libvirtService.StopDomainWithName(powerRequest.Name)
+	}
+	if err != nil {
+		logger.Errorf("failed to %v virtual machine %v: %v", action, powerRequest.Name, err)
+		recorder.SetOutcome(audit.OUTCOME_FAILURE, err.Error())
+		result.Error = err.Error()
+		writeResult(writer, http.StatusInternalServerError, contract.GenericResponse{
+			Body:    result,
+			Message: fmt.Sprintf("could not %v virtual machine", action),
+		})
+		return
+	}
+
+	writeResult(writer, http.StatusOK, contract.GenericResponse{
+		Body:    result,
+		Message: fmt.Sprintf("%v virtual machine done", action),
+	})
+}
+
+var formatContentTypes = map[string]string{
+	format.FORMAT_JSON:        "application/json",
+	format.FORMAT_YAML:        "application/yaml",
+	format.FORMAT_JSON_SCHEMA: "application/schema+json",
+}
+
+// echoes a request the way the API would act on it, or the JSON Schema of the contract without a body
+func (handler *VirtualMachine) FormatRequest(writer http.ResponseWriter, request *http.Request) {
+	queries := request.URL.Query()
+
+	outputFormat := queries.Get("format")
+	if outputFormat == "" {
+		outputFormat = format.FORMAT_JSON
+	}
+	if _, ok := formatContentTypes[outputFormat]; !ok {
 		writeResult(writer, http.StatusNotFound, contract.GenericResponse{
 			Body:    nil,
-			Message: "no matching serializer to format request",
+			Message: fmt.Sprintf("no matching serializer to format request, use one of %v", format.FORMATS),
 		})
 		return
+	}
+
+	inputData, err := format.NewContract(queries.Get("contract"))
+	if err != nil {
+		writeResult(writer, http.StatusNotFound, contract.GenericResponse{
+			Body:    nil,
+			Message: fmt.Sprintf("no matching contract to format request: %v", err),
+		})
+		return
+	}
+
+	var outputData []byte
+	if outputFormat == format.FORMAT_JSON_SCHEMA {
+		outputData, err = format.Schema(queries.Get("contract"))
 	} else {
-		outputData, err = serializer(inputData)
+		cb, parseErr := parseBodyAndHandleError(writer, request, inputData, true)
+		if parseErr != nil {
+			cb()
+			return
+		}
+
+		// files and secrets are checked to resolve but never echoed back
+		if err = handler.newFleetService(request.Context()).Normalize(inputData); err != nil {
+			writeResult(writer, http.StatusBadRequest, contract.GenericResponse{
+				Body: struct {
+					Errors []string `json:"errors"`
+				}{Errors: strings.Split(err.Error(), "\n")},
+				Message: "could not resolve references of request",
+			})
+			return
+		}
+		outputData, err = format.Serialize(inputData, outputFormat)
 	}
 
 	if err != nil {
 		writeResult(writer, http.StatusInternalServerError, contract.GenericResponse{
-			Body:    err,
+			Body:    err.Error(),
 			Message: "could not serialize data",
 		})
 		return
 	}
 
+	writer.Header().Set("Content-Type", formatContentTypes[outputFormat])
 	writeBytes(writer, http.StatusOK, outputData)
 }
 
@@ -131,41 +356,57 @@ func (handler *VirtualMachine) CreateFleet(writer http.ResponseWriter, request *
 		return
 	}
 
-	result := contract.CreateVirtualMachineFleetResult{
-		SubResults: []contract.CreateVirtualMachineResult{},
-		Failed:     0,
-		Success:    0,
-		Total:      0,
-	}
-
-	for _, config := range fleetCreateRequest.GetCoalesced().VirtualMachineConfigs {
-		subResult := contract.CreateVirtualMachineResult{
-			Name: config.Name,
-		}
+	recorder := audit.FromContext(request.Context())
+	fleetService := handler.newFleetService(request.Context())
 
-		logger.Infof("creating VM %v", config.GeneralVMConfig.Name)
-		domainUuid, err := handler.create(config)
+	coalescedFleetConfig, err := fleetService.Prepare(fleetCreateRequest.VirtualMachineFleetConfig)
+	recordFleet(recorder, coalescedFleetConfig)
+	if err != nil {
+		recorder.SetOutcome(audit.OUTCOME_FAILURE, err.Error())
+		logger.Errorf("failed to schedule virtual machine fleet: %v", err)
+		writeResult(writer, http.StatusBadRequest, contract.GenericResponse{
+			Body:    err.Error(),
+			Message: "could not schedule virtual machine fleet",
+		})
+		return
+	}
 
-		if err != nil {
-			subResult.Error = err.Error()
-			logger.Errorf("failed to create VM %v: %v", config.GeneralVMConfig.Name, subResult.Error)
-			result.Failed++
-		} else {
-			subResult.UUID = domainUuid
-			result.Success++
-		}
-		result.Total++
+	// the server reads no key or script of its own for a caller, checked before any hypervisor is probed
+	if err = coalescedFleetConfig.ValidateInlined(); err != nil {
+		recorder.SetOutcome(audit.OUTCOME_FAILURE, err.Error())
+		writeResult(writer, http.StatusBadRequest, contract.GenericResponse{
+			Body:    strings.Split(err.Error(), "\n"),
+			Message: "post-provision keys and scripts must be sent inline",
+		})
+		return
+	}
 
-		result.SubResults = append(result.SubResults, subResult)
+	coalescedFleetConfig, err = fleetService.Place(coalescedFleetConfig)
+	recordFleet(recorder, coalescedFleetConfig)
+	if err != nil {
+		recorder.SetOutcome(audit.OUTCOME_FAILURE, err.Error())
+		logger.Errorf("failed to schedule virtual machine fleet: %v", err)
+		writeResult(writer, http.StatusBadRequest, contract.GenericResponse{
+			Body:    err.Error(),
+			Message: "could not schedule virtual machine fleet",
+		})
+		return
 	}
 
+	result := fleetService.Create(coalescedFleetConfig)
+
 	var message string
 	if result.Failed > 0 {
 		if result.Failed == result.Total {
 			message = "failed to create virtual machine fleet"
+			recorder.SetOutcome(audit.OUTCOME_FAILURE, message)
 		} else {
 			message = "created virtual machine fleet with partial failures"
+			recorder.SetOutcome(audit.OUTCOME_PARTIAL, message)
 		}
+	} else if result.PostProvisionFailed() > 0 {
+		message = "created virtual machine fleet with failing post-provision hooks"
+		recorder.SetOutcome(audit.OUTCOME_PARTIAL, message)
 	} else {
 		message = "created virtual machine fleet"
 	}
@@ -188,40 +429,31 @@ func (handler *VirtualMachine) DeleteFleet(writer http.ResponseWriter, request *
 		return
 	}
 
-	result := contract.DeleteVirtualMachineFleetResult{
-		SubResults: []contract.DeleteVirtualMachineResult{},
-		Failed:     0,
-		Success:    0,
-		Total:      0,
-	}
-
-	for _, config := range fleetDeleteRequest.GetCoalesced().VirtualMachineConfigs {
-		subResult := contract.DeleteVirtualMachineResult{
-			Name: config.Name,
-		}
-
-		logger.Infof("creating VM %v", config.GeneralVMConfig.Name)
-		domainUuid, err := handler.delete(config)
-
-		if err != nil {
-			subResult.Error = err.Error()
-			logger.Errorf("failed to delete VM %v: %v", config.GeneralVMConfig.Name, subResult.Error)
-			result.Failed++
-		} else {
-			subResult.UUID = domainUuid
-			result.Success++
-		}
-		result.Total++
+	recorder := audit.FromContext(request.Context())
+	fleetService := handler.newFleetService(request.Context())
 
-		result.SubResults = append(result.SubResults, subResult)
+	coalescedFleetConfig, err := fleetService.Locate(fleetDeleteRequest.VirtualMachineFleetConfig)
+	recordFleet(recorder, coalescedFleetConfig)
+	if err != nil {
+		recorder.SetOutcome(audit.OUTCOME_FAILURE, err.Error())
+		logger.Errorf("failed to locate virtual machine fleet: %v", err)
+		writeResult(writer, http.StatusBadRequest, contract.GenericResponse{
+			Body:    err.Error(),
+			Message: "could not locate virtual machine fleet",
+		})
+		return
 	}
 
+	result := fleetService.Delete(coalescedFleetConfig)
+
 	var message string
 	if result.Failed > 0 {
 		if result.Failed == result.Total {
 			message = "failed to delete virtual machine fleet"
+			recorder.SetOutcome(audit.OUTCOME_FAILURE, message)
 		} else {
 			message = "deleted virtual machine fleet with partial failures"
+			recorder.SetOutcome(audit.OUTCOME_PARTIAL, message)
 		}
 	} else {
 		message = "deleted virtual machine fleet"
@@ -235,3 +467,66 @@ func (handler *VirtualMachine) DeleteFleet(writer http.ResponseWriter, request *
 		},
 	)
 }
+
+// lists domains of a hypervisor, optionally narrowed to harmonia fleets and labels
+func (handler *VirtualMachine) List(writer http.ResponseWriter, request *http.Request) {
+	var listRequest contract.ListDomainsRequest
+	cb, err := parseBodyAndHandleError(writer, request, &listRequest, true)
+	if err != nil {
+		cb()
+		return
+	}
+
+	hypervisorConfig := listRequest.HypervisorConnectionConfig
+	if hypervisorConfig == nil {
+		if hypervisorConfig, err = handler.serverConfig.GetHypervisor(listRequest.Hypervisor); err != nil {
+			writeResult(writer, http.StatusBadRequest, contract.GenericResponse{
+				Body:    err.Error(),
+				Message: "no matching hypervisor",
+			})
+			return
+		}
+	}
+
+	conn, err := connection.NewLibvirt(hypervisorConfig.LibvirtConfig)
+	if err != nil {
+		writeResult(writer, http.StatusBadGateway, contract.GenericResponse{
+			Body:    err.Error(),
+			Message: "could not connect to hypervisor",
+		})
+		return
+	}
+
+	libvirtService, err := service.NewLibvirt(conn)
+	if err != nil {
+		writeResult(writer, http.StatusInternalServerError, contract.GenericResponse{
+			Body:    err.Error(),
+			Message: "could not create Libvirt service",
+		})
+		return
+	}
+	defer libvirtService.Cleanup()
+
+	summaries, err := libvirtService.ListDomainSummaries(listRequest.IncludeInactive, listRequest.Selector)
+	if err != nil {
+		logger.Errorf("failed to list virtual machines: %v", err)
+		writeResult(writer, http.StatusInternalServerError, contract.GenericResponse{
+			Body:    err.Error(),
+			Message: "could not list virtual machines",
+		})
+		return
+	}
+
+	writeResult(writer, http.StatusOK, contract.GenericResponse{
+		Body:    contract.ListDomainsResult{Domains: summaries},
+		Message: "listed virtual machines",
+	})
+}
+
+func recordFleet(recorder *audit.Recorder, fleetConfig contract.VirtualMachineFleetConfig) {
+	recorder.SetConfig(fleetConfig.Redacted())
+	for _, vmConfig := range fleetConfig.VirtualMachineConfigs {
+		recorder.AddVirtualMachines(vmConfig.Name)
+		recorder.AddHypervisors(vmConfig.HypervisorLabel())
+	}
+}
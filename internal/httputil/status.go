@@ -0,0 +1,36 @@
+package httputil
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+)
+
+// keeps the status code written through it, for metrics and the audit log
+type StatusRecorder struct {
+	http.ResponseWriter
+	StatusCode int
+}
+
+func NewStatusRecorder(writer http.ResponseWriter) *StatusRecorder {
+	return &StatusRecorder{ResponseWriter: writer, StatusCode: http.StatusOK}
+}
+
+func (recorder *StatusRecorder) WriteHeader(statusCode int) {
+	recorder.StatusCode = statusCode
+	recorder.ResponseWriter.WriteHeader(statusCode)
+}
+
+// lets WebSocket upgrades through, the upgrade answers on the raw connection
+func (recorder *StatusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := recorder.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("response writer does not support hijacking")
+	}
+	conn, readWriter, err := hijacker.Hijack()
+	if err == nil {
+		recorder.StatusCode = http.StatusSwitchingProtocols
+	}
+	return conn, readWriter, err
+}
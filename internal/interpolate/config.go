@@ -0,0 +1,48 @@
+package interpolate
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+const DEFAULT_SECRETS_DIR = "/etc/harmonia/secrets"
+
+type Config struct {
+	// ${secret:name} reads the file name in it
+	SecretsDir string `json:"secrets_dir"`
+	// ${file:/path} may only read files below these, none by default
+	FileDirs []string `json:"file_dirs"`
+	// ${ENV_VAR} may only read these names, or names starting with those ending in *, none by default
+	EnvAllowlist []string `json:"env_allowlist"`
+}
+
+func NewConfig() Config {
+	return Config{SecretsDir: DEFAULT_SECRETS_DIR}
+}
+
+func (cfg Config) Validate() error {
+	if cfg.SecretsDir == "" {
+		return fmt.Errorf("secrets_dir is empty")
+	}
+	for _, dir := range cfg.FileDirs {
+		if !filepath.IsAbs(dir) {
+			return fmt.Errorf("file_dirs entry '%v' is not an absolute path", dir)
+		}
+	}
+	for _, name := range cfg.EnvAllowlist {
+		if !ENV_NAME_PATTERN.MatchString(strings.TrimSuffix(name, "*")) {
+			return fmt.Errorf("env_allowlist entry '%v' is not an environment variable name or prefix", name)
+		}
+	}
+	return nil
+}
+
+func (cfg Config) isEnvAllowed(name string) bool {
+	for _, allowed := range cfg.EnvAllowlist {
+		if prefix, isPrefix := strings.CutSuffix(allowed, "*"); isPrefix && strings.HasPrefix(name, prefix) || allowed == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,231 @@
+package interpolate
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/nnurry/harmonia/internal/connconfig"
+)
+
+const (
+	KIND_FILE   = "file"
+	KIND_SECRET = "secret"
+)
+
+var (
+	// $${ is a literal ${
+	REFERENCE_PATTERN   = regexp.MustCompile(`\$\$\{|\$\{([^}]*)\}`)
+	ENV_NAME_PATTERN    = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	SECRET_NAME_PATTERN = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+)
+
+// resolves ${ENV_VAR}, ${file:/path} and ${secret:name} in every string of a config,
+// but those of fields tagged interpolate:"-"; every reference is sensitive, be it env, file or secret
+type Interpolator struct {
+	config    Config
+	lookupEnv func(string) (string, bool)
+}
+
+func New(config Config) *Interpolator {
+	return &Interpolator{config: config, lookupEnv: os.LookupEnv}
+}
+
+func (interpolator *Interpolator) WithLookupEnv(lookupEnv func(string) (string, bool)) *Interpolator {
+	interpolator.lookupEnv = lookupEnv
+	return interpolator
+}
+
+// resolved strings holding a reference by their path, see Redacted
+type Filled map[string]string
+
+// replaces references in the strings v points to, reporting every unresolved one at once;
+// what it filled is to be redacted before anything is stored or logged
+func (interpolator *Interpolator) Resolve(v any) (Filled, error) {
+	filled := Filled{}
+	err := interpolator.walk(reflect.ValueOf(v), "", false, filled)
+	return filled, err
+}
+
+// as Resolve, strings holding a reference are replaced as a whole by REDACTED; to echo configs back
+func (interpolator *Interpolator) ResolveMasked(v any) error {
+	return interpolator.walk(reflect.ValueOf(v), "", true, Filled{})
+}
+
+// sorted, without duplicates
+func (filled Filled) Values() []string {
+	values := []string{}
+	for _, value := range filled {
+		values = append(values, value)
+	}
+	slices.Sort(values)
+	return slices.Compact(values)
+}
+
+func (interpolator *Interpolator) walk(value reflect.Value, path string, isMasked bool, filled Filled) error {
+	switch value.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if value.IsNil() {
+			return nil
+		}
+		return interpolator.walk(value.Elem(), path, isMasked, filled)
+
+	case reflect.Struct:
+		problems := []error{}
+		valueType := value.Type()
+		for i := 0; i < value.NumField(); i++ {
+			field := valueType.Field(i)
+			// e.g. shell scripts, full of ${VAR} of their own
+			if !field.IsExported() || field.Tag.Get("interpolate") == "-" {
+				continue
+			}
+			if err := interpolator.walk(value.Field(i), joinPath(path, fieldName(field)), isMasked, filled); err != nil {
+				problems = append(problems, err)
+			}
+		}
+		return errors.Join(problems...)
+
+	case reflect.Slice, reflect.Array:
+		problems := []error{}
+		for i := 0; i < value.Len(); i++ {
+			if err := interpolator.walk(value.Index(i), fmt.Sprintf("%v[%d]", path, i), isMasked, filled); err != nil {
+				problems = append(problems, err)
+			}
+		}
+		return errors.Join(problems...)
+
+	case reflect.Map:
+		problems := []error{}
+		for _, key := range value.MapKeys() {
+			// map values can't be set in place
+			element := reflect.New(value.Type().Elem()).Elem()
+			element.Set(value.MapIndex(key))
+			if err := interpolator.walk(element, joinPath(path, fmt.Sprint(key.Interface())), isMasked, filled); err != nil {
+				problems = append(problems, err)
+				continue
+			}
+			value.SetMapIndex(key, element)
+		}
+		return errors.Join(problems...)
+
+	case reflect.String:
+		if !value.CanSet() || !strings.Contains(value.String(), "${") {
+			return nil
+		}
+		resolved, isFilled, err := interpolator.resolveString(value.String(), path)
+		if err != nil {
+			return err
+		}
+		if isFilled {
+			if isMasked {
+				resolved = connconfig.REDACTED
+			}
+			filled[path] = resolved
+		}
+		value.SetString(resolved)
+	}
+	return nil
+}
+
+// s with its references resolved, whether it had any
+func (interpolator *Interpolator) resolveString(s string, path string) (string, bool, error) {
+	problems := []error{}
+	isFilled := false
+	resolved := REFERENCE_PATTERN.ReplaceAllStringFunc(s, func(match string) string {
+		if match == "$${" {
+			return "${"
+		}
+		reference := REFERENCE_PATTERN.FindStringSubmatch(match)[1]
+		value, err := interpolator.resolveReference(reference)
+		if err != nil {
+			problems = append(problems, fmt.Errorf("%v: ${%v}: %v", path, reference, err))
+			return match
+		}
+		isFilled = true
+		return value
+	})
+	return resolved, isFilled, errors.Join(problems...)
+}
+
+func (interpolator *Interpolator) resolveReference(reference string) (string, error) {
+	kind, argument, hasKind := strings.Cut(reference, ":")
+	if !hasKind {
+		if !ENV_NAME_PATTERN.MatchString(reference) {
+			return "", fmt.Errorf("not an environment variable name")
+		}
+		// the server's own environment is off limits but what env_allowlist lets through
+		if !interpolator.config.isEnvAllowed(reference) {
+			return "", fmt.Errorf("environment variable is not in env_allowlist")
+		}
+		value, ok := interpolator.lookupEnv(reference)
+		if !ok {
+			return "", fmt.Errorf("environment variable is not set")
+		}
+		return value, nil
+	}
+
+	switch kind {
+	case KIND_FILE:
+		return interpolator.readFile(argument)
+	case KIND_SECRET:
+		if !SECRET_NAME_PATTERN.MatchString(argument) || strings.Trim(argument, ".") == "" {
+			return "", fmt.Errorf("invalid secret name")
+		}
+		value, err := readTrimmed(filepath.Join(interpolator.config.SecretsDir, argument))
+		if err != nil {
+			return "", fmt.Errorf("secret not found")
+		}
+		return value, nil
+	default:
+		return "", fmt.Errorf("unknown kind '%v', use an environment variable, file: or secret:", kind)
+	}
+}
+
+func (interpolator *Interpolator) readFile(path string) (string, error) {
+	if !filepath.IsAbs(path) {
+		return "", fmt.Errorf("path is not absolute")
+	}
+	path = filepath.Clean(path)
+	for _, dir := range interpolator.config.FileDirs {
+		if relativePath, err := filepath.Rel(filepath.Clean(dir), path); err == nil && filepath.IsLocal(relativePath) {
+			return readTrimmed(path)
+		}
+	}
+	return "", fmt.Errorf("path is not below any of file_dirs")
+}
+
+// content without trailing newlines, as left by editors and echo
+func readTrimmed(path string) (string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("could not read '%v': %v", path, err)
+	}
+	return strings.TrimRight(string(content), "\r\n"), nil
+}
+
+// json name of the field, empty for inlined ones
+func fieldName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "-" {
+		return ""
+	}
+	if name == "" && !field.Anonymous {
+		return field.Name
+	}
+	return name
+}
+
+func joinPath(path string, name string) string {
+	if name == "" {
+		return path
+	}
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
@@ -0,0 +1,91 @@
+package interpolate
+
+import (
+	"reflect"
+
+	"github.com/nnurry/harmonia/internal/connconfig"
+)
+
+// deep copy of v with every string equal to one of values replaced by REDACTED,
+// covering the paths Resolve filled and wherever coalescing copied them to
+func Redacted[T any](v T, values []string) T {
+	if len(values) < 1 {
+		return v
+	}
+	set := map[string]bool{}
+	for _, value := range values {
+		if value != "" {
+			set[value] = true
+		}
+	}
+	copied := reflect.New(reflect.TypeOf(&v).Elem()).Elem()
+	redactCopy(copied, reflect.ValueOf(&v).Elem(), set)
+	return copied.Interface().(T)
+}
+
+// copies value into target, a settable value of the same type
+func redactCopy(target reflect.Value, value reflect.Value, set map[string]bool) {
+	switch value.Kind() {
+	case reflect.Pointer:
+		if value.IsNil() {
+			return
+		}
+		element := reflect.New(value.Type().Elem())
+		redactCopy(element.Elem(), value.Elem(), set)
+		target.Set(element)
+
+	case reflect.Interface:
+		if value.IsNil() {
+			return
+		}
+		element := reflect.New(value.Elem().Type()).Elem()
+		redactCopy(element, value.Elem(), set)
+		target.Set(element)
+
+	case reflect.Struct:
+		// unexported fields can't be copied one by one
+		target.Set(value)
+		for i := 0; i < value.NumField(); i++ {
+			if value.Type().Field(i).IsExported() {
+				redactCopy(target.Field(i), value.Field(i), set)
+			}
+		}
+
+	case reflect.Slice:
+		if value.IsNil() {
+			return
+		}
+		copied := reflect.MakeSlice(value.Type(), value.Len(), value.Len())
+		for i := 0; i < value.Len(); i++ {
+			redactCopy(copied.Index(i), value.Index(i), set)
+		}
+		target.Set(copied)
+
+	case reflect.Array:
+		for i := 0; i < value.Len(); i++ {
+			redactCopy(target.Index(i), value.Index(i), set)
+		}
+
+	case reflect.Map:
+		if value.IsNil() {
+			return
+		}
+		copied := reflect.MakeMapWithSize(value.Type(), value.Len())
+		for _, key := range value.MapKeys() {
+			element := reflect.New(value.Type().Elem()).Elem()
+			redactCopy(element, value.MapIndex(key), set)
+			copied.SetMapIndex(key, element)
+		}
+		target.Set(copied)
+
+	case reflect.String:
+		if set[value.String()] {
+			target.SetString(connconfig.REDACTED)
+		} else {
+			target.Set(value)
+		}
+
+	default:
+		target.Set(value)
+	}
+}
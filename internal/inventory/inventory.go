@@ -0,0 +1,228 @@
+package inventory
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/goccy/go-yaml"
+	"github.com/nnurry/harmonia/internal/contract"
+)
+
+const (
+	FORMAT_ANSIBLE_INI  = "ansible-ini"
+	FORMAT_ANSIBLE_YAML = "ansible-yaml"
+	FORMAT_SSH_CONFIG   = "ssh-config"
+	FORMAT_JSON         = "json"
+)
+
+var FORMATS = []string{FORMAT_ANSIBLE_INI, FORMAT_ANSIBLE_YAML, FORMAT_SSH_CONFIG, FORMAT_JSON}
+
+// label of a VM listing extra groups, comma separated
+const GROUPS_LABEL = "groups"
+
+var (
+	invalidGroupCharacters = regexp.MustCompile(`[^A-Za-z0-9_]`)
+	trailingIndex          = regexp.MustCompile(`[-_]?[0-9]+$`)
+)
+
+// ansible only takes letters, digits and underscores in group names
+func groupName(name string) string {
+	return invalidGroupCharacters.ReplaceAllString(name, "_")
+}
+
+// "master" for k8s-master-1 of fleet k8s, empty when the name has no trailing index
+func prefixGroup(fleet string, name string) string {
+	shortName := strings.TrimPrefix(name, fleet+"-")
+	prefix := trailingIndex.ReplaceAllString(shortName, "")
+	if prefix == shortName || prefix == "" {
+		return ""
+	}
+	return groupName(prefix)
+}
+
+// groups of a VM: the fleet, its name prefix and its groups label
+func hostGroups(fleet string, record contract.VirtualMachineRecord) []string {
+	groups := []string{groupName(fleet)}
+	if prefix := prefixGroup(fleet, record.Name); prefix != "" {
+		groups = append(groups, prefix)
+	}
+	for _, group := range strings.Split(record.Config.GeneralVMConfig.Labels[GROUPS_LABEL], ",") {
+		if group = strings.TrimSpace(group); group != "" {
+			groups = append(groups, groupName(group))
+		}
+	}
+
+	sort.Strings(groups[1:])
+	return slices.Compact(groups)
+}
+
+// turns state records of a fleet into hosts; domains holds what the hypervisors report per
+// connection URL and domain name, a reached hypervisor without the domain drops its host
+func New(fleet string, records []contract.VirtualMachineRecord, domains map[string]map[string]contract.DomainSummary) contract.FleetInventory {
+	inventory := contract.FleetInventory{
+		Fleet:  fleet,
+		Hosts:  []contract.InventoryHost{},
+		Groups: map[string][]string{},
+		Errors: map[string]string{},
+	}
+
+	for _, record := range records {
+		host := contract.InventoryHost{
+			Name:           record.Name,
+			User:           record.Config.UserVMConfig.User,
+			Hypervisor:     record.Hypervisor,
+			PrivateKeyPath: record.Config.PostProvision.PrivateKeyPath,
+			Groups:         hostGroups(fleet, record),
+			Labels:         record.Config.GeneralVMConfig.Labels,
+		}
+		if host.Hypervisor == "" {
+			host.Hypervisor = record.ConnectionUrl
+		}
+		if len(record.IPv4Addresses) > 0 {
+			host.Address = record.IPv4Addresses[0]
+		}
+
+		if hypervisorDomains, ok := domains[record.ConnectionUrl]; ok {
+			summary, ok := hypervisorDomains[record.Name]
+			if !ok {
+				inventory.Errors[record.Name] = fmt.Sprintf("recorded but not found on %v", host.Hypervisor)
+				continue
+			}
+			host.State = summary.State
+			if len(summary.IPv4Addresses) > 0 {
+				host.Address = summary.IPv4Addresses[0]
+			}
+		}
+
+		inventory.Hosts = append(inventory.Hosts, host)
+		for _, group := range host.Groups {
+			inventory.Groups[group] = append(inventory.Groups[group], host.Name)
+		}
+	}
+
+	sort.Slice(inventory.Hosts, func(i, j int) bool { return inventory.Hosts[i].Name < inventory.Hosts[j].Name })
+	for _, hostNames := range inventory.Groups {
+		sort.Strings(hostNames)
+	}
+	return inventory
+}
+
+// the fleet group first, the others by name
+func sortedGroupNames(inventory contract.FleetInventory) []string {
+	fleetGroup := groupName(inventory.Fleet)
+	names := []string{}
+	for name := range inventory.Groups {
+		if name != fleetGroup {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	if _, ok := inventory.Groups[fleetGroup]; ok {
+		names = append([]string{fleetGroup}, names...)
+	}
+	return names
+}
+
+func ansibleHostVars(host contract.InventoryHost) yaml.MapSlice {
+	hostVars := yaml.MapSlice{}
+	if host.Address != "" {
+		hostVars = append(hostVars, yaml.MapItem{Key: "ansible_host", Value: host.Address})
+	}
+	if host.User != "" {
+		hostVars = append(hostVars, yaml.MapItem{Key: "ansible_user", Value: host.User})
+	}
+	if host.PrivateKeyPath != "" {
+		hostVars = append(hostVars, yaml.MapItem{Key: "ansible_ssh_private_key_file", Value: host.PrivateKeyPath})
+	}
+	return hostVars
+}
+
+// host variables go on the hosts of the fleet group, other groups only list names
+func renderAnsibleINI(inventory contract.FleetInventory) []byte {
+	buffer := bytes.NewBufferString("")
+	fleetGroup := groupName(inventory.Fleet)
+
+	for i, group := range sortedGroupNames(inventory) {
+		if i > 0 {
+			buffer.WriteString("\n")
+		}
+		fmt.Fprintf(buffer, "[%v]\n", group)
+		for _, host := range inventory.Hosts {
+			if !slices.Contains(host.Groups, group) {
+				continue
+			}
+			buffer.WriteString(host.Name)
+			if group == fleetGroup {
+				for _, hostVar := range ansibleHostVars(host) {
+					fmt.Fprintf(buffer, " %v=%v", hostVar.Key, hostVar.Value)
+				}
+			}
+			buffer.WriteString("\n")
+		}
+	}
+	return buffer.Bytes()
+}
+
+func renderAnsibleYAML(inventory contract.FleetInventory) ([]byte, error) {
+	hosts := yaml.MapSlice{}
+	for _, host := range inventory.Hosts {
+		hosts = append(hosts, yaml.MapItem{Key: host.Name, Value: ansibleHostVars(host)})
+	}
+
+	children := yaml.MapSlice{}
+	for _, group := range sortedGroupNames(inventory) {
+		groupHosts := yaml.MapSlice{}
+		for _, hostName := range inventory.Groups[group] {
+			groupHosts = append(groupHosts, yaml.MapItem{Key: hostName, Value: yaml.MapSlice{}})
+		}
+		children = append(children, yaml.MapItem{Key: group, Value: yaml.MapSlice{{Key: "hosts", Value: groupHosts}}})
+	}
+
+	return yaml.Marshal(yaml.MapSlice{{Key: "all", Value: yaml.MapSlice{
+		{Key: "hosts", Value: hosts},
+		{Key: "children", Value: children},
+	}}})
+}
+
+// a Host block per VM, hosts without a known address are left as a comment
+func renderSSHConfig(inventory contract.FleetInventory) []byte {
+	buffer := bytes.NewBufferString("")
+	for i, host := range inventory.Hosts {
+		if i > 0 {
+			buffer.WriteString("\n")
+		}
+		if host.Address == "" {
+			fmt.Fprintf(buffer, "# %v has no known address\n", host.Name)
+			continue
+		}
+		fmt.Fprintf(buffer, "Host %v\n", host.Name)
+		fmt.Fprintf(buffer, "  HostName %v\n", host.Address)
+		if host.User != "" {
+			fmt.Fprintf(buffer, "  User %v\n", host.User)
+		}
+		if host.PrivateKeyPath != "" {
+			fmt.Fprintf(buffer, "  IdentityFile %v\n", host.PrivateKeyPath)
+		}
+	}
+	return buffer.Bytes()
+}
+
+func Render(inventory contract.FleetInventory, format string) ([]byte, error) {
+	switch format {
+	case FORMAT_ANSIBLE_INI:
+		return renderAnsibleINI(inventory), nil
+	case FORMAT_ANSIBLE_YAML:
+		return renderAnsibleYAML(inventory)
+	case FORMAT_SSH_CONFIG:
+		return renderSSHConfig(inventory), nil
+	case FORMAT_JSON:
+		data, err := json.MarshalIndent(inventory, "", " ")
+		return append(data, '\n'), err
+	}
+	return nil, fmt.Errorf("unknown inventory format '%v', use one of %v", format, strings.Join(FORMATS, ", "))
+}
@@ -0,0 +1,42 @@
+package logger
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	DEFAULT_LEVEL  = "info"
+	FORMAT_JSON    = "json"
+	FORMAT_CONSOLE = "console"
+)
+
+func Validate(level string, format string) error {
+	if _, err := zerolog.ParseLevel(level); err != nil || level == "" {
+		return fmt.Errorf("unknown log level '%v'", level)
+	}
+	switch format {
+	case FORMAT_JSON, FORMAT_CONSOLE:
+		return nil
+	}
+	return fmt.Errorf("unknown log format '%v'", format)
+}
+
+func Configure(level string, format string) error {
+	if err := Validate(level, format); err != nil {
+		return err
+	}
+
+	parsedLevel, _ := zerolog.ParseLevel(level)
+	zerolog.SetGlobalLevel(parsedLevel)
+
+	if format == FORMAT_CONSOLE {
+		log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr})
+	} else {
+		log.Logger = zerolog.New(os.Stderr).With().Timestamp().Logger()
+	}
+	return nil
+}
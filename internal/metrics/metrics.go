@@ -0,0 +1,156 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nnurry/harmonia/internal/httputil"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const NAMESPACE = "harmonia"
+
+// provisioning steps of a single VM
+const (
+	STEP_CLOUD_INIT_ISO  = "cloud_init_iso"
+	STEP_IGNITION_CONFIG = "ignition_config"
+	STEP_DISK_CLONE      = "disk_clone"
+	STEP_DEFINE          = "define"
+	STEP_BOOT            = "boot"
+	STEP_READY           = "ready"
+	STEP_POST_PROVISION  = "post_provision"
+)
+
+const (
+	JOB_VM_CREATE    = "vm_create"
+	JOB_VM_DELETE    = "vm_delete"
+	JOB_FLEET_CREATE = "fleet_create"
+	JOB_FLEET_DELETE = "fleet_delete"
+)
+
+const (
+	CONNECTION_LIBVIRT = "libvirt"
+	CONNECTION_SSH     = "ssh"
+)
+
+var Registry = prometheus.NewRegistry()
+
+var (
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: NAMESPACE,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests served, by route, method and status code.",
+	}, []string{"route", "method", "code"})
+
+	httpRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: NAMESPACE,
+		Name:      "http_request_duration_seconds",
+		Help:      "Latency of HTTP requests, by route and method.",
+		Buckets:   []float64{0.01, 0.05, 0.1, 0.5, 1, 5, 15, 30, 60, 120, 300, 600},
+	}, []string{"route", "method"})
+
+	provisioningStepDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: NAMESPACE,
+		Name:      "provisioning_step_duration_seconds",
+		Help:      "Duration of VM provisioning steps, by step and hypervisor.",
+		Buckets:   []float64{0.1, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300, 600},
+	}, []string{"step", "hypervisor"})
+
+	provisioningFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: NAMESPACE,
+		Name:      "provisioning_failures_total",
+		Help:      "Failed VM provisioning steps, by step and hypervisor.",
+	}, []string{"step", "hypervisor"})
+
+	activeJobs = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: NAMESPACE,
+		Name:      "active_jobs",
+		Help:      "VM and fleet operations in progress, by kind.",
+	}, []string{"kind"})
+
+	openConnections = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: NAMESPACE,
+		Name:      "open_connections",
+		Help:      "Open connections to hypervisors, by type.",
+	}, []string{"type"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpRequests,
+		httpRequestDuration,
+		provisioningStepDuration,
+		provisioningFailures,
+		activeJobs,
+		openConnections,
+	)
+}
+
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
+
+// records how long a provisioning step took and whether it failed
+func ObserveStep(step string, hypervisor string, started time.Time, err error) {
+	if hypervisor == "" {
+		hypervisor = "unknown"
+	}
+	provisioningStepDuration.WithLabelValues(step, hypervisor).Observe(time.Since(started).Seconds())
+	if err != nil {
+		provisioningFailures.WithLabelValues(step, hypervisor).Inc()
+	}
+}
+
+// returns the function ending the job, meant to be deferred
+func StartJob(kind string) func() {
+	activeJobs.WithLabelValues(kind).Inc()
+	return func() {
+		activeJobs.WithLabelValues(kind).Dec()
+	}
+}
+
+func ConnectionOpened(connectionType string) {
+	openConnections.WithLabelValues(connectionType).Inc()
+}
+
+func ConnectionClosed(connectionType string) {
+	openConnections.WithLabelValues(connectionType).Dec()
+}
+
+// labels requests by the pattern they match in mux, prefixed with where mux is mounted,
+// so path values like VM names never end up as label values
+func InstrumentMux(prefix string, mux *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		route := "unmatched"
+		if _, pattern := mux.Handler(request); pattern != "" {
+			// drop the method of patterns like "POST /create"
+			if _, path, found := strings.Cut(pattern, " "); found {
+				pattern = path
+			}
+			route = prefix + pattern
+		}
+
+		instrument(route, mux, writer, request)
+	})
+}
+
+func InstrumentHandler(route string, handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		instrument(route, handler, writer, request)
+	})
+}
+
+func instrument(route string, handler http.Handler, writer http.ResponseWriter, request *http.Request) {
+	started := time.Now()
+	statusWriter := httputil.NewStatusRecorder(writer)
+	handler.ServeHTTP(statusWriter, request)
+
+	httpRequests.WithLabelValues(route, request.Method, strconv.Itoa(statusWriter.StatusCode)).Inc()
+	httpRequestDuration.WithLabelValues(route, request.Method).Observe(time.Since(started).Seconds())
+}
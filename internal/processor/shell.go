@@ -6,7 +6,9 @@ import (
 	"fmt"
 	"io"
 	"os/exec"
+	"time"
 
+	"github.com/nnurry/harmonia/internal/audit"
 	"github.com/nnurry/harmonia/internal/connection"
 	"github.com/nnurry/harmonia/internal/logger"
 )
@@ -34,10 +36,12 @@ func (processor *LocalShell) Execute(
 	}
 
 	logger.Infof("executing command '%v' locally", cmdBytesBuffer.String())
+	started := time.Now()
 	cmd := exec.CommandContext(ctx, command, args...)
 	cmd.Stdout = stdout
 	cmd.Stderr = stderr
 	err := cmd.Run()
+	audit.RecordCommand(ctx, processor.Name(), command, args, started, err)
 
 	if err != nil {
 		return fmt.Errorf("cmd.Run() error: %v", err)
@@ -82,7 +86,9 @@ func (processor *SecureShell) Execute(
 
 	logger.Infof("executing command '%v' via SSH", command)
 
+	started := time.Now()
 	err = session.Run(command)
+	audit.RecordCommand(ctx, processor.Name(), command, nil, started, err)
 	if err != nil {
 		return fmt.Errorf("session.Run() error: %v", err)
 	}
@@ -3,43 +3,142 @@ package routes
 import (
 	"net/http"
 
+	"github.com/nnurry/harmonia/internal/audit"
+	"github.com/nnurry/harmonia/internal/auth"
+	"github.com/nnurry/harmonia/internal/config"
 	"github.com/nnurry/harmonia/internal/handler"
+	"github.com/nnurry/harmonia/internal/logger"
+	"github.com/nnurry/harmonia/internal/metrics"
+	"github.com/nnurry/harmonia/internal/store"
 )
 
 type Router struct {
 	*http.ServeMux
+	serverConfig *config.ServerConfig
+	stateStore   *store.Store
+	authHandler  *handler.Auth
+	auditHandler *handler.Audit
 }
 
 func (router *Router) VirtualMachineHandler() http.Handler {
 	mux := http.NewServeMux()
 
-	handler := handler.NewVirtualMachine()
+	handler := handler.NewVirtualMachine(router.serverConfig, router.stateStore)
 
-	mux.HandleFunc("POST /create", handler.Create)
-	mux.HandleFunc("POST /create/fleet", handler.CreateFleet)
-	mux.HandleFunc("POST /delete/fleet", handler.DeleteFleet)
+	mux.HandleFunc("POST /create", router.authHandler.Require(auth.SCOPE_VM_WRITE, router.auditHandler.Record("vm.create", handler.Create)))
+	mux.HandleFunc("POST /delete", router.authHandler.Require(auth.SCOPE_VM_WRITE, router.auditHandler.Record("vm.delete", handler.Delete)))
+	mux.HandleFunc("POST /start", router.authHandler.Require(auth.SCOPE_VM_WRITE, router.auditHandler.Record("vm.start", handler.Start)))
+	mux.HandleFunc("POST /stop", router.authHandler.Require(auth.SCOPE_VM_WRITE, router.auditHandler.Record("vm.stop", handler.Stop)))
+	mux.HandleFunc("POST /create/fleet", router.authHandler.Require(auth.SCOPE_FLEET_WRITE, router.auditHandler.Record("fleet.create", handler.CreateFleet)))
+	mux.HandleFunc("POST /delete/fleet", router.authHandler.Require(auth.SCOPE_FLEET_DELETE, router.auditHandler.Record("fleet.delete", handler.DeleteFleet)))
+	mux.HandleFunc("POST /list", router.authHandler.Require(auth.SCOPE_VM_READ, handler.List))
 
-	mux.HandleFunc("POST /format", handler.FormatRequest)
+	mux.HandleFunc("POST /format", router.authHandler.Require(auth.SCOPE_VM_READ, handler.FormatRequest))
 
-	return mux
+	return metrics.InstrumentMux("/virtual-machine", mux)
+}
+
+func (router *Router) VirtualNetworkHandler() http.Handler {
+	mux := http.NewServeMux()
+
+	handler := handler.NewVirtualNetwork()
+
+	mux.HandleFunc("POST /create", router.authHandler.Require(auth.SCOPE_NETWORK_WRITE, router.auditHandler.Record("network.create", handler.Create)))
+	mux.HandleFunc("POST /delete", router.authHandler.Require(auth.SCOPE_NETWORK_WRITE, router.auditHandler.Record("network.delete", handler.Delete)))
+	mux.HandleFunc("POST /list", router.authHandler.Require(auth.SCOPE_NETWORK_READ, handler.List))
+
+	return metrics.InstrumentMux("/virtual-network", mux)
+}
+
+func (router *Router) HypervisorHandler() http.Handler {
+	mux := http.NewServeMux()
+
+	handler := handler.NewHypervisor(router.serverConfig)
+
+	mux.HandleFunc("GET /{name}/capacity", router.authHandler.Require(auth.SCOPE_HYPERVISOR_READ, handler.Capacity))
+
+	return metrics.InstrumentMux("/hypervisors", mux)
+}
+
+func (router *Router) StateHandler() http.Handler {
+	mux := http.NewServeMux()
+
+	handler := handler.NewState(router.stateStore)
+
+	mux.HandleFunc("GET /virtual-machines", router.authHandler.Require(auth.SCOPE_STATE_READ, handler.ListVirtualMachines))
+	mux.HandleFunc("GET /virtual-machines/{name}", router.authHandler.Require(auth.SCOPE_STATE_READ, handler.GetVirtualMachine))
+
+	return metrics.InstrumentMux("/state", mux)
+}
+
+func (router *Router) StatsHandler() http.Handler {
+	mux := http.NewServeMux()
+
+	consoleHandler := handler.NewConsole(router.serverConfig, router.stateStore)
+	guestAgentHandler := handler.NewGuestAgent(router.serverConfig)
+	handler := handler.NewStats(router.serverConfig)
+
+	mux.HandleFunc("GET /stats", router.authHandler.Require(auth.SCOPE_VM_READ, handler.List))
+	mux.HandleFunc("GET /{name}/stats", router.authHandler.Require(auth.SCOPE_VM_READ, handler.VirtualMachine))
+	mux.HandleFunc("GET /{name}/console", router.authHandler.Require(auth.SCOPE_VM_CONSOLE, router.auditHandler.Record("vm.console", consoleHandler.Attach)))
+	mux.HandleFunc("GET /{name}/console-log", router.authHandler.Require(auth.SCOPE_VM_CONSOLE, consoleHandler.Log))
+	mux.HandleFunc("GET /{name}/interfaces", router.authHandler.Require(auth.SCOPE_VM_READ, guestAgentHandler.Interfaces))
+	mux.HandleFunc("POST /{name}/exec", router.authHandler.Require(auth.SCOPE_VM_EXEC, router.auditHandler.Record("vm.exec", guestAgentHandler.Exec)))
+	mux.HandleFunc("POST /{name}/files", router.authHandler.Require(auth.SCOPE_VM_EXEC, router.auditHandler.Record("vm.file.write", guestAgentHandler.WriteFile)))
+
+	return metrics.InstrumentMux("/virtual-machines", mux)
+}
+
+func (router *Router) FleetHandler() http.Handler {
+	mux := http.NewServeMux()
+
+	handler := handler.NewInventory(router.serverConfig, router.stateStore)
+
+	mux.HandleFunc("GET /{name}/inventory", router.authHandler.Require(auth.SCOPE_FLEET_READ, handler.Fleet))
+
+	return metrics.InstrumentMux("/fleets", mux)
 }
 
 func (router *Router) V1Handler() http.Handler {
 	mux := http.NewServeMux()
 
 	mux.Handle("/virtual-machine/", http.StripPrefix("/virtual-machine", router.VirtualMachineHandler()))
+	mux.Handle("/virtual-machines/", http.StripPrefix("/virtual-machines", router.StatsHandler()))
+	mux.Handle("/virtual-network/", http.StripPrefix("/virtual-network", router.VirtualNetworkHandler()))
+	mux.Handle("/hypervisors/", http.StripPrefix("/hypervisors", router.HypervisorHandler()))
+	mux.Handle("/state/", http.StripPrefix("/state", router.StateHandler()))
+	mux.Handle("/fleets/", http.StripPrefix("/fleets", router.FleetHandler()))
+	mux.Handle("GET /audit", metrics.InstrumentHandler("/audit", router.authHandler.Require(auth.SCOPE_AUDIT_READ, router.auditHandler.Query)))
 
 	return mux
 }
 
-func SetupMux() *Router {
-	router := Router{http.NewServeMux()}
+func SetupMux(serverConfig *config.ServerConfig, stateStore *store.Store, auditLog *audit.Log) (*Router, error) {
+	authenticator, err := auth.NewAuthenticator(serverConfig.Auth)
+	if err != nil {
+		return nil, err
+	}
+	if !authenticator.Enabled() {
+		logger.Warnf("no API tokens configured, the API is served without authentication")
+	}
+
+	router := Router{
+		ServeMux:     http.NewServeMux(),
+		serverConfig: serverConfig,
+		stateStore:   stateStore,
+		authHandler:  handler.NewAuth(authenticator),
+		auditHandler: handler.NewAudit(auditLog),
+	}
+
+	limiter := handler.NewLimiter(serverConfig.Limits.MaxConcurrentRequests)
+	router.ServeMux.Handle("/api/v1/", limiter.Limit(http.StripPrefix("/api/v1", router.V1Handler())))
 
-	router.ServeMux.Handle("/api/v1/", http.StripPrefix("/api/v1", router.V1Handler()))
+	// not behind the limiter so scrapes still work while the API is saturated
+	router.ServeMux.HandleFunc("GET /metrics", router.authHandler.Require(auth.SCOPE_METRICS_READ, metrics.Handler().ServeHTTP))
 
 	router.ServeMux.HandleFunc("/heartbeat", func(writer http.ResponseWriter, request *http.Request) {
 		writer.WriteHeader(200)
 		writer.Write([]byte("i have not exploded"))
 	})
-	return &router
+	return &router, nil
 }
@@ -0,0 +1,212 @@
+package scheduler
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/nnurry/harmonia/internal/contract"
+)
+
+const (
+	POLICY_SPREAD           = "spread"
+	POLICY_BINPACK          = "binpack"
+	POLICY_MOST_FREE_MEMORY = "most-free-memory"
+
+	DEFAULT_POLICY = POLICY_SPREAD
+)
+
+type Candidate struct {
+	Name      string
+	Capacity  contract.HypervisorCapacity
+	Admission contract.AdmissionConfig
+}
+
+type Workload struct {
+	Name              string
+	NumOfVCPUs        uint
+	MemoryInKiB       uint64
+	Hypervisor        string
+	AntiAffinityGroup string
+}
+
+// candidate state while placing a batch of workloads
+type node struct {
+	Candidate
+	admission         contract.AdmissionConfig
+	placedVCPUs       uint
+	placedMemoryInKiB uint64
+	groups            map[string]bool
+}
+
+func (n *node) allocatedVCPUs() uint {
+	return n.Capacity.AllocatedVCPUs + n.placedVCPUs
+}
+
+func (n *node) allocatedMemoryInKiB() uint64 {
+	return n.Capacity.AllocatedMemoryKiB + n.placedMemoryInKiB
+}
+
+func (n *node) freeMemoryInKiB() uint64 {
+	if n.placedMemoryInKiB > n.Capacity.FreeMemoryKiB {
+		return 0
+	}
+	return n.Capacity.FreeMemoryKiB - n.placedMemoryInKiB
+}
+
+// fraction of overcommit-adjusted memory already in use
+func (n *node) memoryUsage() float64 {
+	maxMemoryInKiB := float64(n.Capacity.TotalMemoryKiB) * n.admission.MemoryOvercommitRatio
+	if maxMemoryInKiB == 0 {
+		return 1
+	}
+	return float64(n.allocatedMemoryInKiB()) / maxMemoryInKiB
+}
+
+func (n *node) fits(workload Workload) bool {
+	if n.admission.Mode == contract.ADMISSION_MODE_OFF {
+		return true
+	}
+	maxVCPUs := float64(n.Capacity.CPUs) * n.admission.CPUOvercommitRatio
+	maxMemoryInKiB := float64(n.Capacity.TotalMemoryKiB) * n.admission.MemoryOvercommitRatio
+	return float64(n.allocatedVCPUs()+workload.NumOfVCPUs) <= maxVCPUs &&
+		float64(n.allocatedMemoryInKiB()+workload.MemoryInKiB) <= maxMemoryInKiB &&
+		workload.MemoryInKiB <= n.freeMemoryInKiB()
+}
+
+func (n *node) place(workload Workload) {
+	n.placedVCPUs += workload.NumOfVCPUs
+	n.placedMemoryInKiB += workload.MemoryInKiB
+	if workload.AntiAffinityGroup != "" {
+		n.groups[workload.AntiAffinityGroup] = true
+	}
+}
+
+type Scheduler struct {
+	policy string
+}
+
+func New(policy string) (*Scheduler, error) {
+	switch policy {
+	case "":
+		policy = DEFAULT_POLICY
+	case POLICY_SPREAD, POLICY_BINPACK, POLICY_MOST_FREE_MEMORY:
+	default:
+		return nil, fmt.Errorf("unsupported scheduling policy '%v'", policy)
+	}
+	return &Scheduler{policy: policy}, nil
+}
+
+func (scheduler *Scheduler) Policy() string {
+	return scheduler.policy
+}
+
+// returns workload name -> candidate name, pinned workloads are placed first
+func (scheduler *Scheduler) Schedule(workloads []Workload, candidates []Candidate) (map[string]string, error) {
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("no hypervisor to schedule on")
+	}
+
+	nodes := []*node{}
+	nodeMap := map[string]*node{}
+	for _, candidate := range candidates {
+		n := &node{
+			Candidate: candidate,
+			admission: candidate.Admission.GetCoalesced(),
+			groups:    map[string]bool{},
+		}
+		nodes = append(nodes, n)
+		nodeMap[candidate.Name] = n
+	}
+
+	orderedWorkloads := make([]Workload, len(workloads))
+	copy(orderedWorkloads, workloads)
+	sort.SliceStable(orderedWorkloads, func(i, j int) bool {
+		return orderedWorkloads[i].Hypervisor != "" && orderedWorkloads[j].Hypervisor == ""
+	})
+
+	placements := map[string]string{}
+	for _, workload := range orderedWorkloads {
+		if workload.Hypervisor != "" {
+			n, ok := nodeMap[workload.Hypervisor]
+			if !ok {
+				return nil, fmt.Errorf("%v is pinned to unknown hypervisor '%v'", workload.Name, workload.Hypervisor)
+			}
+			if workload.AntiAffinityGroup != "" && n.groups[workload.AntiAffinityGroup] {
+				return nil, fmt.Errorf(
+					"%v is pinned to '%v' which already hosts anti-affinity group '%v'",
+					workload.Name, workload.Hypervisor, workload.AntiAffinityGroup,
+				)
+			}
+			n.place(workload)
+			placements[workload.Name] = n.Name
+			continue
+		}
+
+		n, err := scheduler.pick(workload, nodes)
+		if err != nil {
+			return nil, err
+		}
+		n.place(workload)
+		placements[workload.Name] = n.Name
+	}
+
+	return placements, nil
+}
+
+func (scheduler *Scheduler) pick(workload Workload, nodes []*node) (*node, error) {
+	eligible := []*node{}
+	for _, n := range nodes {
+		if workload.AntiAffinityGroup != "" && n.groups[workload.AntiAffinityGroup] {
+			continue
+		}
+		eligible = append(eligible, n)
+	}
+
+	if len(eligible) == 0 {
+		return nil, fmt.Errorf(
+			"no hypervisor left for %v, every one already hosts anti-affinity group '%v'",
+			workload.Name, workload.AntiAffinityGroup,
+		)
+	}
+
+	fitting := []*node{}
+	for _, n := range eligible {
+		if n.fits(workload) {
+			fitting = append(fitting, n)
+		}
+	}
+
+	// hypervisors which only warn on admission still take overflow
+	if len(fitting) == 0 {
+		for _, n := range eligible {
+			if n.admission.Mode != contract.ADMISSION_MODE_REJECT {
+				fitting = append(fitting, n)
+			}
+		}
+	}
+
+	if len(fitting) == 0 {
+		return nil, fmt.Errorf("no hypervisor has enough capacity for %v", workload.Name)
+	}
+
+	sort.SliceStable(fitting, func(i, j int) bool {
+		a, b := fitting[i], fitting[j]
+		switch scheduler.policy {
+		case POLICY_BINPACK:
+			if a.memoryUsage() != b.memoryUsage() {
+				return a.memoryUsage() > b.memoryUsage()
+			}
+		case POLICY_MOST_FREE_MEMORY:
+			if a.freeMemoryInKiB() != b.freeMemoryInKiB() {
+				return a.freeMemoryInKiB() > b.freeMemoryInKiB()
+			}
+		default:
+			if a.memoryUsage() != b.memoryUsage() {
+				return a.memoryUsage() < b.memoryUsage()
+			}
+		}
+		return a.Name < b.Name
+	})
+
+	return fitting[0], nil
+}
@@ -2,6 +2,7 @@ package server
 
 import (
 	"context"
+	"fmt"
 	"net/http"
 	"os"
 	"os/signal"
@@ -9,39 +10,84 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/nnurry/harmonia/internal/audit"
+	"github.com/nnurry/harmonia/internal/config"
 	"github.com/nnurry/harmonia/internal/logger"
+	"github.com/nnurry/harmonia/internal/metrics"
 	"github.com/nnurry/harmonia/internal/routes"
+	"github.com/nnurry/harmonia/internal/service"
+	"github.com/nnurry/harmonia/internal/store"
 )
 
-func Init() *http.Server {
+func Init(serverConfig *config.ServerConfig) (*http.Server, error) {
 	osChan := make(chan os.Signal, 1)
 	signal.Notify(osChan, syscall.SIGTERM, syscall.SIGINT)
 
-	mux := routes.SetupMux()
+	stateStore, err := store.New(serverConfig.StatePath)
+	if err != nil {
+		return nil, err
+	}
+	logger.Infof("using state store at %v", stateStore.Path())
+
+	auditLog, err := audit.New(serverConfig.Audit)
+	if err != nil {
+		return nil, err
+	}
+	logger.Infof("writing audit log to %v", auditLog.Path())
+
+	if err = metrics.Registry.Register(service.NewDomainStatsCollector(serverConfig.Hypervisors)); err != nil {
+		return nil, fmt.Errorf("could not register domain stats collector: %v", err)
+	}
+
+	mux, err := routes.SetupMux(serverConfig, stateStore, auditLog)
+	if err != nil {
+		return nil, err
+	}
 	httpSrv := http.Server{
-		Addr:    ":15000",
-		Handler: mux,
+		Addr:              serverConfig.ListenAddress,
+		Handler:           mux,
+		ReadHeaderTimeout: serverConfig.Timeouts.ReadHeader.Duration(),
+		ReadTimeout:       serverConfig.Timeouts.Read.Duration(),
+		WriteTimeout:      serverConfig.Timeouts.Write.Duration(),
+		IdleTimeout:       serverConfig.Timeouts.Idle.Duration(),
 	}
 
-	return &httpSrv
+	if serverConfig.TLS.Enabled() {
+		if httpSrv.TLSConfig, err = buildTLSConfig(serverConfig.TLS); err != nil {
+			return nil, err
+		}
+	}
+
+	return &httpSrv, nil
 }
 
 func Start(server *http.Server, osChan chan os.Signal, wg *sync.WaitGroup) {
 	wg.Add(1)
-	logger.Infof("serving HTTP on %v", server.Addr)
-	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+	var err error
+	if server.TLSConfig != nil {
+		logger.Infof("serving HTTPS on %v", server.Addr)
+		if server.TLSConfig.ClientCAs != nil {
+			logger.Infof("client certificates are verified (%v)", server.TLSConfig.ClientAuth)
+		}
+		// certificates are already loaded into TLSConfig
+		err = server.ListenAndServeTLS("", "")
+	} else {
+		logger.Infof("serving HTTP on %v", server.Addr)
+		err = server.ListenAndServe()
+	}
+	if err != nil && err != http.ErrServerClosed {
 		logger.Errorf("can't start server: %v", err)
 		osChan <- syscall.SIGTERM
 	}
 }
 
-func Cleanup(server *http.Server, osChan chan os.Signal, wg *sync.WaitGroup) {
+func Cleanup(server *http.Server, shutdownTimeout time.Duration, osChan chan os.Signal, wg *sync.WaitGroup) {
 	sig := <-osChan
 	logger.Infof("encountered OS signal %v", sig.String())
 
 	close(osChan)
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(5*time.Microsecond))
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
 	defer cancel()
 
 	logger.Info("shutting down HTTP server")
@@ -0,0 +1,150 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/nnurry/harmonia/internal/config"
+	"github.com/nnurry/harmonia/internal/logger"
+)
+
+const (
+	SELF_SIGNED_CERT_FILENAME = "harmonia.crt"
+	SELF_SIGNED_KEY_FILENAME  = "harmonia.key"
+	SELF_SIGNED_VALIDITY      = 365 * 24 * time.Hour
+)
+
+func buildTLSConfig(tlsConfig config.TLSConfig) (*tls.Config, error) {
+	certFile, keyFile := tlsConfig.CertFile, tlsConfig.KeyFile
+	if tlsConfig.SelfSigned && (certFile == "" || keyFile == "") {
+		var err error
+		certFile, keyFile, err = ensureSelfSignedCertificate(tlsConfig.SelfSignedDir, tlsConfig.Hosts)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	certificate, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("could not load TLS certificate: %v", err)
+	}
+
+	serverTLSConfig := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{certificate},
+	}
+
+	if tlsConfig.ClientCAFile != "" {
+		caData, err := os.ReadFile(tlsConfig.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not read client CA: %v", err)
+		}
+		clientCAs := x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(caData) {
+			return nil, fmt.Errorf("no certificate found in client CA '%v'", tlsConfig.ClientCAFile)
+		}
+		serverTLSConfig.ClientCAs = clientCAs
+		serverTLSConfig.ClientAuth = tls.RequireAndVerifyClientCert
+		if tlsConfig.ClientAuth == config.TLS_CLIENT_AUTH_OPTIONAL {
+			serverTLSConfig.ClientAuth = tls.VerifyClientCertIfGiven
+		}
+	}
+
+	return serverTLSConfig, nil
+}
+
+// reuses a previously generated pair so clients can pin it across restarts
+func ensureSelfSignedCertificate(dir string, hosts []string) (string, string, error) {
+	certFile := filepath.Join(dir, SELF_SIGNED_CERT_FILENAME)
+	keyFile := filepath.Join(dir, SELF_SIGNED_KEY_FILENAME)
+
+	_, certErr := os.Stat(certFile)
+	_, keyErr := os.Stat(keyFile)
+	if certErr == nil && keyErr == nil {
+		logger.Infof("using self-signed certificate %v", certFile)
+		return certFile, keyFile, nil
+	}
+
+	logger.Infof("generating self-signed certificate in %v", dir)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", "", fmt.Errorf("could not create %v: %v", dir, err)
+	}
+
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return "", "", fmt.Errorf("could not generate key: %v", err)
+	}
+
+	serialNumber, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return "", "", fmt.Errorf("could not generate serial number: %v", err)
+	}
+
+	template := x509.Certificate{
+		SerialNumber:          serialNumber,
+		Subject:               pkix.Name{CommonName: "harmonia", Organization: []string{"harmonia"}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(SELF_SIGNED_VALIDITY),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+
+	if len(hosts) == 0 {
+		hosts = []string{"localhost", "127.0.0.1", "::1"}
+		if hostname, err := os.Hostname(); err == nil {
+			hosts = append(hosts, hostname)
+		}
+	}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+
+	certDer, err := x509.CreateCertificate(rand.Reader, &template, &template, &privateKey.PublicKey, privateKey)
+	if err != nil {
+		return "", "", fmt.Errorf("could not create certificate: %v", err)
+	}
+
+	keyDer, err := x509.MarshalECPrivateKey(privateKey)
+	if err != nil {
+		return "", "", fmt.Errorf("could not serialize key: %v", err)
+	}
+
+	if err = writePEM(keyFile, "EC PRIVATE KEY", keyDer, 0600); err != nil {
+		return "", "", err
+	}
+	if err = writePEM(certFile, "CERTIFICATE", certDer, 0644); err != nil {
+		return "", "", err
+	}
+
+	return certFile, keyFile, nil
+}
+
+func writePEM(path string, blockType string, data []byte, perm os.FileMode) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return fmt.Errorf("could not open %v: %v", path, err)
+	}
+	defer file.Close()
+
+	if err = pem.Encode(file, &pem.Block{Type: blockType, Bytes: data}); err != nil {
+		return fmt.Errorf("could not write %v: %v", path, err)
+	}
+	return nil
+}
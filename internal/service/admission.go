@@ -0,0 +1,135 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/nnurry/harmonia/internal/contract"
+	"github.com/nnurry/harmonia/internal/logger"
+)
+
+type AdmissionRequest struct {
+	NumOfVCPUs    uint
+	MemoryInKiB   uint64
+	DiskSizeInGiB float64
+	DiskPath      string
+}
+
+type AdmissionRejectedError struct {
+	Violations []string
+}
+
+func (e *AdmissionRejectedError) Error() string {
+	return fmt.Sprintf("admission rejected: %v", strings.Join(e.Violations, "; "))
+}
+
+// returns violations as warnings in warn mode and as an error in reject mode
+func CheckAdmission(capacity *contract.HypervisorCapacity, admission contract.AdmissionConfig, request AdmissionRequest) ([]string, error) {
+	admission = admission.GetCoalesced()
+	if admission.Mode == contract.ADMISSION_MODE_OFF {
+		return nil, nil
+	}
+
+	violations := []string{}
+
+	maxVCPUs := float64(capacity.CPUs) * admission.CPUOvercommitRatio
+	if wantedVCPUs := float64(capacity.AllocatedVCPUs + request.NumOfVCPUs); wantedVCPUs > maxVCPUs {
+		violations = append(violations, fmt.Sprintf(
+			"vCPU %v/%v exceeds ratio %v of %v CPUs",
+			wantedVCPUs, maxVCPUs, admission.CPUOvercommitRatio, capacity.CPUs,
+		))
+	}
+
+	maxMemoryInKiB := float64(capacity.TotalMemoryKiB) * admission.MemoryOvercommitRatio
+	if wantedMemoryInKiB := float64(capacity.AllocatedMemoryKiB + request.MemoryInKiB); wantedMemoryInKiB > maxMemoryInKiB {
+		violations = append(violations, fmt.Sprintf(
+			"memory %.0fKiB/%.0fKiB exceeds ratio %v of %vKiB",
+			wantedMemoryInKiB, maxMemoryInKiB, admission.MemoryOvercommitRatio, capacity.TotalMemoryKiB,
+		))
+	}
+
+	if request.MemoryInKiB > capacity.FreeMemoryKiB {
+		violations = append(violations, fmt.Sprintf(
+			"memory %vKiB exceeds free memory %vKiB",
+			request.MemoryInKiB, capacity.FreeMemoryKiB,
+		))
+	}
+
+	if pool := findStoragePoolOfPath(capacity, request.DiskPath); pool != nil {
+		maxDiskInBytes := float64(pool.AvailableBytes) * admission.DiskOvercommitRatio
+		if wantedDiskInBytes := request.DiskSizeInGiB * 1024 * 1024 * 1024; wantedDiskInBytes > maxDiskInBytes {
+			violations = append(violations, fmt.Sprintf(
+				"disk %.0fB exceeds ratio %v of %vB available in storage pool %v",
+				wantedDiskInBytes, admission.DiskOvercommitRatio, pool.AvailableBytes, pool.Name,
+			))
+		}
+	} else {
+		logger.Warnf("no active storage pool holds '%v', skip disk admission", request.DiskPath)
+	}
+
+	if len(violations) == 0 {
+		return nil, nil
+	}
+
+	if admission.Mode == contract.ADMISSION_MODE_REJECT {
+		return nil, &AdmissionRejectedError{Violations: violations}
+	}
+
+	for _, violation := range violations {
+		logger.Warnf("admission: %v", violation)
+	}
+	return violations, nil
+}
+
+// requests admitted on a hypervisor whose create is still in flight, so parallel creates
+// don't all pass against the same capacity; only creates of this process are known
+type admissionLedger struct {
+	mutex   sync.Mutex
+	pending map[int]AdmissionRequest
+	nextID  int
+}
+
+var (
+	admissionLedgersMutex sync.Mutex
+	admissionLedgers      = map[string]*admissionLedger{}
+)
+
+func getAdmissionLedger(hypervisorKey string) *admissionLedger {
+	admissionLedgersMutex.Lock()
+	defer admissionLedgersMutex.Unlock()
+	ledger, ok := admissionLedgers[hypervisorKey]
+	if !ok {
+		ledger = &admissionLedger{pending: map[int]AdmissionRequest{}}
+		admissionLedgers[hypervisorKey] = ledger
+	}
+	return ledger
+}
+
+// copy of capacity with the pending requests counted as allocated; caller holds the mutex
+func (ledger *admissionLedger) withPending(capacity *contract.HypervisorCapacity) *contract.HypervisorCapacity {
+	pendingCapacity := *capacity
+	pendingCapacity.StoragePools = append([]contract.StoragePoolCapacity{}, capacity.StoragePools...)
+	for _, request := range ledger.pending {
+		pendingCapacity.AllocatedVCPUs += request.NumOfVCPUs
+		pendingCapacity.AllocatedMemoryKiB += request.MemoryInKiB
+		pendingCapacity.FreeMemoryKiB -= min(pendingCapacity.FreeMemoryKiB, request.MemoryInKiB)
+		if pool := findStoragePoolOfPath(&pendingCapacity, request.DiskPath); pool != nil {
+			diskInBytes := uint64(request.DiskSizeInGiB * 1024 * 1024 * 1024)
+			pool.AvailableBytes -= min(pool.AvailableBytes, diskInBytes)
+		}
+	}
+	return &pendingCapacity
+}
+
+// holds request until the returned release is called; caller holds the mutex
+func (ledger *admissionLedger) reserve(request AdmissionRequest) func() {
+	id := ledger.nextID
+	ledger.nextID++
+	ledger.pending[id] = request
+	return func() {
+		ledger.mutex.Lock()
+		defer ledger.mutex.Unlock()
+		delete(ledger.pending, id)
+	}
+}
@@ -0,0 +1,113 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/nnurry/harmonia/internal/contract"
+	"libvirt.org/go/libvirt"
+	"libvirt.org/go/libvirtxml"
+)
+
+func (service *Libvirt) GetCapacity() (*contract.HypervisorCapacity, error) {
+	nodeInfo, err := service.Connect().GetNodeInfo()
+	if err != nil {
+		return nil, fmt.Errorf("could not get node info: %v", err)
+	}
+
+	freeMemoryInBytes, err := service.Connect().GetFreeMemory()
+	if err != nil {
+		return nil, fmt.Errorf("could not get free memory: %v", err)
+	}
+
+	capacity := &contract.HypervisorCapacity{
+		CPUModel:       nodeInfo.Model,
+		CPUs:           nodeInfo.Cpus,
+		TotalMemoryKiB: nodeInfo.Memory,
+		FreeMemoryKiB:  freeMemoryInBytes / 1024,
+		StoragePools:   []contract.StoragePoolCapacity{},
+	}
+
+	if capacity.Name, err = service.Connect().GetHostname(); err != nil {
+		return nil, fmt.Errorf("could not get hostname: %v", err)
+	}
+
+	domains, err := service.ListDomains(true)
+	if err != nil {
+		return nil, fmt.Errorf("could not list domains: %v", err)
+	}
+
+	for _, domain := range domains {
+		domainInfo, err := domain.GetInfo()
+		if err != nil {
+			return nil, fmt.Errorf("could not get domain info: %v", err)
+		}
+
+		capacity.NumOfDomains++
+		capacity.AllocatedVCPUs += domainInfo.NrVirtCpu
+		capacity.AllocatedMemoryKiB += domainInfo.MaxMem
+
+		if domainInfo.State == libvirt.DOMAIN_RUNNING || domainInfo.State == libvirt.DOMAIN_PAUSED {
+			capacity.RunningVCPUs += domainInfo.NrVirtCpu
+			capacity.RunningMemoryKiB += domainInfo.MaxMem
+		}
+	}
+
+	pools, err := service.Connect().ListAllStoragePools(0)
+	if err != nil {
+		return nil, fmt.Errorf("could not list storage pools: %v", err)
+	}
+
+	for _, pool := range pools {
+		poolCapacity := contract.StoragePoolCapacity{}
+
+		if poolCapacity.Name, err = pool.GetName(); err != nil {
+			return nil, fmt.Errorf("could not get storage pool name: %v", err)
+		}
+
+		poolInfo, err := pool.GetInfo()
+		if err != nil {
+			return nil, fmt.Errorf("could not get info of storage pool %v: %v", poolCapacity.Name, err)
+		}
+
+		poolCapacity.IsActive = poolInfo.State == libvirt.STORAGE_POOL_RUNNING
+		poolCapacity.CapacityBytes = poolInfo.Capacity
+		poolCapacity.AllocationBytes = poolInfo.Allocation
+		poolCapacity.AvailableBytes = poolInfo.Available
+
+		poolXMLString, err := pool.GetXMLDesc(0)
+		if err != nil {
+			return nil, fmt.Errorf("could not get XML of storage pool %v: %v", poolCapacity.Name, err)
+		}
+
+		poolXML := &libvirtxml.StoragePool{}
+		if err = poolXML.Unmarshal(poolXMLString); err != nil {
+			return nil, fmt.Errorf("could not parse XML of storage pool %v: %v", poolCapacity.Name, err)
+		}
+
+		if poolXML.Target != nil {
+			poolCapacity.Path = poolXML.Target.Path
+		}
+
+		capacity.StoragePools = append(capacity.StoragePools, poolCapacity)
+	}
+
+	return capacity, nil
+}
+
+// picks the active pool whose target path is the longest prefix of the disk path
+func findStoragePoolOfPath(capacity *contract.HypervisorCapacity, path string) *contract.StoragePoolCapacity {
+	var matchedPool *contract.StoragePoolCapacity
+	for i, pool := range capacity.StoragePools {
+		if !pool.IsActive || pool.Path == "" {
+			continue
+		}
+		if !strings.HasPrefix(path, strings.TrimSuffix(pool.Path, "/")+"/") {
+			continue
+		}
+		if matchedPool == nil || len(pool.Path) > len(matchedPool.Path) {
+			matchedPool = &capacity.StoragePools[i]
+		}
+	}
+	return matchedPool
+}
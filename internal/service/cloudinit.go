@@ -3,10 +3,16 @@ package service
 import (
 	"bytes"
 	"context"
+	"encoding/base64"
 	"errors"
 	"fmt"
+	"io"
 	"os"
+	"slices"
+	"strconv"
+	"strings"
 
+	"github.com/nnurry/harmonia/internal/builder"
 	"github.com/nnurry/harmonia/internal/connection"
 	"github.com/nnurry/harmonia/internal/logger"
 	"github.com/nnurry/harmonia/internal/service/cloudinit"
@@ -15,11 +21,24 @@ import (
 
 const (
 	DEFAULT_CLOUD_INIT_ISO_BASE_PATH = "/var/lib/libvirt/images"
+
+	// files written for guests may hold keys, only the qemu group gets to read them
+	HYPERVISOR_DIR_MODE  = 0750
+	HYPERVISOR_FILE_MODE = 0640
+	// when they can't be handed to the qemu group
+	HYPERVISOR_SHARED_DIR_MODE  = 0755
+	HYPERVISOR_SHARED_FILE_MODE = 0644
 )
 
+// group qemu runs as, named differently across distros
+var QEMU_GROUP_NAMES = []string{"qemu", "libvirt-qemu"}
+
+var errNoQemuGroup = errors.New("hypervisor has no qemu group")
+
 type CloudInit struct {
 	processor     ShellProcessor
 	sftpClient    *sftp.Client
+	warnings      []string
 	UserData      cloudinit.UserData
 	MetaData      cloudinit.MetaData
 	NetworkConfig cloudinit.NetworkConfig
@@ -58,19 +77,13 @@ func (service *CloudInit) WriteToDisk(ctx context.Context, basePath string, file
 	if filename == "" {
 		return "", fmt.Errorf("empty file path for cloud-init ISO")
 	}
+	service.warnings = nil
 
-	var err error
-
-	if service.sftpClient != nil {
-		err = service.sftpClient.MkdirAll(basePath)
-		err = errors.Join(err, service.sftpClient.Chmod(basePath, os.FileMode(0777)))
-	} else {
-		err = os.MkdirAll(basePath, os.FileMode(0777))
-	}
-
+	warning, err := mkdirOnHypervisor(service.sftpClient, basePath)
 	if err != nil {
-		return "", fmt.Errorf("could not mkdir '%v': %v", basePath, err)
+		return "", err
 	}
+	service.addWarning(warning)
 
 	isoFilePath := fmt.Sprintf("%v/%v", basePath, filename)
 	paths := make([]string, 3)
@@ -88,19 +101,11 @@ func (service *CloudInit) WriteToDisk(ctx context.Context, basePath string, file
 			return "", fmt.Errorf("could not serialize ingredient %v for cloud-init ISO: %v", name, err)
 		}
 
-		if service.sftpClient != nil {
-			var sftpFile *sftp.File
-			if sftpFile, err = service.sftpClient.Create(path); err == nil {
-				sftpFile.Chmod(os.FileMode(0777))
-				_, err = sftpFile.Write(data)
-			}
-		} else {
-			err = os.WriteFile(path, data, os.FileMode(0777))
-		}
-
+		warning, err := writeFileOnHypervisor(service.sftpClient, path, data)
 		if err != nil {
 			return "", fmt.Errorf("could not write ingredient %v to disk for cloud-init ISO: %v", name, err)
 		}
+		service.addWarning(warning)
 
 		paths = append(paths, path)
 	}
@@ -128,9 +133,230 @@ func (service *CloudInit) WriteToDisk(ctx context.Context, basePath string, file
 	// it writes to stderr instead of stdout
 	logger.Infof("output of writing cloud-init.iso command: %v", stderrBuffer.String())
 
+	warning, err = shareWithQemu(service.sftpClient, isoFilePath, HYPERVISOR_FILE_MODE, HYPERVISOR_SHARED_FILE_MODE)
+	if err != nil {
+		return "", err
+	}
+	service.addWarning(warning)
+
 	return isoFilePath, nil
 }
 
+// non-fatal issues found by the last WriteToDisk
+func (service *CloudInit) Warnings() []string {
+	return service.warnings
+}
+
+func (service *CloudInit) addWarning(warning string) {
+	if warning != "" && !slices.Contains(service.warnings, warning) {
+		service.warnings = append(service.warnings, warning)
+	}
+}
+
 func (service *CloudInit) RemoveFromDisk(ctx context.Context, basePath string) error {
-	return service.sftpClient.RemoveAll(basePath)
+	return removeFromHypervisor(service.sftpClient, basePath)
+}
+
+// renders user-data, meta-data and network-config of the guest into a NoCloud ISO
+func (service *CloudInit) Provision(ctx context.Context, basePath string, data GuestProvisioningData) (string, error) {
+	service.SetMetaData(cloudinit.MetaData{
+		Hostname:   data.Hostname,
+		InstanceId: data.InstanceID,
+	})
+
+	writeFiles := []cloudinit.WriteFile{}
+	for _, file := range data.Files {
+		mode, err := file.FileMode()
+		if err != nil {
+			return "", err
+		}
+		writeFiles = append(writeFiles, cloudinit.WriteFile{
+			Path:        file.Path,
+			Content:     base64.StdEncoding.EncodeToString([]byte(file.Content)),
+			Encoding:    "b64",
+			Permissions: fmt.Sprintf("%#o", mode),
+		})
+	}
+
+	userData := cloudinit.UserData{
+		Hostname:       data.Hostname,
+		ManageEtcHosts: true,
+		DisableRootPw:  true,
+		Users: []cloudinit.User{{
+			Name:           data.User,
+			Sudo:           "ALL=(ALL) NOPASSWD:ALL",
+			AuthorizedKeys: data.AuthorizedKeys,
+		}},
+		WriteFiles: writeFiles,
+	}
+	hostPublicKey, err := data.HostPublicKey()
+	if err != nil {
+		return "", err
+	}
+	if hostPublicKey != "" {
+		userData.SSHKeys = map[string]string{
+			"ed25519_private": data.HostKey,
+			"ed25519_public":  hostPublicKey,
+		}
+	}
+	service.SetUserData(userData)
+
+	ethernets := cloudinit.Ethernet{}
+	for i, networkInterface := range data.Interfaces {
+		ethernet := cloudinit.EthernetInterface{
+			Dhcp4:      networkInterface.IPv4Address == "",
+			MacAddress: networkInterface.MacAddress,
+		}
+		if !ethernet.Dhcp4 {
+			ethernet.IPv4Addresses = []string{fmt.Sprintf("%v/%v", networkInterface.IPv4Address, networkInterface.GetIPv4Prefix())}
+			ethernet.IPv4GatewayAddress = networkInterface.IPv4GatewayAddress
+			ethernet.Nameservers = cloudinit.Nameserver{Addresses: data.Nameservers}
+		}
+		ethernets[fmt.Sprintf("eth%d", i)] = ethernet
+	}
+
+	service.SetNetworkConfig(cloudinit.NetworkConfig{
+		Network: cloudinit.Network{
+			Version:   2,
+			Ethernets: ethernets,
+		},
+	})
+
+	return service.WriteToDisk(ctx, basePath, "cloud-init.iso")
+}
+
+// the ISO goes in as a read-only cdrom
+func (service *CloudInit) AttachTo(libvirtBuilder *builder.LibvirtDomainBuilder, path string) *builder.LibvirtDomainBuilder {
+	return libvirtBuilder.WithCiDiskPath(path)
+}
+
+// over SFTP when there is a client, else on the local filesystem;
+// the warning is set when the directory could not be handed to the qemu group
+func mkdirOnHypervisor(sftpClient *sftp.Client, path string) (string, error) {
+	var err error
+	if sftpClient != nil {
+		err = sftpClient.MkdirAll(path)
+	} else {
+		err = os.MkdirAll(path, os.FileMode(HYPERVISOR_DIR_MODE))
+	}
+
+	if err != nil {
+		return "", fmt.Errorf("could not mkdir '%v': %v", path, err)
+	}
+	return shareWithQemu(sftpClient, path, HYPERVISOR_DIR_MODE, HYPERVISOR_SHARED_DIR_MODE)
+}
+
+// readable by the qemu user, which isn't the one writing it
+func writeFileOnHypervisor(sftpClient *sftp.Client, path string, data []byte) (string, error) {
+	if sftpClient == nil {
+		if err := os.WriteFile(path, data, os.FileMode(HYPERVISOR_FILE_MODE)); err != nil {
+			return "", err
+		}
+		return shareWithQemu(sftpClient, path, HYPERVISOR_FILE_MODE, HYPERVISOR_SHARED_FILE_MODE)
+	}
+
+	sftpFile, err := sftpClient.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
+	if err != nil {
+		return "", err
+	}
+	defer sftpFile.Close()
+	// restricted before any data goes in
+	warning, err := shareWithQemu(sftpClient, path, HYPERVISOR_FILE_MODE, HYPERVISOR_SHARED_FILE_MODE)
+	if err != nil {
+		return "", err
+	}
+	_, err = sftpFile.Write(data)
+	return warning, err
+}
+
+// hands path to the qemu group with mode, keeping its owner; when the SSH user may not
+// (not root nor in the group) or there is no such group, path gets sharedMode and a warning instead
+func shareWithQemu(sftpClient *sftp.Client, path string, mode os.FileMode, sharedMode os.FileMode) (string, error) {
+	gid, err := qemuGroupID(sftpClient)
+	if err == nil {
+		err = chownOnHypervisor(sftpClient, path, gid)
+	}
+	if errors.Is(err, errNoQemuGroup) || errors.Is(err, os.ErrPermission) {
+		logger.Warnf("could not hand '%v' to the qemu group, making it readable by everyone: %v", path, err)
+		if err := chmodOnHypervisor(sftpClient, path, sharedMode); err != nil {
+			return "", fmt.Errorf("could not chmod '%v': %v", path, err)
+		}
+		return fmt.Sprintf("guest provisioning files are readable by every user of the hypervisor, they could not be handed to the qemu group: %v", errors.Unwrap(err)), nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("could not hand '%v' to the qemu group: %v", path, err)
+	}
+
+	if err = chmodOnHypervisor(sftpClient, path, mode); err != nil {
+		return "", fmt.Errorf("could not chmod '%v': %v", path, err)
+	}
+	return "", nil
+}
+
+func chownOnHypervisor(sftpClient *sftp.Client, path string, gid int) error {
+	if sftpClient == nil {
+		return os.Chown(path, -1, gid)
+	}
+
+	fileInfo, err := sftpClient.Stat(path)
+	if err != nil {
+		return err
+	}
+	fileStat, ok := fileInfo.Sys().(*sftp.FileStat)
+	if !ok {
+		return fmt.Errorf("could not read owner of '%v'", path)
+	}
+	if err = sftpClient.Chown(path, int(fileStat.UID), gid); err != nil {
+		return fmt.Errorf("chown '%v': %w", path, err)
+	}
+	return nil
+}
+
+func chmodOnHypervisor(sftpClient *sftp.Client, path string, mode os.FileMode) error {
+	if sftpClient == nil {
+		return os.Chmod(path, mode)
+	}
+	return sftpClient.Chmod(path, mode)
+}
+
+// looked up in /etc/group of the hypervisor
+func qemuGroupID(sftpClient *sftp.Client) (int, error) {
+	var content []byte
+	var err error
+	if sftpClient == nil {
+		content, err = os.ReadFile("/etc/group")
+	} else {
+		var file *sftp.File
+		if file, err = sftpClient.Open("/etc/group"); err == nil {
+			content, err = io.ReadAll(file)
+			file.Close()
+		}
+	}
+	if err != nil {
+		return 0, fmt.Errorf("could not read groups of hypervisor: %v", err)
+	}
+
+	gids := map[string]int{}
+	for _, line := range strings.Split(string(content), "\n") {
+		fields := strings.Split(line, ":")
+		if len(fields) < 3 {
+			continue
+		}
+		if gid, err := strconv.Atoi(fields[2]); err == nil {
+			gids[fields[0]] = gid
+		}
+	}
+	for _, name := range QEMU_GROUP_NAMES {
+		if gid, ok := gids[name]; ok {
+			return gid, nil
+		}
+	}
+	return 0, fmt.Errorf("%w, none of %v", errNoQemuGroup, strings.Join(QEMU_GROUP_NAMES, ", "))
+}
+
+func removeFromHypervisor(sftpClient *sftp.Client, path string) error {
+	if sftpClient == nil {
+		return os.RemoveAll(path)
+	}
+	return sftpClient.RemoveAll(path)
 }
@@ -16,20 +16,19 @@ type Network struct {
 	Ethernets Ethernet `yaml:"ethernets"`
 }
 
-type Ethernet struct {
-	Eth0 Eth0 `yaml:"eth0"`
-}
+// keyed by interface name (eth0, eth1, ...)
+type Ethernet map[string]EthernetInterface
 
-type Eth0 struct {
+type EthernetInterface struct {
 	Dhcp4              bool       `yaml:"dhcp4"`
-	IPv4Addresses      []string   `yaml:"addresses,flow"`
-	IPv4GatewayAddress string     `yaml:"gateway4"`
-	MacAddress         string     `yaml:"macaddress"`
-	Nameservers        Nameserver `yaml:"nameservers"`
+	IPv4Addresses      []string   `yaml:"addresses,flow,omitempty"`
+	IPv4GatewayAddress string     `yaml:"gateway4,omitempty"`
+	MacAddress         string     `yaml:"macaddress,omitempty"`
+	Nameservers        Nameserver `yaml:"nameservers,omitempty"`
 }
 
 type Nameserver struct {
-	Addresses []string `yaml:"addresses"`
+	Addresses []string `yaml:"addresses,omitempty"`
 }
 
 func (nc NetworkConfig) FileName() string {
@@ -8,10 +8,20 @@ import (
 )
 
 type UserData struct {
-	Hostname       string `yaml:"hostname"`
-	ManageEtcHosts bool   `yaml:"manage_etc_hosts,omitempty"`
-	DisableRootPw  bool   `yaml:"disable_root_pw,omitempty"`
-	Users          []User `yaml:"users,omitempty"`
+	Hostname       string      `yaml:"hostname"`
+	ManageEtcHosts bool        `yaml:"manage_etc_hosts,omitempty"`
+	DisableRootPw  bool        `yaml:"disable_root_pw,omitempty"`
+	Users          []User      `yaml:"users,omitempty"`
+	WriteFiles     []WriteFile `yaml:"write_files,omitempty"`
+	// host keys by <type>_private and <type>_public
+	SSHKeys map[string]string `yaml:"ssh_keys,omitempty"`
+}
+
+type WriteFile struct {
+	Path        string `yaml:"path"`
+	Content     string `yaml:"content"`
+	Encoding    string `yaml:"encoding,omitempty"`
+	Permissions string `yaml:"permissions,omitempty"`
 }
 
 type User struct {
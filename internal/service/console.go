@@ -0,0 +1,75 @@
+package service
+
+import (
+	"fmt"
+	"sync"
+
+	"libvirt.org/go/libvirt"
+)
+
+// serial console stream of a domain, reads block until the guest writes something
+type Console struct {
+	stream    *libvirt.Stream
+	closeOnce sync.Once
+}
+
+func (console *Console) Read(p []byte) (int, error) {
+	return console.stream.Recv(p)
+}
+
+// libvirt may send less than asked, io.Writer must not
+func (console *Console) Write(p []byte) (int, error) {
+	written := 0
+	for written < len(p) {
+		n, err := console.stream.Send(p[written:])
+		if err != nil {
+			return written, err
+		}
+		written += n
+	}
+	return written, nil
+}
+
+// aborts the stream so a blocked Read returns, safe to call more than once
+func (console *Console) Close() error {
+	var err error
+	console.closeOnce.Do(func() {
+		console.stream.Abort()
+		err = console.stream.Free()
+	})
+	return err
+}
+
+// attaches to the first serial console of a running domain,
+// isForce takes it over from whoever else holds it
+func (service *Libvirt) OpenConsole(name string, isForce bool) (*Console, error) {
+	domain, err := service.GetDomainByName(name)
+	if err != nil {
+		return nil, err
+	}
+	defer domain.Free()
+
+	isActive, err := domain.IsActive()
+	if err != nil {
+		return nil, fmt.Errorf("could not get state of domain %v: %v", name, err)
+	}
+	if !isActive {
+		return nil, fmt.Errorf("domain %v is not running", name)
+	}
+
+	stream, err := service.Connect().NewStream(0)
+	if err != nil {
+		return nil, fmt.Errorf("could not create stream: %v", err)
+	}
+
+	flags := libvirt.DOMAIN_CONSOLE_SAFE
+	if isForce {
+		flags |= libvirt.DOMAIN_CONSOLE_FORCE
+	}
+	if err = domain.OpenConsole("", stream, flags); err != nil {
+		stream.Free()
+		return nil, fmt.Errorf("could not open console of domain %v: %v", name, err)
+	}
+
+	return &Console{stream: stream}, nil
+}
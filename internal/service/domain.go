@@ -0,0 +1,148 @@
+package service
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+
+	"github.com/nnurry/harmonia/internal/contract"
+	"libvirt.org/go/libvirt"
+)
+
+func DomainStateToString(state libvirt.DomainState) string {
+	switch state {
+	case libvirt.DOMAIN_RUNNING:
+		return "running"
+	case libvirt.DOMAIN_SHUTOFF:
+		return "shutoff"
+	case libvirt.DOMAIN_SHUTDOWN:
+		return "shutdown"
+	case libvirt.DOMAIN_CRASHED:
+		return "crashed"
+	case libvirt.DOMAIN_NOSTATE:
+		return "nostate"
+	case libvirt.DOMAIN_PAUSED:
+		return "paused"
+	case libvirt.DOMAIN_BLOCKED:
+		return "blocked"
+	case libvirt.DOMAIN_PMSUSPENDED:
+		return "pmsuspended"
+	default:
+		return fmt.Sprintf("other (code=%v)", state)
+	}
+}
+
+// nil without error means the domain was not created by harmonia
+func (service *Libvirt) GetHarmoniaMetadata(domain *libvirt.Domain) (*contract.HarmoniaDomainMetadata, error) {
+	metadataXml, err := domain.GetMetadata(
+		libvirt.DOMAIN_METADATA_ELEMENT,
+		contract.HARMONIA_METADATA_NAMESPACE,
+		libvirt.DOMAIN_AFFECT_CONFIG,
+	)
+	if err != nil {
+		var libvirtErr libvirt.Error
+		if errors.As(err, &libvirtErr) && libvirtErr.Code == libvirt.ERR_NO_DOMAIN_METADATA {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("could not get harmonia metadata: %v", err)
+	}
+
+	metadata := &contract.HarmoniaDomainMetadata{}
+	if err = xml.Unmarshal([]byte(metadataXml), metadata); err != nil {
+		return nil, fmt.Errorf("could not parse harmonia metadata: %v", err)
+	}
+	return metadata, nil
+}
+
+func (service *Libvirt) GetDomainSummary(domain *libvirt.Domain) (*contract.DomainSummary, error) {
+	domainName, err := domain.GetName()
+	if err != nil {
+		return nil, fmt.Errorf("fail to get name of domain: %v", err)
+	}
+
+	domainUuid, err := domain.GetUUIDString()
+	if err != nil {
+		return nil, fmt.Errorf("fail to get uuid of domain %v: %v", domainName, err)
+	}
+
+	domainState, reason, err := domain.GetState()
+	if err != nil {
+		return nil, fmt.Errorf("fail to get state of domain %v: %v (%v)", domainName, err, reason)
+	}
+
+	domainInfo, err := domain.GetInfo()
+	if err != nil {
+		return nil, fmt.Errorf("fail to get info of domain %v: %v", domainName, err)
+	}
+
+	metadata, err := service.GetHarmoniaMetadata(domain)
+	if err != nil {
+		return nil, fmt.Errorf("fail to get metadata of domain %v: %v", domainName, err)
+	}
+
+	return &contract.DomainSummary{
+		Name:          domainName,
+		UUID:          domainUuid,
+		State:         DomainStateToString(domainState),
+		NumOfVCPUs:    domainInfo.NrVirtCpu,
+		MemoryInKiB:   domainInfo.MaxMem,
+		IPv4Addresses: getIPv4Addresses(domain, domainState),
+		Harmonia:      metadata,
+	}, nil
+}
+
+// best effort, what the guest agent reports first, DHCP leases of libvirt-managed networks
+// second; bridged interfaces of guests without an agent have no address to look up
+func getIPv4Addresses(domain *libvirt.Domain, domainState libvirt.DomainState) []string {
+	addresses := []string{}
+	if domainState != libvirt.DOMAIN_RUNNING {
+		return addresses
+	}
+
+	interfaces, err := domain.ListAllInterfaceAddresses(libvirt.DOMAIN_INTERFACE_ADDRESSES_SRC_AGENT)
+	if err == nil {
+		for _, guestInterface := range toGuestInterfaces(interfaces) {
+			for _, address := range guestInterface.IPAddresses {
+				if address.Type == contract.IP_ADDRESS_TYPE_IPV4 {
+					addresses = append(addresses, address.Address)
+				}
+			}
+		}
+		if len(addresses) > 0 {
+			return addresses
+		}
+	}
+
+	interfaces, err = domain.ListAllInterfaceAddresses(libvirt.DOMAIN_INTERFACE_ADDRESSES_SRC_LEASE)
+	if err != nil {
+		return addresses
+	}
+	for _, domainInterface := range interfaces {
+		for _, address := range domainInterface.Addrs {
+			if address.Type == libvirt.IP_ADDR_TYPE_IPV4 {
+				addresses = append(addresses, address.Addr)
+			}
+		}
+	}
+	return addresses
+}
+
+func (service *Libvirt) ListDomainSummaries(includeInactive bool, selector contract.DomainSelector) ([]contract.DomainSummary, error) {
+	domains, err := service.ListDomains(includeInactive)
+	if err != nil {
+		return nil, fmt.Errorf("could not list domains: %v", err)
+	}
+
+	summaries := []contract.DomainSummary{}
+	for _, domain := range domains {
+		summary, err := service.GetDomainSummary(&domain)
+		domain.Free()
+		if err != nil {
+			return nil, err
+		}
+		if selector.Match(*summary) {
+			summaries = append(summaries, *summary)
+		}
+	}
+	return summaries, nil
+}
@@ -0,0 +1,552 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/nnurry/harmonia/internal/contract"
+	"github.com/nnurry/harmonia/internal/interpolate"
+	"github.com/nnurry/harmonia/internal/logger"
+	"github.com/nnurry/harmonia/internal/metrics"
+	"github.com/nnurry/harmonia/pkg/utils"
+)
+
+const (
+	FLEET_EVENT_KIND_VM      = "vm"
+	FLEET_EVENT_KIND_NETWORK = "network"
+	FLEET_EVENT_KIND_HOOK    = "hook"
+)
+
+// reported before (IsDone false) and after (IsDone true) each VM or network is handled
+type FleetEvent struct {
+	Kind       string
+	Name       string
+	Hypervisor string
+	IsDone     bool
+	UUID       string
+	Err        error
+}
+
+// may be called from several goroutines at once
+type FleetProgress func(event FleetEvent)
+
+// creates and deletes whole fleets, shared by the API handlers and the CLI
+type Fleet struct {
+	placementService          *Placement
+	stateStore                StateStore
+	cloudInitDir              string
+	diskDir                   string
+	consoleLogDir             string
+	maxConcurrentVMOperations int
+	progress                  FleetProgress
+	instanceTypes             map[string]contract.InstanceType
+	interpolator              *interpolate.Interpolator
+	ctx                       context.Context
+}
+
+func NewFleet(placementService *Placement) *Fleet {
+	return &Fleet{
+		placementService:          placementService,
+		maxConcurrentVMOperations: 1,
+		progress:                  func(event FleetEvent) {},
+		ctx:                       context.Background(),
+	}
+}
+
+func (service *Fleet) WithStateStore(stateStore StateStore) *Fleet {
+	service.stateStore = stateStore
+	return service
+}
+
+func (service *Fleet) WithPaths(cloudInitDir string, diskDir string, consoleLogDir string) *Fleet {
+	service.cloudInitDir = cloudInitDir
+	service.diskDir = diskDir
+	service.consoleLogDir = consoleLogDir
+	return service
+}
+
+// VMs handled in parallel, below 1 means one at a time
+func (service *Fleet) WithConcurrency(maxConcurrentVMOperations int) *Fleet {
+	service.maxConcurrentVMOperations = maxConcurrentVMOperations
+	return service
+}
+
+func (service *Fleet) WithProgress(progress FleetProgress) *Fleet {
+	service.progress = progress
+	return service
+}
+
+// instance types of the server config, those of a fleet with the same name win
+func (service *Fleet) WithInstanceTypes(instanceTypes map[string]contract.InstanceType) *Fleet {
+	service.instanceTypes = instanceTypes
+	return service
+}
+
+// resolves references in fleets before coalescing, none are resolved without it
+func (service *Fleet) WithInterpolator(interpolator *interpolate.Interpolator) *Fleet {
+	service.interpolator = interpolator
+	return service
+}
+
+// passed on to every VM service, see VirtualMachine.WithContext
+func (service *Fleet) WithContext(ctx context.Context) *Fleet {
+	service.ctx = ctx
+	return service
+}
+
+func (service *Fleet) coalesce(fleetConfig contract.VirtualMachineFleetConfig) (contract.VirtualMachineFleetConfig, error) {
+	if service.interpolator != nil {
+		filled, err := service.interpolator.Resolve(&fleetConfig)
+		fleetConfig.SensitiveValues = append(fleetConfig.SensitiveValues, filled.Values()...)
+		if err != nil {
+			return fleetConfig, fmt.Errorf("unresolved references:\n%v", err)
+		}
+	}
+	return fleetConfig.WithInstanceTypes(service.instanceTypes).GetCoalesced(), nil
+}
+
+// request (a pointer, see format.CONTRACTS) the way the API would act on it, safe to echo back:
+// references resolved with files and secrets masked, instance types applied, fleets coalesced and SSH secrets redacted;
+// fails with a line per unresolved reference
+func (service *Fleet) Normalize(request any) error {
+	if service.interpolator != nil {
+		if err := service.interpolator.ResolveMasked(request); err != nil {
+			return err
+		}
+	}
+
+	switch typedRequest := request.(type) {
+	case *contract.CreateVirtualMachineRequest:
+		// an unknown instance type is reported upon create
+		vmConfig, _ := typedRequest.VirtualMachineConfig.WithInstanceType(service.instanceTypes)
+		typedRequest.VirtualMachineConfig = vmConfig.Redacted()
+	case *contract.DeleteVirtualMachineRequest:
+		typedRequest.VirtualMachineConfig = typedRequest.VirtualMachineConfig.Redacted()
+	case *contract.CreateVirtualMachineFleetRequest:
+		typedRequest.VirtualMachineFleetConfig = typedRequest.VirtualMachineFleetConfig.WithInstanceTypes(service.instanceTypes).GetCoalesced().Redacted()
+	case *contract.DeleteVirtualMachineFleetRequest:
+		typedRequest.VirtualMachineFleetConfig = typedRequest.VirtualMachineFleetConfig.WithInstanceTypes(service.instanceTypes).GetCoalesced().Redacted()
+	case *contract.CreateVirtualNetworkRequest:
+		typedRequest.VirtualNetworkConfig = typedRequest.VirtualNetworkConfig.Redacted()
+	case *contract.DeleteVirtualNetworkRequest:
+		typedRequest.HypervisorConnectionConfig = redactedConnection(typedRequest.HypervisorConnectionConfig)
+	case *contract.ListVirtualNetworksRequest:
+		typedRequest.HypervisorConnectionConfig = redactedConnection(typedRequest.HypervisorConnectionConfig)
+	case *contract.VirtualMachinePowerRequest:
+		typedRequest.HypervisorConnectionConfig = redactedConnection(typedRequest.HypervisorConnectionConfig)
+	case *contract.ListDomainsRequest:
+		typedRequest.HypervisorConnectionConfig = redactedConnection(typedRequest.HypervisorConnectionConfig)
+	}
+	return nil
+}
+
+func redactedConnection(connectionConfig *contract.HypervisorConnectionConfig) *contract.HypervisorConnectionConfig {
+	if connectionConfig == nil {
+		return nil
+	}
+	redactedConnectionConfig := connectionConfig.Redacted()
+	return &redactedConnectionConfig
+}
+
+// coalesces, validates and places a fleet to be created
+func (service *Fleet) Plan(fleetConfig contract.VirtualMachineFleetConfig) (contract.VirtualMachineFleetConfig, error) {
+	coalescedFleetConfig, err := service.Prepare(fleetConfig)
+	if err != nil {
+		return coalescedFleetConfig, err
+	}
+	return service.Place(coalescedFleetConfig)
+}
+
+// coalesces and validates a fleet to be created without connecting to any hypervisor
+func (service *Fleet) Prepare(fleetConfig contract.VirtualMachineFleetConfig) (contract.VirtualMachineFleetConfig, error) {
+	coalescedFleetConfig, err := service.coalesce(fleetConfig)
+	if err != nil {
+		return coalescedFleetConfig, fmt.Errorf("invalid fleet: %v", err)
+	}
+	if err := coalescedFleetConfig.ValidateForCreate(); err != nil {
+		return coalescedFleetConfig, fmt.Errorf("invalid fleet: %v", err)
+	}
+	return coalescedFleetConfig, nil
+}
+
+// places a prepared fleet, probing hypervisors of scheduled fleets
+func (service *Fleet) Place(coalescedFleetConfig contract.VirtualMachineFleetConfig) (contract.VirtualMachineFleetConfig, error) {
+	return service.placementService.Place(coalescedFleetConfig)
+}
+
+// coalesces and validates a fleet, resolving named hypervisors without connecting to them
+func (service *Fleet) Validate(fleetConfig contract.VirtualMachineFleetConfig) (contract.VirtualMachineFleetConfig, error) {
+	coalescedFleetConfig, err := service.coalesce(fleetConfig)
+	if err != nil {
+		return coalescedFleetConfig, fmt.Errorf("invalid fleet: %v", err)
+	}
+	if err := coalescedFleetConfig.Validate(); err != nil {
+		return coalescedFleetConfig, fmt.Errorf("invalid fleet: %v", err)
+	}
+
+	if coalescedFleetConfig.IsScheduled() {
+		hypervisors, err := service.placementService.ResolveHypervisors(coalescedFleetConfig)
+		if err != nil {
+			return coalescedFleetConfig, err
+		}
+		coalescedFleetConfig.SharedConfig.Hypervisors = hypervisors
+		return coalescedFleetConfig, nil
+	}
+	return service.placementService.resolveUnscheduled(coalescedFleetConfig)
+}
+
+// coalesces a fleet to be deleted and finds where its VMs live
+func (service *Fleet) Locate(fleetConfig contract.VirtualMachineFleetConfig) (contract.VirtualMachineFleetConfig, error) {
+	coalescedFleetConfig, err := service.coalesce(fleetConfig)
+	if err != nil {
+		return coalescedFleetConfig, fmt.Errorf("invalid fleet: %v", err)
+	}
+	return service.placementService.Locate(coalescedFleetConfig)
+}
+
+// creates a VM then runs its post_provision steps, a VM failing its steps is kept
+func (service *Fleet) CreateVirtualMachine(config contract.VirtualMachineConfig) (contract.CreateVirtualMachineResult, error) {
+	defer metrics.StartJob(metrics.JOB_VM_CREATE)()
+
+	result := contract.CreateVirtualMachineResult{
+		Name:       config.Name,
+		Hypervisor: config.Hypervisor,
+	}
+
+	config, err := withGuestHostKey(config)
+	if err != nil {
+		result.Error = err.Error()
+		return result, err
+	}
+
+	virtualMachineService, err := NewVirtualMachineFromVirtualMachineConfig(config)
+	if err != nil {
+		result.Error = err.Error()
+		return result, err
+	}
+	defer virtualMachineService.Cleanup()
+
+	virtualMachineService = virtualMachineService.
+		WithContext(service.ctx).
+		WithStateStore(service.stateStore).
+		WithPaths(service.cloudInitDir, service.diskDir, service.consoleLogDir)
+
+	result.UUID, err = virtualMachineService.Create(config)
+	result.Warnings = virtualMachineService.Warnings()
+	if err == nil && len(config.PostProvision.Steps) > 0 {
+		result.PostProvision, err = virtualMachineService.PostProvision(config, config.PostProvision.Steps)
+	}
+	if err != nil {
+		result.Error = err.Error()
+		result.ConsoleLog = ConsoleLogOf(err)
+	}
+	return result, err
+}
+
+// runs steps in a VM that already exists once it is ready
+func (service *Fleet) postProvisionVirtualMachine(config contract.VirtualMachineConfig, steps []contract.PostProvisionStep) ([]contract.PostProvisionStepResult, error) {
+	virtualMachineService, err := NewVirtualMachineFromVirtualMachineConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	defer virtualMachineService.Cleanup()
+
+	return virtualMachineService.
+		WithContext(service.ctx).
+		WithStateStore(service.stateStore).
+		WithPaths(service.cloudInitDir, service.diskDir, service.consoleLogDir).
+		PostProvision(config, steps)
+}
+
+// runs fleet hooks in order, one VM at a time; all of them are skipped when a VM failed,
+// everything after a hook failing on a VM too
+func (service *Fleet) runPostProvisionHooks(plannedFleetConfig contract.VirtualMachineFleetConfig, failed int) []contract.FleetPostProvisionResult {
+	results := []contract.FleetPostProvisionResult{}
+	skipReason := ""
+	if failed > 0 {
+		skipReason = fmt.Sprintf("skipped, %v virtual machines failed", failed)
+	}
+
+	for i, hook := range plannedFleetConfig.PostProvisionHooks {
+		hookName := hook.Name
+		if hookName == "" {
+			hookName = fmt.Sprintf("hook-%d", i+1)
+		}
+
+		for _, target := range hook.Targets(plannedFleetConfig.VirtualMachineConfigs) {
+			subResult := contract.FleetPostProvisionResult{
+				Hook:           hookName,
+				VirtualMachine: target.Name,
+				Steps:          []contract.PostProvisionStepResult{},
+			}
+			if skipReason != "" {
+				subResult.Error = skipReason
+				results = append(results, subResult)
+				continue
+			}
+
+			event := FleetEvent{Kind: FLEET_EVENT_KIND_HOOK, Name: fmt.Sprintf("%v on %v", hookName, target.Name), Hypervisor: target.HypervisorLabel()}
+			service.progress(event)
+
+			logger.Infof("running post-provision hook %v on %v", hookName, target.Name)
+			steps, err := service.postProvisionVirtualMachine(target, hook.Steps)
+			if steps != nil {
+				subResult.Steps = steps
+			}
+			if err != nil {
+				subResult.Error = err.Error()
+				skipReason = fmt.Sprintf("skipped, hook %v failed on %v", hookName, target.Name)
+				logger.Errorf("post-provision hook %v failed on %v: %v", hookName, target.Name, err)
+			}
+
+			event.IsDone, event.Err = true, err
+			service.progress(event)
+			results = append(results, subResult)
+		}
+	}
+	return results
+}
+
+func (service *Fleet) DeleteVirtualMachine(config contract.VirtualMachineConfig) (contract.DeleteVirtualMachineResult, error) {
+	defer metrics.StartJob(metrics.JOB_VM_DELETE)()
+
+	result := contract.DeleteVirtualMachineResult{
+		Name:       config.Name,
+		Hypervisor: config.Hypervisor,
+	}
+
+	virtualMachineService, err := NewVirtualMachineFromVirtualMachineConfig(config)
+	if err != nil {
+		result.Error = err.Error()
+		return result, err
+	}
+	defer virtualMachineService.Cleanup()
+
+	result.UUID, err = virtualMachineService.WithContext(service.ctx).WithStateStore(service.stateStore).Delete(config)
+	result.Warnings = virtualMachineService.Warnings()
+	if err != nil {
+		result.Error = err.Error()
+	}
+	return result, err
+}
+
+// records networks the fleet defined, those it found are someone else's
+func (service *Fleet) createNetwork(fleet string, config contract.VirtualNetworkConfig) (string, error) {
+	virtualNetworkService, err := NewVirtualNetworkFromHypervisorConnectionConfig(config.HypervisorConnectionConfig)
+	if err != nil {
+		return "", err
+	}
+	defer virtualNetworkService.Cleanup()
+
+	networkUuid, isCreated, err := virtualNetworkService.CreateOrReuse(config)
+	if isCreated && service.stateStore != nil {
+		recordErr := service.stateStore.PutNetwork(contract.NetworkRecord{
+			Name:          config.Name,
+			UUID:          networkUuid,
+			Fleet:         fleet,
+			ConnectionUrl: networkHypervisorLabel(config),
+		})
+		if recordErr != nil {
+			logger.Warnf("could not record network %v, fleet delete will keep it: %v", config.Name, recordErr)
+		}
+	}
+	return networkUuid, err
+}
+
+// whether the fleet created the network, else why it is kept
+func (service *Fleet) isOwnNetwork(fleet string, config contract.VirtualNetworkConfig) (bool, string) {
+	if service.stateStore == nil {
+		return false, "no state store to tell who created it"
+	}
+	record, err := service.stateStore.GetNetwork(networkHypervisorLabel(config), config.Name)
+	if err != nil {
+		return false, fmt.Sprintf("could not read its record: %v", err)
+	}
+	if record == nil || record.Fleet != fleet {
+		return false, "not created by this fleet"
+	}
+	return true, ""
+}
+
+func deleteNetwork(name string, config *contract.HypervisorConnectionConfig) (string, error) {
+	virtualNetworkService, err := NewVirtualNetworkFromHypervisorConnectionConfig(config)
+	if err != nil {
+		return "", err
+	}
+	defer virtualNetworkService.Cleanup()
+
+	return virtualNetworkService.Delete(name)
+}
+
+func networkHypervisorLabel(config contract.VirtualNetworkConfig) string {
+	return contract.HypervisorLabel("", config.HypervisorConnectionConfig)
+}
+
+// creates networks then VMs of a planned fleet, failures are reported per VM
+func (service *Fleet) Create(plannedFleetConfig contract.VirtualMachineFleetConfig) contract.CreateVirtualMachineFleetResult {
+	defer metrics.StartJob(metrics.JOB_FLEET_CREATE)()
+
+	result := contract.CreateVirtualMachineFleetResult{
+		SubResults: []contract.CreateVirtualMachineResult{},
+		Failed:     0,
+		Success:    0,
+		Total:      0,
+	}
+
+	// networks go first, VMs attach to them
+	for _, networkConfig := range plannedFleetConfig.VirtualNetworkConfigs {
+		networkSubResult := contract.CreateVirtualNetworkResult{
+			Name: networkConfig.Name,
+		}
+		event := FleetEvent{Kind: FLEET_EVENT_KIND_NETWORK, Name: networkConfig.Name, Hypervisor: networkHypervisorLabel(networkConfig)}
+		service.progress(event)
+
+		logger.Infof("creating network %v", networkConfig.Name)
+		networkUuid, err := service.createNetwork(plannedFleetConfig.SharedConfig.VirtualMachineFleetName, networkConfig)
+
+		if err != nil {
+			networkSubResult.Error = err.Error()
+			result.Failed++
+			logger.Errorf("failed to create network %v: %v", networkConfig.Name, networkSubResult.Error)
+		} else {
+			networkSubResult.UUID = networkUuid
+			result.Success++
+		}
+		result.Total++
+
+		event.IsDone, event.UUID, event.Err = true, networkUuid, err
+		service.progress(event)
+		result.NetworkSubResults = append(result.NetworkSubResults, networkSubResult)
+	}
+
+	// generated ahead so fleet hooks pin the same host keys, CreateVirtualMachine tries again and reports a failure
+	vmConfigs := make([]contract.VirtualMachineConfig, len(plannedFleetConfig.VirtualMachineConfigs))
+	for i, config := range plannedFleetConfig.VirtualMachineConfigs {
+		vmConfigs[i], _ = withGuestHostKey(config)
+	}
+	plannedFleetConfig.VirtualMachineConfigs = vmConfigs
+
+	subResults := make([]contract.CreateVirtualMachineResult, len(vmConfigs))
+	utils.RunConcurrently(service.maxConcurrentVMOperations, len(vmConfigs), func(i int) {
+		config := vmConfigs[i]
+		event := FleetEvent{Kind: FLEET_EVENT_KIND_VM, Name: config.Name, Hypervisor: config.HypervisorLabel()}
+		service.progress(event)
+
+		logger.Infof("creating VM %v", config.GeneralVMConfig.Name)
+		subResult, err := service.CreateVirtualMachine(config)
+		if err != nil {
+			logger.Errorf("failed to create VM %v: %v", config.GeneralVMConfig.Name, subResult.Error)
+		}
+
+		event.IsDone, event.UUID, event.Err = true, subResult.UUID, err
+		service.progress(event)
+		subResults[i] = subResult
+	})
+
+	failedVMs := 0
+	for _, subResult := range subResults {
+		if subResult.Error != "" {
+			failedVMs++
+			result.Failed++
+		} else {
+			result.Success++
+		}
+		result.Total++
+	}
+	result.SubResults = subResults
+
+	if len(plannedFleetConfig.PostProvisionHooks) > 0 {
+		result.PostProvisionSubResults = service.runPostProvisionHooks(plannedFleetConfig, failedVMs)
+	}
+
+	return result
+}
+
+// deletes VMs then networks of a located fleet, failures are reported per VM
+func (service *Fleet) Delete(locatedFleetConfig contract.VirtualMachineFleetConfig) contract.DeleteVirtualMachineFleetResult {
+	defer metrics.StartJob(metrics.JOB_FLEET_DELETE)()
+
+	result := contract.DeleteVirtualMachineFleetResult{
+		SubResults: []contract.DeleteVirtualMachineResult{},
+		Failed:     0,
+		Success:    0,
+		Total:      0,
+	}
+
+	vmConfigs := locatedFleetConfig.VirtualMachineConfigs
+	subResults := make([]contract.DeleteVirtualMachineResult, len(vmConfigs))
+	utils.RunConcurrently(service.maxConcurrentVMOperations, len(vmConfigs), func(i int) {
+		config := vmConfigs[i]
+		event := FleetEvent{Kind: FLEET_EVENT_KIND_VM, Name: config.Name, Hypervisor: config.HypervisorLabel()}
+		service.progress(event)
+
+		logger.Infof("deleting VM %v", config.GeneralVMConfig.Name)
+		subResult, err := service.DeleteVirtualMachine(config)
+		if err != nil {
+			logger.Errorf("failed to delete VM %v: %v", config.GeneralVMConfig.Name, subResult.Error)
+		}
+
+		event.IsDone, event.UUID, event.Err = true, subResult.UUID, err
+		service.progress(event)
+		subResults[i] = subResult
+	})
+
+	for _, subResult := range subResults {
+		if subResult.Error != "" {
+			result.Failed++
+		} else {
+			result.Success++
+		}
+		result.Total++
+	}
+	result.SubResults = subResults
+
+	// networks go last, nothing should be attached to them anymore; only those the fleet created,
+	// and none while a VM that failed to go may still use them
+	fleet := locatedFleetConfig.SharedConfig.VirtualMachineFleetName
+	failedVMs := result.Failed
+	for _, networkConfig := range locatedFleetConfig.VirtualNetworkConfigs {
+		networkSubResult := contract.DeleteVirtualNetworkResult{
+			Name: networkConfig.Name,
+		}
+
+		if isOwn, reason := service.isOwnNetwork(fleet, networkConfig); !isOwn {
+			logger.Infof("keeping network %v: %v", networkConfig.Name, reason)
+			networkSubResult.Kept = reason
+			result.NetworkSubResults = append(result.NetworkSubResults, networkSubResult)
+			continue
+		}
+
+		result.Total++
+		if failedVMs > 0 {
+			networkSubResult.Error = fmt.Sprintf("skipped, %v virtual machines failed", failedVMs)
+			result.Failed++
+			result.NetworkSubResults = append(result.NetworkSubResults, networkSubResult)
+			continue
+		}
+
+		event := FleetEvent{Kind: FLEET_EVENT_KIND_NETWORK, Name: networkConfig.Name, Hypervisor: networkHypervisorLabel(networkConfig)}
+		service.progress(event)
+
+		logger.Infof("deleting network %v", networkConfig.Name)
+		networkUuid, err := deleteNetwork(networkConfig.Name, networkConfig.HypervisorConnectionConfig)
+		networkSubResult.UUID = networkUuid
+
+		if err != nil {
+			networkSubResult.Error = err.Error()
+			result.Failed++
+			logger.Errorf("failed to delete network %v: %v", networkConfig.Name, networkSubResult.Error)
+		} else {
+			result.Success++
+			if err = service.stateStore.DeleteNetwork(networkHypervisorLabel(networkConfig), networkConfig.Name); err != nil {
+				logger.Warnf("could not delete record of network %v: %v", networkConfig.Name, err)
+			}
+		}
+
+		event.IsDone, event.UUID, event.Err = true, networkUuid, err
+		service.progress(event)
+		result.NetworkSubResults = append(result.NetworkSubResults, networkSubResult)
+	}
+
+	return result
+}
@@ -0,0 +1,240 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/nnurry/harmonia/internal/contract"
+	"libvirt.org/go/libvirt"
+)
+
+const (
+	DEFAULT_GUEST_EXEC_TIMEOUT  = 30 * time.Second
+	MAX_GUEST_EXEC_TIMEOUT      = 10 * time.Minute
+	GUEST_EXEC_POLL_INTERVAL    = 200 * time.Millisecond
+	GUEST_AGENT_COMMAND_TIMEOUT = libvirt.DOMAIN_QEMU_AGENT_COMMAND_DEFAULT
+	// raw bytes per guest-file-write, well below the agent's message limit once base64 encoded
+	GUEST_FILE_CHUNK_SIZE = 48 * 1024
+)
+
+type guestAgentCommand struct {
+	Execute   string `json:"execute"`
+	Arguments any    `json:"arguments,omitempty"`
+}
+
+type guestExecArguments struct {
+	Path          string   `json:"path"`
+	Arg           []string `json:"arg,omitempty"`
+	Env           []string `json:"env,omitempty"`
+	InputData     string   `json:"input-data,omitempty"`
+	CaptureOutput bool     `json:"capture-output"`
+}
+
+type guestExecStatus struct {
+	Exited       bool   `json:"exited"`
+	ExitCode     int    `json:"exitcode"`
+	Signal       int    `json:"signal"`
+	OutData      string `json:"out-data"`
+	ErrData      string `json:"err-data"`
+	OutTruncated bool   `json:"out-truncated"`
+	ErrTruncated bool   `json:"err-truncated"`
+}
+
+// sends one command to qemu-guest-agent and decodes its "return" into result (if any)
+func guestAgentRequest(domain *libvirt.Domain, execute string, arguments any, result any) error {
+	command, err := json.Marshal(guestAgentCommand{Execute: execute, Arguments: arguments})
+	if err != nil {
+		return fmt.Errorf("could not serialize %v: %v", execute, err)
+	}
+
+	response, err := domain.QemuAgentCommand(string(command), GUEST_AGENT_COMMAND_TIMEOUT, 0)
+	if err != nil {
+		return fmt.Errorf("guest agent failed %v: %v", execute, err)
+	}
+	if result == nil {
+		return nil
+	}
+
+	envelope := struct {
+		Return json.RawMessage `json:"return"`
+	}{}
+	if err = json.Unmarshal([]byte(response), &envelope); err != nil {
+		return fmt.Errorf("could not parse %v response: %v", execute, err)
+	}
+	if err = json.Unmarshal(envelope.Return, result); err != nil {
+		return fmt.Errorf("could not parse %v response: %v", execute, err)
+	}
+	return nil
+}
+
+// addresses the guest itself reports, loopback left out
+func (service *Libvirt) GetGuestInterfaces(name string) ([]contract.GuestInterface, error) {
+	domain, err := service.GetDomainByName(name)
+	if err != nil {
+		return nil, err
+	}
+	defer domain.Free()
+
+	domainInterfaces, err := domain.ListAllInterfaceAddresses(libvirt.DOMAIN_INTERFACE_ADDRESSES_SRC_AGENT)
+	if err != nil {
+		return nil, fmt.Errorf("could not get interfaces of %v from guest agent: %v", name, err)
+	}
+	return toGuestInterfaces(domainInterfaces), nil
+}
+
+func toGuestInterfaces(domainInterfaces []libvirt.DomainInterface) []contract.GuestInterface {
+	guestInterfaces := []contract.GuestInterface{}
+	for _, domainInterface := range domainInterfaces {
+		if domainInterface.Name == "lo" {
+			continue
+		}
+
+		guestInterface := contract.GuestInterface{
+			Name:        domainInterface.Name,
+			MacAddress:  domainInterface.Hwaddr,
+			IPAddresses: []contract.GuestIPAddress{},
+		}
+		for _, address := range domainInterface.Addrs {
+			addressType := contract.IP_ADDRESS_TYPE_IPV4
+			if address.Type == libvirt.IP_ADDR_TYPE_IPV6 {
+				addressType = contract.IP_ADDRESS_TYPE_IPV6
+			}
+			guestInterface.IPAddresses = append(guestInterface.IPAddresses, contract.GuestIPAddress{
+				Type:    addressType,
+				Address: address.Addr,
+				Prefix:  address.Prefix,
+			})
+		}
+		guestInterfaces = append(guestInterfaces, guestInterface)
+	}
+	return guestInterfaces
+}
+
+// runs a command in the guest and waits for it, a non-zero exit code is not an error;
+// ctx or the request timeout ending first leaves the command running in the guest
+func (service *Libvirt) GuestExec(ctx context.Context, name string, request contract.GuestExecRequest) (*contract.GuestExecResult, error) {
+	if request.Path == "" {
+		return nil, fmt.Errorf("path of the command is empty")
+	}
+
+	timeout := DEFAULT_GUEST_EXEC_TIMEOUT
+	if request.TimeoutSeconds > 0 {
+		timeout = min(time.Duration(request.TimeoutSeconds)*time.Second, MAX_GUEST_EXEC_TIMEOUT)
+	}
+
+	domain, err := service.GetDomainByName(name)
+	if err != nil {
+		return nil, err
+	}
+	defer domain.Free()
+
+	arguments := guestExecArguments{
+		Path:          request.Path,
+		Arg:           request.Args,
+		Env:           request.Env,
+		CaptureOutput: true,
+	}
+	if len(request.Input) > 0 {
+		arguments.InputData = base64.StdEncoding.EncodeToString(request.Input)
+	}
+
+	started := struct {
+		PID int `json:"pid"`
+	}{}
+	if err = guestAgentRequest(domain, "guest-exec", arguments, &started); err != nil {
+		return nil, err
+	}
+
+	result := &contract.GuestExecResult{PID: started.PID}
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	ticker := time.NewTicker(GUEST_EXEC_POLL_INTERVAL)
+	defer ticker.Stop()
+
+	for {
+		var status guestExecStatus
+		err = guestAgentRequest(domain, "guest-exec-status", map[string]int{"pid": started.PID}, &status)
+		if err != nil {
+			return result, err
+		}
+
+		if status.Exited {
+			stdout, err := base64.StdEncoding.DecodeString(status.OutData)
+			if err != nil {
+				return result, fmt.Errorf("could not decode stdout: %v", err)
+			}
+			stderr, err := base64.StdEncoding.DecodeString(status.ErrData)
+			if err != nil {
+				return result, fmt.Errorf("could not decode stderr: %v", err)
+			}
+
+			result.ExitCode = status.ExitCode
+			result.Signal = status.Signal
+			result.Stdout = stdout
+			result.Stderr = stderr
+			result.IsTruncated = status.OutTruncated || status.ErrTruncated
+			return result, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return result, fmt.Errorf("stopped waiting for pid %v: %v", started.PID, ctx.Err())
+		case <-deadline.C:
+			return result, fmt.Errorf("pid %v still running after %v", started.PID, timeout)
+		case <-ticker.C:
+		}
+	}
+}
+
+// writes content to path in the guest, creating or truncating it unless isAppend
+func (service *Libvirt) GuestWriteFile(name string, path string, content []byte, isAppend bool) (int, error) {
+	if path == "" {
+		return 0, fmt.Errorf("path of the file is empty")
+	}
+
+	domain, err := service.GetDomainByName(name)
+	if err != nil {
+		return 0, err
+	}
+	defer domain.Free()
+
+	mode := "w"
+	if isAppend {
+		mode = "a"
+	}
+
+	var handle int
+	err = guestAgentRequest(domain, "guest-file-open", map[string]string{"path": path, "mode": mode}, &handle)
+	if err != nil {
+		return 0, err
+	}
+
+	written := 0
+	for written < len(content) {
+		chunk := content[written:min(written+GUEST_FILE_CHUNK_SIZE, len(content))]
+
+		var count struct {
+			Count int `json:"count"`
+		}
+		err = guestAgentRequest(domain, "guest-file-write", map[string]any{
+			"handle":  handle,
+			"buf-b64": base64.StdEncoding.EncodeToString(chunk),
+		}, &count)
+		if err == nil && count.Count < 1 {
+			err = fmt.Errorf("guest agent wrote nothing to %v", path)
+		}
+		if err != nil {
+			guestAgentRequest(domain, "guest-file-close", map[string]int{"handle": handle}, nil)
+			return written, err
+		}
+		written += count.Count
+	}
+
+	if err = guestAgentRequest(domain, "guest-file-close", map[string]int{"handle": handle}, nil); err != nil {
+		return written, err
+	}
+	return written, nil
+}
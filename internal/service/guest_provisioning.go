@@ -0,0 +1,45 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/nnurry/harmonia/internal/connection"
+	"github.com/nnurry/harmonia/internal/contract"
+	"golang.org/x/crypto/ssh"
+)
+
+// what a GuestProvisioner renders, taken from the config of the VM
+type GuestProvisioningData struct {
+	Hostname       string
+	InstanceID     string
+	User           string
+	AuthorizedKeys []string
+	Interfaces     []contract.NetworkInterfaceConfig
+	Nameservers    []string
+	Files          []contract.GuestFileConfig
+	// PEM of the ed25519 SSH host key of the guest, the image generates its own if empty
+	HostKey string
+}
+
+// authorized_keys line of the host key, empty if there is none
+func (data GuestProvisioningData) HostPublicKey() (string, error) {
+	if data.HostKey == "" {
+		return "", nil
+	}
+	signer, err := ssh.ParsePrivateKey([]byte(data.HostKey))
+	if err != nil {
+		return "", fmt.Errorf("could not parse host key: %v", err)
+	}
+	return strings.TrimSpace(string(ssh.MarshalAuthorizedKey(signer.PublicKey()))), nil
+}
+
+func NewGuestProvisioner(name string, processor ShellProcessor, sshConnection *connection.SSH) (GuestProvisioner, error) {
+	switch name {
+	case "", contract.PROVISIONER_CLOUD_INIT:
+		return NewCloudInit(processor, sshConnection)
+	case contract.PROVISIONER_IGNITION:
+		return NewIgnition(sshConnection)
+	}
+	return nil, fmt.Errorf("unknown provisioner '%v'", name)
+}
@@ -0,0 +1,150 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/nnurry/harmonia/internal/builder"
+	"github.com/nnurry/harmonia/internal/connection"
+	"github.com/nnurry/harmonia/internal/logger"
+	"github.com/nnurry/harmonia/internal/service/ignition"
+	"github.com/pkg/sftp"
+)
+
+const (
+	IGNITION_SUDOERS_MODE  = 0440
+	IGNITION_HOST_KEY_PATH = "/etc/ssh/ssh_host_ed25519_key"
+)
+
+// provisions Fedora CoreOS and Flatcar guests with an Ignition config read over fw_cfg
+type Ignition struct {
+	sftpClient *sftp.Client
+	warnings   []string
+	Config     ignition.Config
+}
+
+// writes to the local filesystem when there is no SSH connection
+func NewIgnition(sshConnection *connection.SSH) (*Ignition, error) {
+	if sshConnection == nil {
+		return &Ignition{}, nil
+	}
+
+	logger.Info("creating SFTP client")
+	sftpClient, err := sftp.NewClient(sshConnection.Client())
+	if err != nil {
+		return nil, fmt.Errorf("could not create SFTP client for ignition service: %v", err)
+	}
+
+	logger.Info("created SFTP client")
+	return &Ignition{sftpClient: sftpClient}, nil
+}
+
+// users and their keys, hostname, NetworkManager keyfiles and files of the guest
+func (service *Ignition) Render(data GuestProvisioningData) (ignition.Config, error) {
+	config := ignition.NewConfig()
+	config.Passwd.Users = []ignition.User{{
+		Name:              data.User,
+		SSHAuthorizedKeys: data.AuthorizedKeys,
+	}}
+
+	files := []ignition.File{
+		ignition.NewFile(
+			fmt.Sprintf("/etc/sudoers.d/harmonia-%v", data.User),
+			IGNITION_SUDOERS_MODE,
+			[]byte(fmt.Sprintf("%v ALL=(ALL) NOPASSWD:ALL\n", data.User)),
+		),
+		ignition.NewFile("/etc/hostname", 0644, []byte(data.Hostname+"\n")),
+	}
+
+	for i, networkInterface := range data.Interfaces {
+		// NetworkManager brings up unmatched NICs with DHCP by itself
+		if networkInterface.MacAddress == "" {
+			if networkInterface.IPv4Address != "" {
+				return config, fmt.Errorf("interface #%d of %v needs a mac_address for its static address", i+1, data.Hostname)
+			}
+			continue
+		}
+
+		networkConnection := ignition.Connection{
+			ID:         fmt.Sprintf("eth%d", i),
+			MacAddress: strings.ToUpper(networkInterface.MacAddress),
+		}
+		if networkInterface.IPv4Address != "" {
+			networkConnection.Address = networkInterface.IPv4Address
+			networkConnection.Prefix = networkInterface.GetIPv4Prefix()
+			networkConnection.Gateway = networkInterface.IPv4GatewayAddress
+			networkConnection.Nameservers = data.Nameservers
+		}
+		// NetworkManager ignores keyfiles others can read
+		files = append(files, ignition.NewFile(networkConnection.Path(), 0600, networkConnection.Serialize()))
+	}
+
+	hostPublicKey, err := data.HostPublicKey()
+	if err != nil {
+		return config, err
+	}
+	if hostPublicKey != "" {
+		files = append(files,
+			ignition.NewFile(IGNITION_HOST_KEY_PATH, 0600, []byte(data.HostKey)),
+			ignition.NewFile(IGNITION_HOST_KEY_PATH+".pub", 0644, []byte(hostPublicKey+"\n")),
+		)
+	}
+
+	for _, file := range data.Files {
+		mode, err := file.FileMode()
+		if err != nil {
+			return config, err
+		}
+		files = append(files, ignition.NewFile(file.Path, mode, []byte(file.Content)))
+	}
+
+	config.Storage.Files = files
+	return config, nil
+}
+
+func (service *Ignition) Provision(ctx context.Context, basePath string, data GuestProvisioningData) (string, error) {
+	config, err := service.Render(data)
+	if err != nil {
+		return "", err
+	}
+	service.Config = config
+
+	content, err := config.Serialize()
+	if err != nil {
+		return "", fmt.Errorf("could not serialize ignition config: %v", err)
+	}
+
+	dirWarning, err := mkdirOnHypervisor(service.sftpClient, basePath)
+	if err != nil {
+		return "", err
+	}
+
+	path := fmt.Sprintf("%v/%v", strings.TrimSuffix(basePath, "/"), config.FileName())
+	fileWarning, err := writeFileOnHypervisor(service.sftpClient, path, content)
+	if err != nil {
+		return "", fmt.Errorf("could not write ignition config to disk: %v", err)
+	}
+
+	service.warnings = nil
+	for _, warning := range []string{dirWarning, fileWarning} {
+		if warning != "" && !slices.Contains(service.warnings, warning) {
+			service.warnings = append(service.warnings, warning)
+		}
+	}
+	return path, nil
+}
+
+// non-fatal issues found by the last Provision
+func (service *Ignition) Warnings() []string {
+	return service.warnings
+}
+
+func (service *Ignition) AttachTo(libvirtBuilder *builder.LibvirtDomainBuilder, path string) *builder.LibvirtDomainBuilder {
+	return libvirtBuilder.WithIgnitionConfigPath(path)
+}
+
+func (service *Ignition) RemoveFromDisk(ctx context.Context, basePath string) error {
+	return removeFromHypervisor(service.sftpClient, basePath)
+}
@@ -0,0 +1,70 @@
+package ignition
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+
+	"github.com/nnurry/harmonia/pkg/utils"
+)
+
+const SPEC_VERSION = "3.4.0"
+
+// the subset of the Ignition v3 spec harmonia renders
+type Config struct {
+	Ignition Ignition `json:"ignition"`
+	Passwd   Passwd   `json:"passwd,omitempty"`
+	Storage  Storage  `json:"storage,omitempty"`
+}
+
+type Ignition struct {
+	Version string `json:"version"`
+}
+
+type Passwd struct {
+	Users []User `json:"users,omitempty"`
+}
+
+type User struct {
+	Name              string   `json:"name"`
+	SSHAuthorizedKeys []string `json:"sshAuthorizedKeys,omitempty"`
+	Groups            []string `json:"groups,omitempty"`
+}
+
+type Storage struct {
+	Files []File `json:"files,omitempty"`
+}
+
+type File struct {
+	Path      string       `json:"path"`
+	Mode      uint32       `json:"mode"`
+	Overwrite bool         `json:"overwrite"`
+	Contents  FileContents `json:"contents"`
+}
+
+type FileContents struct {
+	Source string `json:"source"`
+}
+
+func NewConfig() Config {
+	return Config{Ignition: Ignition{Version: SPEC_VERSION}}
+}
+
+// a file replacing whatever the image has at path
+func NewFile(path string, mode uint32, content []byte) File {
+	return File{
+		Path:      path,
+		Mode:      mode,
+		Overwrite: true,
+		Contents:  FileContents{Source: "data:;base64," + base64.StdEncoding.EncodeToString(content)},
+	}
+}
+
+func (config Config) FileName() string {
+	return "config.ign"
+}
+
+func (config Config) Serialize() ([]byte, error) {
+	var buf bytes.Buffer
+	return utils.SerializeFromEncoder(json.NewEncoder(&buf), &buf, config)
+}
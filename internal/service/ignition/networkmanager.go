@@ -0,0 +1,46 @@
+package ignition
+
+import (
+	"fmt"
+	"strings"
+)
+
+const NETWORK_MANAGER_CONNECTIONS_DIR = "/etc/NetworkManager/system-connections"
+
+// NetworkManager keyfile of an ethernet connection bound to a MAC address, DHCP when Address is empty
+type Connection struct {
+	ID          string
+	MacAddress  string
+	Address     string
+	Prefix      uint
+	Gateway     string
+	Nameservers []string
+}
+
+func (connection Connection) Path() string {
+	return fmt.Sprintf("%v/%v.nmconnection", NETWORK_MANAGER_CONNECTIONS_DIR, connection.ID)
+}
+
+func (connection Connection) Serialize() []byte {
+	var builder strings.Builder
+	fmt.Fprintf(&builder, "[connection]\nid=%v\ntype=ethernet\nautoconnect=true\n\n", connection.ID)
+	fmt.Fprintf(&builder, "[ethernet]\nmac-address=%v\n\n", connection.MacAddress)
+
+	if connection.Address == "" {
+		builder.WriteString("[ipv4]\nmethod=auto\n\n")
+	} else {
+		builder.WriteString("[ipv4]\nmethod=manual\n")
+		address := fmt.Sprintf("%v/%v", connection.Address, connection.Prefix)
+		if connection.Gateway != "" {
+			address += "," + connection.Gateway
+		}
+		fmt.Fprintf(&builder, "address1=%v\n", address)
+		if len(connection.Nameservers) > 0 {
+			fmt.Fprintf(&builder, "dns=%v;\n", strings.Join(connection.Nameservers, ";"))
+		}
+		builder.WriteString("\n")
+	}
+
+	builder.WriteString("[ipv6]\nmethod=auto\n")
+	return []byte(builder.String())
+}
@@ -5,6 +5,7 @@ import (
 	"io"
 
 	"github.com/nnurry/harmonia/internal/builder"
+	"github.com/nnurry/harmonia/internal/contract"
 	"github.com/nnurry/harmonia/internal/service/cloudinit"
 	"libvirt.org/go/libvirt"
 )
@@ -12,6 +13,14 @@ import (
 type LibvirtService interface {
 	GetDomainByName(name string) (*libvirt.Domain, error)
 	DefineDomainFromBuilder(domainBuilder *builder.LibvirtDomainBuilder) (*libvirt.Domain, error)
+	GetNetworkByName(name string) (*libvirt.Network, error)
+	DefineNetworkFromBuilder(networkBuilder *builder.LibvirtNetworkBuilder) (*libvirt.Network, error)
+	RemoveNetworkByName(name string) error
+	ListNetworks(includeInactive bool) ([]libvirt.Network, error)
+	AddNetworkReservation(networkName string, macAddress string, hostname string, ipAddress string) error
+	RemoveNetworkReservation(networkName string, macAddress string, hostname string) error
+	GetCapacity() (*contract.HypervisorCapacity, error)
+	Cleanup() error
 }
 
 type CloudInitService interface {
@@ -22,7 +31,25 @@ type CloudInitService interface {
 	RemoveFromDisk(ctx context.Context, basePath string) error
 }
 
+// renders what the guest needs on first boot and hands it to the domain
+type GuestProvisioner interface {
+	Provision(ctx context.Context, basePath string, data GuestProvisioningData) (string, error)
+	AttachTo(libvirtBuilder *builder.LibvirtDomainBuilder, path string) *builder.LibvirtDomainBuilder
+	RemoveFromDisk(ctx context.Context, basePath string) error
+	// non-fatal issues found by the last Provision
+	Warnings() []string
+}
+
 type ShellProcessor interface {
 	Name() string
 	Execute(ctx context.Context, stdout io.Writer, stderr io.Writer, command string, arguments ...string) error
 }
+
+type StateStore interface {
+	PutVirtualMachine(record contract.VirtualMachineRecord) error
+	GetVirtualMachine(connectionUrl string, name string) (*contract.VirtualMachineRecord, error)
+	DeleteVirtualMachine(connectionUrl string, name string) error
+	PutNetwork(record contract.NetworkRecord) error
+	GetNetwork(connectionUrl string, name string) (*contract.NetworkRecord, error)
+	DeleteNetwork(connectionUrl string, name string) error
+}
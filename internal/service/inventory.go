@@ -0,0 +1,92 @@
+package service
+
+import (
+	"sync"
+
+	"github.com/nnurry/harmonia/internal/connection"
+	"github.com/nnurry/harmonia/internal/contract"
+	"github.com/nnurry/harmonia/internal/inventory"
+	"github.com/nnurry/harmonia/internal/logger"
+)
+
+func listFleetDomains(libvirtConfig connection.LibvirtConfig, fleet string) (map[string]contract.DomainSummary, error) {
+	conn, err := connection.NewLibvirt(libvirtConfig)
+	if err != nil {
+		return nil, err
+	}
+	libvirtService, err := NewLibvirt(conn)
+	if err != nil {
+		return nil, err
+	}
+	defer libvirtService.Cleanup()
+
+	summaries, err := libvirtService.ListDomainSummaries(true, contract.DomainSelector{Fleet: fleet})
+	if err != nil {
+		return nil, err
+	}
+
+	domains := map[string]contract.DomainSummary{}
+	for _, summary := range summaries {
+		domains[summary.Name] = summary
+	}
+	return domains, nil
+}
+
+// hosts of the recorded VMs of a fleet with the state and addresses their hypervisors report,
+// all hypervisors are asked at once; named hypervisors use the server config of today
+func GetFleetInventory(
+	fleet string,
+	records []contract.VirtualMachineRecord,
+	getHypervisor func(name string) (*contract.HypervisorConnectionConfig, error),
+) contract.FleetInventory {
+	libvirtConfigs := map[string]connection.LibvirtConfig{}
+	hypervisorLabels := map[string]string{}
+	for _, record := range records {
+		if _, ok := libvirtConfigs[record.ConnectionUrl]; ok {
+			continue
+		}
+
+		libvirtConfig := connection.LibvirtConfig{ConnectionUrl: record.ConnectionUrl}
+		if record.Config.HypervisorConnectionConfig != nil {
+			libvirtConfig = record.Config.HypervisorConnectionConfig.LibvirtConfig
+		}
+		hypervisorLabels[record.ConnectionUrl] = record.ConnectionUrl
+		if record.Hypervisor != "" {
+			hypervisorLabels[record.ConnectionUrl] = record.Hypervisor
+			if hypervisorConfig, err := getHypervisor(record.Hypervisor); err == nil {
+				libvirtConfig = hypervisorConfig.LibvirtConfig
+			}
+		}
+		libvirtConfigs[record.ConnectionUrl] = libvirtConfig
+	}
+
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		errors = map[string]string{}
+	)
+	domains := map[string]map[string]contract.DomainSummary{}
+	for connectionUrl, libvirtConfig := range libvirtConfigs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			hypervisorDomains, err := listFleetDomains(libvirtConfig, fleet)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				logger.Warnf("could not list domains of fleet %v on %v: %v", fleet, hypervisorLabels[connectionUrl], err)
+				errors[hypervisorLabels[connectionUrl]] = err.Error()
+				return
+			}
+			domains[connectionUrl] = hypervisorDomains
+		}()
+	}
+	wg.Wait()
+
+	fleetInventory := inventory.New(fleet, records, domains)
+	for hypervisor, message := range errors {
+		fleetInventory.Errors[hypervisor] = message
+	}
+	return fleetInventory
+}
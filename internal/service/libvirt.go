@@ -1,13 +1,20 @@
 package service
 
 import (
+	"errors"
+	"fmt"
+
 	"github.com/nnurry/harmonia/internal/builder"
 	"github.com/nnurry/harmonia/internal/connection"
+	"github.com/nnurry/harmonia/internal/defaults"
 	"libvirt.org/go/libvirt"
+	"libvirt.org/go/libvirtxml"
 )
 
 const (
 	DEFAULT_LIBVIRT_QEMU_DISK_BASE_PATH = "/var/lib/libvirt/images"
+	DEFAULT_CLOUD_INIT_BASE_PATH        = defaults.CLOUD_INIT_DIR
+	DEFAULT_CONSOLE_LOG_BASE_PATH       = defaults.CONSOLE_LOG_DIR
 )
 
 type Libvirt struct {
@@ -67,3 +74,152 @@ func (service *Libvirt) ListDomains(includeInactive bool) ([]libvirt.Domain, err
 	}
 	return service.Connect().ListAllDomains(flags)
 }
+
+func (service *Libvirt) GetNetworkByName(name string) (*libvirt.Network, error) {
+	return service.Connect().LookupNetworkByName(name)
+}
+
+func (service *Libvirt) DefineNetworkFromBuilder(networkBuilder *builder.LibvirtNetworkBuilder) (*libvirt.Network, error) {
+	return networkBuilder.Build(service.Connect())
+}
+
+func (service *Libvirt) RemoveNetworkByName(name string) error {
+	network, err := service.GetNetworkByName(name)
+
+	if err != nil {
+		return err
+	}
+
+	isActive, err := network.IsActive()
+	if err != nil {
+		return err
+	}
+
+	if isActive {
+		if err = network.Destroy(); err != nil {
+			return err
+		}
+	}
+
+	return network.Undefine()
+}
+
+func (service *Libvirt) ListNetworks(includeInactive bool) ([]libvirt.Network, error) {
+	flags := libvirt.CONNECT_LIST_NETWORKS_ACTIVE
+	if includeInactive {
+		flags |= libvirt.CONNECT_LIST_NETWORKS_INACTIVE
+	}
+	return service.Connect().ListAllNetworks(flags)
+}
+
+// registers a static DHCP lease and a DNS record for the host on the network
+func (service *Libvirt) AddNetworkReservation(networkName string, macAddress string, hostname string, ipAddress string) error {
+	network, err := service.GetNetworkByName(networkName)
+	if err != nil {
+		return err
+	}
+
+	flags, err := service.getNetworkUpdateFlags(network)
+	if err != nil {
+		return err
+	}
+
+	dhcpHostXML, err := (&libvirtxml.NetworkDHCPHost{MAC: macAddress, Name: hostname, IP: ipAddress}).Marshal()
+	if err != nil {
+		return fmt.Errorf("unable to serialize DHCP host: %v", err)
+	}
+
+	err = network.Update(libvirt.NETWORK_UPDATE_COMMAND_ADD_LAST, libvirt.NETWORK_SECTION_IP_DHCP_HOST, -1, dhcpHostXML, flags)
+	if err != nil {
+		return fmt.Errorf("could not add DHCP host %v to network %v: %v", hostname, networkName, err)
+	}
+
+	dnsHostXML, err := (&libvirtxml.NetworkDNSHost{
+		IP:        ipAddress,
+		Hostnames: []libvirtxml.NetworkDNSHostHostname{{Hostname: hostname}},
+	}).Marshal()
+	if err != nil {
+		return fmt.Errorf("unable to serialize DNS host: %v", err)
+	}
+
+	err = network.Update(libvirt.NETWORK_UPDATE_COMMAND_ADD_LAST, libvirt.NETWORK_SECTION_DNS_HOST, -1, dnsHostXML, flags)
+	if err != nil {
+		return fmt.Errorf("could not add DNS host %v to network %v: %v", hostname, networkName, err)
+	}
+
+	return nil
+}
+
+// removes every DHCP lease matching the MAC address and every DNS record carrying the hostname
+func (service *Libvirt) RemoveNetworkReservation(networkName string, macAddress string, hostname string) error {
+	network, err := service.GetNetworkByName(networkName)
+	if err != nil {
+		return err
+	}
+
+	flags, err := service.getNetworkUpdateFlags(network)
+	if err != nil {
+		return err
+	}
+
+	networkXMLString, err := network.GetXMLDesc(0)
+	if err != nil {
+		return err
+	}
+
+	networkXML := &libvirtxml.Network{}
+	if err = networkXML.Unmarshal(networkXMLString); err != nil {
+		return err
+	}
+
+	var joinedErr error
+
+	for _, ip := range networkXML.IPs {
+		if ip.DHCP == nil {
+			continue
+		}
+		for _, host := range ip.DHCP.Hosts {
+			if host.MAC != macAddress {
+				continue
+			}
+			hostXML, err := host.Marshal()
+			if err == nil {
+				err = network.Update(libvirt.NETWORK_UPDATE_COMMAND_DELETE, libvirt.NETWORK_SECTION_IP_DHCP_HOST, -1, hostXML, flags)
+			}
+			joinedErr = errors.Join(joinedErr, err)
+		}
+	}
+
+	if networkXML.DNS != nil {
+		for _, host := range networkXML.DNS.Host {
+			for _, dnsHostname := range host.Hostnames {
+				if dnsHostname.Hostname != hostname {
+					continue
+				}
+				hostXML, err := host.Marshal()
+				if err == nil {
+					err = network.Update(libvirt.NETWORK_UPDATE_COMMAND_DELETE, libvirt.NETWORK_SECTION_DNS_HOST, -1, hostXML, flags)
+				}
+				joinedErr = errors.Join(joinedErr, err)
+				break
+			}
+		}
+	}
+
+	return joinedErr
+}
+
+func (service *Libvirt) getNetworkUpdateFlags(network *libvirt.Network) (libvirt.NetworkUpdateFlags, error) {
+	flags := libvirt.NETWORK_UPDATE_AFFECT_CONFIG
+
+	isActive, err := network.IsActive()
+	if err != nil {
+		return flags, err
+	}
+
+	if isActive {
+		flags |= libvirt.NETWORK_UPDATE_AFFECT_LIVE
+	}
+
+	return flags, nil
+}
@@ -0,0 +1,140 @@
+package service
+
+import (
+	"sync"
+
+	"github.com/nnurry/harmonia/internal/connection"
+	"github.com/nnurry/harmonia/internal/contract"
+	"github.com/nnurry/harmonia/internal/logger"
+	"github.com/nnurry/harmonia/internal/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"libvirt.org/go/libvirt"
+)
+
+var (
+	hypervisorUpDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(metrics.NAMESPACE, "hypervisor", "up"),
+		"Whether domain stats of the hypervisor could be gathered.",
+		[]string{"hypervisor"}, nil,
+	)
+	domainStateDesc = newDomainDesc("state", "Libvirt state of the domain, 1 for the state it is in.", "state")
+	domainVCPUsDesc = newDomainDesc("vcpus", "Number of vCPUs of the domain.")
+
+	domainCPUSecondsDesc    = newDomainDesc("cpu_seconds_total", "CPU time consumed by the domain.")
+	domainMemoryCurrentDesc = newDomainDesc("memory_current_bytes", "Memory currently assigned to the domain by the balloon driver.")
+	domainMemoryMaximumDesc = newDomainDesc("memory_maximum_bytes", "Maximum memory of the domain.")
+	domainBlockReadDesc     = newDomainDesc("block_read_bytes_total", "Bytes read from all disks of the domain.")
+	domainBlockWriteDesc    = newDomainDesc("block_write_bytes_total", "Bytes written to all disks of the domain.")
+	domainNetReceiveDesc    = newDomainDesc("network_receive_bytes_total", "Bytes received on all interfaces of the domain.")
+	domainNetTransmitDesc   = newDomainDesc("network_transmit_bytes_total", "Bytes transmitted on all interfaces of the domain.")
+)
+
+func newDomainDesc(name string, help string, extraLabels ...string) *prometheus.Desc {
+	return prometheus.NewDesc(
+		prometheus.BuildFQName(metrics.NAMESPACE, "domain", name),
+		help,
+		append([]string{"hypervisor", "domain"}, extraLabels...), nil,
+	)
+}
+
+// gathers per-domain stats of every configured hypervisor on scrape
+type DomainStatsCollector struct {
+	hypervisors map[string]contract.HypervisorConnectionConfig
+}
+
+func NewDomainStatsCollector(hypervisors map[string]contract.HypervisorConnectionConfig) *DomainStatsCollector {
+	return &DomainStatsCollector{hypervisors: hypervisors}
+}
+
+func (collector *DomainStatsCollector) Describe(descs chan<- *prometheus.Desc) {
+	for _, desc := range []*prometheus.Desc{
+		hypervisorUpDesc,
+		domainStateDesc,
+		domainVCPUsDesc,
+		domainCPUSecondsDesc,
+		domainMemoryCurrentDesc,
+		domainMemoryMaximumDesc,
+		domainBlockReadDesc,
+		domainBlockWriteDesc,
+		domainNetReceiveDesc,
+		domainNetTransmitDesc,
+	} {
+		descs <- desc
+	}
+}
+
+func (collector *DomainStatsCollector) Collect(ch chan<- prometheus.Metric) {
+	var wg sync.WaitGroup
+	for name, hypervisor := range collector.hypervisors {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			samples, err := getHypervisorDomainStats(hypervisor)
+			if err != nil {
+				logger.Warnf("could not gather domain stats of hypervisor %v: %v", name, err)
+				ch <- prometheus.MustNewConstMetric(hypervisorUpDesc, prometheus.GaugeValue, 0, name)
+				return
+			}
+			ch <- prometheus.MustNewConstMetric(hypervisorUpDesc, prometheus.GaugeValue, 1, name)
+
+			for _, sample := range samples {
+				collectDomainStatsSample(ch, name, sample)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func getHypervisorDomainStats(hypervisor contract.HypervisorConnectionConfig) ([]contract.DomainStatsSample, error) {
+	conn, err := connection.NewLibvirt(hypervisor.LibvirtConfig)
+	if err != nil {
+		return nil, err
+	}
+	libvirtService, err := NewLibvirt(conn)
+	if err != nil {
+		return nil, err
+	}
+	defer libvirtService.Cleanup()
+
+	return libvirtService.GetDomainStats()
+}
+
+func collectDomainStatsSample(ch chan<- prometheus.Metric, hypervisor string, sample contract.DomainStatsSample) {
+	for _, state := range []libvirt.DomainState{
+		libvirt.DOMAIN_NOSTATE,
+		libvirt.DOMAIN_RUNNING,
+		libvirt.DOMAIN_BLOCKED,
+		libvirt.DOMAIN_PAUSED,
+		libvirt.DOMAIN_SHUTDOWN,
+		libvirt.DOMAIN_SHUTOFF,
+		libvirt.DOMAIN_CRASHED,
+		libvirt.DOMAIN_PMSUSPENDED,
+	} {
+		value := 0.0
+		if DomainStateToString(state) == sample.State {
+			value = 1
+		}
+		ch <- prometheus.MustNewConstMetric(domainStateDesc, prometheus.GaugeValue, value, hypervisor, sample.Name, DomainStateToString(state))
+	}
+
+	gauges := map[*prometheus.Desc]float64{
+		domainVCPUsDesc:         float64(sample.VCPUs),
+		domainMemoryCurrentDesc: float64(sample.MemoryCurrentKiB * 1024),
+		domainMemoryMaximumDesc: float64(sample.MemoryMaximumKiB * 1024),
+	}
+	for desc, value := range gauges {
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, value, hypervisor, sample.Name)
+	}
+
+	counters := map[*prometheus.Desc]float64{
+		domainCPUSecondsDesc:  float64(sample.CPUTimeNs) / 1e9,
+		domainBlockReadDesc:   float64(sample.BlockReadBytes),
+		domainBlockWriteDesc:  float64(sample.BlockWriteBytes),
+		domainNetReceiveDesc:  float64(sample.NetRxBytes),
+		domainNetTransmitDesc: float64(sample.NetTxBytes),
+	}
+	for desc, value := range counters {
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.CounterValue, value, hypervisor, sample.Name)
+	}
+}
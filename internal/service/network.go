@@ -0,0 +1,145 @@
+package service
+
+import (
+	"fmt"
+
+	"github.com/nnurry/harmonia/internal/builder"
+	"github.com/nnurry/harmonia/internal/connection"
+	"github.com/nnurry/harmonia/internal/contract"
+	"github.com/nnurry/harmonia/internal/logger"
+)
+
+type VirtualNetwork struct {
+	libvirtService LibvirtService
+}
+
+func NewVirtualNetwork(libvirtService LibvirtService) (*VirtualNetwork, error) {
+	return &VirtualNetwork{libvirtService: libvirtService}, nil
+}
+
+func NewVirtualNetworkFromHypervisorConnectionConfig(config *contract.HypervisorConnectionConfig) (*VirtualNetwork, error) {
+	if config == nil {
+		return nil, fmt.Errorf("missing hypervisor connection config")
+	}
+
+	conn, err := connection.NewLibvirt(config.LibvirtConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	libvirtService, err := NewLibvirt(conn)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewVirtualNetwork(libvirtService)
+}
+
+// networks that already exist are left untouched so fleets can share them
+func (service *VirtualNetwork) Create(config contract.VirtualNetworkConfig) (string, error) {
+	networkUuid, _, err := service.CreateOrReuse(config)
+	return networkUuid, err
+}
+
+// as Create, also telling whether the network was defined by this call
+func (service *VirtualNetwork) CreateOrReuse(config contract.VirtualNetworkConfig) (string, bool, error) {
+	if existingNetwork, err := service.libvirtService.GetNetworkByName(config.Name); err == nil {
+		logger.Infof("network %v already exists, skip defining it", config.Name)
+		networkUuid, err := existingNetwork.GetUUIDString()
+		return networkUuid, false, err
+	}
+
+	networkBuilder, err := builder.NewLibvirtNetworkBuilder(
+		[]*builder.NetworkBuilderFlag{builder.SET_NETWORK_NAME, builder.SET_NETWORK_IPV4_ADDRESS},
+		false,
+	)
+	if err != nil {
+		return "", false, err
+	}
+
+	networkBuilder = networkBuilder.
+		WithNetworkName(config.Name).
+		WithForwardMode(config.Mode, config.ForwardDevice).
+		WithIPv4Address(config.IPv4Address, config.IPv4Prefix)
+
+	if config.BridgeName != "" {
+		networkBuilder = networkBuilder.WithBridgeName(config.BridgeName)
+	}
+
+	if config.DHCPRangeStart != "" && config.DHCPRangeEnd != "" {
+		networkBuilder = networkBuilder.WithDHCPRange(config.DHCPRangeStart, config.DHCPRangeEnd)
+	}
+
+	if config.DomainName != "" {
+		networkBuilder = networkBuilder.WithDomainName(config.DomainName)
+	}
+
+	logger.Infof("defining network %v", config.Name)
+	network, err := service.libvirtService.DefineNetworkFromBuilder(networkBuilder)
+	if err != nil {
+		return "", false, err
+	}
+
+	// defined from here on, so it is ours to delete even if starting it fails
+	logger.Infof("starting network %v", config.Name)
+	if err = network.Create(); err != nil {
+		return "", true, fmt.Errorf("failed to start network %v: %v", config.Name, err)
+	}
+
+	if err = network.SetAutostart(config.Autostart); err != nil {
+		return "", true, fmt.Errorf("failed to set autostart of network %v: %v", config.Name, err)
+	}
+
+	networkUuid, err := network.GetUUIDString()
+	return networkUuid, true, err
+}
+
+func (service *VirtualNetwork) Delete(name string) (string, error) {
+	network, err := service.libvirtService.GetNetworkByName(name)
+	if err != nil {
+		return "", err
+	}
+
+	networkUuid, err := network.GetUUIDString()
+	if err != nil {
+		return "", err
+	}
+
+	logger.Infof("removing network %v", name)
+	return networkUuid, service.libvirtService.RemoveNetworkByName(name)
+}
+
+func (service *VirtualNetwork) List(includeInactive bool) ([]contract.VirtualNetworkSummary, error) {
+	networks, err := service.libvirtService.ListNetworks(includeInactive)
+	if err != nil {
+		return nil, err
+	}
+
+	summaries := []contract.VirtualNetworkSummary{}
+	for _, network := range networks {
+		summary := contract.VirtualNetworkSummary{}
+
+		if summary.Name, err = network.GetName(); err != nil {
+			return nil, fmt.Errorf("fail to get name of network: %v", err)
+		}
+		if summary.UUID, err = network.GetUUIDString(); err != nil {
+			return nil, fmt.Errorf("fail to get uuid of network %v: %v", summary.Name, err)
+		}
+		if summary.IsActive, err = network.IsActive(); err != nil {
+			return nil, fmt.Errorf("fail to get state of network %v: %v", summary.Name, err)
+		}
+		if summary.Autostart, err = network.GetAutostart(); err != nil {
+			return nil, fmt.Errorf("fail to get autostart of network %v: %v", summary.Name, err)
+		}
+		// isolated networks without a bridge just return an error here
+		summary.BridgeName, _ = network.GetBridgeName()
+
+		summaries = append(summaries, summary)
+	}
+
+	return summaries, nil
+}
+
+func (service *VirtualNetwork) Cleanup() error {
+	return service.libvirtService.Cleanup()
+}
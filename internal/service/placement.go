@@ -0,0 +1,304 @@
+package service
+
+import (
+	"fmt"
+
+	"github.com/nnurry/harmonia/internal/connection"
+	"github.com/nnurry/harmonia/internal/contract"
+	"github.com/nnurry/harmonia/internal/logger"
+	"github.com/nnurry/harmonia/internal/scheduler"
+)
+
+// looks up hypervisors known to harmonia by name, e.g. from the server config
+type HypervisorResolver func(name string) (*contract.HypervisorConnectionConfig, error)
+
+// admission policy of a hypervisor by name, whatever connection a request carries
+type AdmissionResolver func(name string) contract.AdmissionConfig
+
+type Placement struct {
+	resolver          HypervisorResolver
+	admissionResolver AdmissionResolver
+}
+
+func NewPlacement(resolver HypervisorResolver) *Placement {
+	return &Placement{resolver: resolver}
+}
+
+// replaces admission of every connection it resolves, so requests can't bring their own;
+// without it admission of the connections is kept
+func (service *Placement) WithAdmissionResolver(admissionResolver AdmissionResolver) *Placement {
+	service.admissionResolver = admissionResolver
+	return service
+}
+
+func (service *Placement) withAdmission(name string, connectionConfig contract.HypervisorConnectionConfig) contract.HypervisorConnectionConfig {
+	if service.admissionResolver != nil {
+		connectionConfig.Admission = service.admissionResolver(name)
+	}
+	return connectionConfig
+}
+
+func (service *Placement) withVirtualMachineAdmission(config contract.VirtualMachineConfig) contract.VirtualMachineConfig {
+	if config.HypervisorConnectionConfig != nil {
+		connectionConfig := service.withAdmission(config.Hypervisor, *config.HypervisorConnectionConfig)
+		config.HypervisorConnectionConfig = &connectionConfig
+	}
+	return config
+}
+
+// fills connection config of fleet hypervisors that are only referenced by name
+func (service *Placement) ResolveHypervisors(fleetConfig contract.VirtualMachineFleetConfig) ([]contract.FleetHypervisorConfig, error) {
+	hypervisors := []contract.FleetHypervisorConfig{}
+	seen := map[string]bool{}
+
+	for _, hypervisor := range fleetConfig.SharedConfig.Hypervisors {
+		if hypervisor.Name == "" {
+			return nil, fmt.Errorf("fleet hypervisor without name")
+		}
+		if seen[hypervisor.Name] {
+			return nil, fmt.Errorf("fleet hypervisor '%v' is listed twice", hypervisor.Name)
+		}
+		seen[hypervisor.Name] = true
+
+		if hypervisor.LibvirtConfig.ConnectionUrl == "" {
+			if service.resolver == nil {
+				return nil, fmt.Errorf("fleet hypervisor '%v' has no connection config", hypervisor.Name)
+			}
+			resolvedConfig, err := service.resolver(hypervisor.Name)
+			if err != nil {
+				return nil, err
+			}
+			hypervisor.HypervisorConnectionConfig = *resolvedConfig
+		}
+
+		hypervisor.HypervisorConnectionConfig = service.withAdmission(hypervisor.Name, hypervisor.HypervisorConnectionConfig)
+		hypervisors = append(hypervisors, hypervisor)
+	}
+
+	return hypervisors, nil
+}
+
+// resolves a single VM pinned by name (or the default hypervisor of the resolver
+// when unnamed), VMs with their own connection are left as is
+func (service *Placement) ResolveVirtualMachine(config contract.VirtualMachineConfig) (contract.VirtualMachineConfig, error) {
+	if config.HypervisorConnectionConfig != nil {
+		return service.withVirtualMachineAdmission(config), nil
+	}
+
+	if service.resolver == nil {
+		if config.Hypervisor == "" {
+			return config, nil
+		}
+		return config, fmt.Errorf("can't resolve hypervisor '%v' of %v", config.Hypervisor, config.Name)
+	}
+
+	resolvedConfig, err := service.resolver(config.Hypervisor)
+	if err != nil {
+		return config, err
+	}
+
+	config.HypervisorConnectionConfig = resolvedConfig
+	return service.withVirtualMachineAdmission(config), nil
+}
+
+// assigns a hypervisor to every VM of a coalesced fleet according to the scheduling policy
+func (service *Placement) Place(fleetConfig contract.VirtualMachineFleetConfig) (contract.VirtualMachineFleetConfig, error) {
+	if !fleetConfig.IsScheduled() {
+		return service.resolveUnscheduled(fleetConfig)
+	}
+
+	fleetScheduler, err := scheduler.New(fleetConfig.SharedConfig.Scheduling.Policy)
+	if err != nil {
+		return fleetConfig, err
+	}
+
+	hypervisors, err := service.ResolveHypervisors(fleetConfig)
+	if err != nil {
+		return fleetConfig, err
+	}
+
+	candidates := []scheduler.Candidate{}
+	for _, hypervisor := range hypervisors {
+		capacity, err := service.getCapacity(hypervisor)
+		if err != nil {
+			return fleetConfig, fmt.Errorf("could not get capacity of hypervisor '%v': %v", hypervisor.Name, err)
+		}
+		candidates = append(candidates, scheduler.Candidate{
+			Name:      hypervisor.Name,
+			Capacity:  *capacity,
+			Admission: hypervisor.Admission,
+		})
+	}
+
+	workloads := []scheduler.Workload{}
+	for _, vmConfig := range fleetConfig.VirtualMachineConfigs {
+		if vmConfig.HypervisorConnectionConfig != nil {
+			continue
+		}
+		workloads = append(workloads, scheduler.Workload{
+			Name:              vmConfig.Name,
+			NumOfVCPUs:        uint(vmConfig.NumOfVCPUs),
+			MemoryInKiB:       uint64(vmConfig.MemoryInGiB * 1024 * 1024),
+			Hypervisor:        vmConfig.Hypervisor,
+			AntiAffinityGroup: vmConfig.AntiAffinityGroup,
+		})
+	}
+
+	logger.Infof("scheduling %v VMs on %v hypervisors with policy %v", len(workloads), len(candidates), fleetScheduler.Policy())
+	placements, err := fleetScheduler.Schedule(workloads, candidates)
+	if err != nil {
+		return fleetConfig, err
+	}
+
+	hypervisorMap := map[string]contract.FleetHypervisorConfig{}
+	for _, hypervisor := range hypervisors {
+		hypervisorMap[hypervisor.Name] = hypervisor
+	}
+
+	placedConfigs := make([]contract.VirtualMachineConfig, len(fleetConfig.VirtualMachineConfigs))
+	for i, vmConfig := range fleetConfig.VirtualMachineConfigs {
+		if hypervisorName, ok := placements[vmConfig.Name]; ok {
+			hypervisorConnectionConfig := hypervisorMap[hypervisorName].HypervisorConnectionConfig
+			vmConfig.HypervisorConnectionConfig = &hypervisorConnectionConfig
+			vmConfig.Hypervisor = hypervisorName
+			logger.Infof("placed %v on hypervisor %v", vmConfig.Name, hypervisorName)
+		} else {
+			vmConfig = service.withVirtualMachineAdmission(vmConfig)
+		}
+		placedConfigs[i] = vmConfig
+	}
+
+	fleetConfig.VirtualMachineConfigs = placedConfigs
+	fleetConfig.VirtualNetworkConfigs = service.spreadNetworks(fleetConfig, hypervisors)
+	return fleetConfig, nil
+}
+
+// finds the hypervisor each VM of a scheduled fleet lives on, used to delete fleets
+func (service *Placement) Locate(fleetConfig contract.VirtualMachineFleetConfig) (contract.VirtualMachineFleetConfig, error) {
+	if !fleetConfig.IsScheduled() {
+		return service.resolveUnscheduled(fleetConfig)
+	}
+
+	hypervisors, err := service.ResolveHypervisors(fleetConfig)
+	if err != nil {
+		return fleetConfig, err
+	}
+
+	locations := map[string]contract.FleetHypervisorConfig{}
+	for _, hypervisor := range hypervisors {
+		domainNames, err := service.listDomainNames(hypervisor)
+		if err != nil {
+			logger.Warnf("could not list domains on hypervisor '%v': %v", hypervisor.Name, err)
+			continue
+		}
+		for _, domainName := range domainNames {
+			if _, ok := locations[domainName]; !ok {
+				locations[domainName] = hypervisor
+			}
+		}
+	}
+
+	locatedConfigs := make([]contract.VirtualMachineConfig, len(fleetConfig.VirtualMachineConfigs))
+	for i, vmConfig := range fleetConfig.VirtualMachineConfigs {
+		if vmConfig.HypervisorConnectionConfig == nil {
+			if hypervisor, ok := locations[vmConfig.Name]; ok {
+				hypervisorConnectionConfig := hypervisor.HypervisorConnectionConfig
+				vmConfig.HypervisorConnectionConfig = &hypervisorConnectionConfig
+				vmConfig.Hypervisor = hypervisor.Name
+			}
+		}
+		locatedConfigs[i] = vmConfig
+	}
+
+	fleetConfig.VirtualMachineConfigs = locatedConfigs
+	fleetConfig.VirtualNetworkConfigs = service.spreadNetworks(fleetConfig, hypervisors)
+	return fleetConfig, nil
+}
+
+// VMs and networks of fleets without hypervisor list go to their pinned or the default hypervisor
+func (service *Placement) resolveUnscheduled(fleetConfig contract.VirtualMachineFleetConfig) (contract.VirtualMachineFleetConfig, error) {
+	resolvedConfigs := make([]contract.VirtualMachineConfig, len(fleetConfig.VirtualMachineConfigs))
+	for i, vmConfig := range fleetConfig.VirtualMachineConfigs {
+		resolvedConfig, err := service.ResolveVirtualMachine(vmConfig)
+		if err != nil {
+			return fleetConfig, fmt.Errorf("could not resolve hypervisor of %v: %v", vmConfig.Name, err)
+		}
+		resolvedConfigs[i] = resolvedConfig
+	}
+
+	networkConfigs := make([]contract.VirtualNetworkConfig, len(fleetConfig.VirtualNetworkConfigs))
+	for i, networkConfig := range fleetConfig.VirtualNetworkConfigs {
+		if networkConfig.HypervisorConnectionConfig == nil && service.resolver != nil {
+			resolvedConfig, err := service.resolver("")
+			if err != nil {
+				return fleetConfig, fmt.Errorf("could not resolve hypervisor of network %v: %v", networkConfig.Name, err)
+			}
+			networkConfig.HypervisorConnectionConfig = resolvedConfig
+		}
+		networkConfigs[i] = networkConfig
+	}
+
+	fleetConfig.VirtualMachineConfigs = resolvedConfigs
+	fleetConfig.VirtualNetworkConfigs = networkConfigs
+	return fleetConfig, nil
+}
+
+// networks without their own connection are needed on every fleet hypervisor
+func (service *Placement) spreadNetworks(fleetConfig contract.VirtualMachineFleetConfig, hypervisors []contract.FleetHypervisorConfig) []contract.VirtualNetworkConfig {
+	networkConfigs := []contract.VirtualNetworkConfig{}
+	for _, networkConfig := range fleetConfig.VirtualNetworkConfigs {
+		if networkConfig.HypervisorConnectionConfig != nil {
+			networkConfigs = append(networkConfigs, networkConfig)
+			continue
+		}
+		for _, hypervisor := range hypervisors {
+			hypervisorConnectionConfig := hypervisor.HypervisorConnectionConfig
+			networkConfig.HypervisorConnectionConfig = &hypervisorConnectionConfig
+			networkConfigs = append(networkConfigs, networkConfig)
+		}
+	}
+	return networkConfigs
+}
+
+func (service *Placement) getCapacity(hypervisor contract.FleetHypervisorConfig) (*contract.HypervisorCapacity, error) {
+	conn, err := connection.NewLibvirt(hypervisor.LibvirtConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	libvirtService, err := NewLibvirt(conn)
+	if err != nil {
+		return nil, err
+	}
+	defer libvirtService.Cleanup()
+
+	return libvirtService.GetCapacity()
+}
+
+func (service *Placement) listDomainNames(hypervisor contract.FleetHypervisorConfig) ([]string, error) {
+	conn, err := connection.NewLibvirt(hypervisor.LibvirtConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	libvirtService, err := NewLibvirt(conn)
+	if err != nil {
+		return nil, err
+	}
+	defer libvirtService.Cleanup()
+
+	domains, err := libvirtService.ListDomains(true)
+	if err != nil {
+		return nil, err
+	}
+
+	domainNames := []string{}
+	for _, domain := range domains {
+		domainName, err := domain.GetName()
+		if err != nil {
+			return nil, err
+		}
+		domainNames = append(domainNames, domainName)
+	}
+	return domainNames, nil
+}
@@ -0,0 +1,239 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nnurry/harmonia/internal/connection"
+	"github.com/nnurry/harmonia/internal/contract"
+	"github.com/nnurry/harmonia/internal/logger"
+	"github.com/nnurry/harmonia/internal/metrics"
+	"github.com/nnurry/harmonia/internal/processor"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	DEFAULT_POST_PROVISION_READY_TIMEOUT = 5 * time.Minute
+	DEFAULT_POST_PROVISION_STEP_TIMEOUT  = 10 * time.Minute
+	DEFAULT_POST_PROVISION_SSH_PORT      = 22
+	POST_PROVISION_READY_POLL_INTERVAL   = 5 * time.Second
+	// of stdout and stderr each, the start of longer output is dropped
+	POST_PROVISION_OUTPUT_LIMIT = 64 * 1024
+)
+
+// SSH config to reach the guest as the user of the VM with the post-provision key,
+// accepting only the host key given to the guest upon create
+func guestSSHConfig(config contract.VirtualMachineConfig, address string) connection.SSHConfig {
+	sshConfig := connection.SSHConfig{
+		User:                config.UserVMConfig.User,
+		Host:                address,
+		Port:                config.PostProvision.Port,
+		HostKeyCallbackName: "FixedHostKey",
+	}
+	if sshConfig.Port < 1 {
+		sshConfig.Port = DEFAULT_POST_PROVISION_SSH_PORT
+	}
+	if hostKey, err := ssh.ParsePrivateKey([]byte(config.PostProvision.HostKey)); err == nil {
+		sshConfig.HostKey = string(ssh.MarshalAuthorizedKey(hostKey.PublicKey()))
+	}
+	sshConfig.PrivateKeyAuth.PrivateKeyPath = config.PostProvision.PrivateKeyPath
+	sshConfig.PrivateKeyAuth.PrivateKey = config.PostProvision.PrivateKey
+	sshConfig.PrivateKeyAuth.Passphrase = config.PostProvision.Passphrase
+	return sshConfig
+}
+
+// config with a new ed25519 host key for the guest when it is to be post-provisioned
+func withGuestHostKey(config contract.VirtualMachineConfig) (contract.VirtualMachineConfig, error) {
+	if config.PostProvision.HostKey != "" || !config.PostProvision.HasPrivateKey() {
+		return config, nil
+	}
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return config, fmt.Errorf("could not generate host key of %v: %v", config.GeneralVMConfig.Name, err)
+	}
+	block, err := ssh.MarshalPrivateKey(privateKey, config.GeneralVMConfig.Name)
+	if err != nil {
+		return config, fmt.Errorf("could not serialize host key of %v: %v", config.GeneralVMConfig.Name, err)
+	}
+	config.PostProvision.HostKey = string(pem.EncodeToMemory(block))
+	return config, nil
+}
+
+// authorized_keys line of the post-provision key, injected into the VM through cloud-init
+func postProvisionAuthorizedKey(config contract.VirtualMachineConfig) (string, error) {
+	signer, err := guestSSHConfig(config, "").ParsePrivateKey()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(ssh.MarshalAuthorizedKey(signer.PublicKey()))), nil
+}
+
+// static address of the first interface that has one, else what libvirt learned of the guest
+func (service *VirtualMachine) guestAddress(config contract.VirtualMachineConfig) (string, error) {
+	for _, networkInterface := range config.NetworkVMConfig.GetInterfaces() {
+		if networkInterface.IPv4Address != "" {
+			return networkInterface.IPv4Address, nil
+		}
+	}
+
+	domain, err := service.libvirtService.GetDomainByName(config.GeneralVMConfig.Name)
+	if err != nil {
+		return "", err
+	}
+	defer domain.Free()
+
+	domainState, _, err := domain.GetState()
+	if err != nil {
+		return "", fmt.Errorf("could not get state of %v: %v", config.GeneralVMConfig.Name, err)
+	}
+
+	addresses := getIPv4Addresses(domain, domainState)
+	if len(addresses) < 1 {
+		return "", fmt.Errorf("no address of %v known yet", config.GeneralVMConfig.Name)
+	}
+	return addresses[0], nil
+}
+
+func (service *VirtualMachine) connectGuest(config contract.VirtualMachineConfig) (*connection.SSH, error) {
+	address, err := service.guestAddress(config)
+	if err != nil {
+		return nil, err
+	}
+	return connection.NewSSH(guestSSHConfig(config, address))
+}
+
+// polls until the guest takes SSH with the post-provision key, then waits for cloud-init to finish;
+// cloud-init missing or reporting a degraded run is not a failure
+func (service *VirtualMachine) waitForGuest(config contract.VirtualMachineConfig) (*connection.SSH, error) {
+	timeout := DEFAULT_POST_PROVISION_READY_TIMEOUT
+	if config.PostProvision.ReadyTimeoutSeconds > 0 {
+		timeout = time.Duration(config.PostProvision.ReadyTimeoutSeconds) * time.Second
+	}
+	deadline := time.Now().Add(timeout)
+
+	logger.Infof("waiting up to %v for %v to take SSH", timeout, config.GeneralVMConfig.Name)
+	for {
+		guestConnection, err := service.connectGuest(config)
+		if err == nil {
+			remaining := max(int(time.Until(deadline).Seconds()), 1)
+			processor.NewSecureShell(guestConnection).Execute(
+				service.ctx,
+				io.Discard, io.Discard,
+				"timeout", strconv.Itoa(remaining), "cloud-init", "status", "--wait",
+			)
+			logger.Infof("%v is ready", config.GeneralVMConfig.Name)
+			return guestConnection, nil
+		}
+
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("%v not ready after %v: %v", config.GeneralVMConfig.Name, timeout, err)
+		}
+		time.Sleep(POST_PROVISION_READY_POLL_INTERVAL)
+	}
+}
+
+// waits for the VM to be ready then runs steps in it, a VM that never gets ready fails with a BootError
+func (service *VirtualMachine) PostProvision(config contract.VirtualMachineConfig, steps []contract.PostProvisionStep) ([]contract.PostProvisionStepResult, error) {
+	hypervisorLabel := config.HypervisorLabel()
+
+	stepStarted := time.Now()
+	guestConnection, err := service.waitForGuest(config)
+	metrics.ObserveStep(metrics.STEP_READY, hypervisorLabel, stepStarted, err)
+	if err != nil {
+		return nil, service.newBootError(service.consoleLogPath(config.GeneralVMConfig.Name), err)
+	}
+	defer guestConnection.Cleanup()
+
+	stepStarted = time.Now()
+	results, err := runPostProvisionSteps(service.ctx, processor.NewSecureShell(guestConnection), steps)
+	metrics.ObserveStep(metrics.STEP_POST_PROVISION, hypervisorLabel, stepStarted, err)
+	return results, err
+}
+
+// runs steps in order, stops at the first one failing all of its attempts
+func runPostProvisionSteps(ctx context.Context, guestShell ShellProcessor, steps []contract.PostProvisionStep) ([]contract.PostProvisionStepResult, error) {
+	results := []contract.PostProvisionStepResult{}
+	for i, step := range steps {
+		result, err := runPostProvisionStep(ctx, guestShell, i, step)
+		results = append(results, result)
+		if err != nil {
+			return results, fmt.Errorf("post-provision step %v failed: %v", result.Name, err)
+		}
+	}
+	return results, nil
+}
+
+func runPostProvisionStep(ctx context.Context, guestShell ShellProcessor, index int, step contract.PostProvisionStep) (contract.PostProvisionStepResult, error) {
+	result := contract.PostProvisionStepResult{Name: step.DisplayName(index)}
+	if err := step.Validate(); err != nil {
+		result.Error = err.Error()
+		return result, err
+	}
+
+	script := step.Script
+	if step.ScriptPath != "" {
+		content, err := os.ReadFile(step.ScriptPath)
+		if err != nil {
+			err = fmt.Errorf("could not read script '%v': %v", step.ScriptPath, err)
+			result.Error = err.Error()
+			return result, err
+		}
+		script = string(content)
+	}
+
+	timeout := DEFAULT_POST_PROVISION_STEP_TIMEOUT
+	if step.TimeoutSeconds > 0 {
+		timeout = time.Duration(step.TimeoutSeconds) * time.Second
+	}
+
+	var err error
+	for result.Attempts <= step.Retries {
+		if result.Attempts > 0 {
+			logger.Warnf("retrying post-provision step %v after %v", result.Name, err)
+			time.Sleep(time.Duration(step.RetryDelaySeconds) * time.Second)
+		}
+		result.Attempts++
+
+		stdoutBuffer := bytes.NewBuffer([]byte{})
+		stderrBuffer := bytes.NewBuffer([]byte{})
+		// the SSH session can't stop the script, timeout(1) in the guest does
+		err = guestShell.Execute(
+			ctx,
+			stdoutBuffer, stderrBuffer,
+			"timeout", strconv.Itoa(int(timeout.Seconds())), "sh", "-c", shellQuote(script),
+		)
+
+		var isStdoutTruncated, isStderrTruncated bool
+		result.Stdout, isStdoutTruncated = tailOutput(stdoutBuffer.String())
+		result.Stderr, isStderrTruncated = tailOutput(stderrBuffer.String())
+		result.IsTruncated = isStdoutTruncated || isStderrTruncated
+
+		if err == nil {
+			result.Error = ""
+			return result, nil
+		}
+		result.Error = err.Error()
+	}
+	return result, err
+}
+
+func tailOutput(output string) (string, bool) {
+	if len(output) <= POST_PROVISION_OUTPUT_LIMIT {
+		return output, false
+	}
+	return output[len(output)-POST_PROVISION_OUTPUT_LIMIT:], true
+}
+
+// single-quotes s for a POSIX shell
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,275 @@
+package service
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/nnurry/harmonia/internal/connection"
+	"github.com/nnurry/harmonia/internal/contract"
+	"libvirt.org/go/libvirt"
+)
+
+const DOMAIN_STATS_TYPES = libvirt.DOMAIN_STATS_STATE |
+	libvirt.DOMAIN_STATS_CPU_TOTAL |
+	libvirt.DOMAIN_STATS_BALLOON |
+	libvirt.DOMAIN_STATS_VCPU |
+	libvirt.DOMAIN_STATS_INTERFACE |
+	libvirt.DOMAIN_STATS_BLOCK
+
+const DEFAULT_STATS_INTERVAL = 1 * time.Second
+
+// samples every domain, or only the given ones
+func (service *Libvirt) GetDomainStats(domains ...*libvirt.Domain) ([]contract.DomainStatsSample, error) {
+	flags := libvirt.ConnectGetAllDomainStatsFlags(0)
+	if len(domains) == 0 {
+		flags = libvirt.CONNECT_GET_ALL_DOMAINS_STATS_ACTIVE | libvirt.CONNECT_GET_ALL_DOMAINS_STATS_INACTIVE
+	}
+
+	allStats, err := service.Connect().GetAllDomainStats(domains, DOMAIN_STATS_TYPES, flags)
+	if err != nil {
+		return nil, fmt.Errorf("could not get domain stats: %v", err)
+	}
+
+	now := time.Now().UnixNano()
+	samples := []contract.DomainStatsSample{}
+	for _, stats := range allStats {
+		sample, err := service.newDomainStatsSample(stats)
+		// domains passed in are owned by the caller
+		if len(domains) == 0 {
+			stats.Domain.Free()
+		}
+		if err != nil {
+			return nil, err
+		}
+		sample.Timestamp = now
+		samples = append(samples, *sample)
+	}
+	return samples, nil
+}
+
+func (service *Libvirt) newDomainStatsSample(stats libvirt.DomainStats) (*contract.DomainStatsSample, error) {
+	sample := &contract.DomainStatsSample{
+		Disks:      []contract.DiskStatsSample{},
+		Interfaces: []contract.InterfaceStatsSample{},
+	}
+
+	var err error
+	if sample.Name, err = stats.Domain.GetName(); err != nil {
+		return nil, fmt.Errorf("fail to get name of domain: %v", err)
+	}
+	if sample.UUID, err = stats.Domain.GetUUIDString(); err != nil {
+		return nil, fmt.Errorf("fail to get uuid of domain %v: %v", sample.Name, err)
+	}
+	// domains not created by harmonia simply have no fleet
+	if metadata, err := service.GetHarmoniaMetadata(stats.Domain); err == nil && metadata != nil {
+		sample.Fleet = metadata.Fleet
+	}
+
+	if stats.State != nil && stats.State.StateSet {
+		sample.State = DomainStateToString(stats.State.State)
+	}
+	if stats.Cpu != nil && stats.Cpu.TimeSet {
+		sample.CPUTimeNs = stats.Cpu.Time
+	}
+	if stats.Balloon != nil {
+		sample.MemoryCurrentKiB = stats.Balloon.Current
+		sample.MemoryMaximumKiB = stats.Balloon.Maximum
+	}
+	sample.VCPUs = uint(len(stats.Vcpu))
+	for _, block := range stats.Block {
+		sample.Disks = append(sample.Disks, contract.DiskStatsSample{
+			Name:          block.Name,
+			ReadBytes:     block.RdBytes,
+			WriteBytes:    block.WrBytes,
+			ReadRequests:  block.RdReqs,
+			WriteRequests: block.WrReqs,
+		})
+		sample.BlockReadBytes += block.RdBytes
+		sample.BlockWriteBytes += block.WrBytes
+	}
+	for _, net := range stats.Net {
+		sample.Interfaces = append(sample.Interfaces, contract.InterfaceStatsSample{
+			Name:      net.Name,
+			RxBytes:   net.RxBytes,
+			TxBytes:   net.TxBytes,
+			RxPackets: net.RxPkts,
+			TxPackets: net.TxPkts,
+		})
+		sample.NetRxBytes += net.RxBytes
+		sample.NetTxBytes += net.TxBytes
+	}
+	return sample, nil
+}
+
+// takes two samples interval apart and turns them into rates
+func (service *Libvirt) SampleDomainStats(interval time.Duration, domains ...*libvirt.Domain) ([]contract.DomainStats, error) {
+	if interval <= 0 {
+		interval = DEFAULT_STATS_INTERVAL
+	}
+
+	previous, err := service.GetDomainStats(domains...)
+	if err != nil {
+		return nil, err
+	}
+	time.Sleep(interval)
+	current, err := service.GetDomainStats(domains...)
+	if err != nil {
+		return nil, err
+	}
+
+	return ComputeAllDomainStats(previous, current), nil
+}
+
+// pairs samples by UUID, domains missing from previous get zero rates
+func ComputeAllDomainStats(previous []contract.DomainStatsSample, current []contract.DomainStatsSample) []contract.DomainStats {
+	previousByUUID := map[string]contract.DomainStatsSample{}
+	for _, sample := range previous {
+		previousByUUID[sample.UUID] = sample
+	}
+
+	allStats := []contract.DomainStats{}
+	for _, sample := range current {
+		previousSample, ok := previousByUUID[sample.UUID]
+		if !ok {
+			previousSample = sample
+		}
+		allStats = append(allStats, ComputeDomainStats(previousSample, sample))
+	}
+	return allStats
+}
+
+func ComputeDomainStats(previous contract.DomainStatsSample, current contract.DomainStatsSample) contract.DomainStats {
+	seconds := float64(current.Timestamp-previous.Timestamp) / float64(time.Second)
+	rate := func(previousValue uint64, currentValue uint64) float64 {
+		// counters restart along with the domain
+		if seconds <= 0 || currentValue < previousValue {
+			return 0
+		}
+		return float64(currentValue-previousValue) / seconds
+	}
+
+	stats := contract.DomainStats{
+		Name:             current.Name,
+		UUID:             current.UUID,
+		Fleet:            current.Fleet,
+		State:            current.State,
+		VCPUs:            current.VCPUs,
+		CPUTimeNs:        current.CPUTimeNs,
+		MemoryCurrentKiB: current.MemoryCurrentKiB,
+		MemoryMaximumKiB: current.MemoryMaximumKiB,
+		Disks:            []contract.DiskStats{},
+		Interfaces:       []contract.InterfaceStats{},
+		IntervalSeconds:  seconds,
+	}
+	if current.VCPUs > 0 {
+		cpuSecondsPerSecond := rate(previous.CPUTimeNs, current.CPUTimeNs) / float64(time.Second)
+		stats.CPUUtilisationPercent = cpuSecondsPerSecond / float64(current.VCPUs) * 100
+	}
+
+	previousDisks := map[string]contract.DiskStatsSample{}
+	for _, disk := range previous.Disks {
+		previousDisks[disk.Name] = disk
+	}
+	for _, disk := range current.Disks {
+		previousDisk, ok := previousDisks[disk.Name]
+		if !ok {
+			previousDisk = disk
+		}
+		diskStats := contract.DiskStats{
+			Name:                disk.Name,
+			ReadBytes:           disk.ReadBytes,
+			WriteBytes:          disk.WriteBytes,
+			ReadBytesPerSecond:  rate(previousDisk.ReadBytes, disk.ReadBytes),
+			WriteBytesPerSecond: rate(previousDisk.WriteBytes, disk.WriteBytes),
+			ReadIOPS:            rate(previousDisk.ReadRequests, disk.ReadRequests),
+			WriteIOPS:           rate(previousDisk.WriteRequests, disk.WriteRequests),
+		}
+		stats.ReadBytesPerSecond += diskStats.ReadBytesPerSecond
+		stats.WriteBytesPerSecond += diskStats.WriteBytesPerSecond
+		stats.IOPS += diskStats.ReadIOPS + diskStats.WriteIOPS
+		stats.Disks = append(stats.Disks, diskStats)
+	}
+
+	previousInterfaces := map[string]contract.InterfaceStatsSample{}
+	for _, networkInterface := range previous.Interfaces {
+		previousInterfaces[networkInterface.Name] = networkInterface
+	}
+	for _, networkInterface := range current.Interfaces {
+		previousInterface, ok := previousInterfaces[networkInterface.Name]
+		if !ok {
+			previousInterface = networkInterface
+		}
+		interfaceStats := contract.InterfaceStats{
+			Name:               networkInterface.Name,
+			RxBytes:            networkInterface.RxBytes,
+			TxBytes:            networkInterface.TxBytes,
+			RxBytesPerSecond:   rate(previousInterface.RxBytes, networkInterface.RxBytes),
+			TxBytesPerSecond:   rate(previousInterface.TxBytes, networkInterface.TxBytes),
+			RxPacketsPerSecond: rate(previousInterface.RxPackets, networkInterface.RxPackets),
+			TxPacketsPerSecond: rate(previousInterface.TxPackets, networkInterface.TxPackets),
+		}
+		stats.RxBytesPerSecond += interfaceStats.RxBytesPerSecond
+		stats.TxBytesPerSecond += interfaceStats.TxBytesPerSecond
+		stats.Interfaces = append(stats.Interfaces, interfaceStats)
+	}
+
+	return stats
+}
+
+// sums domain stats per fleet, domains without a fleet are left out
+func AggregateFleetStats(allStats []contract.DomainStats) []contract.FleetStats {
+	fleets := map[string]*contract.FleetStats{}
+	busiestCPU := map[string]float64{}
+
+	for _, stats := range allStats {
+		if stats.Fleet == "" {
+			continue
+		}
+		fleet, ok := fleets[stats.Fleet]
+		if !ok {
+			fleet = &contract.FleetStats{Fleet: stats.Fleet}
+			fleets[stats.Fleet] = fleet
+		}
+
+		cpuCoresUsed := stats.CPUUtilisationPercent / 100 * float64(stats.VCPUs)
+		fleet.Domains++
+		fleet.VCPUs += stats.VCPUs
+		fleet.CPUCoresUsed += cpuCoresUsed
+		fleet.MemoryCurrentKiB += stats.MemoryCurrentKiB
+		fleet.ReadBytesPerSecond += stats.ReadBytesPerSecond
+		fleet.WriteBytesPerSecond += stats.WriteBytesPerSecond
+		fleet.IOPS += stats.IOPS
+		fleet.RxBytesPerSecond += stats.RxBytesPerSecond
+		fleet.TxBytesPerSecond += stats.TxBytesPerSecond
+
+		if fleet.BusiestDomain == "" || cpuCoresUsed > busiestCPU[stats.Fleet] {
+			fleet.BusiestDomain = stats.Name
+			busiestCPU[stats.Fleet] = cpuCoresUsed
+		}
+	}
+
+	fleetStats := []contract.FleetStats{}
+	for _, fleet := range fleets {
+		fleetStats = append(fleetStats, *fleet)
+	}
+	sort.Slice(fleetStats, func(i, j int) bool {
+		return fleetStats[i].Fleet < fleetStats[j].Fleet
+	})
+	return fleetStats
+}
+
+// opens a short-lived connection to hypervisor and samples all of its domains
+func SampleHypervisorDomainStats(hypervisor contract.HypervisorConnectionConfig, interval time.Duration) ([]contract.DomainStats, error) {
+	conn, err := connection.NewLibvirt(hypervisor.LibvirtConfig)
+	if err != nil {
+		return nil, err
+	}
+	libvirtService, err := NewLibvirt(conn)
+	if err != nil {
+		return nil, err
+	}
+	defer libvirtService.Cleanup()
+
+	return libvirtService.SampleDomainStats(interval)
+}
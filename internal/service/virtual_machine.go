@@ -3,50 +3,122 @@ package service
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"os"
+	"path"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/nnurry/harmonia/internal/builder"
 	"github.com/nnurry/harmonia/internal/connection"
 	"github.com/nnurry/harmonia/internal/contract"
 	"github.com/nnurry/harmonia/internal/logger"
+	"github.com/nnurry/harmonia/internal/metrics"
 	"github.com/nnurry/harmonia/internal/processor"
-	"github.com/nnurry/harmonia/internal/service/cloudinit"
 	"github.com/nnurry/harmonia/pkg/utils"
 	"libvirt.org/go/libvirt"
 	"libvirt.org/go/libvirtxml"
 )
 
+// lines of the console log attached to a failure after the VM was started
+const BOOT_ERROR_CONSOLE_LOG_LINES = 50
+
+// read when the whole console log is asked for, from its end
+const MAX_CONSOLE_LOG_READ_BYTES = 1024 * 1024
+
+// a VM that failed after its domain was started, with what the guest printed by then
+type BootError struct {
+	Err        error
+	ConsoleLog string
+}
+
+func (err *BootError) Error() string {
+	return err.Err.Error()
+}
+
+func (err *BootError) Unwrap() error {
+	return err.Err
+}
+
+// console log carried by a BootError in err, empty otherwise
+func ConsoleLogOf(err error) string {
+	var bootErr *BootError
+	if errors.As(err, &bootErr) {
+		return bootErr.ConsoleLog
+	}
+	return ""
+}
+
 type VirtualMachine struct {
 	libvirtService        LibvirtService
-	cloudInitService      CloudInitService
+	guestProvisioner      GuestProvisioner
 	shellProcessor        ShellProcessor
 	revertCloudInitChange chan bool
+	warnings              []string
+	stateStore            StateStore
+	cloudInitDir          string
+	diskDir               string
+	consoleLogDir         string
+	ctx                   context.Context
+	sshConnection         *connection.SSH
 }
 
 func NewVirtualMachine(
 	libvirtService LibvirtService,
-	cloudInitService CloudInitService,
+	guestProvisioner GuestProvisioner,
 	shellProcessor ShellProcessor) (*VirtualMachine, error) {
 
 	return &VirtualMachine{
 		libvirtService:        libvirtService,
-		cloudInitService:      cloudInitService,
+		guestProvisioner:      guestProvisioner,
 		shellProcessor:        shellProcessor,
 		revertCloudInitChange: make(chan bool, 1),
+		cloudInitDir:          DEFAULT_CLOUD_INIT_BASE_PATH,
+		consoleLogDir:         DEFAULT_CONSOLE_LOG_BASE_PATH,
+		ctx:                   context.Background(),
 	}, nil
 
 }
 
+// records created VMs so Delete can clean up exactly what was created
+func (service *VirtualMachine) WithStateStore(stateStore StateStore) *VirtualMachine {
+	service.stateStore = stateStore
+	return service
+}
+
+// carries request scoped values (e.g. the audit recorder) to shell commands,
+// cancellation is dropped so a disconnecting client can't leave a VM half-created
+func (service *VirtualMachine) WithContext(ctx context.Context) *VirtualMachine {
+	service.ctx = context.WithoutCancel(ctx)
+	return service
+}
+
+// empty cloudInitDir and consoleLogDir keep the defaults, empty diskDir keeps disks next to the base VM disk
+func (service *VirtualMachine) WithPaths(cloudInitDir string, diskDir string, consoleLogDir string) *VirtualMachine {
+	if cloudInitDir != "" {
+		service.cloudInitDir = cloudInitDir
+	}
+	service.diskDir = diskDir
+	if consoleLogDir != "" {
+		service.consoleLogDir = consoleLogDir
+	}
+	return service
+}
+
 func NewVirtualMachineFromVirtualMachineConfig(config contract.VirtualMachineConfig) (*VirtualMachine, error) {
 	var (
 		sshConnection    *connection.SSH
 		shellProcessor   ShellProcessor
 		libvirtService   LibvirtService
-		cloudInitService CloudInitService
+		guestProvisioner GuestProvisioner
 	)
 
+	if config.HypervisorConnectionConfig == nil {
+		return nil, fmt.Errorf("missing hypervisor connection config of %v", config.GeneralVMConfig.Name)
+	}
+
 	if config.HypervisorConnectionConfig.IsLocalShell {
 		shellProcessor = processor.NewLocalShell()
 	} else {
@@ -60,6 +132,9 @@ func NewVirtualMachineFromVirtualMachineConfig(config contract.VirtualMachineCon
 
 	// create services
 	if conn, err := connection.NewLibvirt(config.HypervisorConnectionConfig.LibvirtConfig); err != nil {
+		if sshConnection != nil {
+			sshConnection.Cleanup()
+		}
 		return nil, err
 	} else {
 		libvirtService, err = NewLibvirt(conn)
@@ -68,75 +143,90 @@ func NewVirtualMachineFromVirtualMachineConfig(config contract.VirtualMachineCon
 		}
 	}
 
-	cloudInitService, err := NewCloudInit(shellProcessor, sshConnection)
+	guestProvisioner, err := NewGuestProvisioner(config.GetProvisioner(), shellProcessor, sshConnection)
 	if err != nil {
 		return nil, err
 	}
 
-	return NewVirtualMachine(libvirtService, cloudInitService, shellProcessor)
+	virtualMachineService, err := NewVirtualMachine(libvirtService, guestProvisioner, shellProcessor)
+	if err != nil {
+		return nil, err
+	}
+	virtualMachineService.sshConnection = sshConnection
+	return virtualMachineService, nil
 }
 
-func (service *VirtualMachine) Create(config contract.VirtualMachineConfig) (string, error) {
-	uniqueID := utils.GenerateUniqueTimestamp()
+// closes the connections opened by NewVirtualMachineFromVirtualMachineConfig
+func (service *VirtualMachine) Cleanup() error {
+	err := service.libvirtService.Cleanup()
+	if service.sshConnection != nil {
+		if sshErr := service.sshConnection.Cleanup(); sshErr != nil && err == nil {
+			err = sshErr
+		}
+	}
+	return err
+}
 
-	// make sure base VM already exists
-	baseDomain, err := service.libvirtService.GetDomainByName(config.GeneralVMConfig.BaseVirtualMachineName)
-	if err != nil {
-		return "", err
+// checks the VM against the hypervisor's capacity unless admission is off, only reject mode fails
+// when capacity can't be probed; the VM is held against the capacity until release is called,
+// after the domain is defined and started and shows up in the next probe
+func (service *VirtualMachine) admit(config contract.VirtualMachineConfig, diskPath string) (func(), error) {
+	admissionConfig := contract.AdmissionConfig{}
+	hypervisorKey := config.HypervisorLabel()
+	if config.HypervisorConnectionConfig != nil {
+		admissionConfig = config.HypervisorConnectionConfig.Admission
+		hypervisorKey = config.HypervisorConnectionConfig.LibvirtConfig.ConnectionUrl
+	}
+	admissionMode := admissionConfig.GetCoalesced().Mode
+	if admissionMode == contract.ADMISSION_MODE_OFF {
+		return func() {}, nil
 	}
 
-	// create cloud-init ISO
-	service.cloudInitService.SetMetaData(cloudinit.MetaData{
-		Hostname:   config.GeneralVMConfig.Name,
-		InstanceId: fmt.Sprintf("%v-%v", config.GeneralVMConfig.Name, uniqueID),
-	})
-	service.cloudInitService.SetUserData(cloudinit.UserData{
-		Hostname:       config.GeneralVMConfig.Name,
-		ManageEtcHosts: true,
-		DisableRootPw:  true,
-		Users: []cloudinit.User{{
-			Name:           config.UserVMConfig.User,
-			Sudo:           "ALL=(ALL) NOPASSWD:ALL",
-			AuthorizedKeys: config.AuthorizedKeyContents,
-		}},
-	})
-	service.cloudInitService.SetNetworkConfig(cloudinit.NetworkConfig{
-		Network: cloudinit.Network{
-			Version: 2,
-			Ethernets: cloudinit.Ethernet{
-				Eth0: cloudinit.Eth0{
-					Dhcp4:              false,
-					IPv4Addresses:      []string{fmt.Sprintf("%v/24", config.NetworkVMConfig.IPv4Address)},
-					IPv4GatewayAddress: config.NetworkVMConfig.IPv4GatewayAddress,
-					MacAddress:         config.NetworkVMConfig.MacAddress,
-					Nameservers:        cloudinit.Nameserver{Addresses: config.NetworkVMConfig.Nameservers},
-				},
-			},
-		},
-	})
+	request := AdmissionRequest{
+		NumOfVCPUs:    uint(config.GeneralVMConfig.NumOfVCPUs),
+		MemoryInKiB:   uint64(config.GeneralVMConfig.MemoryInGiB * 1024 * 1024),
+		DiskSizeInGiB: config.GeneralVMConfig.DiskSizeInGiB,
+		DiskPath:      diskPath,
+	}
 
-	cloudInitDir := fmt.Sprintf("/var/my-cloud-init/%v/%v", config.GeneralVMConfig.Name, uniqueID)
+	// probe, check and reserve in one go so parallel creates on the hypervisor see each other
+	ledger := getAdmissionLedger(hypervisorKey)
+	ledger.mutex.Lock()
+	defer ledger.mutex.Unlock()
 
-	logger.Info("creating cloud-init.iso")
-	cloudInitIsoPath, err := service.cloudInitService.WriteToDisk(context.Background(), cloudInitDir, "cloud-init.iso")
+	capacity, err := service.libvirtService.GetCapacity()
+	if err != nil && admissionMode == contract.ADMISSION_MODE_REJECT {
+		return nil, fmt.Errorf("could not get hypervisor capacity: %v", err)
+	}
 	if err != nil {
-		return "", err
+		logger.Warnf("admission of %v skipped, could not get hypervisor capacity: %v", config.GeneralVMConfig.Name, err)
+		service.warnings = append(service.warnings, fmt.Sprintf("admission skipped, could not get hypervisor capacity: %v", err))
+	} else {
+		warnings, err := CheckAdmission(ledger.withPending(capacity), admissionConfig, request)
+		if err != nil {
+			return nil, err
+		}
+		service.warnings = append(service.warnings, warnings...)
 	}
-	logger.Info("created cloud-init.iso")
-	defer service.CleanupUponFailure(cloudInitDir)
+	return ledger.reserve(request), nil
+}
 
-	// create VM
-	logger.Infof("creating libvirt domain from %v\n", config.GeneralVMConfig.BaseVirtualMachineName)
+func (service *VirtualMachine) Create(config contract.VirtualMachineConfig) (string, error) {
+	uniqueID := utils.GenerateUniqueTimestamp()
+
+	// make sure base VM already exists
+	baseDomain, err := service.libvirtService.GetDomainByName(config.GeneralVMConfig.BaseVirtualMachineName)
+	if err != nil {
+		return "", err
+	}
 
 	baseDomainXMLDesc, err := baseDomain.GetXMLDesc(libvirt.DOMAIN_XML_SECURE)
 	if err != nil {
-		service.revertCloudInitChange <- true
 		return "", err
 	}
 	baseDomainXML := &libvirtxml.Domain{}
 	err = baseDomainXML.Unmarshal(baseDomainXMLDesc)
 	if err != nil {
-		service.revertCloudInitChange <- true
 		return "", err
 	}
 
@@ -149,19 +239,80 @@ func (service *VirtualMachine) Create(config contract.VirtualMachineConfig) (str
 	}
 
 	if baseQCOW2Disk == nil {
-		service.revertCloudInitChange <- true
 		return "", fmt.Errorf("could not get QCOW2 disk from base VM %v", config.BaseVirtualMachineName)
 	}
 
 	baseQCOW2Path := baseQCOW2Disk.Source.File.File
 	baseQCOW2PathAsParts := strings.Split(baseQCOW2Path, "/")
 
+	diskDir := service.diskDir
+	if diskDir == "" {
+		diskDir = strings.Join(baseQCOW2PathAsParts[:len(baseQCOW2PathAsParts)-1], "/")
+	}
+
 	newQCOW2Path := fmt.Sprintf(
 		"%v/%v.qcow2",
-		strings.Join(baseQCOW2PathAsParts[:len(baseQCOW2PathAsParts)-1], "/"),
+		strings.TrimSuffix(diskDir, "/"),
 		config.GeneralVMConfig.Name,
 	)
-	if err = service.cloneDisk(baseQCOW2Path, newQCOW2Path, config.DiskSizeInGiB, config.IsCopyOnWriteClone); err != nil {
+
+	// make sure hypervisor can host the VM before touching anything
+	service.warnings = nil
+	releaseAdmission, err := service.admit(config, newQCOW2Path)
+	if err != nil {
+		return "", err
+	}
+	defer releaseAdmission()
+
+	authorizedKeys := config.AuthorizedKeyContents
+	if config.PostProvision.HasPrivateKey() {
+		authorizedKey, err := postProvisionAuthorizedKey(config)
+		if err != nil {
+			return "", fmt.Errorf("could not read post-provision key: %v", err)
+		}
+		authorizedKeys = append(append([]string{}, authorizedKeys...), authorizedKey)
+	}
+
+	networkInterfaces := config.NetworkVMConfig.GetInterfaces()
+	provisioningData := GuestProvisioningData{
+		Hostname:       config.GeneralVMConfig.Name,
+		InstanceID:     fmt.Sprintf("%v-%v", config.GeneralVMConfig.Name, uniqueID),
+		User:           config.UserVMConfig.User,
+		AuthorizedKeys: authorizedKeys,
+		Interfaces:     networkInterfaces,
+		Nameservers:    config.NetworkVMConfig.Nameservers,
+		Files:          config.UserVMConfig.Files,
+		HostKey:        config.PostProvision.HostKey,
+	}
+
+	cloudInitDir := fmt.Sprintf("%v/%v/%v", strings.TrimSuffix(service.cloudInitDir, "/"), config.GeneralVMConfig.Name, uniqueID)
+
+	hypervisorLabel := config.HypervisorLabel()
+
+	provisioner := config.GetProvisioner()
+	provisioningStep := metrics.STEP_CLOUD_INIT_ISO
+	if provisioner == contract.PROVISIONER_IGNITION {
+		provisioningStep = metrics.STEP_IGNITION_CONFIG
+	}
+
+	logger.Infof("creating %v data of guest", provisioner)
+	stepStarted := time.Now()
+	provisioningPath, err := service.guestProvisioner.Provision(service.ctx, cloudInitDir, provisioningData)
+	metrics.ObserveStep(provisioningStep, hypervisorLabel, stepStarted, err)
+	if err != nil {
+		return "", err
+	}
+	logger.Infof("created %v", provisioningPath)
+	service.warnings = append(service.warnings, service.guestProvisioner.Warnings()...)
+	defer service.CleanupUponFailure(cloudInitDir)
+
+	// create VM
+	logger.Infof("creating libvirt domain from %v\n", config.GeneralVMConfig.BaseVirtualMachineName)
+
+	stepStarted = time.Now()
+	err = service.cloneDisk(baseQCOW2Path, newQCOW2Path, config.DiskSizeInGiB, config.GetIsCopyOnWriteClone())
+	metrics.ObserveStep(metrics.STEP_DISK_CLONE, hypervisorLabel, stepStarted, err)
+	if err != nil {
 		service.revertCloudInitChange <- true
 		return "", err
 	}
@@ -177,28 +328,161 @@ func (service *VirtualMachine) Create(config contract.VirtualMachineConfig) (str
 		return "", err
 	}
 
+	// virtlogd won't create the directory of the console log
+	consoleLogPath := service.consoleLogPath(config.GeneralVMConfig.Name)
+	err = service.shellProcessor.Execute(service.ctx, os.Stdout, os.Stderr, "mkdir", "-p", path.Dir(consoleLogPath))
+	if err != nil {
+		service.revertCloudInitChange <- true
+		return "", fmt.Errorf("could not create console log directory: %v", err)
+	}
+
 	libvirtBuilder = libvirtBuilder.
 		WithDomainName(config.GeneralVMConfig.Name).
-		WithCiDiskPath(cloudInitIsoPath).
+		WithConsoleLogPath(consoleLogPath).
 		WithQcow2DiskPath(newQCOW2Path).
 		WithMemory(uint(config.GeneralVMConfig.MemoryInGiB*1024*1024), "KiB").
-		WithNumOfCpus(config.GeneralVMConfig.NumOfVCPUs).
-		WithMacAddress(config.NetworkVMConfig.MacAddress)
+		WithNumOfCpus(config.GeneralVMConfig.NumOfVCPUs)
+	libvirtBuilder = service.guestProvisioner.AttachTo(libvirtBuilder, provisioningPath)
 
+	// set by the VM or its instance type, else kept from the base VM
+	if config.GeneralVMConfig.CPUMode != "" {
+		libvirtBuilder = libvirtBuilder.WithCPUMode(config.GeneralVMConfig.CPUMode)
+	}
+	if config.GeneralVMConfig.DiskBus != "" {
+		libvirtBuilder = libvirtBuilder.WithDiskBus(config.GeneralVMConfig.DiskBus)
+	}
+
+	if len(config.NetworkVMConfig.Interfaces) > 0 {
+		domainInterfaces := []builder.DomainNetworkInterface{}
+		for _, networkInterface := range networkInterfaces {
+			model := networkInterface.Model
+			if model == "" {
+				model = config.GeneralVMConfig.NICModel
+			}
+			domainInterfaces = append(domainInterfaces, builder.DomainNetworkInterface{
+				Network:    networkInterface.Network,
+				Bridge:     networkInterface.Bridge,
+				MacAddress: networkInterface.MacAddress,
+				Model:      model,
+			})
+		}
+		libvirtBuilder = libvirtBuilder.WithNetworkInterfaces(domainInterfaces...)
+	} else {
+		libvirtBuilder = libvirtBuilder.WithMacAddress(config.NetworkVMConfig.MacAddress)
+		if config.GeneralVMConfig.NICModel != "" {
+			libvirtBuilder = libvirtBuilder.WithInterfaceModel(config.GeneralVMConfig.NICModel)
+		}
+	}
+
+	configHash, err := config.Hash()
+	if err != nil {
+		logger.Warnf("could not hash config of %v: %v", config.GeneralVMConfig.Name, err)
+	}
+	libvirtBuilder = libvirtBuilder.WithHarmoniaMetadata(contract.HarmoniaDomainMetadata{
+		Fleet:       config.GeneralVMConfig.Fleet,
+		CreatedAt:   time.Now().UTC().Format(time.RFC3339),
+		SourceImage: baseQCOW2Path,
+		BaseVM:      config.GeneralVMConfig.BaseVirtualMachineName,
+		ConfigHash:  configHash,
+		Labels:      config.GeneralVMConfig.Labels,
+	})
+
+	// reserve IP + hostname on libvirt-managed networks so DHCP'd guests get a stable address
+	reservedInterfaces := []contract.NetworkInterfaceConfig{}
+	for _, networkInterface := range networkInterfaces {
+		if networkInterface.Network == "" || networkInterface.MacAddress == "" || networkInterface.IPv4Address == "" {
+			continue
+		}
+		logger.Infof("reserving %v for %v on network %v", networkInterface.IPv4Address, config.GeneralVMConfig.Name, networkInterface.Network)
+		err = service.libvirtService.AddNetworkReservation(
+			networkInterface.Network,
+			networkInterface.MacAddress,
+			config.GeneralVMConfig.Name,
+			networkInterface.IPv4Address,
+		)
+		if err != nil {
+			service.removeNetworkReservations(config.GeneralVMConfig.Name, reservedInterfaces)
+			service.revertCloudInitChange <- true
+			return "", err
+		}
+		reservedInterfaces = append(reservedInterfaces, networkInterface)
+	}
+
+	stepStarted = time.Now()
 	newDomain, err := service.libvirtService.DefineDomainFromBuilder(libvirtBuilder)
+	metrics.ObserveStep(metrics.STEP_DEFINE, hypervisorLabel, stepStarted, err)
 	if err != nil {
+		service.removeNetworkReservations(config.GeneralVMConfig.Name, reservedInterfaces)
 		service.revertCloudInitChange <- true
 		return "", err
 	}
 	logger.Info("created libvirt domain")
+
+	// the log is appended to and outlives deleted VMs, one by the same name must not show up in ours
+	err = service.shellProcessor.Execute(service.ctx, os.Stdout, os.Stderr, "truncate", "--no-create", "--size", "0", consoleLogPath)
+	if err != nil {
+		logger.Warnf("could not truncate console log '%v' left by a previous VM: %v", consoleLogPath, err)
+	}
+
 	logger.Info("starting VM")
-	if err = newDomain.Create(); err != nil {
-		return "", fmt.Errorf("failed to start VM")
+	stepStarted = time.Now()
+	err = newDomain.Create()
+	metrics.ObserveStep(metrics.STEP_BOOT, hypervisorLabel, stepStarted, err)
+	if err != nil {
+		// the defined domain still uses the cloud-init ISO or Ignition config,
+		// the reservations go so a retry with the same MAC and IP doesn't collide
+		service.removeNetworkReservations(config.GeneralVMConfig.Name, reservedInterfaces)
+		service.revertCloudInitChange <- false
+		return "", service.newBootError(consoleLogPath, fmt.Errorf("failed to start VM: %v", err))
 	}
 	logger.Info("started VM")
 
 	service.revertCloudInitChange <- false
-	return newDomain.GetUUIDString()
+
+	domainUuid, err := newDomain.GetUUIDString()
+	if err != nil {
+		return "", err
+	}
+
+	if service.stateStore != nil {
+		record := contract.VirtualMachineRecord{
+			Name:           config.GeneralVMConfig.Name,
+			UUID:           domainUuid,
+			Fleet:          config.GeneralVMConfig.Fleet,
+			Hypervisor:     config.GeneralVMConfig.Hypervisor,
+			ConnectionUrl:  config.HypervisorConnectionConfig.LibvirtConfig.ConnectionUrl,
+			DiskPaths:      []string{newQCOW2Path},
+			CloudInitDir:   cloudInitDir,
+			ConsoleLogPath: consoleLogPath,
+			IPv4Addresses:  []string{},
+			MacAddresses:   []string{},
+			Config:         config.Redacted(),
+		}
+		if provisioner == contract.PROVISIONER_CLOUD_INIT {
+			record.DiskPaths = append(record.DiskPaths, provisioningPath)
+			record.CloudInitISOPath = provisioningPath
+		}
+		for _, networkInterface := range networkInterfaces {
+			if networkInterface.IPv4Address != "" {
+				record.IPv4Addresses = append(record.IPv4Addresses, networkInterface.IPv4Address)
+			}
+			if networkInterface.MacAddress != "" {
+				record.MacAddresses = append(record.MacAddresses, networkInterface.MacAddress)
+			}
+		}
+
+		if err = service.stateStore.PutVirtualMachine(record); err != nil {
+			logger.Warnf("could not record %v in state store: %v", config.GeneralVMConfig.Name, err)
+			service.warnings = append(service.warnings, fmt.Sprintf("not recorded in state store: %v", err))
+		}
+	}
+
+	return domainUuid, nil
+}
+
+// non-fatal issues (e.g. admission in warn mode) found by the last Create or Delete
+func (service *VirtualMachine) Warnings() []string {
+	return service.warnings
 }
 
 func (service *VirtualMachine) Delete(config contract.VirtualMachineConfig) (string, error) {
@@ -219,13 +503,48 @@ func (service *VirtualMachine) Delete(config contract.VirtualMachineConfig) (str
 		return "", err
 	}
 
-	disksToBeDeleted := []libvirtxml.DomainDisk{}
+	var (
+		record        *contract.VirtualMachineRecord
+		connectionUrl = config.HypervisorConnectionConfig.LibvirtConfig.ConnectionUrl
+	)
+	if service.stateStore != nil {
+		record, err = service.stateStore.GetVirtualMachine(connectionUrl, config.GeneralVMConfig.Name)
+		if err != nil {
+			logger.Warnf("could not read state of '%v', fall back to domain XML: %v", domainXML.Name, err)
+		}
+	}
+
+	diskPathsToBeDeleted := []string{}
+	pathsToBeDeleted := []string{}
 
-	// get QCOW2 + CI disk path
-	for _, disk := range domainXML.Devices.Disks {
-		if (disk.Device == "disk" && disk.Driver.Type == "qcow2") ||
-			(disk.Device == "cdrom" && disk.Driver.Type == "raw") {
-			disksToBeDeleted = append(disksToBeDeleted, disk)
+	if record != nil && record.UUID == domainXML.UUID {
+		logger.Infof("deleting what was recorded for '%v'", domainXML.Name)
+		diskPathsToBeDeleted = append(diskPathsToBeDeleted, record.DiskPaths...)
+		if record.CloudInitDir != "" {
+			pathsToBeDeleted = append(pathsToBeDeleted, record.CloudInitDir)
+		}
+	} else {
+		// get QCOW2 + CI disk path
+		for _, disk := range domainXML.Devices.Disks {
+			if disk.Source == nil || disk.Source.File == nil || disk.Driver == nil {
+				continue
+			}
+			if (disk.Device == "disk" && disk.Driver.Type == "qcow2") ||
+				(disk.Device == "cdrom" && disk.Driver.Type == "raw") {
+				diskPathsToBeDeleted = append(diskPathsToBeDeleted, disk.Source.File.File)
+			}
+		}
+	}
+
+	for _, domainInterface := range domainXML.Devices.Interfaces {
+		if domainInterface.Source == nil || domainInterface.Source.Network == nil || domainInterface.MAC == nil {
+			continue
+		}
+		networkName := domainInterface.Source.Network.Network
+		logger.Infof("removing reservation of '%v' on network '%v'", domainXML.Name, networkName)
+		err = service.libvirtService.RemoveNetworkReservation(networkName, domainInterface.MAC.Address, domainXML.Name)
+		if err != nil {
+			logger.Warnf("could not remove reservation of '%v' on network '%v': %v", domainXML.Name, networkName, err)
 		}
 	}
 
@@ -241,28 +560,118 @@ func (service *VirtualMachine) Delete(config contract.VirtualMachineConfig) (str
 		return domainXML.UUID, err
 	}
 
-	for _, disk := range disksToBeDeleted {
-		logger.Infof("deleting disk '%v'", disk.Source.File.File)
-		service.shellProcessor.Execute(
-			context.Background(),
-			os.Stdout, os.Stderr,
-			"rm",
-			"-f",
-			disk.Source.File.File,
-		)
+	// the domain is gone by now, leftovers are reported instead of failing the delete
+	service.warnings = nil
+	for _, diskPath := range diskPathsToBeDeleted {
+		logger.Infof("deleting disk '%v'", diskPath)
+		if err = service.removePath(diskPath); err != nil {
+			service.warnings = append(service.warnings, err.Error())
+		}
+	}
+
+	for _, pathToBeDeleted := range pathsToBeDeleted {
+		logger.Infof("deleting '%v'", pathToBeDeleted)
+		if err = service.removePath(pathToBeDeleted); err != nil {
+			service.warnings = append(service.warnings, err.Error())
+			continue
+		}
+
+		// <cloud_init_dir>/<vm name> only holds directories of its instances
+		parentPath := path.Dir(pathToBeDeleted)
+		if path.Base(parentPath) != domainXML.Name {
+			continue
+		}
+		stderrBuffer := bytes.NewBuffer([]byte{})
+		err = service.shellProcessor.Execute(service.ctx, os.Stdout, stderrBuffer, "rmdir", "--ignore-fail-on-non-empty", parentPath)
+		if err != nil {
+			logger.Warnf("could not remove '%v': %v", parentPath, strings.TrimSpace(stderrBuffer.String()))
+		}
+	}
+
+	if service.stateStore != nil {
+		// kept so what is left can still be found
+		if len(service.warnings) > 0 {
+			logger.Warnf("keeping '%v' in state store, some of its files are left: %v", domainXML.Name, strings.Join(service.warnings, "; "))
+		} else if err = service.stateStore.DeleteVirtualMachine(connectionUrl, domainXML.Name); err != nil {
+			logger.Warnf("could not remove '%v' from state store: %v", domainXML.Name, err)
+		}
 	}
 
 	return domainXML.UUID, nil
 }
 
+func (service *VirtualMachine) removePath(path string) error {
+	stderrBuffer := bytes.NewBuffer([]byte{})
+	err := service.shellProcessor.Execute(service.ctx, os.Stdout, stderrBuffer, "rm", "-rf", path)
+	if err != nil {
+		return fmt.Errorf("could not delete '%v': %v", path, strings.TrimSpace(stderrBuffer.String()))
+	}
+	return nil
+}
+
+func (service *VirtualMachine) consoleLogPath(name string) string {
+	return fmt.Sprintf("%v/%v/console.log", strings.TrimSuffix(service.consoleLogDir, "/"), name)
+}
+
+// last lines of what the VM printed to its serial console, its last MAX_CONSOLE_LOG_READ_BYTES if lines < 1;
+// the path recorded in the state store wins over the one of the current console log dir
+func (service *VirtualMachine) ReadConsoleLog(config contract.VirtualMachineConfig, lines int) (string, string, error) {
+	consoleLogPath := service.consoleLogPath(config.GeneralVMConfig.Name)
+	if service.stateStore != nil && config.HypervisorConnectionConfig != nil {
+		record, err := service.stateStore.GetVirtualMachine(config.HypervisorConnectionConfig.LibvirtConfig.ConnectionUrl, config.GeneralVMConfig.Name)
+		if err != nil {
+			logger.Warnf("could not read state of '%v', fall back to console log dir: %v", config.GeneralVMConfig.Name, err)
+		} else if record != nil && record.ConsoleLogPath != "" {
+			consoleLogPath = record.ConsoleLogPath
+		}
+	}
+
+	log, err := service.tailConsoleLog(consoleLogPath, lines)
+	return log, consoleLogPath, err
+}
+
+func (service *VirtualMachine) tailConsoleLog(consoleLogPath string, lines int) (string, error) {
+	command, arguments := "tail", []string{"-c", strconv.Itoa(MAX_CONSOLE_LOG_READ_BYTES), consoleLogPath}
+	if lines > 0 {
+		command, arguments = "tail", []string{"-n", strconv.Itoa(lines), consoleLogPath}
+	}
+
+	stdoutBuffer := bytes.NewBuffer([]byte{})
+	stderrBuffer := bytes.NewBuffer([]byte{})
+	err := service.shellProcessor.Execute(service.ctx, stdoutBuffer, stderrBuffer, command, arguments...)
+	if err != nil {
+		return "", fmt.Errorf("could not read console log '%v': %v", consoleLogPath, strings.TrimSpace(stderrBuffer.String()))
+	}
+	return stdoutBuffer.String(), nil
+}
+
+// err with the end of the console log, read on a best effort basis
+func (service *VirtualMachine) newBootError(consoleLogPath string, err error) error {
+	consoleLog, tailErr := service.tailConsoleLog(consoleLogPath, BOOT_ERROR_CONSOLE_LOG_LINES)
+	if tailErr != nil {
+		logger.Warnf("could not attach console log to failure: %v", tailErr)
+	}
+	return &BootError{Err: err, ConsoleLog: consoleLog}
+}
+
+// best effort, a leftover reservation is only logged
+func (service *VirtualMachine) removeNetworkReservations(name string, networkInterfaces []contract.NetworkInterfaceConfig) {
+	for _, networkInterface := range networkInterfaces {
+		err := service.libvirtService.RemoveNetworkReservation(networkInterface.Network, networkInterface.MacAddress, name)
+		if err != nil {
+			logger.Warnf("could not remove reservation of %v on network %v: %v", name, networkInterface.Network, err)
+		}
+	}
+}
+
 func (service *VirtualMachine) CleanupUponFailure(cloudInitDir string) error {
 	// revert cloud-init change
 	if <-service.revertCloudInitChange {
-		err := service.cloudInitService.RemoveFromDisk(context.Background(), cloudInitDir)
+		err := service.guestProvisioner.RemoveFromDisk(service.ctx, cloudInitDir)
 		if err != nil {
-			return fmt.Errorf("failed to remove cloud-init iso after failing to create VM: %v", err)
+			return fmt.Errorf("failed to remove provisioning data after failing to create VM: %v", err)
 		}
-		logger.Info("removed cloud-init iso after failing to create VM")
+		logger.Info("removed provisioning data after failing to create VM")
 	}
 	return nil
 }
@@ -292,7 +701,7 @@ func (service *VirtualMachine) cloneDisk(basePath, newPath string, diskSizeInGiB
 	stderrBuffer := bytes.NewBuffer([]byte{})
 
 	err := service.shellProcessor.Execute(
-		context.Background(),
+		service.ctx,
 		os.Stdout, stderrBuffer,
 		command, arguments...,
 	)
@@ -0,0 +1,193 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/nnurry/harmonia/internal/contract"
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	DEFAULT_STATE_PATH = "/var/lib/harmonia/state.db"
+
+	VIRTUAL_MACHINE_BUCKET = "virtual_machines"
+	NETWORK_BUCKET         = "networks"
+
+	LOCK_TIMEOUT = 5 * time.Second
+)
+
+// the database is opened per transaction so the API server and the CLI can share it
+type Store struct {
+	path string
+}
+
+func New(path string) (*Store, error) {
+	if path == "" {
+		path = DEFAULT_STATE_PATH
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), os.FileMode(0700)); err != nil {
+		return nil, fmt.Errorf("could not create state directory: %v", err)
+	}
+
+	store := &Store{path: path}
+
+	// make sure the file and buckets exist upfront
+	err := store.update(func(tx *bolt.Tx) error {
+		for _, bucket := range []string{VIRTUAL_MACHINE_BUCKET, NETWORK_BUCKET} {
+			if _, err := tx.CreateBucketIfNotExists([]byte(bucket)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not initialize state store '%v': %v", path, err)
+	}
+
+	return store, nil
+}
+
+func (store *Store) Path() string {
+	return store.path
+}
+
+func (store *Store) open(readOnly bool) (*bolt.DB, error) {
+	return bolt.Open(store.path, os.FileMode(0600), &bolt.Options{Timeout: LOCK_TIMEOUT, ReadOnly: readOnly})
+}
+
+func (store *Store) update(fn func(tx *bolt.Tx) error) error {
+	db, err := store.open(false)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	return db.Update(fn)
+}
+
+func (store *Store) view(fn func(tx *bolt.Tx) error) error {
+	db, err := store.open(true)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	return db.View(fn)
+}
+
+// VM and network names are only unique per hypervisor
+func virtualMachineKey(connectionUrl string, name string) []byte {
+	return []byte(fmt.Sprintf("%v|%v", connectionUrl, name))
+}
+
+func (store *Store) PutVirtualMachine(record contract.VirtualMachineRecord) error {
+	now := time.Now().UTC()
+	if record.CreatedAt.IsZero() {
+		record.CreatedAt = now
+	}
+	record.UpdatedAt = now
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("could not serialize record of %v: %v", record.Name, err)
+	}
+
+	return store.update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(VIRTUAL_MACHINE_BUCKET))
+		return bucket.Put(virtualMachineKey(record.ConnectionUrl, record.Name), data)
+	})
+}
+
+func (store *Store) GetVirtualMachine(connectionUrl string, name string) (*contract.VirtualMachineRecord, error) {
+	var record *contract.VirtualMachineRecord
+
+	err := store.view(func(tx *bolt.Tx) error {
+		data := tx.Bucket([]byte(VIRTUAL_MACHINE_BUCKET)).Get(virtualMachineKey(connectionUrl, name))
+		if data == nil {
+			return nil
+		}
+		record = &contract.VirtualMachineRecord{}
+		return json.Unmarshal(data, record)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return record, nil
+}
+
+func (store *Store) DeleteVirtualMachine(connectionUrl string, name string) error {
+	return store.update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(VIRTUAL_MACHINE_BUCKET)).Delete(virtualMachineKey(connectionUrl, name))
+	})
+}
+
+// empty filter fields match everything
+func (store *Store) ListVirtualMachines(filter contract.VirtualMachineRecordFilter) ([]contract.VirtualMachineRecord, error) {
+	records := []contract.VirtualMachineRecord{}
+
+	err := store.view(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(VIRTUAL_MACHINE_BUCKET)).ForEach(func(_, data []byte) error {
+			record := contract.VirtualMachineRecord{}
+			if err := json.Unmarshal(data, &record); err != nil {
+				return err
+			}
+			if filter.Match(record) {
+				records = append(records, record)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].CreatedAt.Before(records[j].CreatedAt)
+	})
+
+	return records, nil
+}
+
+func (store *Store) PutNetwork(record contract.NetworkRecord) error {
+	if record.CreatedAt.IsZero() {
+		record.CreatedAt = time.Now().UTC()
+	}
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("could not serialize record of network %v: %v", record.Name, err)
+	}
+
+	return store.update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(NETWORK_BUCKET)).Put(virtualMachineKey(record.ConnectionUrl, record.Name), data)
+	})
+}
+
+func (store *Store) GetNetwork(connectionUrl string, name string) (*contract.NetworkRecord, error) {
+	var record *contract.NetworkRecord
+
+	err := store.view(func(tx *bolt.Tx) error {
+		data := tx.Bucket([]byte(NETWORK_BUCKET)).Get(virtualMachineKey(connectionUrl, name))
+		if data == nil {
+			return nil
+		}
+		record = &contract.NetworkRecord{}
+		return json.Unmarshal(data, record)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return record, nil
+}
+
+func (store *Store) DeleteNetwork(connectionUrl string, name string) error {
+	return store.update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(NETWORK_BUCKET)).Delete(virtualMachineKey(connectionUrl, name))
+	})
+}
@@ -0,0 +1,187 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+const API_PREFIX = "/api/v1"
+
+// what the API answers with when a request fails, Body holds the raw response body
+type APIError struct {
+	StatusCode int
+	Message    string
+	Body       json.RawMessage
+}
+
+func (err *APIError) Error() string {
+	var detail string
+	if json.Unmarshal(err.Body, &detail) != nil {
+		// result bodies carry the reason in their error field, rejected requests a list of errors
+		var result struct {
+			Error  string   `json:"error"`
+			Errors []string `json:"errors"`
+		}
+		json.Unmarshal(err.Body, &result)
+		detail = result.Error
+		if detail == "" {
+			detail = strings.Join(result.Errors, "; ")
+		}
+	}
+	if detail == "" {
+		return fmt.Sprintf("%v (status %v)", err.Message, err.StatusCode)
+	}
+	return fmt.Sprintf("%v: %v (status %v)", err.Message, detail, err.StatusCode)
+}
+
+type response struct {
+	Body    json.RawMessage `json:"body"`
+	Message string          `json:"message"`
+}
+
+// talks to a harmonia API server, safe for concurrent use
+type Client struct {
+	serverURL  *url.URL
+	token      string
+	httpClient *http.Client
+}
+
+// serverURL is the base of the server, e.g. https://harmonia:8080
+func New(serverURL string) (*Client, error) {
+	parsedURL, err := url.Parse(strings.TrimSuffix(serverURL, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("could not parse server URL '%v': %v", serverURL, err)
+	}
+	if parsedURL.Scheme != "http" && parsedURL.Scheme != "https" {
+		return nil, fmt.Errorf("server URL '%v' must start with http:// or https://", serverURL)
+	}
+
+	return &Client{
+		serverURL:  parsedURL,
+		httpClient: &http.Client{},
+	}, nil
+}
+
+// bearer token sent with every request
+func (client *Client) WithToken(token string) *Client {
+	client.token = token
+	return client
+}
+
+func (client *Client) WithHTTPClient(httpClient *http.Client) *Client {
+	client.httpClient = httpClient
+	return client
+}
+
+func (client *Client) WithTLSConfig(tlsConfig *tls.Config) *Client {
+	client.httpClient.Transport = &http.Transport{
+		Proxy:           http.ProxyFromEnvironment,
+		TLSClientConfig: tlsConfig,
+	}
+	return client
+}
+
+// caFile verifies the server, certFile and keyFile are the client certificate for mTLS, all optional
+func NewTLSConfig(caFile string, certFile string, keyFile string) (*tls.Config, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if caFile != "" {
+		caPEM, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not read CA file '%v': %v", caFile, err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return nil, fmt.Errorf("no certificate found in CA file '%v'", caFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if certFile != "" || keyFile != "" {
+		certificate, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("could not load client certificate: %v", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+	}
+
+	return tlsConfig, nil
+}
+
+// sends requestBody as JSON (if any), returns the status code and raw body of the response
+func (client *Client) send(ctx context.Context, method string, path string, query url.Values, requestBody any) (int, []byte, error) {
+	requestURL := *client.serverURL
+	requestURL.Path += API_PREFIX + path
+	requestURL.RawQuery = query.Encode()
+
+	var bodyReader io.Reader
+	if requestBody != nil {
+		data, err := json.Marshal(requestBody)
+		if err != nil {
+			return 0, nil, fmt.Errorf("could not serialize request: %v", err)
+		}
+		bodyReader = bytes.NewReader(data)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, method, requestURL.String(), bodyReader)
+	if err != nil {
+		return 0, nil, fmt.Errorf("could not build request: %v", err)
+	}
+	if requestBody != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+	if client.token != "" {
+		request.Header.Set("Authorization", "Bearer "+client.token)
+	}
+
+	httpResponse, err := client.httpClient.Do(request)
+	if err != nil {
+		return 0, nil, fmt.Errorf("could not reach harmonia API: %v", err)
+	}
+	defer httpResponse.Body.Close()
+
+	data, err := io.ReadAll(httpResponse.Body)
+	if err != nil {
+		return 0, nil, fmt.Errorf("could not read response: %v", err)
+	}
+	return httpResponse.StatusCode, data, nil
+}
+
+// as send, then decodes the body of the response into result (if any);
+// on failure result is still filled when the API returned one, e.g. a result with its error field
+func (client *Client) do(ctx context.Context, method string, path string, query url.Values, requestBody any, result any) error {
+	statusCode, data, err := client.send(ctx, method, path, query, requestBody)
+	if err != nil {
+		return err
+	}
+
+	var apiResponse response
+	if err = json.Unmarshal(data, &apiResponse); err != nil {
+		if statusCode >= 400 {
+			return &APIError{StatusCode: statusCode, Message: strings.TrimSpace(string(data))}
+		}
+		return fmt.Errorf("could not parse response: %v", err)
+	}
+
+	var decodeErr error
+	if result != nil && len(apiResponse.Body) > 0 {
+		decodeErr = json.Unmarshal(apiResponse.Body, result)
+	}
+
+	if statusCode >= 400 {
+		return &APIError{StatusCode: statusCode, Message: apiResponse.Message, Body: apiResponse.Body}
+	}
+	if decodeErr != nil {
+		return fmt.Errorf("could not parse response body: %v", decodeErr)
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/gorilla/websocket"
+	"github.com/nnurry/harmonia/internal/console"
+)
+
+// attaches to the serial console of a running VM, empty hypervisor is the default one of the server;
+// isForce takes the console over from whoever holds it, closing detaches
+func (client *Client) OpenConsole(ctx context.Context, name string, hypervisor string, isForce bool) (io.ReadWriteCloser, error) {
+	consoleURL := *client.serverURL
+	consoleURL.Scheme = "ws"
+	if client.serverURL.Scheme == "https" {
+		consoleURL.Scheme = "wss"
+	}
+	consoleURL.Path += API_PREFIX + "/virtual-machines/" + url.PathEscape(name) + "/console"
+
+	query := url.Values{}
+	if hypervisor != "" {
+		query.Set("hypervisor", hypervisor)
+	}
+	if isForce {
+		query.Set("force", "true")
+	}
+	consoleURL.RawQuery = query.Encode()
+
+	dialer := &websocket.Dialer{
+		Proxy:        http.ProxyFromEnvironment,
+		Subprotocols: []string{console.SUBPROTOCOL},
+	}
+	if transport, ok := client.httpClient.Transport.(*http.Transport); ok {
+		dialer.TLSClientConfig = transport.TLSClientConfig
+	}
+
+	header := http.Header{}
+	if client.token != "" {
+		header.Set("Authorization", "Bearer "+client.token)
+	}
+
+	conn, httpResponse, err := dialer.DialContext(ctx, consoleURL.String(), header)
+	if err != nil {
+		if httpResponse == nil {
+			return nil, fmt.Errorf("could not reach harmonia API: %v", err)
+		}
+		defer httpResponse.Body.Close()
+
+		var apiResponse response
+		data, _ := io.ReadAll(httpResponse.Body)
+		if json.Unmarshal(data, &apiResponse) != nil {
+			apiResponse.Message = err.Error()
+		}
+		return nil, &APIError{StatusCode: httpResponse.StatusCode, Message: apiResponse.Message, Body: apiResponse.Body}
+	}
+
+	return console.NewWebSocketStream(conn), nil
+}
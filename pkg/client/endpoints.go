@@ -0,0 +1,195 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func statsQuery(hypervisor string, fleet string, interval time.Duration) url.Values {
+	query := url.Values{}
+	if hypervisor != "" {
+		query.Set("hypervisor", hypervisor)
+	}
+	if fleet != "" {
+		query.Set("fleet", fleet)
+	}
+	if interval > 0 {
+		query.Set("interval", interval.String())
+	}
+	return query
+}
+
+func (client *Client) CreateVirtualMachine(ctx context.Context, request CreateVirtualMachineRequest) (CreateVirtualMachineResult, error) {
+	var result CreateVirtualMachineResult
+	err := client.do(ctx, http.MethodPost, "/virtual-machine/create", nil, request, &result)
+	return result, err
+}
+
+func (client *Client) DeleteVirtualMachine(ctx context.Context, request DeleteVirtualMachineRequest) (DeleteVirtualMachineResult, error) {
+	var result DeleteVirtualMachineResult
+	err := client.do(ctx, http.MethodPost, "/virtual-machine/delete", nil, request, &result)
+	return result, err
+}
+
+func (client *Client) StartVirtualMachine(ctx context.Context, request VirtualMachinePowerRequest) (VirtualMachinePowerResult, error) {
+	var result VirtualMachinePowerResult
+	err := client.do(ctx, http.MethodPost, "/virtual-machine/start", nil, request, &result)
+	return result, err
+}
+
+func (client *Client) StopVirtualMachine(ctx context.Context, request VirtualMachinePowerRequest) (VirtualMachinePowerResult, error) {
+	var result VirtualMachinePowerResult
+	err := client.do(ctx, http.MethodPost, "/virtual-machine/stop", nil, request, &result)
+	return result, err
+}
+
+// last lines of the serial console log of a VM, 0 lines for all of it
+func (client *Client) ConsoleLog(ctx context.Context, name string, hypervisor string, lines int) (ConsoleLogResult, error) {
+	query := hypervisorQuery(hypervisor)
+	query.Set("tail", strconv.Itoa(lines))
+
+	var result ConsoleLogResult
+	err := client.do(ctx, http.MethodGet, "/virtual-machines/"+url.PathEscape(name)+"/console-log", query, nil, &result)
+	return result, err
+}
+
+func hypervisorQuery(hypervisor string) url.Values {
+	query := url.Values{}
+	if hypervisor != "" {
+		query.Set("hypervisor", hypervisor)
+	}
+	return query
+}
+
+// addresses reported by qemu-guest-agent of a running VM
+func (client *Client) GuestInterfaces(ctx context.Context, name string, hypervisor string) (GuestInterfacesResult, error) {
+	var result GuestInterfacesResult
+	err := client.do(ctx, http.MethodGet, "/virtual-machines/"+url.PathEscape(name)+"/interfaces", hypervisorQuery(hypervisor), nil, &result)
+	return result, err
+}
+
+// waits for the command to exit, a non-zero exit code is not an error
+func (client *Client) GuestExec(ctx context.Context, name string, hypervisor string, request GuestExecRequest) (GuestExecResult, error) {
+	var result GuestExecResult
+	err := client.do(ctx, http.MethodPost, "/virtual-machines/"+url.PathEscape(name)+"/exec", hypervisorQuery(hypervisor), request, &result)
+	return result, err
+}
+
+func (client *Client) GuestWriteFile(ctx context.Context, name string, hypervisor string, request GuestFileWriteRequest) (GuestFileWriteResult, error) {
+	var result GuestFileWriteResult
+	err := client.do(ctx, http.MethodPost, "/virtual-machines/"+url.PathEscape(name)+"/files", hypervisorQuery(hypervisor), request, &result)
+	return result, err
+}
+
+func (client *Client) ListVirtualMachines(ctx context.Context, request ListDomainsRequest) (ListDomainsResult, error) {
+	var result ListDomainsResult
+	err := client.do(ctx, http.MethodPost, "/virtual-machine/list", nil, request, &result)
+	return result, err
+}
+
+// partial failures are not an error, see Failed and the error of every sub result
+func (client *Client) CreateFleet(ctx context.Context, request CreateVirtualMachineFleetRequest) (CreateVirtualMachineFleetResult, error) {
+	var result CreateVirtualMachineFleetResult
+	err := client.do(ctx, http.MethodPost, "/virtual-machine/create/fleet", nil, request, &result)
+	return result, err
+}
+
+// partial failures are not an error, see Failed and the error of every sub result
+func (client *Client) DeleteFleet(ctx context.Context, request DeleteVirtualMachineFleetRequest) (DeleteVirtualMachineFleetResult, error) {
+	var result DeleteVirtualMachineFleetResult
+	err := client.do(ctx, http.MethodPost, "/virtual-machine/delete/fleet", nil, request, &result)
+	return result, err
+}
+
+func (client *Client) CreateNetwork(ctx context.Context, request CreateVirtualNetworkRequest) (CreateVirtualNetworkResult, error) {
+	var result CreateVirtualNetworkResult
+	err := client.do(ctx, http.MethodPost, "/virtual-network/create", nil, request, &result)
+	return result, err
+}
+
+func (client *Client) DeleteNetwork(ctx context.Context, request DeleteVirtualNetworkRequest) (DeleteVirtualNetworkResult, error) {
+	var result DeleteVirtualNetworkResult
+	err := client.do(ctx, http.MethodPost, "/virtual-network/delete", nil, request, &result)
+	return result, err
+}
+
+func (client *Client) ListNetworks(ctx context.Context, request ListVirtualNetworksRequest) (ListVirtualNetworksResult, error) {
+	var result ListVirtualNetworksResult
+	err := client.do(ctx, http.MethodPost, "/virtual-network/list", nil, request, &result)
+	return result, err
+}
+
+// name as defined in the server config
+func (client *Client) HypervisorCapacity(ctx context.Context, name string) (HypervisorCapacity, error) {
+	var result HypervisorCapacity
+	err := client.do(ctx, http.MethodGet, "/hypervisors/"+url.PathEscape(name)+"/capacity", nil, nil, &result)
+	return result, err
+}
+
+func (client *Client) ListVirtualMachineRecords(ctx context.Context, filter VirtualMachineRecordFilter) (ListVirtualMachineRecordsResult, error) {
+	query := url.Values{}
+	if filter.Fleet != "" {
+		query.Set("fleet", filter.Fleet)
+	}
+	if filter.Hypervisor != "" {
+		query.Set("hypervisor", filter.Hypervisor)
+	}
+
+	var result ListVirtualMachineRecordsResult
+	path := "/state/virtual-machines"
+	if filter.Name != "" {
+		path += "/" + url.PathEscape(filter.Name)
+	}
+	err := client.do(ctx, http.MethodGet, path, query, nil, &result)
+	return result, err
+}
+
+// samples one VM over interval, empty hypervisor is the default one of the server
+func (client *Client) VirtualMachineStats(ctx context.Context, name string, hypervisor string, interval time.Duration) (DomainStats, error) {
+	var result DomainStats
+	err := client.do(ctx, http.MethodGet, "/virtual-machines/"+url.PathEscape(name)+"/stats", statsQuery(hypervisor, "", interval), nil, &result)
+	return result, err
+}
+
+// samples every VM over interval, empty hypervisor is all of them, empty fleet is every fleet
+func (client *Client) ListVirtualMachineStats(ctx context.Context, hypervisor string, fleet string, interval time.Duration) (VirtualMachineStatsResult, error) {
+	var result VirtualMachineStatsResult
+	err := client.do(ctx, http.MethodGet, "/virtual-machines/stats", statsQuery(hypervisor, fleet, interval), nil, &result)
+	return result, err
+}
+
+// hosts of a fleet as the API builds them, inventory formats are rendered by the caller
+func (client *Client) FleetInventory(ctx context.Context, fleet string) (FleetInventory, error) {
+	query := url.Values{}
+	query.Set("format", "json")
+
+	var result FleetInventory
+	err := client.do(ctx, http.MethodGet, "/fleets/"+url.PathEscape(fleet)+"/inventory", query, nil, &result)
+	return result, err
+}
+
+// a request the way the API would act on it in format json or yaml, or the JSON Schema of
+// the contract in format json-schema, for which request may be nil
+func (client *Client) Format(ctx context.Context, contractName string, outputFormat string, request any) ([]byte, error) {
+	query := url.Values{}
+	query.Set("contract", contractName)
+	query.Set("format", outputFormat)
+
+	statusCode, data, err := client.send(ctx, http.MethodPost, "/virtual-machine/format", query, request)
+	if err != nil {
+		return nil, err
+	}
+	if statusCode >= 400 {
+		var apiResponse response
+		if json.Unmarshal(data, &apiResponse) != nil {
+			return nil, &APIError{StatusCode: statusCode, Message: strings.TrimSpace(string(data))}
+		}
+		return nil, &APIError{StatusCode: statusCode, Message: apiResponse.Message, Body: apiResponse.Body}
+	}
+	return data, nil
+}
@@ -0,0 +1,89 @@
+package client
+
+import (
+	"github.com/nnurry/harmonia/internal/connconfig"
+	"github.com/nnurry/harmonia/internal/contract"
+)
+
+// the contract types the API speaks, aliased so tooling outside this module can build requests
+
+type (
+	HypervisorConnectionConfig = contract.HypervisorConnectionConfig
+	LibvirtConfig              = connconfig.LibvirtConfig
+	SSHConfig                  = connconfig.SSHConfig
+	AdmissionConfig            = contract.AdmissionConfig
+
+	VirtualMachineConfig   = contract.VirtualMachineConfig
+	GeneralVMConfig        = contract.GeneralVMConfig
+	UserVMConfig           = contract.UserVMConfig
+	NetworkVMConfig        = contract.NetworkVMConfig
+	NetworkInterfaceConfig = contract.NetworkInterfaceConfig
+	InstanceType           = contract.InstanceType
+	GuestFileConfig        = contract.GuestFileConfig
+
+	CreateVirtualMachineRequest = contract.CreateVirtualMachineRequest
+	CreateVirtualMachineResult  = contract.CreateVirtualMachineResult
+	DeleteVirtualMachineRequest = contract.DeleteVirtualMachineRequest
+	DeleteVirtualMachineResult  = contract.DeleteVirtualMachineResult
+	VirtualMachinePowerRequest  = contract.VirtualMachinePowerRequest
+	VirtualMachinePowerResult   = contract.VirtualMachinePowerResult
+	ConsoleLogResult            = contract.ConsoleLogResult
+
+	PostProvisionConfig      = contract.PostProvisionConfig
+	PostProvisionStep        = contract.PostProvisionStep
+	PostProvisionStepResult  = contract.PostProvisionStepResult
+	FleetPostProvisionHook   = contract.FleetPostProvisionHook
+	FleetHookTarget          = contract.FleetHookTarget
+	FleetPostProvisionResult = contract.FleetPostProvisionResult
+
+	GuestInterface        = contract.GuestInterface
+	GuestIPAddress        = contract.GuestIPAddress
+	GuestInterfacesResult = contract.GuestInterfacesResult
+	GuestExecRequest      = contract.GuestExecRequest
+	GuestExecResult       = contract.GuestExecResult
+	GuestFileWriteRequest = contract.GuestFileWriteRequest
+	GuestFileWriteResult  = contract.GuestFileWriteResult
+
+	VirtualMachineFleetConfig        = contract.VirtualMachineFleetConfig
+	VirtualMachineGroup              = contract.VirtualMachineGroup
+	FleetSharedConfig                = contract.FleetSharedConfig
+	FleetHypervisorConfig            = contract.FleetHypervisorConfig
+	SchedulingConfig                 = contract.SchedulingConfig
+	GeneralSharedConfig              = contract.GeneralSharedConfig
+	SSHSharedConfig                  = contract.SSHSharedConfig
+	NetworkSharedConfig              = contract.NetworkSharedConfig
+	CreateVirtualMachineFleetRequest = contract.CreateVirtualMachineFleetRequest
+	CreateVirtualMachineFleetResult  = contract.CreateVirtualMachineFleetResult
+	DeleteVirtualMachineFleetRequest = contract.DeleteVirtualMachineFleetRequest
+	DeleteVirtualMachineFleetResult  = contract.DeleteVirtualMachineFleetResult
+	FleetInventory                   = contract.FleetInventory
+	InventoryHost                    = contract.InventoryHost
+
+	DomainSelector         = contract.DomainSelector
+	DomainSummary          = contract.DomainSummary
+	HarmoniaDomainMetadata = contract.HarmoniaDomainMetadata
+	ListDomainsRequest     = contract.ListDomainsRequest
+	ListDomainsResult      = contract.ListDomainsResult
+
+	VirtualNetworkConfig        = contract.VirtualNetworkConfig
+	CreateVirtualNetworkRequest = contract.CreateVirtualNetworkRequest
+	CreateVirtualNetworkResult  = contract.CreateVirtualNetworkResult
+	DeleteVirtualNetworkRequest = contract.DeleteVirtualNetworkRequest
+	DeleteVirtualNetworkResult  = contract.DeleteVirtualNetworkResult
+	ListVirtualNetworksRequest  = contract.ListVirtualNetworksRequest
+	ListVirtualNetworksResult   = contract.ListVirtualNetworksResult
+	VirtualNetworkSummary       = contract.VirtualNetworkSummary
+
+	HypervisorCapacity  = contract.HypervisorCapacity
+	StoragePoolCapacity = contract.StoragePoolCapacity
+
+	VirtualMachineRecord            = contract.VirtualMachineRecord
+	VirtualMachineRecordFilter      = contract.VirtualMachineRecordFilter
+	ListVirtualMachineRecordsResult = contract.ListVirtualMachineRecordsResult
+
+	DomainStats               = contract.DomainStats
+	DiskStats                 = contract.DiskStats
+	InterfaceStats            = contract.InterfaceStats
+	FleetStats                = contract.FleetStats
+	VirtualMachineStatsResult = contract.VirtualMachineStatsResult
+)
@@ -0,0 +1,165 @@
+package output
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/goccy/go-yaml"
+	"github.com/urfave/cli/v2"
+)
+
+type Format string
+
+const (
+	FORMAT_JSON  = Format("json")
+	FORMAT_YAML  = Format("yaml")
+	FORMAT_TABLE = Format("table")
+	// table with the columns marked as wide
+	FORMAT_WIDE = Format("wide")
+)
+
+const (
+	FLAG_NAME      = "output"
+	DEFAULT_FORMAT = FORMAT_TABLE
+)
+
+var FORMATS = []Format{FORMAT_JSON, FORMAT_YAML, FORMAT_TABLE, FORMAT_WIDE}
+
+func ParseFormat(rawFormat string) (Format, error) {
+	for _, format := range FORMATS {
+		if Format(strings.ToLower(rawFormat)) == format {
+			return format, nil
+		}
+	}
+	return "", fmt.Errorf("unknown output format '%v', expected one of %v", rawFormat, FORMATS)
+}
+
+func (format Format) IsTable() bool {
+	return format == FORMAT_TABLE || format == FORMAT_WIDE
+}
+
+// added to the app and to every command so it can be given at any position
+func Flag() cli.Flag {
+	return &cli.StringFlag{
+		Name:    FLAG_NAME,
+		Aliases: []string{"o"},
+		Value:   string(DEFAULT_FORMAT),
+		Usage:   "Output format: json, yaml, table or wide",
+	}
+}
+
+// the innermost --output given on the command line wins
+func FromContext(ctx *cli.Context) (Format, error) {
+	for _, lineageCtx := range ctx.Lineage() {
+		if lineageCtx.IsSet(FLAG_NAME) {
+			return ParseFormat(lineageCtx.String(FLAG_NAME))
+		}
+	}
+	return DEFAULT_FORMAT, nil
+}
+
+// 1.5 GiB rather than 1610612736
+func FormatBytes(bytes float64) string {
+	units := []string{"B", "KiB", "MiB", "GiB", "TiB"}
+	i := 0
+	for bytes >= 1024 && i < len(units)-1 {
+		bytes /= 1024
+		i++
+	}
+	return fmt.Sprintf("%.1f %v", bytes, units[i])
+}
+
+type Column struct {
+	Name string
+	// only shown in wide mode
+	IsWide bool
+}
+
+type Table struct {
+	Columns []Column
+	Rows    [][]string
+	// for rows streamed below an already printed table
+	IsHeaderless bool
+}
+
+func NewTable(columns ...Column) *Table {
+	return &Table{Columns: columns, Rows: [][]string{}}
+}
+
+func (table *Table) AddRow(cells ...any) {
+	row := make([]string, len(cells))
+	for i, cell := range cells {
+		row[i] = fmt.Sprintf("%v", cell)
+		if row[i] == "" {
+			row[i] = "-"
+		}
+	}
+	table.Rows = append(table.Rows, row)
+}
+
+func (table *Table) Write(writer io.Writer, isWide bool) error {
+	tabWriter := tabwriter.NewWriter(writer, 0, 4, 2, ' ', 0)
+
+	visible := []int{}
+	for i, column := range table.Columns {
+		if !column.IsWide || isWide {
+			visible = append(visible, i)
+		}
+	}
+
+	cells := make([]string, len(visible))
+	for i, columnIndex := range visible {
+		cells[i] = table.Columns[columnIndex].Name
+	}
+	if !table.IsHeaderless {
+		fmt.Fprintln(tabWriter, strings.Join(cells, "\t"))
+	}
+
+	for _, row := range table.Rows {
+		for i, columnIndex := range visible {
+			cells[i] = ""
+			if columnIndex < len(row) {
+				cells[i] = row[columnIndex]
+			}
+		}
+		fmt.Fprintln(tabWriter, strings.Join(cells, "\t"))
+	}
+	return tabWriter.Flush()
+}
+
+// data is what json and yaml show, table is what table and wide show,
+// data without a table is shown as yaml in table modes
+func Write(writer io.Writer, format Format, data any, table *Table) error {
+	if format.IsTable() && table != nil {
+		return table.Write(writer, format == FORMAT_WIDE)
+	}
+
+	var (
+		serialized []byte
+		err        error
+	)
+	if format == FORMAT_JSON {
+		serialized, err = json.MarshalIndent(data, "", "  ")
+		serialized = append(serialized, '\n')
+	} else {
+		serialized, err = yaml.Marshal(data)
+	}
+	if err != nil {
+		return fmt.Errorf("could not serialize output: %v", err)
+	}
+	_, err = writer.Write(serialized)
+	return err
+}
+
+// writes to stdout in the format chosen with --output
+func Render(ctx *cli.Context, data any, table *Table) error {
+	format, err := FromContext(ctx)
+	if err != nil {
+		return err
+	}
+	return Write(os.Stdout, format, data, table)
+}
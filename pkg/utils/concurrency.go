@@ -0,0 +1,25 @@
+package utils
+
+import "sync"
+
+// calls fn for 0..count-1 with at most limit calls in flight, limit < 1 means sequential
+func RunConcurrently(limit int, count int, fn func(i int)) {
+	if limit < 1 {
+		limit = 1
+	}
+
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, limit)
+	for i := 0; i < count; i++ {
+		slots <- struct{}{}
+		wg.Add(1)
+		go func(i int) {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+			fn(i)
+		}(i)
+	}
+	wg.Wait()
+}
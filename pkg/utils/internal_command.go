@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"github.com/nnurry/harmonia/pkg/output"
 	"github.com/nnurry/harmonia/pkg/types"
 	"github.com/urfave/cli/v2"
 )
@@ -10,7 +11,7 @@ func ConvertInternalCommandToCliCommand(command types.InternalCommand) *cli.Comm
 		Name:        command.Signature(),
 		Usage:       command.Description(),
 		Action:      command.Handler(),
-		Flags:       command.Flags(),
+		Flags:       append(command.Flags(), output.Flag()),
 		Subcommands: command.Subcommands(),
 	}
 }